@@ -6,8 +6,11 @@ require (
 	github.com/otiai10/gosseract/v2 v2.4.1
 	github.com/signintech/gopdf v0.29.0
 	gocv.io/x/gocv v0.39.0
+	golang.org/x/image v0.23.0
 	golang.org/x/net v0.33.0
+	golang.org/x/text v0.21.0
 	gopkg.in/gographics/imagick.v3 v3.7.2
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
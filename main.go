@@ -1,13 +1,25 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"go-ocr/src"
 	doc "go-ocr/src/documents"
+	"go-ocr/src/evaluation"
 	img "go-ocr/src/images"
+	"go-ocr/src/pdf"
 	vid "go-ocr/src/videos"
+	"image"
+	"image/png"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 )
 
 func main() {
@@ -31,8 +43,68 @@ func main() {
 	switch algorithm {
 	case "PLAIN_TEXT_EXTRACTION":
 		{
-			extractedText := doc.NewPlainTextExtractor().
-				Execute(inputFile, language)
+			flags := flag.NewFlagSet(algorithm, flag.ExitOnError)
+			flatten := flags.Bool("flatten", false, "Cut the page out of a photo and correct its perspective first")
+			dewarp := flags.Bool("dewarp", false, "Straighten the text lines of curled pages, with -flatten")
+			removeStamps := flags.Bool("remove-stamps", false, "Paint over colored stamps and seals before reading the text")
+			clean := flags.String("clean", "", "Cleaning steps to run first, e.g. 'shadows,background,watermark'")
+			removeLines := flags.Bool("remove-lines", false, "Take form lines, table borders and underlines off the page first")
+			fixPolarity := flags.Bool("fix-polarity", false, "Turn light text on dark or colored bars into dark text on white first")
+			quality := flags.String("quality", "", "Check the image quality first: 'warn' logs the issues, 'fail' also skips rejected images")
+			minDPI := flags.Float64("min-dpi", img.DefaultQualityThresholds().Fail.MinDPI, "Resolution below which -quality rejects an image")
+			upscale := flags.String("upscale", "", "Enlarge small text first: 'lanczos', 'espcn' or 'fsrcnn'")
+			upscaleModel := flags.String("upscale-model", "models/ESPCN_x4.pb", "Super-resolution model of -upscale espcn or fsrcnn")
+			modelScale := flags.Int("model-scale", 4, "Factor the super-resolution model enlarges by")
+			flags.Parse(os.Args[4:])
+
+			extractor := doc.NewPlainTextExtractor()
+			if *flatten {
+				extractor.WithPageFlattening(img.NewPageFlattener().WithDewarp(*dewarp))
+			}
+			if *removeStamps {
+				extractor.WithStampRemoval(img.NewStampDetector())
+			}
+			if *clean != "" {
+				var steps []img.CleanStep
+				for _, step := range strings.Split(*clean, ",") {
+					steps = append(steps, img.CleanStep(strings.TrimSpace(step)))
+				}
+				extractor.WithBackgroundCleaning(img.NewBackgroundCleaner(steps...))
+			}
+			if *fixPolarity {
+				extractor.WithPolarityCorrection(img.NewPolarityNormalizer())
+			}
+			if *removeLines {
+				extractor.WithLineRemoval(img.NewLineRemover())
+			}
+			if *quality != "" {
+				if *quality != "warn" && *quality != "fail" {
+					log.Fatalf("Unknown quality mode %q, please use 'warn' or 'fail'.", *quality)
+				}
+				thresholds := img.DefaultQualityThresholds()
+				thresholds.Fail.MinDPI = *minDPI
+				extractor.WithQualityGate(img.NewQualityAnalyzer().WithThresholds(thresholds), *quality == "fail")
+			}
+			if *upscale != "" {
+				extractor.WithUpscaling(newUpscaler(*upscale, *upscaleModel, *modelScale))
+			}
+			extractedText, err := extractor.Extract(inputFile, language)
+			for _, report := range extractor.QualityReports() {
+				for _, issue := range report.Issues {
+					log.Printf("Page %d: %s (%.4g, limit %.4g)", report.Page+1, issue.Reason, issue.Value, issue.Limit)
+				}
+			}
+			if errors.Is(err, doc.ErrPageRejected) {
+				var reasons []string
+				for _, report := range extractor.QualityReports() {
+					reasons = append(reasons, report.Reasons()...)
+				}
+				fmt.Printf("File: %s \nResult: Image rejected: %s\n", inputFile, strings.Join(reasons, ", "))
+				break
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
 			if len(extractedText) == 0 {
 				fmt.Printf("File: %s \nResult: No text extracted.\n", inputFile)
 				break
@@ -43,43 +115,719 @@ func main() {
 
 	case "HOCR_TEXT_EXTRACTION":
 		{
-			outfilePath, err := doc.NewHOCRTextExtractor("fonts/").
-				Execute(inputFile, language, "output/generated-hocr/")
+			flags := flag.NewFlagSet(algorithm, flag.ExitOnError)
+			pdfa := flags.String("pdfa", "", "Write archival PDF/A output: '2b' or '3b'")
+			author := flags.String("author", "", "Author recorded in the PDF/A metadata")
+			scan := flags.String("scan", "", "Embed the scan under the text: 'auto', 'jpeg', 'bitonal' or 'mrc'")
+			scanDPI := flags.Float64("scan-dpi", 300, "Resolution of the input scan")
+			maxDPI := flags.Float64("max-dpi", 0, "Downsample embedded scans to at most this resolution")
+			jpegQuality := flags.Int("jpeg-quality", 75, "JPEG quality of embedded scans, 1-100")
+			upscale := flags.String("upscale", "", "Enlarge small text first: 'lanczos', 'espcn' or 'fsrcnn'")
+			upscaleModel := flags.String("upscale-model", "models/ESPCN_x4.pb", "Super-resolution model of -upscale espcn or fsrcnn")
+			modelScale := flags.Int("model-scale", 4, "Factor the super-resolution model enlarges by")
+			flags.Parse(os.Args[4:])
+
+			extractor := doc.NewHOCRTextExtractor("fonts/")
+			switch *pdfa {
+			case "":
+			case "2b":
+				extractor.WithPDFA(pdf.PDFA2B, *author)
+			case "3b":
+				extractor.WithPDFA(pdf.PDFA3B, *author)
+			default:
+				log.Fatal("Allowed PDF/A levels are: '2b', '3b'")
+			}
+			if *scan != "" {
+				extractor.WithScan(pdf.ScanOptions{
+					Profile:     pdf.CompressionProfile(*scan),
+					DPI:         *scanDPI,
+					MaxDPI:      *maxDPI,
+					JPEGQuality: *jpegQuality,
+				})
+			}
+			if *upscale != "" {
+				extractor.WithUpscaling(newUpscaler(*upscale, *upscaleModel, *modelScale))
+			}
+
+			outfilePath, err := extractor.Execute(inputFile, language, "output/generated-hocr/")
 			if err != nil {
 				fmt.Printf("File: %s \nResult: No text extracted.%s\n", inputFile, err)
 				break
 			}
 
 			fmt.Printf("File: %s \nResult: \n%s\n", inputFile, *outfilePath)
+			for _, stats := range extractor.CompressionReport() {
+				fmt.Printf("Page %d: %s, %d -> %d bytes, ratio %.1f:1\n", stats.Page+1, stats.Profile,
+					stats.RawBytes, stats.StoredBytes, stats.Ratio())
+			}
+			break
+		}
+
+	case "PDF_TEXT_EXTRACTION":
+		{
+			flags := flag.NewFlagSet(algorithm, flag.ExitOnError)
+			forceOCR := flags.Bool("force-ocr", false, "OCR every page, ignoring any existing text")
+			redoOCR := flags.Bool("redo-ocr", false, "Strip text left by an earlier OCR run and OCR every page again")
+			barcodes := flags.Bool("barcodes", false, "Also decode barcodes and QR codes")
+			flags.Parse(os.Args[4:])
+
+			if *forceOCR && *redoOCR {
+				log.Fatal("Only one of -force-ocr and -redo-ocr can be used.")
+			}
+
+			mode := doc.OCRModeAuto
+			if *forceOCR {
+				mode = doc.OCRModeForce
+			} else if *redoOCR {
+				mode = doc.OCRModeRedo
+			}
+
+			extractor := doc.NewPDFTextExtractor(mode)
+			if *barcodes {
+				detector := img.NewBarcodeDetector()
+				defer detector.Close()
+				extractor.WithBarcodes(detector)
+			}
+
+			pages, err := extractor.Execute(inputFile, language)
+			if err != nil {
+				fmt.Printf("File: %s \nResult: No text extracted.%s\n", inputFile, err)
+				break
+			}
+
+			fmt.Printf("File: %s\n", inputFile)
+			for _, page := range pages {
+				fmt.Printf("Page %d (%s): \n%s\n", page.Index+1, page.Source, page.Text)
+				for _, barcode := range page.Barcodes {
+					fmt.Printf("Barcode (%s): %s\n", barcode.Symbology, barcode.Payload)
+				}
+			}
+			break
+		}
+
+	case "REDACTION":
+		{
+			flags := flag.NewFlagSet(algorithm, flag.ExitOnError)
+			kinds := flags.String("kinds", "", "Comma separated PII kinds to redact, all when empty: "+
+				"'email', 'phone', 'national-id', 'card-number', 'tax-id', 'date-of-birth'")
+			var patterns []*regexp.Regexp
+			flags.Func("pattern", "Regular expression to redact, can be repeated", func(value string) error {
+				re, err := regexp.Compile(value)
+				if err != nil {
+					return err
+				}
+				patterns = append(patterns, re)
+				return nil
+			})
+			wordsFile := flags.String("words", "", "File with words or phrases to redact, one per line")
+			flags.Parse(os.Args[4:])
+
+			rules := doc.RedactionRules{Patterns: patterns}
+			for _, kind := range strings.Split(*kinds, ",") {
+				if kind = strings.TrimSpace(kind); kind == "" {
+					continue
+				}
+				if !slices.Contains(doc.AllPIIKinds, doc.PIIKind(kind)) {
+					log.Fatalf("Unknown PII kind: %s", kind)
+				}
+				rules.Kinds = append(rules.Kinds, doc.PIIKind(kind))
+			}
+			if *wordsFile != "" {
+				data, err := os.ReadFile(*wordsFile)
+				if err != nil {
+					log.Fatalf("Error reading word list: %v", err)
+				}
+				rules.Words = strings.Split(string(data), "\n")
+			}
+
+			outDir := "output/redacted/"
+			if err := os.MkdirAll(outDir, 0755); err != nil {
+				log.Fatalf("Error creating output folder: %v", err)
+			}
+
+			result, err := doc.NewRedactor("fonts/", rules).Execute(inputFile, language, outDir)
+			if err != nil {
+				fmt.Printf("File: %s \nResult: Redaction failed.%s\n", inputFile, err)
+				break
+			}
+
+			fmt.Printf("File: %s \nResult: %d redactions\n", inputFile, len(result.Redactions))
+			for _, r := range result.Redactions {
+				fmt.Printf("Page %d: %s (%s) at %v\n", r.Page+1, r.Kind, r.Rule, r.Box)
+			}
+			fmt.Printf("PDF: %s\nText: %s\nJSON: %s\nAudit log: %s\n", result.PDF, result.Text, result.JSON, result.AuditLog)
+			break
+		}
+
+	case "MRZ_READER":
+		{
+			mrz, err := doc.NewMRZReader().Execute(inputFile, language)
+			if err != nil {
+				fmt.Printf("File: %s \nResult: No machine-readable zone found.%s\n", inputFile, err)
+				break
+			}
+
+			fmt.Printf("File: %s \nResult: %s, valid: %t\n", inputFile, mrz.Format, mrz.Valid())
+			fmt.Printf("Document: %s %s issued by %s\n", mrz.DocumentCode, mrz.DocumentNumber, mrz.IssuingState)
+			fmt.Printf("Name: %s, %s\nNationality: %s\nSex: %s\n", mrz.Surname, mrz.GivenNames, mrz.Nationality, mrz.Sex)
+			fmt.Printf("Born: %s\nExpires: %s\n", mrz.BirthDate.Format("2006-01-02"), mrz.ExpiryDate.Format("2006-01-02"))
+			for _, check := range mrz.Checks {
+				fmt.Printf("Check %s: %t\n", check.Field, check.Valid)
+			}
+			if len(mrz.Corrected) > 0 {
+				fmt.Printf("Corrected: %s\n", strings.Join(mrz.Corrected, ", "))
+			}
 			break
 		}
 
 	case "IMG_OBJECT_DETECTION":
 		{
-			detectedObjects := img.NewImageObjectDetector(
+			flags := flag.NewFlagSet(algorithm, flag.ExitOnError)
+			summary := flags.Bool("summary", false, "Print only the most confident object of each class")
+			options := detectorFlags(flags, img.DefaultDetectorOptions())
+			flags.Parse(os.Args[4:])
+
+			instances, err := img.NewImageObjectDetector(
 				"models/yolov3.weights",
 				"models/yolov3.cfg",
-				"models/coco.names").
+				"models/coco.names",
+				options()).
 				Execute(inputFile)
 
-			if len(detectedObjects) == 0 {
+			if err != nil {
+				fmt.Printf("File: %s \nResult: No objects detected.%s\n", inputFile, err)
+				break
+			}
+			if len(instances) == 0 {
 				fmt.Printf("File: %s \nResult: No objects detected.\n", inputFile)
 				break
 			}
 
 			fmt.Printf("File: %s\n", inputFile)
-			for _, detectedObject := range detectedObjects {
-				fmt.Printf("Result: %s with confidence: %2f.\n", detectedObject.ClassName, detectedObject.Confidence)
+			if *summary {
+				for _, detectedObject := range img.SummarizeObjects(instances) {
+					fmt.Printf("Result: %s with confidence: %2f.\n", detectedObject.ClassName, detectedObject.Confidence)
+				}
+				break
+			}
+			for _, instance := range instances {
+				fmt.Printf("Result: %s (class %d) with confidence: %2f at %v, normalized %.4f.\n", instance.ClassName,
+					instance.ClassID, instance.Confidence, instance.Box, instance.NormalizedBox)
+			}
+
+			break
+		}
+	case "OBJECT_DETECTION_EVALUATION":
+		{
+			flags := flag.NewFlagSet(algorithm, flag.ExitOnError)
+			imageFolder := flags.String("images", "", "Folder of the labeled images, the folder of the annotations by default")
+			minScore := flags.Float64("min-score", 0.5, "Confidence a detection needs to count in the confusion matrix")
+			outDir := flags.String("out", "", "Folder to also write detection-report.json and pr-curves.csv to")
+			// The whole precision-recall curve is scored, as COCO does, so
+			// nearly every box is kept
+			defaults := img.DefaultDetectorOptions()
+			defaults.ConfidenceThreshold = 0.001
+			options := detectorFlags(flags, defaults)
+			flags.Parse(os.Args[4:])
+
+			dataset, err := evaluation.LoadCocoDataset(inputFile)
+			if err != nil {
+				log.Fatalf("Error loading the annotations: %v", err)
+			}
+			if *imageFolder == "" {
+				*imageFolder = filepath.Dir(inputFile)
+			}
+
+			iod := img.NewImageObjectDetector(
+				"models/yolov3.weights",
+				"models/yolov3.cfg",
+				"models/coco.names",
+				options())
+			defer iod.Close()
+
+			// Classes the dataset doesn't label are left out
+			var detections []evaluation.Detection
+			for _, labeled := range dataset.Images {
+				instances, err := iod.Execute(filepath.Join(*imageFolder, labeled.FileName))
+				if err != nil {
+					log.Fatalf("Error detecting the objects: %v", err)
+				}
+				for _, instance := range instances {
+					category, ok := dataset.Category(instance.ClassName)
+					if !ok {
+						continue
+					}
+					box := instance.Box
+					detections = append(detections, evaluation.Detection{
+						ImageID:    labeled.ID,
+						CategoryID: category.ID,
+						BBox:       [4]float64{float64(box.Min.X), float64(box.Min.Y), float64(box.Dx()), float64(box.Dy())},
+						Score:      float64(instance.Confidence),
+					})
+				}
+			}
+			report := evaluation.EvaluateDetections(dataset, detections, *minScore)
+
+			if *outDir != "" {
+				if err := os.MkdirAll(*outDir, os.ModePerm); err != nil {
+					log.Fatalf("Error creating the output folder: %v", err)
+				}
+				writers := map[string]func(io.Writer) error{
+					"detection-report.json": report.WriteJSON,
+					"pr-curves.csv":         report.WriteCurvesCSV,
+				}
+				for name, write := range writers {
+					file, err := os.Create(filepath.Join(*outDir, name))
+					if err != nil {
+						log.Fatalf("Error writing the report: %v", err)
+					}
+					err = write(file)
+					file.Close()
+					if err != nil {
+						log.Fatalf("Error writing the report: %v", err)
+					}
+				}
+			}
+			fmt.Printf("File: %s \nResult: %d images\n%s", inputFile, report.Images, report)
+			break
+		}
+	case "BARCODE_DETECTION":
+		{
+			detector := img.NewBarcodeDetector()
+			defer detector.Close()
+
+			barcodes, err := detector.Execute(inputFile)
+			if err != nil {
+				fmt.Printf("File: %s \nResult: No barcodes detected.%s\n", inputFile, err)
+				break
+			}
+			if len(barcodes) == 0 {
+				fmt.Printf("File: %s \nResult: No barcodes detected.\n", inputFile)
+				break
+			}
+
+			fmt.Printf("File: %s\n", inputFile)
+			for _, barcode := range barcodes {
+				fmt.Printf("Page %d: %s %q at %v\n", barcode.Page+1, barcode.Symbology, barcode.Payload, barcode.Polygon)
+			}
+			break
+		}
+	case "SIGNATURE_DETECTION":
+		{
+			flags := flag.NewFlagSet(algorithm, flag.ExitOnError)
+			ocrMask := flags.Bool("ocr-mask", false, "Ignore the words OCR reads, using the given language")
+			minScore := flags.Float64("min-score", 0.5, "Drop candidates scoring below this, from 0 to 1")
+			crops := flags.String("crops", "", "Write the image of every candidate to this folder")
+			flags.Parse(os.Args[4:])
+
+			detector := img.NewSignatureDetector().
+				WithMinScore(*minScore).
+				WithCrops(*crops != "")
+			if *ocrMask {
+				detector.WithOCRMask(language)
+			}
+
+			candidates, err := detector.Execute(inputFile)
+			if err != nil {
+				fmt.Printf("File: %s \nResult: No signatures detected.%s\n", inputFile, err)
+				break
+			}
+			if len(candidates) == 0 {
+				fmt.Printf("File: %s \nResult: No signatures detected.\n", inputFile)
+				break
+			}
+
+			if *crops != "" {
+				if err := os.MkdirAll(*crops, os.ModePerm); err != nil {
+					log.Fatalf("Error creating the crops folder: %v", err)
+				}
+			}
+			fmt.Printf("File: %s\n", inputFile)
+			for i, candidate := range candidates {
+				fmt.Printf("Page %d: signature at %v with score %.2f\n", candidate.Page+1, candidate.Box, candidate.Score)
+				if candidate.Crop == nil {
+					continue
+				}
+				cropFile := filepath.Join(*crops, fmt.Sprintf("signature-%d.png", i+1))
+				out, err := os.Create(cropFile)
+				if err != nil {
+					log.Fatalf("Error creating %s: %v", cropFile, err)
+				}
+				if err := png.Encode(out, candidate.Crop); err != nil {
+					log.Fatalf("Error writing %s: %v", cropFile, err)
+				}
+				out.Close()
+				fmt.Printf("Crop: %s\n", cropFile)
+			}
+			break
+		}
+	case "SIGNATURE_COMPARISON":
+		{
+			flags := flag.NewFlagSet(algorithm, flag.ExitOnError)
+			candidate := flags.String("candidate", "", "Signature image to check against the input file")
+			threshold := flags.Float64("threshold", 0.55, "Score needed to accept the signature, from 0 to 1")
+			visualization := flags.String("visualization", "", "Write the keypoint matches to this PNG file")
+			flags.Parse(os.Args[4:])
+			if *candidate == "" {
+				log.Fatal("Please provide the signature to compare with -candidate.")
+			}
+
+			comparison, err := img.NewSignatureComparator().
+				WithThreshold(*threshold).
+				WithVisualization(*visualization != "").
+				Execute(inputFile, *candidate)
+			if err != nil {
+				fmt.Printf("File: %s \nResult: Signatures not compared.%s\n", inputFile, err)
+				break
+			}
+
+			fmt.Printf("File: %s \nResult: score %.2f, accepted: %t\n", *candidate, comparison.Score, comparison.Accepted)
+			fmt.Printf("Keypoints: %.2f (%d matches)\nShape: %.2f\nProfile: %.2f\n",
+				comparison.Keypoints, comparison.Matches, comparison.Shape, comparison.Profile)
+			if comparison.Visualization != nil {
+				out, err := os.Create(*visualization)
+				if err != nil {
+					log.Fatalf("Error creating %s: %v", *visualization, err)
+				}
+				if err := png.Encode(out, comparison.Visualization); err != nil {
+					log.Fatalf("Error writing %s: %v", *visualization, err)
+				}
+				out.Close()
+				fmt.Printf("Matches: %s\n", *visualization)
+			}
+			break
+		}
+	case "PAGE_FLATTENING":
+		{
+			flags := flag.NewFlagSet(algorithm, flag.ExitOnError)
+			dewarp := flags.Bool("dewarp", false, "Straighten the text lines of curled pages")
+			corners := flags.String("corners", "", "Use these corners instead of detecting them: 'x1,y1,x2,y2,x3,y3,x4,y4', clockwise from the top-left")
+			flags.Parse(os.Args[4:])
+
+			flattener := img.NewPageFlattener().WithDewarp(*dewarp)
+			if *corners != "" {
+				var c [4]image.Point
+				if _, err := fmt.Sscanf(*corners, "%d,%d,%d,%d,%d,%d,%d,%d",
+					&c[0].X, &c[0].Y, &c[1].X, &c[1].Y, &c[2].X, &c[2].Y, &c[3].X, &c[3].Y); err != nil {
+					log.Fatalf("Error reading the corners: %v", err)
+				}
+				flattener.WithCorners(c)
+			}
+
+			page, err := flattener.Execute(inputFile, "output/flattened/")
+			if err != nil {
+				fmt.Printf("File: %s \nResult: Page not flattened.%s\n", inputFile, err)
+				break
+			}
+
+			fmt.Printf("File: %s \nResult: \n%s\n", inputFile, page.File)
+			fmt.Printf("Corners (%s): %v\nSize: %dx%d\n", page.Boundary.Method, page.Boundary.Corners, page.Size.X, page.Size.Y)
+			break
+		}
+	case "CHECKBOX_DETECTION":
+		{
+			flags := flag.NewFlagSet(algorithm, flag.ExitOnError)
+			labels := flags.Bool("labels", false, "OCR the text next to every mark in the given language")
+			omr := flags.Bool("omr", false, "Read the marks as the answer grid of an answer sheet")
+			flags.Parse(os.Args[4:])
+
+			detector := img.NewCheckboxDetector()
+			if *labels {
+				detector.WithLabels(language)
+			}
+
+			if *omr {
+				sheets, err := detector.ExecuteOMR(inputFile)
+				if err != nil {
+					fmt.Printf("File: %s \nResult: No answers read.%s\n", inputFile, err)
+					break
+				}
+				fmt.Printf("File: %s\n", inputFile)
+				for _, sheet := range sheets {
+					fmt.Printf("Page %d: %d questions, %d choices\n", sheet.Page+1, len(sheet.Questions), sheet.Choices)
+					for _, question := range sheet.Questions {
+						answer := question.Answer()
+						if answer == "" {
+							answer = "-"
+						}
+						fmt.Printf("%d. %s\n", question.Number, answer)
+					}
+				}
+				break
+			}
+
+			marks, err := detector.Execute(inputFile)
+			if err != nil {
+				fmt.Printf("File: %s \nResult: No marks detected.%s\n", inputFile, err)
+				break
+			}
+			if len(marks) == 0 {
+				fmt.Printf("File: %s \nResult: No marks detected.\n", inputFile)
+				break
+			}
+
+			fmt.Printf("File: %s\n", inputFile)
+			for _, mark := range marks {
+				fmt.Printf("Page %d: %s %s at %v (confidence %.2f) %s\n",
+					mark.Page+1, mark.State, mark.Shape, mark.Box, mark.Confidence, mark.Label)
+			}
+			break
+		}
+	case "FORM_EXTRACTION":
+		{
+			flags := flag.NewFlagSet(algorithm, flag.ExitOnError)
+			templateFile := flags.String("template", "", "Form template, a .json, .yaml or .yml file")
+			minQuality := flags.Float64("min-quality", 0.4, "Alignment quality needed to read a form, from 0 to 1")
+			logoFolder := flags.String("logos", "", "Folder of vendor logos to identify the vendor of each form by")
+			flags.Parse(os.Args[4:])
+			if *templateFile == "" {
+				log.Fatal("Please provide the form template with -template.")
+			}
+
+			template, err := doc.LoadFormTemplate(*templateFile)
+			if err != nil {
+				log.Fatalf("Error loading the template: %v", err)
+			}
+			extractor := doc.NewFormExtractor(template).
+				WithRegistrar(img.NewImageRegistrar().WithMinQuality(*minQuality))
+			if *logoFolder != "" {
+				library, err := img.LoadLogoLibrary(*logoFolder)
+				if err != nil {
+					log.Fatalf("Error loading the logos: %v", err)
+				}
+				defer library.Close()
+				extractor.WithVendorLogos(img.NewLogoMatcher(library))
+			}
+
+			var results []doc.FormResult
+			if info, err := os.Stat(inputFile); err == nil && info.IsDir() {
+				results, err = extractor.ExecuteFolder(inputFile)
+				if err != nil {
+					fmt.Printf("File: %s \nResult: No forms read.%s\n", inputFile, err)
+					break
+				}
+			} else {
+				result, err := extractor.Execute(inputFile)
+				if result == nil {
+					fmt.Printf("File: %s \nResult: No forms read.%s\n", inputFile, err)
+					break
+				}
+				if err != nil {
+					result.Error = err.Error()
+				}
+				results = append(results, *result)
+			}
+
+			for _, result := range results {
+				fmt.Printf("File: %s\n", result.File)
+				if result.Registration != nil {
+					fmt.Printf("Alignment: quality %.2f, %d of %d matches, error %.2f px\n", result.Registration.Quality,
+						result.Registration.Inliers, result.Registration.Matches, result.Registration.ReprojectionError)
+				}
+				if result.Vendor != nil {
+					fmt.Printf("Vendor: %s (%.2f)\n", result.Vendor.Name, result.Vendor.Score)
+				}
+				if result.Error != "" {
+					fmt.Printf("Result: Form not read.%s\n", result.Error)
+					continue
+				}
+				for _, field := range result.Fields {
+					fmt.Printf("%s: %s (%.2f)\n", field.Name, field.Value, field.Confidence)
+				}
+			}
+			break
+		}
+	case "STAMP_DETECTION":
+		{
+			flags := flag.NewFlagSet(algorithm, flag.ExitOnError)
+			remove := flags.Bool("remove", false, "Write the first page without its stamps to output/stamps/")
+			minSize := flags.Int("min-size", 30, "Smallest stamp side, in pixels")
+			flags.Parse(os.Args[4:])
+
+			detector := img.NewStampDetector().WithMinSize(*minSize)
+			if *remove {
+				outFile, stamps, err := detector.RemoveStamps(inputFile, "output/stamps/")
+				if err != nil {
+					fmt.Printf("File: %s \nResult: Stamps not removed.%s\n", inputFile, err)
+					break
+				}
+				fmt.Printf("File: %s \nResult: \n%s\n%d stamps removed\n", inputFile, outFile, len(stamps))
+				break
+			}
+
+			stamps, err := detector.Execute(inputFile)
+			if err != nil {
+				fmt.Printf("File: %s \nResult: No stamps detected.%s\n", inputFile, err)
+				break
+			}
+			if len(stamps) == 0 {
+				fmt.Printf("File: %s \nResult: No stamps detected.\n", inputFile)
+				break
+			}
+			fmt.Printf("File: %s\n", inputFile)
+			for _, stamp := range stamps {
+				fmt.Printf("Page %d: %s %s stamp at %v, ink #%02x%02x%02x\n",
+					stamp.Page+1, stamp.Color, stamp.Shape, stamp.Box, stamp.RGB.R, stamp.RGB.G, stamp.RGB.B)
+			}
+			break
+		}
+	case "BACKGROUND_CLEANING":
+		{
+			flags := flag.NewFlagSet(algorithm, flag.ExitOnError)
+			steps := flags.String("steps", "shadows,background,watermark", "Cleaning steps, in order: 'shadows', 'background', 'watermark'")
+			method := flags.String("method", "morphology", "How the paper is estimated: 'morphology' or 'median'")
+			kernel := flags.Int("kernel", 0, "Size of the filter estimating the paper, 0 for a 30th of the page")
+			watermarkLevel := flags.Int("watermark-level", 200, "Gray level from which light pixels are whitened as watermarks")
+			debug := flags.Bool("debug", false, "Write the page before and after every step to output/background/debug/")
+			flags.Parse(os.Args[4:])
+
+			if *method != string(img.BackgroundMorphology) && *method != string(img.BackgroundMedian) {
+				log.Fatal("Allowed background methods are: 'morphology', 'median'")
+			}
+			var cleanSteps []img.CleanStep
+			for _, step := range strings.Split(*steps, ",") {
+				cleanSteps = append(cleanSteps, img.CleanStep(strings.TrimSpace(step)))
+			}
+			cleaner := img.NewBackgroundCleaner(cleanSteps...).
+				WithMethod(img.BackgroundMethod(*method)).
+				WithKernelSize(*kernel).
+				WithWatermarkLevel(byte(min(255, max(0, *watermarkLevel))))
+			if *debug {
+				cleaner.WithDebug("output/background/debug/")
+			}
+
+			outFile, err := cleaner.Execute(inputFile, "output/background/")
+			if err != nil {
+				fmt.Printf("File: %s \nResult: Background not cleaned.%s\n", inputFile, err)
+				break
+			}
+			fmt.Printf("File: %s \nResult: \n%s\n", inputFile, outFile)
+			break
+		}
+	case "POLARITY_CORRECTION":
+		{
+			flags := flag.NewFlagSet(algorithm, flag.ExitOnError)
+			tileSize := flags.Int("tile", 40, "Side of the tiles the polarity is found in, about a header line tall")
+			minContrast := flags.Float64("min-contrast", 40, "Level difference between text and background needed to correct a region")
+			flags.Parse(os.Args[4:])
+
+			outFile, regions, err := img.NewPolarityNormalizer().
+				WithTileSize(*tileSize).
+				WithMinContrast(*minContrast).
+				Execute(inputFile, "output/polarity/")
+			if err != nil {
+				fmt.Printf("File: %s \nResult: Polarity not corrected.%s\n", inputFile, err)
+				break
+			}
+			fmt.Printf("File: %s \nResult: \n%s\n", inputFile, outFile)
+			for _, region := range regions {
+				fmt.Printf("%v: %s channel, inverted %t, contrast %.1f\n", region.Box, region.Channel, region.Inverted, region.Contrast)
+			}
+			break
+		}
+	case "LINE_REMOVAL":
+		{
+			flags := flag.NewFlagSet(algorithm, flag.ExitOnError)
+			minLength := flags.Int("min-length", 0, "Length, in pixels, from which a straight stroke is a line, 0 for a 20th of the page")
+			flags.Parse(os.Args[4:])
+
+			outFile, lines, err := img.NewLineRemover().WithMinLength(*minLength).Execute(inputFile, "output/lines/")
+			if err != nil {
+				fmt.Printf("File: %s \nResult: Lines not removed.%s\n", inputFile, err)
+				break
+			}
+			fmt.Printf("File: %s \nResult: \n%s\n", inputFile, outFile)
+			for _, line := range lines {
+				fmt.Printf("Page %d: %s line from %v to %v, %d pixels thick\n", line.Page+1, line.Orientation, line.Start, line.End, line.Thickness)
+			}
+			if cells := img.TableCells(lines); len(cells) > 0 {
+				fmt.Printf("Table of %d rows:\n", len(cells))
+				for _, row := range cells {
+					fmt.Println(row)
+				}
+			}
+			break
+		}
+	case "QUALITY_ASSESSMENT":
+		{
+			flags := flag.NewFlagSet(algorithm, flag.ExitOnError)
+			thresholds := img.DefaultQualityThresholds()
+			minDPI := flags.Float64("min-dpi", thresholds.Fail.MinDPI, "Resolution below which an image is rejected")
+			minBlur := flags.Float64("min-blur", thresholds.Fail.MinBlur, "Laplacian variance below which an image is rejected as blurry")
+			maxSkew := flags.Float64("max-skew", thresholds.Fail.MaxSkew, "Text angle, in degrees, above which an image is rejected")
+			flags.Parse(os.Args[4:])
+
+			thresholds.Fail.MinDPI, thresholds.Fail.MinBlur, thresholds.Fail.MaxSkew = *minDPI, *minBlur, *maxSkew
+			reports, err := img.NewQualityAnalyzer().WithThresholds(thresholds).Execute(inputFile)
+			if err != nil {
+				fmt.Printf("File: %s \nResult: Quality not assessed.%s\n", inputFile, err)
+				break
+			}
+			fmt.Printf("File: %s\n", inputFile)
+			for _, report := range reports {
+				m := report.Metrics
+				verdict := "passed"
+				if !report.Passed() {
+					verdict = "rejected"
+				}
+				fmt.Printf("Page %d: %s, score %.2f\n", report.Page+1, verdict, report.Score)
+				fmt.Printf("Blur %.0f, contrast %.2f, brightness %.0f, noise %.1f, %.0f DPI, skew %.2f°, text coverage %.1f%%\n",
+					m.Blur, m.Contrast, m.Brightness, m.Noise, m.DPI, m.Skew, 100*m.TextCoverage)
+				for _, issue := range report.Issues {
+					level := "warning"
+					if issue.Fail {
+						level = "failure"
+					}
+					fmt.Printf("  %s: %s (%.4g, limit %.4g)\n", level, issue.Reason, issue.Value, issue.Limit)
+				}
 			}
+			break
+		}
+	case "LOGO_DETECTION":
+		{
+			flags := flag.NewFlagSet(algorithm, flag.ExitOnError)
+			logoFolder := flags.String("logos", "samples/logos", "Folder of reference logos, each named after its file")
+			vendor := flags.Bool("vendor", false, "Print only the best logo of the first page, the vendor")
+			minScore := flags.Float64("min-score", 0.6, "Score needed to report a logo, from 0 to 1")
+			flags.Parse(os.Args[4:])
+
+			library, err := img.LoadLogoLibrary(*logoFolder)
+			if err != nil {
+				log.Fatalf("Error loading the logos: %v", err)
+			}
+			defer library.Close()
 
+			matches, err := img.NewLogoMatcher(library).WithMinScore(*minScore).Execute(inputFile)
+			if err != nil {
+				fmt.Printf("File: %s \nResult: No logos found.%s\n", inputFile, err)
+				break
+			}
+			if len(matches) == 0 || (*vendor && matches[0].Page != 0) {
+				fmt.Printf("File: %s \nResult: No logos found.\n", inputFile)
+				break
+			}
+			if *vendor {
+				fmt.Printf("File: %s \nResult: \nVendor: %s (%.2f)\n", inputFile, matches[0].Name, matches[0].Score)
+				break
+			}
+			fmt.Printf("File: %s\n", inputFile)
+			for _, match := range matches {
+				fmt.Printf("Page %d: %s at %v, score %.2f (template %.2f, keypoints %.2f), scale %.2f\n", match.Page+1,
+					match.Name, match.Box, match.Score, match.TemplateScore, match.KeypointScore, match.Scale)
+			}
 			break
 		}
 	case "VIDEO_OBJECT_DETECTION":
 		{
+			flags := flag.NewFlagSet(algorithm, flag.ExitOnError)
+			options := detectorFlags(flags, vid.DefaultDetectorOptions())
+			flags.Parse(os.Args[4:])
+
 			outfilePath, err := vid.NewVideoObjectDetector(
 				"models/yolov3.weights",
 				"models/yolov3.cfg",
-				"models/coco.names").
+				"models/coco.names",
+				options()).
 				Execute(inputFile, "output/generated-video/", true)
 
 			if err != nil {
@@ -91,9 +839,175 @@ func main() {
 
 			break
 		}
+	case "BENCHMARK":
+		{
+			flags := flag.NewFlagSet(algorithm, flag.ExitOnError)
+			configs := flags.String("configs", "", "Configurations of the manifest to compare, e.g. 'baseline,cleaned', all by default")
+			format := flags.String("format", "markdown", "Table printed: 'markdown', 'csv' or 'json'")
+			outDir := flags.String("out", "", "Folder to also write benchmark.md, benchmark.csv and benchmark.json to")
+			whitespace := flags.String("whitespace", "collapse", "How whitespace is compared: 'collapse', 'ignore' or 'exact'")
+			flags.Parse(os.Args[4:])
+
+			write := map[string]func(io.Writer, []evaluation.BenchmarkResult) error{
+				"markdown": evaluation.WriteBenchmarkMarkdown,
+				"csv":      evaluation.WriteBenchmarkCSV,
+				"json":     evaluation.WriteBenchmarkJSON,
+			}
+			if write[*format] == nil {
+				log.Fatal("Allowed benchmark formats are: 'markdown', 'csv', 'json'")
+			}
+			options := evaluation.DefaultTextOptions()
+			options.FoldPunctuation = true
+			switch options.Whitespace = evaluation.Whitespace(*whitespace); options.Whitespace {
+			case evaluation.WhitespaceCollapse, evaluation.WhitespaceIgnore, evaluation.WhitespaceExact:
+			default:
+				log.Fatal("Allowed whitespace modes are: 'collapse', 'ignore', 'exact'")
+			}
+
+			manifest, err := evaluation.LoadManifest(inputFile)
+			if err != nil {
+				log.Fatalf("Error loading the manifest: %v", err)
+			}
+			if *configs != "" {
+				var names []string
+				for _, name := range strings.Split(*configs, ",") {
+					names = append(names, strings.TrimSpace(name))
+				}
+				if err := manifest.Select(names...); err != nil {
+					log.Fatalf("Error selecting the configurations: %v", err)
+				}
+			}
+
+			// Set up every configuration first, so a bad one fails before the run
+			extractors := map[string]*doc.PlainTextExtractor{}
+			for _, config := range manifest.Configs {
+				extractors[config.Name] = newBenchmarkExtractor(config)
+			}
+			results := evaluation.RunBenchmark(manifest,
+				func(config evaluation.BenchmarkConfig, document evaluation.BenchmarkDocument, language string) (string, error) {
+					return extractors[config.Name].Extract(document.Image, language)
+				}, language, options)
+
+			if *outDir != "" {
+				if err := os.MkdirAll(*outDir, os.ModePerm); err != nil {
+					log.Fatalf("Error creating the output folder: %v", err)
+				}
+				for name, kind := range map[string]string{"benchmark.md": "markdown", "benchmark.csv": "csv", "benchmark.json": "json"} {
+					file, err := os.Create(filepath.Join(*outDir, name))
+					if err != nil {
+						log.Fatalf("Error writing the benchmark: %v", err)
+					}
+					err = write[kind](file, results)
+					file.Close()
+					if err != nil {
+						log.Fatalf("Error writing the benchmark: %v", err)
+					}
+				}
+			}
+			fmt.Printf("File: %s \nResult: \n", inputFile)
+			if err := write[*format](os.Stdout, results); err != nil {
+				log.Fatalf("Error writing the benchmark: %v", err)
+			}
+			break
+		}
 
 	default:
-		log.Fatal("Allowed algorithm are: 'PLAIN_TEXT_EXTRACTION', 'HOCR_TEXT_EXTRACTION', 'IMG_OBJECT_DETECTION','VIDEO_OBJECT_DETECTION'")
+		log.Fatal("Allowed algorithm are: 'PLAIN_TEXT_EXTRACTION', 'HOCR_TEXT_EXTRACTION', 'PDF_TEXT_EXTRACTION', 'REDACTION', 'MRZ_READER', 'IMG_OBJECT_DETECTION', 'OBJECT_DETECTION_EVALUATION', 'BARCODE_DETECTION', 'SIGNATURE_DETECTION', 'SIGNATURE_COMPARISON', 'PAGE_FLATTENING', 'CHECKBOX_DETECTION', 'FORM_EXTRACTION', 'STAMP_DETECTION', 'BACKGROUND_CLEANING', 'POLARITY_CORRECTION', 'LINE_REMOVAL', 'LOGO_DETECTION', 'QUALITY_ASSESSMENT', 'VIDEO_OBJECT_DETECTION', 'BENCHMARK'")
 		os.Exit(1)
 	}
 }
+
+// newUpscaler sets up the upscaling of the -upscale flag.
+func newUpscaler(method, model string, scale int) *img.Upscaler {
+	switch img.UpscaleMethod(method) {
+	case img.UpscaleLanczos:
+		return img.NewUpscaler()
+	case img.UpscaleESPCN, img.UpscaleFSRCNN:
+		if _, err := os.Stat(model); err != nil {
+			log.Fatalf("Super-resolution model not found: %v", err)
+		}
+		return img.NewUpscaler().WithModel(img.UpscaleMethod(method), model, scale)
+	default:
+		log.Fatal("Allowed upscaling methods are: 'lanczos', 'espcn', 'fsrcnn'")
+		return nil
+	}
+}
+
+// detectorFlags adds the flags of the object detector options, with the
+// given defaults, read by the returned function once the flags are parsed.
+func detectorFlags(flags *flag.FlagSet, defaults img.DetectorOptions) func() img.DetectorOptions {
+	confidence := flags.Float64("confidence", float64(defaults.ConfidenceThreshold), "Class score an object needs, from 0 to 1")
+	objectness := flags.Float64("objectness", float64(defaults.ObjectnessThreshold), "Objectness score a box needs, from 0 to 1")
+	nmsIoU := flags.Float64("nms-iou", float64(defaults.NMSIoU), "Overlap above which the less confident of two boxes of a class is dropped")
+	inputSize := flags.String("input-size", fmt.Sprintf("%dx%d", defaults.InputSize.X, defaults.InputSize.Y), "Size the image is resized to for the network, e.g. '608' or '608x416', a multiple of 32")
+	scale := flags.Float64("scale", defaults.ScaleFactor, "Factor the pixel values are multiplied by")
+	mean := flags.String("mean", fmt.Sprintf("%g,%g,%g", defaults.Mean[0], defaults.Mean[1], defaults.Mean[2]), "Red, green and blue values subtracted from the pixels")
+
+	return func() img.DetectorOptions {
+		options := defaults
+		options.ConfidenceThreshold, options.ObjectnessThreshold = float32(*confidence), float32(*objectness)
+		options.NMSIoU, options.ScaleFactor = float32(*nmsIoU), *scale
+
+		width, height, found := strings.Cut(*inputSize, "x")
+		if !found {
+			height = width
+		}
+		var err error
+		if options.InputSize.X, err = strconv.Atoi(width); err == nil {
+			options.InputSize.Y, err = strconv.Atoi(height)
+		}
+		if err != nil {
+			log.Fatalf("Invalid input size %q, please use e.g. '608' or '608x416'.", *inputSize)
+		}
+
+		values := strings.Split(*mean, ",")
+		if len(values) != 3 {
+			log.Fatalf("Invalid mean %q, please give the red, green and blue values.", *mean)
+		}
+		for i, value := range values {
+			if options.Mean[i], err = strconv.ParseFloat(strings.TrimSpace(value), 64); err != nil {
+				log.Fatalf("Invalid mean %q, please give the red, green and blue values.", *mean)
+			}
+		}
+		if err := options.Validate(); err != nil {
+			log.Fatalf("Invalid detector options: %v", err)
+		}
+		return options
+	}
+}
+
+// newBenchmarkExtractor sets up the text extraction of a benchmark
+// configuration, as the PLAIN_TEXT_EXTRACTION flags would.
+func newBenchmarkExtractor(config evaluation.BenchmarkConfig) *doc.PlainTextExtractor {
+	extractor := doc.NewPlainTextExtractor()
+	if config.Flatten {
+		extractor.WithPageFlattening(img.NewPageFlattener().WithDewarp(config.Dewarp))
+	}
+	if config.RemoveStamps {
+		extractor.WithStampRemoval(img.NewStampDetector())
+	}
+	if len(config.Clean) > 0 {
+		var steps []img.CleanStep
+		for _, step := range config.Clean {
+			steps = append(steps, img.CleanStep(strings.TrimSpace(step)))
+		}
+		extractor.WithBackgroundCleaning(img.NewBackgroundCleaner(steps...))
+	}
+	if config.FixPolarity {
+		extractor.WithPolarityCorrection(img.NewPolarityNormalizer())
+	}
+	if config.RemoveLines {
+		extractor.WithLineRemoval(img.NewLineRemover())
+	}
+	if config.Upscale != "" {
+		model, scale := config.UpscaleModel, config.ModelScale
+		if model == "" {
+			model = "models/ESPCN_x4.pb"
+		}
+		if scale == 0 {
+			scale = 4
+		}
+		extractor.WithUpscaling(newUpscaler(config.Upscale, model, scale))
+	}
+	return extractor
+}
@@ -0,0 +1,238 @@
+package doc
+
+import (
+	"fmt"
+	img "go-ocr/src/images"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/otiai10/gosseract/v2"
+	"gocv.io/x/gocv"
+)
+
+// Characters OCR may read in number and date fields
+const (
+	numberCharacters = "0123456789.,-+"
+	dateCharacters   = "0123456789/-."
+)
+
+// FormField is the value read from a field of a filled form.
+type FormField struct {
+	Name  string    `json:"name"`
+	Type  FieldType `json:"type"`
+	Value string    `json:"value"`
+	// From 0 to 1, the mean word confidence of OCR or how clearly a
+	// checkbox is marked
+	Confidence float64 `json:"confidence"`
+}
+
+// FormResult is a filled form registered to its template.
+type FormResult struct {
+	File         string            `json:"file"`
+	Template     string            `json:"template"`
+	Registration *img.Registration `json:"registration"`
+	// The best known logo on the form, when vendor logos are given
+	Vendor *img.LogoMatch `json:"vendor,omitempty"`
+	Fields []FormField    `json:"fields"`
+	// Why the form couldn't be read, when run over a folder
+	Error string `json:"error,omitempty"`
+}
+
+// Value returns the value read for a field, "" when there is none.
+func (fr *FormResult) Value(name string) string {
+	for _, f := range fr.Fields {
+		if f.Name == name {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+type FormExtractor struct {
+	template  *FormTemplate
+	registrar *img.ImageRegistrar
+	vendors   *img.LogoMatcher
+}
+
+func NewFormExtractor(template *FormTemplate) *FormExtractor {
+	return &FormExtractor{template: template, registrar: img.NewImageRegistrar()}
+}
+
+// WithRegistrar replaces the default registration settings.
+func (fe *FormExtractor) WithRegistrar(registrar *img.ImageRegistrar) *FormExtractor {
+	fe.registrar = registrar
+	return fe
+}
+
+// WithVendorLogos identifies the vendor of every form, e.g. of an
+// invoice, by the logos of the matcher's library.
+func (fe *FormExtractor) WithVendorLogos(matcher *img.LogoMatcher) *FormExtractor {
+	fe.vendors = matcher
+	return fe
+}
+
+// Execute registers a filled copy of the form to the reference image of
+// the template and reads every field.
+func (fe *FormExtractor) Execute(fileName string) (*FormResult, error) {
+	reference := gocv.IMRead(fe.template.Reference, gocv.IMReadColor)
+	if reference.Empty() {
+		return nil, fmt.Errorf("error reading the reference image %s", fe.template.Reference)
+	}
+	defer reference.Close()
+	scan := gocv.IMRead(fileName, gocv.IMReadColor)
+	if scan.Empty() {
+		return nil, fmt.Errorf("error reading the image %s", fileName)
+	}
+	defer scan.Close()
+
+	result := &FormResult{File: fileName, Template: fe.template.Name}
+	if fe.vendors != nil {
+		// The logo is looked for on the scan itself, so it's found even
+		// when registration fails
+		vendor, err := fe.vendors.Identify(scan)
+		if err != nil {
+			return result, fmt.Errorf("error identifying the vendor of %s: %w", fileName, err)
+		}
+		result.Vendor = vendor
+	}
+	aligned, registration, err := fe.registrar.Register(reference, scan)
+	defer aligned.Close()
+	result.Registration = registration
+	if err != nil {
+		return result, fmt.Errorf("error registering %s: %w", fileName, err)
+	}
+
+	bounds := image.Rect(0, 0, aligned.Cols(), aligned.Rows())
+	for _, field := range fe.template.Fields {
+		rect := field.Rect().Intersect(bounds)
+		if rect.Empty() {
+			return result, fmt.Errorf("field %s lies outside the reference image", field.Name)
+		}
+		region := aligned.Region(rect)
+		crop := region.Clone()
+		region.Close()
+
+		value := FormField{Name: field.Name, Type: field.Type}
+		if field.Type == FieldCheckbox {
+			err = readCheckbox(crop, &value)
+		} else {
+			err = fe.readText(crop, &value)
+		}
+		crop.Close()
+		if err != nil {
+			return result, fmt.Errorf("error reading field %s: %w", field.Name, err)
+		}
+		result.Fields = append(result.Fields, value)
+	}
+	return result, nil
+}
+
+// ExecuteFolder runs the template over every image of a folder, in name
+// order. Forms that fail are kept with their error and the others are
+// still read.
+func (fe *FormExtractor) ExecuteFolder(folder string) ([]FormResult, error) {
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the folder %s: %w", folder, err)
+	}
+	var files []string
+	for _, entry := range entries {
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".png", ".jpg", ".jpeg", ".tif", ".tiff", ".bmp":
+			if !entry.IsDir() {
+				files = append(files, filepath.Join(folder, entry.Name()))
+			}
+		}
+	}
+	sort.Strings(files)
+
+	var results []FormResult
+	for _, file := range files {
+		result, err := fe.Execute(file)
+		if result == nil {
+			result = &FormResult{File: file, Template: fe.template.Name}
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, *result)
+	}
+	return results, nil
+}
+
+// readCheckbox reads the state of the mark found in the field.
+func readCheckbox(crop gocv.Mat, field *FormField) error {
+	marks, err := img.NewCheckboxDetector().Detect(crop, 0)
+	if err != nil {
+		return err
+	}
+	if len(marks) == 0 {
+		return fmt.Errorf("no checkbox found")
+	}
+	// The biggest mark is the box, not a stray tick
+	sort.Slice(marks, func(i, j int) bool {
+		return marks[i].Box.Dx()*marks[i].Box.Dy() > marks[j].Box.Dx()*marks[j].Box.Dy()
+	})
+	field.Value = string(marks[0].State)
+	field.Confidence = marks[0].Confidence
+	return nil
+}
+
+// readText OCRs a field, restricting the characters of numbers and dates.
+func (fe *FormExtractor) readText(crop gocv.Mat, field *FormField) error {
+	gocv.CvtColor(crop, &crop, gocv.ColorBGRToGray)
+	gocv.Threshold(crop, &crop, 0, 255, gocv.ThresholdBinary+gocv.ThresholdOtsu)
+	// Tesseract reads better with a margin around the text
+	gocv.CopyMakeBorder(crop, &crop, 10, 10, 10, 10, gocv.BorderConstant, color.RGBA{255, 255, 255, 0})
+	buf, err := gocv.IMEncode(gocv.PNGFileExt, crop)
+	if err != nil {
+		return fmt.Errorf("error encoding the field: %w", err)
+	}
+	defer buf.Close()
+
+	client := gosseract.NewClient()
+	defer client.Close()
+	if err := client.SetLanguage(fe.template.Language); err != nil {
+		return fmt.Errorf("error setting language: %w", err)
+	}
+	mode := gosseract.PSM_SINGLE_BLOCK
+	switch field.Type {
+	case FieldNumber:
+		err = client.SetWhitelist(numberCharacters)
+		mode = gosseract.PSM_SINGLE_LINE
+	case FieldDate:
+		err = client.SetWhitelist(dateCharacters)
+		mode = gosseract.PSM_SINGLE_LINE
+	}
+	if err != nil {
+		return fmt.Errorf("error setting whitelist: %w", err)
+	}
+	if err := client.SetPageSegMode(mode); err != nil {
+		return fmt.Errorf("error setting page segmentation mode: %w", err)
+	}
+	if err := client.SetImageFromBytes(buf.GetBytes()); err != nil {
+		return fmt.Errorf("error setting image: %w", err)
+	}
+	boxes, err := client.GetBoundingBoxes(gosseract.RIL_WORD)
+	if err != nil {
+		return fmt.Errorf("error reading words: %w", err)
+	}
+
+	var words []string
+	confidence := 0.0
+	for _, box := range boxes {
+		if word := strings.TrimSpace(box.Word); word != "" {
+			words = append(words, word)
+			confidence += box.Confidence
+		}
+	}
+	field.Value = strings.Join(words, " ")
+	if len(words) > 0 {
+		field.Confidence = confidence / float64(len(words)) / 100
+	}
+	return nil
+}
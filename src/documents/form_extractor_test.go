@@ -0,0 +1,97 @@
+package doc
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Unit test for loading form templates from YAML and JSON
+func TestFormTemplate(t *testing.T) {
+	template, err := LoadFormTemplate("../../samples/forms/service-request.yaml")
+	if err != nil {
+		t.Fatalf("Error loading the template: %v", err)
+	}
+	if template.Reference != filepath.Join("../../samples/forms", "service-request.png") || len(template.Fields) != 5 {
+		t.Errorf("Expected 5 fields on service-request.png, got %d on %s", len(template.Fields), template.Reference)
+	}
+	if field := template.Fields[3]; field.Name != "urgent" || field.Type != FieldCheckbox || field.Box != [4]int{242, 490, 44, 44} {
+		t.Errorf("Expected the urgent checkbox, got %v", field)
+	}
+
+	// The same template written as JSON
+	data, err := json.Marshal(FormTemplate{"service-request", "service-request.png", "eng", template.Fields})
+	if err != nil {
+		t.Fatalf("Error writing the template: %v", err)
+	}
+	jsonFile := "../../output/test/forms/service-request.json"
+	if err := os.MkdirAll(filepath.Dir(jsonFile), os.ModePerm); err != nil {
+		t.Fatalf("Error creating the output folder: %v", err)
+	}
+	if err := os.WriteFile(jsonFile, data, 0o644); err != nil {
+		t.Fatalf("Error writing %s: %v", jsonFile, err)
+	}
+	fromJSON, err := LoadFormTemplate(jsonFile)
+	if err != nil {
+		t.Fatalf("Error loading the JSON template: %v", err)
+	}
+	if !reflect.DeepEqual(fromJSON.Fields, template.Fields) {
+		t.Errorf("Expected the same fields from JSON, got %v", fromJSON.Fields)
+	}
+
+	invalid := *template
+	invalid.Fields = append([]TemplateField{{Name: "urgent", Type: FieldText, Box: [4]int{0, 0, 10, 10}}}, template.Fields...)
+	if err := invalid.Validate(); err == nil {
+		t.Errorf("Expected a field defined twice to be rejected")
+	}
+	invalid.Fields = []TemplateField{{Name: "signature", Type: "drawing", Box: [4]int{0, 0, 10, 10}}}
+	if err := invalid.Validate(); err == nil {
+		t.Errorf("Expected an unknown field type to be rejected")
+	}
+}
+
+// Unit test for registering filled forms to their template and reading
+// the fields, the second scan is rotated and scaled
+func TestFormExtractor(t *testing.T) {
+	template, err := LoadFormTemplate("../../samples/forms/service-request.yaml")
+	if err != nil {
+		t.Fatalf("Error loading the template: %v", err)
+	}
+	expected := []map[string]string{
+		{"customer_name": "Daniel Carter", "request_date": "2024-03-18", "amount_due": "1250.75",
+			"urgent": "checked", "description": "Replace the broken cooling fan in server room B."},
+		{"customer_name": "Aisha Rahman", "request_date": "2024-04-02", "amount_due": "89.90",
+			"urgent": "unchecked", "description": "Install two new monitors at desk 14."},
+	}
+
+	results, err := NewFormExtractor(template).ExecuteFolder("../../samples/forms/filled/")
+	if err != nil {
+		t.Fatalf("Error reading the forms: %v", err)
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d forms, got %d", len(expected), len(results))
+	}
+	for i, result := range results {
+		if result.Error != "" {
+			t.Errorf("Error reading %s: %s", result.File, result.Error)
+			continue
+		}
+		if result.Registration.Quality < 0.6 || result.Registration.ReprojectionError > 2 {
+			t.Errorf("Expected a good alignment of %s, got %+v", result.File, *result.Registration)
+		}
+		for name, value := range expected[i] {
+			if got := result.Value(name); !strings.EqualFold(strings.TrimSpace(got), value) {
+				t.Errorf("Expected %s of %s to be %q, got %q", name, result.File, value, got)
+			}
+		}
+	}
+
+	// A page of another document doesn't register
+	result, err := NewFormExtractor(template).Execute("../../samples/documents/omr-sheet.png")
+	if err == nil {
+		t.Errorf("Expected another document not to register, got %+v", result.Registration)
+	}
+}
@@ -0,0 +1,112 @@
+package doc
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type FieldType string
+
+const (
+	FieldText FieldType = "text"
+	// Digits, signs and decimal separators only
+	FieldNumber FieldType = "number"
+	// Digits and date separators only
+	FieldDate FieldType = "date"
+	// "checked", "unchecked" or "filled"
+	FieldCheckbox FieldType = "checkbox"
+)
+
+// TemplateField is a named region of a form.
+type TemplateField struct {
+	Name string    `json:"name" yaml:"name"`
+	Type FieldType `json:"type" yaml:"type"`
+	// x, y, width and height in pixels of the reference image
+	Box [4]int `json:"box" yaml:"box"`
+}
+
+// Rect returns the box of the field.
+func (f TemplateField) Rect() image.Rectangle {
+	return image.Rect(f.Box[0], f.Box[1], f.Box[0]+f.Box[2], f.Box[1]+f.Box[3])
+}
+
+// FormTemplate describes a recurring form: a blank reference image and
+// the fields to read on every filled copy.
+type FormTemplate struct {
+	Name string `json:"name" yaml:"name"`
+	// The reference image, relative to the template file
+	Reference string `json:"reference" yaml:"reference"`
+	// Tesseract language of the fields, "eng" when empty
+	Language string          `json:"language,omitempty" yaml:"language,omitempty"`
+	Fields   []TemplateField `json:"fields" yaml:"fields"`
+}
+
+// LoadFormTemplate reads a template from a .json, .yaml or .yml file and
+// checks it. The path of the reference image is made relative to the
+// working directory.
+func LoadFormTemplate(fileName string) (*FormTemplate, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the template: %w", err)
+	}
+
+	template := &FormTemplate{}
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".json":
+		err = json.Unmarshal(data, template)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, template)
+	default:
+		return nil, fmt.Errorf("unknown template format %s, use .json, .yaml or .yml", filepath.Ext(fileName))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the template %s: %w", fileName, err)
+	}
+
+	if template.Reference != "" && !filepath.IsAbs(template.Reference) {
+		template.Reference = filepath.Join(filepath.Dir(fileName), template.Reference)
+	}
+	if template.Language == "" {
+		template.Language = "eng"
+	}
+	if err := template.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid template %s: %w", fileName, err)
+	}
+	return template, nil
+}
+
+// Validate checks the template has a reference image and well formed
+// fields with unique names.
+func (t *FormTemplate) Validate() error {
+	if t.Reference == "" {
+		return fmt.Errorf("no reference image")
+	}
+	if len(t.Fields) == 0 {
+		return fmt.Errorf("no fields")
+	}
+	names := map[string]bool{}
+	for _, f := range t.Fields {
+		if f.Name == "" {
+			return fmt.Errorf("a field has no name")
+		}
+		if names[f.Name] {
+			return fmt.Errorf("field %s is defined twice", f.Name)
+		}
+		names[f.Name] = true
+		switch f.Type {
+		case FieldText, FieldNumber, FieldDate, FieldCheckbox:
+		default:
+			return fmt.Errorf("field %s has unknown type %q", f.Name, f.Type)
+		}
+		if f.Box[2] <= 0 || f.Box[3] <= 0 {
+			return fmt.Errorf("field %s has an empty box", f.Name)
+		}
+	}
+	return nil
+}
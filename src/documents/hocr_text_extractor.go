@@ -3,43 +3,170 @@ package doc
 import (
 	"fmt"
 	"go-ocr/src"
+	img "go-ocr/src/images"
+	"go-ocr/src/pdf"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
 	"log"
+	"math"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
+	_ "golang.org/x/image/tiff"
 	"golang.org/x/net/html"
 
 	"github.com/otiai10/gosseract/v2"
 	"github.com/signintech/gopdf"
+	"gopkg.in/gographics/imagick.v3/imagick"
 )
 
 type HOCRTextExtractor struct {
 	tempFolder  string
 	fontsFolder string
+	pdfaPart    pdf.PDFAPart
+	author      string
+	scan        *pdf.ScanOptions
+	scanStats   []pdf.ScanStats
+	upscaler    *img.Upscaler
 }
 
 func NewHOCRTextExtractor(fontsFolder string) *HOCRTextExtractor {
-	return &HOCRTextExtractor{"../../temp/", fontsFolder}
+	return &HOCRTextExtractor{tempFolder: "../../temp/", fontsFolder: fontsFolder}
+}
+
+// WithPDFA makes the generated PDFs archival PDF/A-2b or PDF/A-3b files,
+// recording author in their metadata.
+func (hte *HOCRTextExtractor) WithPDFA(part pdf.PDFAPart, author string) *HOCRTextExtractor {
+	hte.pdfaPart = part
+	hte.author = author
+	return hte
+}
+
+// WithScan embeds the scanned pages under the text, which then becomes an
+// invisible layer, storing them as the options' profile says.
+func (hte *HOCRTextExtractor) WithScan(opts pdf.ScanOptions) *HOCRTextExtractor {
+	hte.scan = &opts
+	return hte
+}
+
+// WithUpscaling enlarges pages whose text is too small for Tesseract
+// before OCR. The boxes of the hOCR are mapped back to the original page.
+func (hte *HOCRTextExtractor) WithUpscaling(upscaler *img.Upscaler) *HOCRTextExtractor {
+	hte.upscaler = upscaler
+	return hte
+}
+
+// CompressionReport returns how well each page scan of the last generated
+// PDF compressed. It is empty unless scans are embedded.
+func (hte *HOCRTextExtractor) CompressionReport() []pdf.ScanStats {
+	return hte.scanStats
 }
 
 func (hte *HOCRTextExtractor) Execute(fileName, lang, outDir string) (*string, error) {
+	pageFiles, err := hte.splitPages(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var pages []hocrPage
+	for _, pageFile := range pageFiles {
+		page, err := hte.recognizePage(pageFile, lang)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, *page)
+	}
+
+	outFilePath := outDir + src.ChangeFileExtension(fileName, ".pdf")
+	return &outFilePath, hte.generatePDF(fileName, lang, outFilePath, pages)
+}
+
+// hocrPage is what Tesseract found on one page of the input.
+type hocrPage struct {
+	file          string
+	text          []string
+	boxes         []struct{ x1, y1, x2, y2 float64 }
+	width, height float64
+	blocks        []LayoutBlock
+}
+
+// splitPages writes every frame of a multi-page image, such as a TIFF, to
+// its own file. Single images are used as they are.
+func (hte *HOCRTextExtractor) splitPages(fileName string) ([]string, error) {
+	imagick.Initialize()
+	defer imagick.Terminate()
+
+	mw := imagick.NewMagickWand()
+	defer mw.Destroy()
+
+	// Pinging reads the frame count without decoding the pixels
+	if err := mw.PingImage(fileName); err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	if mw.GetNumberImages() <= 1 {
+		return []string{fileName}, nil
+	}
+
+	if err := mw.ReadImage(fileName); err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	var pageFiles []string
+	for i := 0; i < int(mw.GetNumberImages()); i++ {
+		mw.SetIteratorIndex(i)
+		frame := mw.GetImage()
+		pageFile := fmt.Sprintf("%spage-%d.png", hte.tempFolder, i+1)
+		err := frame.WriteImage(pageFile)
+		frame.Destroy()
+		if err != nil {
+			return nil, fmt.Errorf("failed to write page %d: %w", i+1, err)
+		}
+		pageFiles = append(pageFiles, pageFile)
+	}
+
+	return pageFiles, nil
+}
+
+func (hte *HOCRTextExtractor) recognizePage(fileName, lang string) (*hocrPage, error) {
 	if err := hte.generateHOCR(fileName, lang); err != nil {
 		return nil, err
 	}
 
-	text, boxes, pageWidth, pageHeight := hte.extractTextAndBoundingBoxes("extracted-text.hocr")
+	return hte.readPage(fileName, "extracted-text.hocr")
+}
+
+// readPage loads the words and layout of an image from its hOCR file in
+// the temp folder.
+func (hte *HOCRTextExtractor) readPage(fileName, hocrFilePath string) (*hocrPage, error) {
+	text, boxes, pageWidth, pageHeight := hte.extractTextAndBoundingBoxes(hocrFilePath)
 
 	if len(text) == 0 || len(boxes) == 0 || pageWidth == 0 || pageHeight == 0 {
 		return nil, fmt.Errorf("error extracting texts and boxes")
 	}
 
-	outFilePath := outDir + src.ChangeFileExtension(fileName, ".pdf")
-	return &outFilePath, hte.generatePDF(lang, outFilePath, pageWidth, pageHeight, text, boxes)
+	hocrFile, err := os.Open(hte.tempFolder + hocrFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer hocrFile.Close()
+
+	blocks, err := AnalyzeLayout(hocrFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &hocrPage{fileName, text, boxes, pageWidth, pageHeight, blocks}, nil
 }
 
 func (hte *HOCRTextExtractor) generateHOCR(fileName, lang string) error {
-	err := NewPlainTextExtractor().preProcessImage(fileName)
+	pte := NewPlainTextExtractor().WithUpscaling(hte.upscaler)
+	pte.tempFolder = hte.tempFolder
+	err := pte.preProcessImage(fileName)
 	if err != nil {
 		log.Fatal("Failed to preprocess image:", err)
 		return err
@@ -62,6 +189,9 @@ func (hte *HOCRTextExtractor) generateHOCR(fileName, lang string) error {
 	if err != nil {
 		log.Fatalf("Error extracting HOCR: %v", err)
 	}
+	if factor := pte.Upscaling().Factor; factor > 1 {
+		hocrText = scaleHOCR(hocrText, 1/factor)
+	}
 
 	file, err := os.OpenFile(hte.tempFolder+"extracted-text.hocr", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
@@ -81,6 +211,31 @@ func (hte *HOCRTextExtractor) generateHOCR(fileName, lang string) error {
 	return nil
 }
 
+// hocrMeasures are the properties of hOCR titles given in pixels.
+var hocrMeasures = regexp.MustCompile(`(bbox|x_size|x_descenders|x_ascenders|baseline -?[\d.]+)((?: -?[\d.]+)+)`)
+
+// scaleHOCR multiplies the boxes and font measures of an hOCR document by
+// factor, e.g. to map those read from an upscaled page back to the
+// original. The slope of baselines is kept.
+func scaleHOCR(hocr string, factor float64) string {
+	return hocrMeasures.ReplaceAllStringFunc(hocr, func(property string) string {
+		parts := hocrMeasures.FindStringSubmatch(property)
+		values := strings.Fields(parts[2])
+		for i, v := range values {
+			number, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return property
+			}
+			if parts[1] == "bbox" {
+				values[i] = strconv.Itoa(int(math.Round(number * factor)))
+			} else {
+				values[i] = strconv.FormatFloat(number*factor, 'f', -1, 64)
+			}
+		}
+		return parts[1] + " " + strings.Join(values, " ")
+	})
+}
+
 func (hte *HOCRTextExtractor) extractTextAndBoundingBoxes(hocrFilePath string) ([]string, []struct{ x1, y1, x2, y2 float64 }, float64, float64) {
 	file, err := os.Open(hte.tempFolder + hocrFilePath)
 	if err != nil {
@@ -122,7 +277,8 @@ func (hte *HOCRTextExtractor) extractTextAndBoundingBoxes(hocrFilePath string) (
 		} else if n.Type == html.ElementNode && n.Data == "span" {
 			// Get the "title" attribute that contains the bounding box information
 			for _, attr := range n.Attr {
-				if isValidNode(*n, "ocrx_word") {
+				// Empty words have no text to draw at their box
+				if isValidNode(*n, "ocrx_word") && strings.TrimSpace(textContent(n)) != "" {
 					if attr.Key == "title" {
 						// Parse the dims values
 						dims, err := getDimensions(attr)
@@ -163,19 +319,16 @@ func (hte *HOCRTextExtractor) extractTextAndBoundingBoxes(hocrFilePath string) (
 	return text, boxes, pageWidth, pageHeight
 }
 
-func (hte *HOCRTextExtractor) generatePDF(lang, outputFilePath string, pageWidth, pageHeight float64,
-	text []string, boxes []struct{ x1, y1, x2, y2 float64 }) error {
+func (hte *HOCRTextExtractor) generatePDF(fileName, lang, outputFilePath string, pages []hocrPage) error {
 	// Initialize PDF
 	const dpi = 72.0 // Assuming 72 DPI for simplicity (standard for many PDF libraries)
 
 	// Convert from pixels to points (1 pixel = 1 point in this case as 1 inch = 72 points)
-	pageWidthInPoints := pageWidth / dpi * 72
-	pageHeightInPoints := pageHeight / dpi * 72
+	scale := 72 / dpi
 
 	pdf := gopdf.GoPdf{}
-	config := gopdf.Config{PageSize: gopdf.Rect{W: pageWidthInPoints, H: pageHeightInPoints}}
+	config := gopdf.Config{PageSize: gopdf.Rect{W: pages[0].width * scale, H: pages[0].height * scale}}
 	pdf.Start(config)
-	pdf.AddPage()
 
 	// Set font (make sure you have a font file or use a default font)
 	if lang == "jpn" {
@@ -202,19 +355,95 @@ func (hte *HOCRTextExtractor) generatePDF(lang, outputFilePath string, pageWidth
 		}
 	}
 
-	// Iterate through the text and bounding boxes and add text at the specified positions
-	for i, t := range text {
-		if i < len(boxes) {
-			// Add the text at the bounding box position
-			box := boxes[i]
-			pdf.SetX(box.x1 * pageWidth)
-			pdf.SetY(box.y1 * pageHeight)
-			pdf.Cell(nil, t)
+	for _, page := range pages {
+		pdf.AddPageWithOption(gopdf.PageOption{PageSize: &gopdf.Rect{W: page.width * scale, H: page.height * scale}})
+
+		// Iterate through the text and bounding boxes and add text at the specified positions
+		for i, t := range page.text {
+			if i < len(page.boxes) {
+				// Add the text at the bounding box position
+				box := page.boxes[i]
+				pdf.SetX(box.x1 * page.width)
+				pdf.SetY(box.y1 * page.height)
+				pdf.Cell(nil, t)
+			}
+		}
+	}
+
+	data, err := pdf.GetBytesPdfReturnErr()
+	if err != nil {
+		fmt.Println("Error generating PDF:", err)
+		return err
+	}
+
+	return hte.writePDF(data, fileName, lang, outputFilePath, pages, scale)
+}
+
+// writePDF tags the generated document so screen readers can follow its
+// structure, adds bookmarks and document info, converts it to PDF/A when
+// asked to, and writes it out. scale converts pixels to points.
+func (hte *HOCRTextExtractor) writePDF(data []byte, fileName, lang, outputFilePath string,
+	pages []hocrPage, scale float64) error {
+	title := strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+
+	hte.scanStats = nil
+	if hte.scan != nil {
+		scans, err := loadScans(pages)
+		if err != nil {
+			return err
+		}
+		data, hte.scanStats, err = pdf.AddScans(data, scans, *hte.scan)
+		if err != nil {
+			return fmt.Errorf("failed to embed scans: %w", err)
+		}
+	}
+
+	var elems []*pdf.StructElem
+	for i, page := range pages {
+		elems = append(elems, structureElements(i, page.blocks, min(len(page.text), len(page.boxes)), scale)...)
+	}
+	data, err := pdf.TagPDF(data, languageTag(lang), title, elems)
+	if err != nil {
+		return fmt.Errorf("failed to tag pdf: %w", err)
+	}
+
+	data, err = pdf.AddOutline(data, outline(pages, scale))
+	if err != nil {
+		return fmt.Errorf("failed to add bookmarks: %w", err)
+	}
+
+	// Dates come from the source image, so converting the same scan twice
+	// yields the same file
+	var created time.Time
+	if info, err := os.Stat(fileName); err == nil {
+		created = info.ModTime()
+	}
+
+	data, err = pdf.SetInfo(data, pdf.DocumentInfo{
+		Title:    title,
+		Author:   hte.author,
+		Creator:  "gocr-lib",
+		Producer: "gocr-lib",
+		Created:  created,
+		Modified: created,
+		Extra: map[string]string{
+			"SourceFile":  filepath.Base(fileName),
+			"OCRLanguage": lang,
+			"OCREngine":   "Tesseract " + gosseract.Version(),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set document info: %w", err)
+	}
+
+	if hte.pdfaPart != 0 {
+		data, err = hte.convertToPDFA(data, title, created)
+		if err != nil {
+			return err
 		}
 	}
 
-	// Write the output PDF
-	err := pdf.WritePdf(outputFilePath)
+	err = os.WriteFile(outputFilePath, data, 0644)
 	if err != nil {
 		fmt.Println("Error writing PDF:", err)
 		return err
@@ -223,6 +452,264 @@ func (hte *HOCRTextExtractor) generatePDF(lang, outputFilePath string, pageWidth
 	return nil
 }
 
+// loadScans reads the page images back, along with where their words are.
+func loadScans(pages []hocrPage) ([]pdf.PageScan, error) {
+	var scans []pdf.PageScan
+	for _, page := range pages {
+		file, err := os.Open(page.file)
+		if err != nil {
+			return nil, err
+		}
+		img, _, err := image.Decode(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", page.file, err)
+		}
+
+		scan := pdf.PageScan{Image: img}
+		for _, box := range page.boxes {
+			scan.Text = append(scan.Text, image.Rect(
+				int(box.x1*page.width), int(box.y1*page.height),
+				int(box.x2*page.width), int(box.y2*page.height)))
+		}
+		scans = append(scans, scan)
+	}
+
+	return scans, nil
+}
+
+// convertToPDFA converts the generated document to PDF/A and verifies it.
+func (hte *HOCRTextExtractor) convertToPDFA(data []byte, title string, created time.Time) ([]byte, error) {
+	archived, err := pdf.ConvertToPDFA(data, hte.pdfaPart, pdf.ArchiveInfo{
+		Title:       title,
+		Author:      hte.author,
+		CreatorTool: "gocr-lib",
+		Producer:    "gocr-lib",
+		Date:        created,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert to PDF/A: %w", err)
+	}
+
+	if problems := pdf.CheckPDFA(archived); len(problems) > 0 {
+		return nil, fmt.Errorf("PDF/A check failed: %s", strings.Join(problems, "; "))
+	}
+
+	return archived, nil
+}
+
+// structureElements turns the layout of a page into the PDF structure tree.
+// Every word is drawn as its own text object, so word indices are the
+// text objects' positions on the page. runs is the number of words drawn.
+func structureElements(page int, blocks []LayoutBlock, runs int, scale float64) []*pdf.StructElem {
+	runsOf := func(words []LayoutWord) []int {
+		var indices []int
+		for _, w := range words {
+			if w.Index < runs {
+				indices = append(indices, w.Index)
+			}
+		}
+		return indices
+	}
+
+	leaf := func(kind pdf.Name, words []LayoutWord) *pdf.StructElem {
+		// URLs and email addresses get Link elements of their own, the text
+		// around them goes into spans
+		var parts [][]LayoutWord
+		var targets []string
+		for i, w := range words {
+			// A link broken after a slash or hyphen at the end of a line
+			// goes on with the first word of the next one
+			if i > 0 && len(targets) > 0 && targets[len(targets)-1] != "" && !sameLine(words[i-1], w) &&
+				strings.ContainsAny(words[i-1].Text[len(words[i-1].Text)-1:], "/-") {
+				if target := linkTarget(joinedText(parts[len(parts)-1]) + w.Text); target != "" {
+					parts[len(parts)-1] = append(parts[len(parts)-1], w)
+					targets[len(targets)-1] = target
+					continue
+				}
+			}
+			target := linkTarget(w.Text)
+			if target != "" || len(parts) == 0 || targets[len(targets)-1] != "" {
+				parts = append(parts, nil)
+				targets = append(targets, target)
+			}
+			parts[len(parts)-1] = append(parts[len(parts)-1], w)
+		}
+		if len(parts) <= 1 && (len(targets) == 0 || targets[0] == "") {
+			return &pdf.StructElem{Type: kind, Page: page, Runs: runsOf(words), ActualText: wordsText(words)}
+		}
+
+		el := &pdf.StructElem{Type: kind, Page: page}
+		for i, part := range parts {
+			text := wordsText(part)
+			if targets[i] != "" {
+				text = joinedText(part)
+			}
+			if i < len(parts)-1 {
+				text += " "
+			}
+			kid := &pdf.StructElem{Type: "Span", Page: page, Runs: runsOf(part), ActualText: text}
+			if targets[i] != "" {
+				// One area per line the link is on
+				areas := []image.Rectangle{part[0].Box}
+				for j := 1; j < len(part); j++ {
+					if sameLine(part[j-1], part[j]) {
+						areas[len(areas)-1] = areas[len(areas)-1].Union(part[j].Box)
+					} else {
+						areas = append(areas, part[j].Box)
+					}
+				}
+				box := pixelsToPoints(areas[0], scale)
+				for _, area := range areas[1:] {
+					box = box.Union(pixelsToPoints(area, scale))
+				}
+				kid.Type = "Link"
+				kid.URI = targets[i]
+				kid.Box = &box
+				if len(areas) > 1 {
+					for _, area := range areas {
+						kid.Areas = append(kid.Areas, pixelsToPoints(area, scale))
+					}
+				}
+			}
+			el.Kids = append(el.Kids, kid)
+		}
+		return el
+	}
+
+	var elems []*pdf.StructElem
+	figures := 0
+	for _, b := range blocks {
+		switch b.Kind {
+		case LayoutHeading:
+			elems = append(elems, leaf(pdf.Name(fmt.Sprintf("H%d", b.Level)), lineWords(b.Lines)))
+		case LayoutParagraph:
+			elems = append(elems, leaf("P", lineWords(b.Lines)))
+		case LayoutList:
+			list := &pdf.StructElem{Type: "L", Page: page}
+			for _, item := range b.Items {
+				li := &pdf.StructElem{Type: "LI", Page: page}
+				words := lineWords(item)
+				if isListMarker(words[0].Text) {
+					li.Kids = append(li.Kids, leaf("Lbl", words[:1]))
+					words = words[1:]
+				}
+				if len(words) > 0 {
+					li.Kids = append(li.Kids, leaf("LBody", words))
+				}
+				list.Kids = append(list.Kids, li)
+			}
+			elems = append(elems, list)
+		case LayoutTable:
+			table := &pdf.StructElem{Type: "Table", Page: page}
+			for _, row := range b.Rows {
+				tr := &pdf.StructElem{Type: "TR", Page: page}
+				for _, cell := range row {
+					tr.Kids = append(tr.Kids, leaf("TD", cell))
+				}
+				table.Kids = append(table.Kids, tr)
+			}
+			elems = append(elems, table)
+		case LayoutFigure:
+			// OCR cannot describe pictures; the placeholder marks where a
+			// description has to be added
+			figures++
+			box := pixelsToPoints(b.Box, scale)
+			elems = append(elems, &pdf.StructElem{
+				Type: "Figure",
+				Page: page,
+				Alt:  fmt.Sprintf("Figure %d: no description available", figures),
+				Box:  &box,
+			})
+		}
+	}
+
+	return elems
+}
+
+// outline builds the bookmarks from the headings, second level headings
+// under the first level one before them. Multi-page documents get an entry
+// per page holding that page's headings.
+func outline(pages []hocrPage, scale float64) []*pdf.OutlineItem {
+	var items []*pdf.OutlineItem
+	for i, page := range pages {
+		var headings []*pdf.OutlineItem
+		var section *pdf.OutlineItem
+		for _, b := range page.blocks {
+			if b.Kind != LayoutHeading {
+				continue
+			}
+			item := &pdf.OutlineItem{
+				Title: strings.ReplaceAll(b.Text(), "\n", " "),
+				Page:  i,
+				Top:   float64(b.Box.Min.Y) * scale,
+			}
+			if b.Level > 1 && section != nil {
+				section.Kids = append(section.Kids, item)
+				continue
+			}
+			if b.Level == 1 {
+				section = item
+			}
+			headings = append(headings, item)
+		}
+
+		if len(pages) == 1 {
+			return headings
+		}
+		items = append(items, &pdf.OutlineItem{Title: fmt.Sprintf("Page %d", i+1), Page: i, Kids: headings})
+	}
+
+	return items
+}
+
+func pixelsToPoints(r image.Rectangle, scale float64) pdf.Rect {
+	return pdf.Rect{
+		X0: float64(r.Min.X) * scale, Y0: float64(r.Min.Y) * scale,
+		X1: float64(r.Max.X) * scale, Y1: float64(r.Max.Y) * scale,
+	}
+}
+
+// sameLine tells whether two words overlap vertically.
+func sameLine(a, b LayoutWord) bool {
+	return a.Box.Min.Y < b.Box.Max.Y && b.Box.Min.Y < a.Box.Max.Y
+}
+
+// joinedText puts the words of a wrapped link back together.
+func joinedText(words []LayoutWord) string {
+	var text strings.Builder
+	for _, w := range words {
+		text.WriteString(w.Text)
+	}
+	return text.String()
+}
+
+func lineWords(lines []LayoutLine) []LayoutWord {
+	var words []LayoutWord
+	for _, l := range lines {
+		words = append(words, l.Words...)
+	}
+	return words
+}
+
+// Tesseract language codes and their BCP 47 tags
+var languageTags = map[string]string{
+	"eng": "en", "jpn": "ja", "hin": "hi", "deu": "de", "fra": "fr", "spa": "es",
+	"ita": "it", "por": "pt", "nld": "nl", "rus": "ru", "ara": "ar", "kor": "ko",
+	"chi_sim": "zh-Hans", "chi_tra": "zh-Hant", "ben": "bn", "tam": "ta", "tel": "te",
+	"mar": "mr", "guj": "gu", "kan": "kn", "mal": "ml", "pan": "pa", "urd": "ur",
+}
+
+// languageTag returns the document language for an OCR language setting
+// such as "eng" or "eng+hin"; the first language is taken as the main one.
+func languageTag(lang string) string {
+	first := strings.Split(lang, "+")[0]
+	if tag, ok := languageTags[first]; ok {
+		return tag
+	}
+	return strings.ReplaceAll(first, "_", "-")
+}
+
 // Struct to hold the bounding box values for each word
 type bbox struct {
 	x1, y1, x2, y2 float64
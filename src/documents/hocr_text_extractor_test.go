@@ -26,3 +26,16 @@ func TestHOCRTestExtraction(t *testing.T) {
 		}
 	}
 }
+
+// Unit test for mapping the hOCR of an upscaled page back to the original
+func TestScaleHOCR(t *testing.T) {
+	hocr := `<div class='ocr_page' title='image "processed-image.jpg"; bbox 0 0 2862 2114; ppageno 0'>` +
+		`<span class='ocr_line' title="bbox 100 200 901 251; baseline 0.001 -11; x_size 50; x_descenders 11; x_ascenders 13">` +
+		`<span class='ocrx_word' title='bbox 100 200 301 251; x_wconf 96'>Invoice</span></span></div>`
+	expected := `<div class='ocr_page' title='image "processed-image.jpg"; bbox 0 0 1431 1057; ppageno 0'>` +
+		`<span class='ocr_line' title="bbox 50 100 451 126; baseline 0.001 -5.5; x_size 25; x_descenders 5.5; x_ascenders 6.5">` +
+		`<span class='ocrx_word' title='bbox 50 100 151 126; x_wconf 96'>Invoice</span></span></div>`
+	if scaled := scaleHOCR(hocr, 0.5); scaled != expected {
+		t.Errorf("Expected: \n%s\n, but got: \n%s", expected, scaled)
+	}
+}
@@ -0,0 +1,379 @@
+package doc
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// LayoutKind is the role a block plays on the page.
+type LayoutKind string
+
+const (
+	LayoutHeading   LayoutKind = "heading"
+	LayoutParagraph LayoutKind = "paragraph"
+	LayoutList      LayoutKind = "list"
+	LayoutTable     LayoutKind = "table"
+	LayoutFigure    LayoutKind = "figure"
+)
+
+const (
+	// Lines this much larger than the page's usual text are headings
+	headingRatio      = 1.3
+	firstHeadingRatio = 1.7
+	maxHeadingWords   = 15
+	// Gaps wider than this many text heights separate table cells
+	cellGapRatio = 1.5
+)
+
+var (
+	listMarker   = regexp.MustCompile(`^(?:[•●○◦▪■□‣∙·*\-–—]|\(?(?:\d{1,3}|[a-zA-Z]|[ivxIVX]{1,4})[.)])$`)
+	urlPattern   = regexp.MustCompile(`(?i)^(?:https?://|www\.)[^\s/]+\.[^\s]+$`)
+	emailPattern = regexp.MustCompile(`^[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}$`)
+)
+
+type LayoutWord struct {
+	// Position of the word in reading order, empty words left out. The
+	// HOCR PDF draws one text object per word in this order.
+	Index int
+	Text  string
+	Box   image.Rectangle
+	// Tesseract's confidence in the word, 0 to 100
+	Confidence float64
+}
+
+type LayoutLine struct {
+	Words []LayoutWord
+	Box   image.Rectangle
+	// Tesseract's estimate of the text size, in pixels
+	XSize float64
+	// Tesseract marked the line as a heading
+	Header bool
+}
+
+type LayoutBlock struct {
+	Kind LayoutKind
+	Box  image.Rectangle
+	// Heading level, 1 being the most prominent
+	Level int
+	// Text of headings and paragraphs
+	Lines []LayoutLine
+	// List items, each starting at a line that begins with a marker
+	Items [][]LayoutLine
+	// Table cells by row
+	Rows [][][]LayoutWord
+}
+
+// Text returns the words of the block joined by spaces, lines by newlines.
+func (b LayoutBlock) Text() string {
+	lines := b.Lines
+	for _, item := range b.Items {
+		lines = append(lines, item...)
+	}
+	var out []string
+	for _, line := range lines {
+		out = append(out, wordsText(line.Words))
+	}
+	for _, row := range b.Rows {
+		var cells []string
+		for _, cell := range row {
+			cells = append(cells, wordsText(cell))
+		}
+		out = append(out, strings.Join(cells, "\t"))
+	}
+	return strings.Join(out, "\n")
+}
+
+// TextLines returns the visual lines of the block in reading order. Table
+// rows come back as one line each.
+func (b LayoutBlock) TextLines() [][]LayoutWord {
+	var out [][]LayoutWord
+	for _, line := range b.Lines {
+		out = append(out, line.Words)
+	}
+	for _, item := range b.Items {
+		for _, line := range item {
+			out = append(out, line.Words)
+		}
+	}
+	for _, row := range b.Rows {
+		var words []LayoutWord
+		for _, cell := range row {
+			words = append(words, cell...)
+		}
+		out = append(out, words)
+	}
+	return out
+}
+
+func wordsText(words []LayoutWord) string {
+	texts := make([]string, len(words))
+	for i, w := range words {
+		texts[i] = w.Text
+	}
+	return strings.Join(texts, " ")
+}
+
+// AnalyzeLayout reads Tesseract hOCR output and groups its words into
+// headings, paragraphs, lists, tables and figures, in reading order.
+func AnalyzeLayout(hocr io.Reader) ([]LayoutBlock, error) {
+	root, err := html.Parse(hocr)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing hocr: %w", err)
+	}
+
+	// A paragraph, or a figure when lines is nil
+	type piece struct {
+		lines  []LayoutLine
+		figure image.Rectangle
+	}
+	var pieces []*piece
+	var par *piece
+	var line *LayoutLine
+	index := 0
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type != html.ElementNode {
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c)
+			}
+			return
+		}
+
+		title := attrValue(n, "title")
+		switch {
+		case hasClass(n, "ocr_photo", "ocr_image", "ocr_linedrawing"):
+			pieces = append(pieces, &piece{figure: titleBox(title)})
+			return
+		case hasClass(n, "ocr_par"):
+			par = &piece{lines: []LayoutLine{}}
+			pieces = append(pieces, par)
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c)
+			}
+			par = nil
+			return
+		case hasClass(n, "ocr_line", "ocr_header", "ocr_caption", "ocr_textfloat"):
+			line = &LayoutLine{Box: titleBox(title), Header: hasClass(n, "ocr_header")}
+			line.XSize, _ = strconv.ParseFloat(titleValue(title, "x_size"), 64)
+			if line.XSize == 0 {
+				line.XSize = float64(line.Box.Dy())
+			}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c)
+			}
+			if len(line.Words) > 0 {
+				if par == nil {
+					// Lines outside of a paragraph stand on their own
+					pieces = append(pieces, &piece{lines: []LayoutLine{*line}})
+				} else {
+					par.lines = append(par.lines, *line)
+				}
+			}
+			line = nil
+			return
+		case hasClass(n, "ocrx_word"):
+			word := LayoutWord{Index: index, Text: strings.TrimSpace(textContent(n)), Box: titleBox(title)}
+			word.Confidence, _ = strconv.ParseFloat(titleValue(title, "x_wconf"), 64)
+			if word.Text == "" {
+				// Nothing is drawn for empty words
+				return
+			}
+			index++
+			if line != nil {
+				line.Words = append(line.Words, word)
+			}
+			return
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+
+	// Typical text size on the page
+	var sizes []float64
+	for _, p := range pieces {
+		for _, l := range p.lines {
+			sizes = append(sizes, l.XSize)
+		}
+	}
+	bodySize := median(sizes)
+
+	var blocks []LayoutBlock
+	for _, p := range pieces {
+		if p.lines == nil {
+			blocks = append(blocks, LayoutBlock{Kind: LayoutFigure, Box: p.figure})
+			continue
+		}
+		if len(p.lines) == 0 {
+			continue
+		}
+
+		block := classifyParagraph(p.lines, bodySize)
+		// Tesseract often makes every list item its own paragraph
+		if last := len(blocks) - 1; block.Kind == LayoutList && last >= 0 && blocks[last].Kind == LayoutList {
+			blocks[last].Items = append(blocks[last].Items, block.Items...)
+			blocks[last].Box = blocks[last].Box.Union(block.Box)
+			continue
+		}
+		blocks = append(blocks, block)
+	}
+
+	return blocks, nil
+}
+
+func classifyParagraph(lines []LayoutLine, bodySize float64) LayoutBlock {
+	block := LayoutBlock{Kind: LayoutParagraph, Lines: lines}
+	words := 0
+	var sizes []float64
+	header := false
+	for _, l := range lines {
+		block.Box = block.Box.Union(l.Box)
+		words += len(l.Words)
+		sizes = append(sizes, l.XSize)
+		header = header || l.Header
+	}
+
+	// Numbered headings ("1. Introduction") look like list items, so size wins
+	size := median(sizes)
+	if len(lines) <= 2 && words <= maxHeadingWords && bodySize > 0 && (header || size >= headingRatio*bodySize) {
+		block.Kind = LayoutHeading
+		block.Level = 2
+		if size >= firstHeadingRatio*bodySize {
+			block.Level = 1
+		}
+		return block
+	}
+
+	if isListMarker(lines[0].Words[0].Text) {
+		var items [][]LayoutLine
+		for _, l := range lines {
+			if isListMarker(l.Words[0].Text) || len(items) == 0 {
+				items = append(items, nil)
+			}
+			items[len(items)-1] = append(items[len(items)-1], l)
+		}
+		return LayoutBlock{Kind: LayoutList, Box: block.Box, Items: items}
+	}
+
+	if rows := tableRows(lines); rows != nil {
+		return LayoutBlock{Kind: LayoutTable, Box: block.Box, Rows: rows}
+	}
+
+	return block
+}
+
+// tableRows splits the lines of a paragraph into cells at wide gaps. It
+// returns nil unless there are several lines with the same number of cells.
+func tableRows(lines []LayoutLine) [][][]LayoutWord {
+	if len(lines) < 2 {
+		return nil
+	}
+
+	var rows [][][]LayoutWord
+	for _, l := range lines {
+		var row [][]LayoutWord
+		for i, w := range l.Words {
+			if i == 0 || float64(w.Box.Min.X-l.Words[i-1].Box.Max.X) > cellGapRatio*l.XSize {
+				row = append(row, nil)
+			}
+			row[len(row)-1] = append(row[len(row)-1], w)
+		}
+		if len(row) < 2 || (len(rows) > 0 && len(row) != len(rows[0])) {
+			return nil
+		}
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+// isListMarker reports whether a word is a bullet or an item number.
+func isListMarker(word string) bool {
+	return listMarker.MatchString(word)
+}
+
+// linkTarget returns the URI a recognized word points to, or "" when the
+// word is not a URL or an email address.
+func linkTarget(word string) string {
+	word = strings.Trim(word, `.,;:!?"'()<>[]`)
+	switch {
+	case emailPattern.MatchString(word):
+		return "mailto:" + word
+	case urlPattern.MatchString(word):
+		if strings.HasPrefix(strings.ToLower(word), "www.") {
+			return "https://" + word
+		}
+		return word
+	}
+	return ""
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	return sorted[len(sorted)/2]
+}
+
+func hasClass(n *html.Node, classes ...string) bool {
+	for _, c := range strings.Fields(attrValue(n, "class")) {
+		for _, want := range classes {
+			if c == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func attrValue(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// titleValue returns a property of an hOCR title, e.g. "x_size" from
+// "bbox 10 10 90 40; x_size 30".
+func titleValue(title, key string) string {
+	for _, part := range strings.Split(title, ";") {
+		fields := strings.Fields(part)
+		if len(fields) > 1 && fields[0] == key {
+			return strings.Join(fields[1:], " ")
+		}
+	}
+	return ""
+}
+
+func titleBox(title string) image.Rectangle {
+	dims, err := getDimensions(html.Attribute{Key: "title", Val: title})
+	if err != nil {
+		return image.Rectangle{}
+	}
+	return image.Rect(int(dims.x1), int(dims.y1), int(dims.x2), int(dims.y2))
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(textContent(c))
+	}
+	return sb.String()
+}
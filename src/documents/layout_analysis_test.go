@@ -0,0 +1,165 @@
+package doc
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"go-ocr/src/pdf"
+)
+
+const layoutTestHOCR = `<html><body>
+<div class='ocr_page' title='bbox 0 0 1000 1400'>
+ <div class='ocr_carea' title='bbox 100 100 900 160'>
+  <p class='ocr_par'>
+   <span class='ocr_line' title='bbox 100 100 600 160; x_size 60'>
+    <span class='ocrx_word' title='bbox 100 100 300 160'>Annual</span>
+    <span class='ocrx_word' title='bbox 320 100 600 160'>Report</span>
+   </span>
+  </p>
+ </div>
+ <div class='ocr_carea' title='bbox 100 200 900 260'>
+  <p class='ocr_par'>
+   <span class='ocr_line' title='bbox 100 200 900 225; x_size 25'>
+    <span class='ocrx_word' title='bbox 100 200 180 225'>Sales</span>
+    <span class='ocrx_word' title='bbox 190 200 260 225'>rose</span>
+    <span class='ocrx_word' title='bbox 270 200 330 225'>this</span>
+    <span class='ocrx_word' title='bbox 340 200 400 225'>year.</span>
+   </span>
+   <span class='ocr_line' title='bbox 100 235 500 260; x_size 25'>
+    <span class='ocrx_word' title='bbox 100 235 200 260'>Costs</span>
+    <span class='ocrx_word' title='bbox 210 235 300 260'>fell.</span>
+   </span>
+  </p>
+ </div>
+ <div class='ocr_carea' title='bbox 100 300 900 360'>
+  <p class='ocr_par'>
+   <span class='ocr_line' title='bbox 100 300 500 325; x_size 25'>
+    <span class='ocrx_word' title='bbox 100 300 120 325'>•</span>
+    <span class='ocrx_word' title='bbox 130 300 250 325'>Hiring</span>
+   </span>
+  </p>
+  <p class='ocr_par'>
+   <span class='ocr_line' title='bbox 100 335 500 360; x_size 25'>
+    <span class='ocrx_word' title='bbox 100 335 120 360'>•</span>
+    <span class='ocrx_word' title='bbox 130 335 250 360'>Training</span>
+   </span>
+  </p>
+ </div>
+ <div class='ocr_carea' title='bbox 100 400 900 460'>
+  <p class='ocr_par'>
+   <span class='ocr_line' title='bbox 100 400 900 425; x_size 25'>
+    <span class='ocrx_word' title='bbox 100 400 200 425'>Region</span>
+    <span class='ocrx_word' title='bbox 600 400 700 425'>Total</span>
+   </span>
+   <span class='ocr_line' title='bbox 100 435 900 460; x_size 25'>
+    <span class='ocrx_word' title='bbox 100 435 200 460'>North</span>
+    <span class='ocrx_word' title='bbox 600 435 700 460'>120</span>
+   </span>
+  </p>
+ </div>
+ <div class='ocr_photo' title='bbox 100 500 500 900'></div>
+</div>
+</body></html>`
+
+// Unit test for grouping hOCR words into headings, paragraphs, lists, tables and figures
+func TestAnalyzeLayout(t *testing.T) {
+	blocks, err := AnalyzeLayout(strings.NewReader(layoutTestHOCR))
+	if err != nil {
+		t.Fatalf("Error analyzing layout: %v", err)
+	}
+
+	expected := []struct {
+		kind LayoutKind
+		text string
+	}{
+		{LayoutHeading, "Annual Report"},
+		{LayoutParagraph, "Sales rose this year.\nCosts fell."},
+		{LayoutList, "• Hiring\n• Training"},
+		{LayoutTable, "Region\tTotal\nNorth\t120"},
+		{LayoutFigure, ""},
+	}
+	if len(blocks) != len(expected) {
+		t.Fatalf("Expected %d blocks, got %d: %+v", len(expected), len(blocks), blocks)
+	}
+	for i, want := range expected {
+		if blocks[i].Kind != want.kind || blocks[i].Text() != want.text {
+			t.Errorf("Block %d: expected %s %q, got %s %q", i, want.kind, want.text, blocks[i].Kind, blocks[i].Text())
+		}
+	}
+	if blocks[0].Level != 1 {
+		t.Errorf("Expected a level 1 heading, got level %d", blocks[0].Level)
+	}
+
+	// Word indices follow the order the words are drawn in the PDF
+	if last := blocks[3].Rows[1][1][0]; last.Index != 15 {
+		t.Errorf("Expected the last word to have index 15, got %d", last.Index)
+	}
+}
+
+// Unit test for numbering words as drawn when Tesseract emits an empty one
+func TestLayoutEmptyWord(t *testing.T) {
+	hocr := `<html><body><div class='ocr_page' title='bbox 0 0 1000 1400'><p class='ocr_par'>
+<span class='ocr_line' title='bbox 100 200 500 225; x_size 25'>
+ <span class='ocrx_word' title='bbox 100 200 180 225'>Total</span>
+ <span class='ocrx_word' title='bbox 190 200 200 225'> </span>
+ <span class='ocrx_word' title='bbox 210 200 260 225'>due</span>
+ <span class='ocrx_word' title='bbox 270 200 330 225'>now</span>
+</span></p></div></body></html>`
+	blocks, err := AnalyzeLayout(strings.NewReader(hocr))
+	if err != nil {
+		t.Fatalf("Error analyzing layout: %v", err)
+	}
+	// Three words, so three runs are drawn
+	elems := structureElements(0, blocks, 3, 1)
+	if len(elems) != 1 || !slices.Equal(elems[0].Runs, []int{0, 1, 2}) || elems[0].ActualText != "Total due now" {
+		t.Errorf("Expected a paragraph of the runs 0 to 2, got %+v", elems)
+	}
+}
+
+// Unit test for linking a URL that wraps to the next line
+func TestLayoutWrappedLink(t *testing.T) {
+	hocr := `<html><body><div class='ocr_page' title='bbox 0 0 1000 1400'><p class='ocr_par'>
+<span class='ocr_line' title='bbox 100 200 600 225; x_size 25'>
+ <span class='ocrx_word' title='bbox 100 200 180 225'>Read</span>
+ <span class='ocrx_word' title='bbox 190 200 600 225'>https://example.com/docs/</span>
+</span>
+<span class='ocr_line' title='bbox 100 240 400 265; x_size 25'>
+ <span class='ocrx_word' title='bbox 100 240 280 265'>guide.html</span>
+ <span class='ocrx_word' title='bbox 290 240 400 265'>first</span>
+</span></p></div></body></html>`
+	blocks, err := AnalyzeLayout(strings.NewReader(hocr))
+	if err != nil {
+		t.Fatalf("Error analyzing layout: %v", err)
+	}
+	elems := structureElements(0, blocks, 4, 1)
+	if len(elems) != 1 || len(elems[0].Kids) != 3 {
+		t.Fatalf("Expected a paragraph with a link between two spans, got %+v", elems)
+	}
+	link := elems[0].Kids[1]
+	if link.URI != "https://example.com/docs/guide.html" || !slices.Equal(link.Runs, []int{1, 2}) ||
+		link.ActualText != "https://example.com/docs/guide.html " {
+		t.Errorf("Expected the link to cover both parts of the URL, got %+v", link)
+	}
+	areas := []pdf.Rect{{X0: 190, Y0: 200, X1: 600, Y1: 225}, {X0: 100, Y0: 240, X1: 280, Y1: 265}}
+	if !slices.Equal(link.Areas, areas) || *link.Box != (pdf.Rect{X0: 100, Y0: 200, X1: 600, Y1: 265}) {
+		t.Errorf("Expected an area on each line, got %+v in %+v", link.Areas, *link.Box)
+	}
+}
+
+// Unit test for recognizing URLs and email addresses among OCR'd words
+func TestLinkTarget(t *testing.T) {
+	words := map[string]string{
+		"https://example.com/docs": "https://example.com/docs",
+		"www.example.org,":         "https://www.example.org",
+		"(billing@example.com)":    "mailto:billing@example.com",
+		"example":                  "",
+		"12.50":                    "",
+		"www.":                     "",
+	}
+	for word, want := range words {
+		if got := linkTarget(word); got != want {
+			t.Errorf("linkTarget(%q) = %q, expected %q", word, got, want)
+		}
+	}
+}
@@ -0,0 +1,572 @@
+package doc
+
+import (
+	"fmt"
+	"image"
+	"math/bits"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/otiai10/gosseract/v2"
+	"gocv.io/x/gocv"
+)
+
+// MRZFormat is the ICAO 9303 layout of a machine-readable zone.
+type MRZFormat string
+
+const (
+	// ID cards: three lines of 30 characters
+	MRZFormatTD1 MRZFormat = "TD1"
+	// Older ID cards and visas: two lines of 36 characters
+	MRZFormatTD2 MRZFormat = "TD2"
+	// Passports: two lines of 44 characters
+	MRZFormatTD3 MRZFormat = "TD3"
+)
+
+const mrzAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789<"
+
+// MRZ lines are never shorter than this, shorter OCR lines are other text
+const minMRZLineLength = 25
+
+// Characters OCR mixes up in the OCR-B font of the zone
+var (
+	digitLookalikes  = map[byte]byte{'O': '0', 'Q': '0', 'D': '0', 'I': '1', 'Z': '2', 'S': '5', 'G': '6', 'B': '8'}
+	letterLookalikes = map[byte]byte{'0': 'O', '1': 'I', '2': 'Z', '5': 'S', '6': 'G', '8': 'B'}
+)
+
+// MRZCheck is the result of one check digit.
+type MRZCheck struct {
+	Field string
+	Valid bool
+}
+
+// MRZ holds the fields of a machine-readable zone.
+type MRZ struct {
+	Format         MRZFormat
+	DocumentCode   string
+	IssuingState   string
+	DocumentNumber string
+	Nationality    string
+	BirthDate      time.Time
+	// "M", "F", "X" or "" when unspecified
+	Sex          string
+	ExpiryDate   time.Time
+	Surname      string
+	GivenNames   string
+	OptionalData string
+	Checks       []MRZCheck
+	// Fields whose look-alike characters were swapped, check digits and
+	// "composite" included. Fields with a check digit are only corrected
+	// when both their check and the composite one pass.
+	Corrected []string
+	// The zone as read, after corrections
+	Lines []string
+	// Where the zone was found in the image, in pixels
+	Box image.Rectangle
+}
+
+// Valid reports whether every check digit passed.
+func (m *MRZ) Valid() bool {
+	for _, c := range m.Checks {
+		if !c.Valid {
+			return false
+		}
+	}
+	return len(m.Checks) > 0
+}
+
+type MRZReader struct {
+	tempFolder string
+}
+
+func NewMRZReader() *MRZReader {
+	return &MRZReader{"../../temp/"}
+}
+
+// Execute finds the machine-readable zone of a passport or ID card photo,
+// OCRs it and parses its fields. lang should be a Tesseract model trained
+// on OCR-B, such as "ocrb" or "mrz", though "eng" works on clean scans.
+func (mr *MRZReader) Execute(fileName, lang string) (*MRZ, error) {
+	img := gocv.IMRead(fileName, gocv.IMReadGrayScale)
+	if img.Empty() {
+		return nil, fmt.Errorf("error reading the image %s", fileName)
+	}
+	defer img.Close()
+
+	band := mr.locateBand(img)
+	if band.Empty() {
+		// The zone is always at the bottom of the data page
+		band = image.Rect(0, img.Rows()*2/3, img.Cols(), img.Rows())
+	}
+
+	region := img.Region(band)
+	crop := region.Clone()
+	region.Close()
+	defer crop.Close()
+
+	// Tesseract wants characters at least 20 pixels high
+	if crop.Cols() < 1200 {
+		scale := 1200 / float64(crop.Cols())
+		gocv.Resize(crop, &crop, image.Pt(0, 0), scale, scale, gocv.InterpolationCubic)
+	}
+	gocv.Threshold(crop, &crop, 0, 255, gocv.ThresholdBinary+gocv.ThresholdOtsu)
+
+	bandFile := mr.tempFolder + "mrz-band.png"
+	if ok := gocv.IMWrite(bandFile, crop); !ok {
+		return nil, fmt.Errorf("failed to write %s", bandFile)
+	}
+
+	client := gosseract.NewClient()
+	defer client.Close()
+
+	client.SetLanguage(lang)
+	if err := client.SetWhitelist(mrzAlphabet); err != nil {
+		return nil, fmt.Errorf("failed to set whitelist: %w", err)
+	}
+	if err := client.SetPageSegMode(gosseract.PSM_SINGLE_BLOCK); err != nil {
+		return nil, fmt.Errorf("failed to set page segmentation mode: %w", err)
+	}
+	if err := client.SetImage(bandFile); err != nil {
+		return nil, fmt.Errorf("failed to set image to Tesseract: %w", err)
+	}
+	text, err := client.Text()
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract text: %w", err)
+	}
+
+	mrz, err := ParseMRZ(text)
+	if err != nil {
+		return nil, err
+	}
+	mrz.Box = band
+	return mrz, nil
+}
+
+// locateBand finds the wide block of dark text lines that makes up the
+// zone. It returns an empty rectangle when there is none.
+func (mr *MRZReader) locateBand(img gocv.Mat) image.Rectangle {
+	// Kernel sizes below are tuned for this width
+	const width = 600
+	scale := float64(width) / float64(img.Cols())
+	small := gocv.NewMat()
+	defer small.Close()
+	gocv.Resize(img, &small, image.Pt(width, int(float64(img.Rows())*scale)), 0, 0, gocv.InterpolationArea)
+	gocv.GaussianBlur(small, &small, image.Pt(3, 3), 0, 0, gocv.BorderDefault)
+
+	// Dark characters on a light background, joined along each line
+	rectKernel := gocv.GetStructuringElement(gocv.MorphRect, image.Pt(13, 5))
+	defer rectKernel.Close()
+	blackhat := gocv.NewMat()
+	defer blackhat.Close()
+	gocv.MorphologyEx(small, &blackhat, gocv.MorphBlackhat, rectKernel)
+
+	grad := gocv.NewMat()
+	defer grad.Close()
+	gocv.Sobel(blackhat, &grad, gocv.MatTypeCV32F, 1, 0, -1, 1, 0, gocv.BorderDefault)
+	gocv.ConvertScaleAbs(grad, &grad, 1, 0)
+	gocv.Normalize(grad, &grad, 0, 255, gocv.NormMinMax)
+
+	gocv.MorphologyEx(grad, &grad, gocv.MorphClose, rectKernel)
+	gocv.Threshold(grad, &grad, 0, 255, gocv.ThresholdBinary+gocv.ThresholdOtsu)
+
+	// Then join the lines of the zone together
+	squareKernel := gocv.GetStructuringElement(gocv.MorphRect, image.Pt(21, 21))
+	defer squareKernel.Close()
+	gocv.MorphologyEx(grad, &grad, gocv.MorphClose, squareKernel)
+	for i := 0; i < 4; i++ {
+		gocv.Erode(grad, &grad, rectKernel)
+	}
+
+	contours := gocv.FindContours(grad, gocv.RetrievalExternal, gocv.ChainApproxSimple)
+	defer contours.Close()
+
+	var rects []image.Rectangle
+	for i := 0; i < contours.Size(); i++ {
+		rects = append(rects, gocv.BoundingRect(contours.At(i)))
+	}
+	sort.Slice(rects, func(i, j int) bool {
+		return rects[i].Dx()*rects[i].Dy() > rects[j].Dx()*rects[j].Dy()
+	})
+
+	for _, r := range rects {
+		// The zone is wide and spans most of the page
+		if r.Dx() < 5*r.Dy() || r.Dx() < width*6/10 {
+			continue
+		}
+		pad := r.Dy() / 4
+		r = image.Rect(r.Min.X-pad, r.Min.Y-pad, r.Max.X+pad, r.Max.Y+pad).Intersect(image.Rect(0, 0, small.Cols(), small.Rows()))
+		return image.Rect(int(float64(r.Min.X)/scale), int(float64(r.Min.Y)/scale),
+			int(float64(r.Max.X)/scale), int(float64(r.Max.Y)/scale)).
+			Intersect(image.Rect(0, 0, img.Cols(), img.Rows()))
+	}
+	return image.Rectangle{}
+}
+
+// ParseMRZ parses OCR'd text holding a machine-readable zone, fixing
+// characters OCR commonly confuses when a check digit fails.
+func ParseMRZ(text string) (*MRZ, error) {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.ToUpper(strings.Join(strings.Fields(line), ""))
+		if len(line) >= minMRZLineLength {
+			lines = append(lines, line)
+		}
+	}
+
+	// The zone is the last lines read, their length gives the format
+	var format MRZFormat
+	var length int
+	n := len(lines)
+	switch {
+	case n >= 2 && len(lines[n-2])+len(lines[n-1]) > 2*40:
+		format, length = MRZFormatTD3, 44
+		lines = lines[n-2:]
+	case n >= 2 && len(lines[n-2])+len(lines[n-1]) > 2*33:
+		format, length = MRZFormatTD2, 36
+		lines = lines[n-2:]
+	case n >= 3:
+		format, length = MRZFormatTD1, 30
+		lines = lines[n-3:]
+	default:
+		return nil, fmt.Errorf("no machine-readable zone found in %q", text)
+	}
+
+	p := &mrzParser{mrz: &MRZ{Format: format}}
+	for _, line := range lines {
+		// Tesseract tends to drop or add filler characters at the end
+		b := []byte((line + strings.Repeat("<", length))[:length])
+		for i, c := range b {
+			if !strings.ContainsRune(mrzAlphabet, rune(c)) {
+				b[i] = '<'
+			}
+		}
+		p.lines = append(p.lines, b)
+	}
+
+	switch format {
+	case MRZFormatTD1:
+		p.parseTD1()
+	default:
+		p.parseTD2TD3(length)
+	}
+
+	for _, line := range p.lines {
+		p.mrz.Lines = append(p.mrz.Lines, string(line))
+	}
+	return p.mrz, nil
+}
+
+type mrzParser struct {
+	lines [][]byte
+	mrz   *MRZ
+	fixes []mrzFix
+}
+
+// parseTD2TD3 reads passports and TD2 documents, which differ only in the
+// length of the names and optional data.
+func (p *mrzParser) parseTD2TD3(length int) {
+	l1, l2 := p.lines[0], p.lines[1]
+	m := p.mrz
+
+	m.DocumentCode = p.alphaField("document code", l1[0:2])
+	m.IssuingState = p.alphaField("issuing state", l1[2:5])
+	m.Surname, m.GivenNames = p.names(l1[5:])
+	m.Nationality = p.alphaField("nationality", l2[10:13])
+	m.Sex = sex(l2[20])
+
+	// Fields failing their check are only fixed once the composite check
+	// says which of their corrections is right
+	number := p.checked("document number", l2[0:9], &l2[9], false)
+	birth := p.checked("birth date", l2[13:19], &l2[19], true)
+	expiry := p.checked("expiry date", l2[21:27], &l2[27], true)
+	var personal []byte
+	if length == 44 {
+		personal = p.checked("personal number", l2[28:42], &l2[42], false)
+	}
+	p.checkComposite(func() string {
+		return string(l2[0:10]) + string(l2[13:20]) + string(l2[21:length-1])
+	}, &l2[length-1])
+
+	m.DocumentNumber = strings.TrimRight(string(number), "<")
+	m.BirthDate = birthDate(string(birth))
+	m.ExpiryDate = expiryDate(string(expiry))
+	if length == 44 {
+		m.OptionalData = strings.TrimRight(string(personal), "<")
+	} else {
+		m.OptionalData = strings.TrimRight(string(l2[28:length-1]), "<")
+	}
+}
+
+func (p *mrzParser) parseTD1() {
+	l1, l2, l3 := p.lines[0], p.lines[1], p.lines[2]
+	m := p.mrz
+
+	m.DocumentCode = p.alphaField("document code", l1[0:2])
+	m.IssuingState = p.alphaField("issuing state", l1[2:5])
+	m.Sex = sex(l2[7])
+	m.Nationality = p.alphaField("nationality", l2[15:18])
+	m.Surname, m.GivenNames = p.names(l3)
+
+	optional := string(l1[15:30])
+	number := l1[5:14]
+	// Puts the corrections of a long document number back in the line
+	sync := func() {}
+	if l1[14] == '<' && strings.Trim(optional, "<") != "" {
+		// Long document numbers continue in the optional data, followed by
+		// their check digit
+		end := strings.IndexByte(optional, '<')
+		if end < 0 {
+			end = len(optional)
+		}
+		if end > 0 {
+			number = append(append([]byte{}, l1[5:14]...), l1[15:15+end-1]...)
+			p.checked("document number", number, &l1[15+end-1], false)
+			sync = func() {
+				copy(l1[5:14], number[:9])
+				copy(l1[15:15+end-1], number[9:])
+			}
+			optional = optional[end:]
+		}
+	} else {
+		p.checked("document number", number, &l1[14], false)
+	}
+
+	birth := p.checked("birth date", l2[0:6], &l2[6], true)
+	expiry := p.checked("expiry date", l2[8:14], &l2[14], true)
+	p.checkComposite(func() string {
+		sync()
+		return string(l1[5:30]) + string(l2[0:7]) + string(l2[8:15]) + string(l2[18:29])
+	}, &l2[29])
+	sync()
+
+	m.DocumentNumber = strings.TrimRight(string(number), "<")
+	m.OptionalData = strings.Trim(optional+"<"+string(l2[18:29]), "<")
+	m.BirthDate = birthDate(string(birth))
+	m.ExpiryDate = expiryDate(string(expiry))
+}
+
+// A field that failed its check digit, and the look-alike swaps that make
+// it pass, fewest swaps first
+type mrzFix struct {
+	name       string
+	check      int
+	field      []byte
+	candidates [][]byte
+}
+
+// checked validates a field against its check digit and returns it. When
+// the check fails, the look-alike swaps that would make it pass are kept
+// for checkComposite to choose from. Numeric fields only have letters
+// turned into digits.
+func (p *mrzParser) checked(name string, field []byte, check *byte, numeric bool) []byte {
+	if d, ok := digitLookalikes[*check]; ok {
+		*check = d
+		p.corrected(name)
+	}
+	valid := checkDigit(field) == checkValue(*check)
+	if !valid {
+		if candidates := correctField(field, *check, numeric); len(candidates) > 0 {
+			p.fixes = append(p.fixes, mrzFix{name, len(p.mrz.Checks), field, candidates})
+		}
+	}
+	p.mrz.Checks = append(p.mrz.Checks, MRZCheck{name, valid})
+	return field
+}
+
+// checkComposite validates the zone against its composite check digit. It
+// applies the corrections of the fields that failed their own check, the
+// fewest swaps in all, only if they make the composite check pass too.
+func (p *mrzParser) checkComposite(composite func() string, check *byte) {
+	if d, ok := digitLookalikes[*check]; ok {
+		*check = d
+		defer p.corrected("composite")
+	}
+	if len(p.fixes) == 0 {
+		p.mrz.Checks = append(p.mrz.Checks, MRZCheck{"composite", checkDigit([]byte(composite())) == checkValue(*check)})
+		return
+	}
+
+	originals := make([][]byte, len(p.fixes))
+	for i, fix := range p.fixes {
+		originals[i] = append([]byte{}, fix.field...)
+	}
+	// Tries every combination of the candidates, the first fix varying
+	// fastest
+	var best []int
+	bestChanges := 0
+	choice := make([]int, len(p.fixes))
+	for {
+		changes := 0
+		for i, fix := range p.fixes {
+			copy(fix.field, fix.candidates[choice[i]])
+			changes += swaps(originals[i], fix.field)
+		}
+		if (best == nil || changes < bestChanges) && checkDigit([]byte(composite())) == checkValue(*check) {
+			best, bestChanges = append([]int{}, choice...), changes
+		}
+
+		i := 0
+		for ; i < len(choice); i++ {
+			if choice[i]++; choice[i] < len(p.fixes[i].candidates) {
+				break
+			}
+			choice[i] = 0
+		}
+		if i == len(choice) {
+			break
+		}
+	}
+
+	for i, fix := range p.fixes {
+		if best == nil {
+			copy(fix.field, originals[i])
+			continue
+		}
+		copy(fix.field, fix.candidates[best[i]])
+		p.mrz.Checks[fix.check].Valid = true
+		p.corrected(fix.name)
+	}
+	p.mrz.Checks = append(p.mrz.Checks, MRZCheck{"composite", best != nil})
+}
+
+// corrected records that characters of a field were swapped, once.
+func (p *mrzParser) corrected(name string) {
+	if !slices.Contains(p.mrz.Corrected, name) {
+		p.mrz.Corrected = append(p.mrz.Corrected, name)
+	}
+}
+
+// Fields failing their check keep at most this many candidate corrections
+const maxFieldCandidates = 16
+
+// correctField lists the look-alike swaps that make the field match its
+// check digit, fewest swaps first, and returns nil when there are none.
+func correctField(field []byte, check byte, numeric bool) [][]byte {
+	var positions []int
+	for i, c := range field {
+		if _, ok := digitLookalikes[c]; ok || (!numeric && letterLookalikes[c] != 0) {
+			positions = append(positions, i)
+		}
+	}
+	// Keep the search small
+	if len(positions) > 10 {
+		positions = positions[:10]
+	}
+
+	var masks []int
+	for mask := 1; mask < 1<<len(positions); mask++ {
+		masks = append(masks, mask)
+	}
+	sort.SliceStable(masks, func(i, j int) bool {
+		return bits.OnesCount(uint(masks[i])) < bits.OnesCount(uint(masks[j]))
+	})
+
+	var candidates [][]byte
+	for _, mask := range masks {
+		candidate := append([]byte{}, field...)
+		for k, pos := range positions {
+			if mask&(1<<k) == 0 {
+				continue
+			}
+			if d, ok := digitLookalikes[candidate[pos]]; ok {
+				candidate[pos] = d
+			} else {
+				candidate[pos] = letterLookalikes[candidate[pos]]
+			}
+		}
+		if checkDigit(candidate) == checkValue(check) {
+			if candidates = append(candidates, candidate); len(candidates) == maxFieldCandidates {
+				break
+			}
+		}
+	}
+	return candidates
+}
+
+// swaps counts the characters that differ between two fields.
+func swaps(a, b []byte) int {
+	n := 0
+	for i := range a {
+		if a[i] != b[i] {
+			n++
+		}
+	}
+	return n
+}
+
+// checkDigit computes the ICAO 9303 check digit of a field.
+func checkDigit(field []byte) int {
+	weights := []int{7, 3, 1}
+	sum := 0
+	for i, c := range field {
+		sum += checkValue(c) * weights[i%3]
+	}
+	return sum % 10
+}
+
+func checkValue(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10
+	}
+	return 0
+}
+
+// alphaField reads a field that only holds letters, such as a country code.
+func (p *mrzParser) alphaField(name string, field []byte) string {
+	out := make([]byte, len(field))
+	for i, c := range field {
+		out[i] = c
+		if l, ok := letterLookalikes[c]; ok {
+			out[i] = l
+			p.corrected(name)
+		}
+	}
+	return strings.TrimRight(string(out), "<")
+}
+
+// names splits the name field into the primary and secondary identifiers.
+func (p *mrzParser) names(field []byte) (string, string) {
+	value := p.alphaField("names", field)
+	surname, given, _ := strings.Cut(value, "<<")
+	clean := func(s string) string {
+		return strings.Join(strings.FieldsFunc(s, func(r rune) bool { return r == '<' }), " ")
+	}
+	return clean(surname), clean(given)
+}
+
+func sex(c byte) string {
+	switch c {
+	case 'M', 'F', 'X':
+		return string(c)
+	}
+	return ""
+}
+
+// birthDate parses a YYMMDD birth date, which is never in the future.
+func birthDate(value string) time.Time {
+	date, err := time.Parse("060102", value)
+	if err != nil {
+		return time.Time{}
+	}
+	if date.After(time.Now()) {
+		date = date.AddDate(-100, 0, 0)
+	}
+	return date
+}
+
+// expiryDate parses a YYMMDD expiry date, always in this century.
+func expiryDate(value string) time.Time {
+	date, err := time.Parse("060102", value)
+	if err != nil {
+		return time.Time{}
+	}
+	if date.Year() < 2000 {
+		date = date.AddDate(100, 0, 0)
+	}
+	return date
+}
@@ -0,0 +1,121 @@
+package doc
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// Unit test for parsing the ICAO 9303 specimen zones of every format
+func TestParseMRZ(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		format MRZFormat
+		number string
+		expiry time.Time
+	}{
+		{"passport", "P<UTOERIKSSON<<ANNA<MARIA<<<<<<<<<<<<<<<<<<<\nL898902C36UTO7408122F1204159ZE184226B<<<<<10\n",
+			MRZFormatTD3, "L898902C3", date(2012, 4, 15)},
+		{"td2", "I<UTOERIKSSON<<ANNA<MARIA<<<<<<<<<<<\nD231458907UTO7408122F1204159<<<<<<<6\n",
+			MRZFormatTD2, "D23145890", date(2012, 4, 15)},
+		{"id card", "I<UTOD231458907<<<<<<<<<<<<<<<\n7408122F1204159UTO<<<<<<<<<<<6\nERIKSSON<<ANNA<MARIA<<<<<<<<<<\n",
+			MRZFormatTD1, "D23145890", date(2012, 4, 15)},
+	}
+
+	for _, test := range tests {
+		mrz, err := ParseMRZ(test.text)
+		if err != nil {
+			t.Fatalf("%s: error parsing: %v", test.name, err)
+		}
+		if mrz.Format != test.format || mrz.DocumentNumber != test.number || !mrz.ExpiryDate.Equal(test.expiry) {
+			t.Errorf("%s: expected %s %s expiring %v, got %s %s expiring %v", test.name,
+				test.format, test.number, test.expiry, mrz.Format, mrz.DocumentNumber, mrz.ExpiryDate)
+		}
+		if mrz.IssuingState != "UTO" || mrz.Nationality != "UTO" || mrz.Sex != "F" ||
+			mrz.Surname != "ERIKSSON" || mrz.GivenNames != "ANNA MARIA" || !mrz.BirthDate.Equal(date(1974, 8, 12)) {
+			t.Errorf("%s: unexpected fields %+v", test.name, mrz)
+		}
+		if !mrz.Valid() || len(mrz.Corrected) != 0 {
+			t.Errorf("%s: expected every check to pass untouched, got %v, corrected %v", test.name, mrz.Checks, mrz.Corrected)
+		}
+	}
+}
+
+// Unit test for fixing look-alike characters that break check digits
+func TestParseMRZCorrections(t *testing.T) {
+	// Noise above the zone, a spaced out first line, O for 0 in the
+	// document number and birth date, I for 1 in the names
+	text := "PASSPORT  PASSEPORT\n" +
+		"P<UTOER1KSSON<<ANNA<MAR1A<<<<<<<<< <<<<<<<<<<\n" +
+		"L8989O2C36UTO74O8122F1204159ZE184226B<<<<<1O\n"
+
+	mrz, err := ParseMRZ(text)
+	if err != nil {
+		t.Fatalf("Error parsing: %v", err)
+	}
+	if mrz.DocumentNumber != "L898902C3" || !mrz.BirthDate.Equal(date(1974, 8, 12)) {
+		t.Errorf("Expected corrected number and birth date, got %s and %v", mrz.DocumentNumber, mrz.BirthDate)
+	}
+	if mrz.Surname != "ERIKSSON" || mrz.GivenNames != "ANNA MARIA" {
+		t.Errorf("Expected corrected names, got %q %q", mrz.Surname, mrz.GivenNames)
+	}
+	if !mrz.Valid() {
+		t.Errorf("Expected every check to pass after corrections, got %v", mrz.Checks)
+	}
+	if strings.Join(mrz.Corrected, ",") != "names,document number,birth date,composite" {
+		t.Errorf("Unexpected corrected fields %v", mrz.Corrected)
+	}
+	if mrz.Lines[1] != "L898902C36UTO7408122F1204159ZE184226B<<<<<10" {
+		t.Errorf("Unexpected corrected line %q", mrz.Lines[1])
+	}
+
+	// A wrong digit can't be fixed and fails its check
+	mrz, err = ParseMRZ("P<UTOERIKSSON<<ANNA<MARIA<<<<<<<<<<<<<<<<<<<\nL898902C36UTO7408132F1204159ZE184226B<<<<<10\n")
+	if err != nil {
+		t.Fatalf("Error parsing: %v", err)
+	}
+	if mrz.Valid() || mrz.Checks[1].Valid {
+		t.Errorf("Expected the birth date check to fail, got %v", mrz.Checks)
+	}
+
+	// Swapping only the first I passes the expiry date check, but not the
+	// composite one
+	mrz, err = ParseMRZ("P<UTOERIKSSON<<ANNA<MARIA<<<<<<<<<<<<<<<<<<<\nL898902C36UTO7408122FI2O4I59ZE184226B<<<<<10\n")
+	if err != nil {
+		t.Fatalf("Error parsing: %v", err)
+	}
+	if !mrz.ExpiryDate.Equal(date(2012, 4, 15)) || !mrz.Valid() || strings.Join(mrz.Corrected, ",") != "expiry date" {
+		t.Errorf("Expected the expiry date corrected to pass both checks, got %v, %v, corrected %v",
+			mrz.ExpiryDate, mrz.Checks, mrz.Corrected)
+	}
+
+	// With a wrong composite check digit, no correction of the document
+	// number is accepted
+	mrz, err = ParseMRZ("P<UTOERIKSSON<<ANNA<MARIA<<<<<<<<<<<<<<<<<<<\nL8989O2C36UTO7408122F1204159ZE184226B<<<<<19\n")
+	if err != nil {
+		t.Fatalf("Error parsing: %v", err)
+	}
+	if mrz.DocumentNumber != "L8989O2C3" || mrz.Checks[0].Valid || len(mrz.Corrected) != 0 {
+		t.Errorf("Expected the document number left as read, got %s, %v, corrected %v",
+			mrz.DocumentNumber, mrz.Checks, mrz.Corrected)
+	}
+}
+
+// Unit test for reading the zone of a passport data page
+func TestMRZReader(t *testing.T) {
+	mrz, err := NewMRZReader().Execute("../../samples/documents/passport.png", "eng")
+	if err != nil {
+		t.Fatalf("Error reading the zone: %v", err)
+	}
+	if mrz.Format != MRZFormatTD3 || mrz.DocumentNumber != "L898902C3" || mrz.Surname != "ERIKSSON" || !mrz.Valid() {
+		t.Errorf("Unexpected zone %+v", mrz)
+	}
+	if mrz.Box.Empty() {
+		t.Errorf("Expected the zone to be located")
+	}
+}
@@ -0,0 +1,324 @@
+package doc
+
+import (
+	"fmt"
+	"image"
+	"sort"
+	"strings"
+
+	img "go-ocr/src/images"
+	"go-ocr/src/pdf"
+
+	"github.com/otiai10/gosseract/v2"
+	"gocv.io/x/gocv"
+	"gopkg.in/gographics/imagick.v3/imagick"
+)
+
+// Resolution used to rasterize PDF pages for OCR. Word boxes of every page,
+// whether they come from the text layer or from OCR, are in pixels at this DPI.
+const renderDPI = 300
+
+// A page needs OCR on top of its text layer once images cover this much of it
+const mixedImageCoverage = 0.25
+
+// Pages where most glyphs can't be mapped to Unicode are treated as image-only
+const maxUnmappedGlyphRatio = 0.5
+
+type OCRMode int
+
+const (
+	// Extract existing text layers and only OCR pages without one
+	OCRModeAuto OCRMode = iota
+	// OCR every page, ignoring any existing text
+	OCRModeForce
+	// Discard invisible text left by an earlier OCR run and OCR every page
+	// again, keeping the visible text
+	OCRModeRedo
+)
+
+type PageSource string
+
+const (
+	PageSourceTextLayer PageSource = "text-layer"
+	PageSourceOCR       PageSource = "ocr"
+	// Text layer words plus OCR of the parts of the page they don't cover
+	PageSourceMixed PageSource = "mixed"
+)
+
+// Word is a single word with its bounding box in page pixels.
+type Word struct {
+	Text       string          `json:"text"`
+	Box        image.Rectangle `json:"box"`
+	Confidence float64         `json:"confidence"`
+}
+
+type Page struct {
+	Index  int        `json:"index"`
+	Width  int        `json:"width"`
+	Height int        `json:"height"`
+	Source PageSource `json:"source"`
+	Words  []Word     `json:"words"`
+	Text   string     `json:"text"`
+	// Barcodes and QR codes on the page, when they were looked for
+	Barcodes []img.Barcode `json:"barcodes,omitempty"`
+}
+
+type PDFTextExtractor struct {
+	tempFolder string
+	mode       OCRMode
+	barcodes   *img.BarcodeDetector
+}
+
+func NewPDFTextExtractor(mode OCRMode) *PDFTextExtractor {
+	return &PDFTextExtractor{tempFolder: "../../temp/", mode: mode}
+}
+
+// WithBarcodes also decodes the barcodes and QR codes of every page, whose
+// payloads are often more reliable than the OCR'd text next to them.
+func (pde *PDFTextExtractor) WithBarcodes(detector *img.BarcodeDetector) *PDFTextExtractor {
+	pde.barcodes = detector
+	return pde
+}
+
+func (pde *PDFTextExtractor) Execute(fileName, lang string) ([]Page, error) {
+	reader, err := pdf.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	pages := make([]Page, 0, reader.NumPages())
+	for i := 0; i < reader.NumPages(); i++ {
+		page, imagePath, err := pde.extractPage(fileName, lang, reader.Page(i))
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %w", i+1, err)
+		}
+		if pde.barcodes != nil {
+			if err := pde.decodeBarcodes(fileName, imagePath, page); err != nil {
+				return nil, fmt.Errorf("page %d: %w", i+1, err)
+			}
+		}
+		pages = append(pages, *page)
+	}
+
+	return pages, nil
+}
+
+// extractPage reads the text of a page, and returns the image it was
+// rendered to for OCR, if any.
+func (pde *PDFTextExtractor) extractPage(fileName, lang string, p pdf.Page) (*Page, string, error) {
+	content, err := p.Analyze()
+	if err != nil {
+		return nil, "", err
+	}
+
+	page := &Page{
+		Index:  p.Index,
+		Width:  pointsToPixels(content.Width),
+		Height: pointsToPixels(content.Height),
+	}
+
+	var visible, invisible []Word
+	for _, w := range content.Words {
+		word := Word{Text: w.Text, Box: rectToPixels(w.Box), Confidence: 100}
+		if w.Invisible {
+			invisible = append(invisible, word)
+		} else {
+			visible = append(visible, word)
+		}
+	}
+
+	extractable := content.Glyphs > 0 &&
+		float64(content.UnmappedGlyphs)/float64(content.Glyphs) < maxUnmappedGlyphRatio
+
+	switch {
+	case pde.mode == OCRModeForce || !extractable || len(visible)+len(invisible) == 0:
+		page.Source = PageSourceOCR
+
+	case pde.mode == OCRModeRedo:
+		// The earlier OCR run may have missed text anywhere on the page, not
+		// only in the images
+		page.Words = visible
+		page.Source = PageSourceOCR
+		if len(visible) > 0 {
+			page.Source = PageSourceMixed
+		}
+
+	case len(visible) == 0:
+		// Only an invisible layer from an earlier OCR run
+		page.Source = PageSourceTextLayer
+		page.Words = invisible
+
+	default:
+		page.Words = append(visible, invisible...)
+		page.Source = PageSourceTextLayer
+		if content.ImageCoverage() >= mixedImageCoverage {
+			page.Source = PageSourceMixed
+		}
+	}
+
+	if page.Source == PageSourceTextLayer {
+		page.Text = wordsToText(page.Words)
+		return page, "", nil
+	}
+
+	imagePath, err := pde.rasterizePage(fileName, p.Index)
+	if err != nil {
+		return nil, "", err
+	}
+	ocrWords, err := recognizeWords(imagePath, lang)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Keep the exact text layer and only add OCR words found elsewhere,
+	// typically inside embedded images
+	for _, w := range ocrWords {
+		if !overlapsAny(w.Box, page.Words) {
+			page.Words = append(page.Words, w)
+		}
+	}
+	page.Text = wordsToText(page.Words)
+
+	return page, imagePath, nil
+}
+
+// decodeBarcodes adds the barcodes found on the page image rendered for
+// OCR, rendering the page only if it had none. Their polygons are in the
+// same pixels as the word boxes.
+func (pde *PDFTextExtractor) decodeBarcodes(fileName, imagePath string, page *Page) error {
+	if imagePath == "" {
+		var err error
+		if imagePath, err = pde.rasterizePage(fileName, page.Index); err != nil {
+			return err
+		}
+	}
+
+	mat := gocv.IMRead(imagePath, gocv.IMReadGrayScale)
+	if mat.Empty() {
+		return fmt.Errorf("failed to read rendered page %s", imagePath)
+	}
+	defer mat.Close()
+
+	page.Barcodes = pde.barcodes.Detect(mat, page.Index)
+	return nil
+}
+
+// rasterizePage renders one page to a grayscale image for Tesseract. The
+// renderer never draws invisible text, so an old OCR layer can't leak into
+// the new result.
+func (pde *PDFTextExtractor) rasterizePage(fileName string, index int) (string, error) {
+	imagick.Initialize()
+	defer imagick.Terminate()
+
+	mw := imagick.NewMagickWand()
+	defer mw.Destroy()
+
+	// Must be *before* ReadImage, this is the rasterization DPI
+	if err := mw.SetResolution(renderDPI, renderDPI); err != nil {
+		return "", fmt.Errorf("failed to set resolution: %w", err)
+	}
+
+	if err := mw.ReadImage(fmt.Sprintf("%s[%d]", fileName, index)); err != nil {
+		return "", fmt.Errorf("failed to render page: %w", err)
+	}
+
+	// Transparent page backgrounds would otherwise turn black
+	white := imagick.NewPixelWand()
+	defer white.Destroy()
+	white.SetColor("white")
+	if err := mw.SetImageBackgroundColor(white); err != nil {
+		return "", fmt.Errorf("failed to set background: %w", err)
+	}
+	if err := mw.SetImageAlphaChannel(imagick.ALPHA_CHANNEL_REMOVE); err != nil {
+		return "", fmt.Errorf("failed to remove alpha channel: %w", err)
+	}
+
+	if err := mw.SetImageColorspace(imagick.COLORSPACE_GRAY); err != nil {
+		return "", fmt.Errorf("failed to set colorspace: %w", err)
+	}
+
+	outPath := fmt.Sprintf("%spdf-page-%d.png", pde.tempFolder, index)
+	if err := mw.WriteImage(outPath); err != nil {
+		return "", fmt.Errorf("failed to save rendered page: %w", err)
+	}
+
+	return outPath, nil
+}
+
+// recognizeWords runs Tesseract on an image and returns its words with boxes.
+func recognizeWords(imagePath, lang string) ([]Word, error) {
+	client := gosseract.NewClient()
+	defer client.Close()
+
+	client.SetLanguage(lang)
+	if err := client.SetImage(imagePath); err != nil {
+		return nil, fmt.Errorf("failed to set image to Tesseract: %w", err)
+	}
+
+	boxes, err := client.GetBoundingBoxes(gosseract.RIL_WORD)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract words: %w", err)
+	}
+
+	words := make([]Word, 0, len(boxes))
+	for _, b := range boxes {
+		if strings.TrimSpace(b.Word) == "" {
+			continue
+		}
+		words = append(words, Word{Text: strings.TrimSpace(b.Word), Box: b.Box, Confidence: b.Confidence})
+	}
+	return words, nil
+}
+
+func pointsToPixels(v float64) int {
+	return int(v*renderDPI/72 + 0.5)
+}
+
+func rectToPixels(r pdf.Rect) image.Rectangle {
+	return image.Rect(pointsToPixels(r.X0), pointsToPixels(r.Y0), pointsToPixels(r.X1), pointsToPixels(r.Y1))
+}
+
+func overlapsAny(box image.Rectangle, words []Word) bool {
+	for _, w := range words {
+		inter := box.Intersect(w.Box)
+		if !inter.Empty() && inter.Dx()*inter.Dy()*2 >= box.Dx()*box.Dy() {
+			return true
+		}
+	}
+	return false
+}
+
+// wordsToText lays words out in reading order, one text line per line of words.
+func wordsToText(words []Word) string {
+	sorted := append([]Word{}, words...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Box.Min.Y < sorted[j].Box.Min.Y
+	})
+
+	var lines [][]Word
+	for _, w := range sorted {
+		if n := len(lines); n > 0 {
+			last := lines[n-1]
+			ref := last[0].Box
+			overlap := min(ref.Max.Y, w.Box.Max.Y) - max(ref.Min.Y, w.Box.Min.Y)
+			if overlap*2 >= min(ref.Dy(), w.Box.Dy()) {
+				lines[n-1] = append(last, w)
+				continue
+			}
+		}
+		lines = append(lines, []Word{w})
+	}
+
+	var sb strings.Builder
+	for _, line := range lines {
+		sort.SliceStable(line, func(i, j int) bool { return line[i].Box.Min.X < line[j].Box.Min.X })
+		for i, w := range line {
+			if i > 0 {
+				sb.WriteString(" ")
+			}
+			sb.WriteString(w.Text)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
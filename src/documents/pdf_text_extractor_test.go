@@ -0,0 +1,75 @@
+package doc
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/signintech/gopdf"
+)
+
+// Writes a PDF with a real text layer and one with only a scanned image
+func generateTestPDFs(t *testing.T) (string, string) {
+	os.MkdirAll("../../output/test/generated-pdf", 0755)
+
+	textPDF := gopdf.GoPdf{}
+	textPDF.Start(gopdf.Config{PageSize: *gopdf.PageSizeA4})
+	textPDF.AddPage()
+	if err := textPDF.AddTTFFont("Arial", "../../fonts/arial.ttf"); err != nil {
+		t.Fatalf("Error loading font: %v", err)
+	}
+	textPDF.SetFont("Arial", "", 14)
+	textPDF.SetXY(72, 100)
+	textPDF.Cell(nil, "Born digital invoice 4711")
+	textPath := "../../output/test/generated-pdf/born-digital.pdf"
+	if err := textPDF.WritePdf(textPath); err != nil {
+		t.Fatalf("Error writing pdf: %v", err)
+	}
+
+	scanPDF := gopdf.GoPdf{}
+	scanPDF.Start(gopdf.Config{PageSize: *gopdf.PageSizeA4})
+	scanPDF.AddPage()
+	if err := scanPDF.Image("../../samples/documents/bill.jpg", 0, 0, gopdf.PageSizeA4); err != nil {
+		t.Fatalf("Error adding image: %v", err)
+	}
+	scanPath := "../../output/test/generated-pdf/scanned.pdf"
+	if err := scanPDF.WritePdf(scanPath); err != nil {
+		t.Fatalf("Error writing pdf: %v", err)
+	}
+
+	return textPath, scanPath
+}
+
+// Unit test for choosing between the text layer and OCR per page
+func TestPDFTextExtraction(t *testing.T) {
+	textPath, scanPath := generateTestPDFs(t)
+
+	tests := []struct {
+		fileName string
+		mode     OCRMode
+		source   PageSource
+	}{
+		{textPath, OCRModeAuto, PageSourceTextLayer},
+		{textPath, OCRModeRedo, PageSourceMixed},
+		{textPath, OCRModeForce, PageSourceOCR},
+		{scanPath, OCRModeAuto, PageSourceOCR},
+	}
+
+	for _, test := range tests {
+		pages, err := NewPDFTextExtractor(test.mode).Execute(test.fileName, "eng")
+		if err != nil {
+			t.Fatalf("Error extracting %s: %v", test.fileName, err)
+		}
+		if len(pages) != 1 || pages[0].Source != test.source {
+			t.Fatalf("For file %s in mode %d, expected one %s page, got %+v", test.fileName, test.mode, test.source, pages)
+		}
+		if len(pages[0].Words) == 0 {
+			t.Errorf("For file %s in mode %d, no words extracted", test.fileName, test.mode)
+		}
+	}
+
+	pages, _ := NewPDFTextExtractor(OCRModeAuto).Execute(textPath, "eng")
+	if strings.TrimSpace(pages[0].Text) != "Born digital invoice 4711" {
+		t.Errorf("Expected the exact text layer, got %q", pages[0].Text)
+	}
+}
@@ -0,0 +1,554 @@
+package doc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go-ocr/src/pdf"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"gocv.io/x/gocv"
+	"golang.org/x/net/html"
+)
+
+// PIIKind is a category of personal information the redactor looks for.
+type PIIKind string
+
+const (
+	PIIEmail       PIIKind = "email"
+	PIIPhone       PIIKind = "phone"
+	PIINationalID  PIIKind = "national-id"
+	PIICardNumber  PIIKind = "card-number"
+	PIITaxID       PIIKind = "tax-id"
+	PIIDateOfBirth PIIKind = "date-of-birth"
+	// Matches of a user supplied regular expression
+	PIICustom PIIKind = "custom"
+	// Words and phrases from a user supplied list
+	PIIWordList PIIKind = "word-list"
+)
+
+// AllPIIKinds are the built-in detectors.
+var AllPIIKinds = []PIIKind{PIIEmail, PIIPhone, PIINationalID, PIICardNumber, PIITaxID, PIIDateOfBirth}
+
+// RedactionRules say what to remove from a document.
+type RedactionRules struct {
+	// Built-in detectors to run, all of them when empty
+	Kinds []PIIKind
+	// Extra expressions, matched against each line of text
+	Patterns []*regexp.Regexp
+	// Words and phrases to remove wherever they appear, ignoring case
+	Words []string
+}
+
+// Redaction is one piece of information removed from a page. The value
+// itself is not kept, only its length and hash, so the audit log can prove
+// what was removed without leaking it.
+type Redaction struct {
+	Kind PIIKind `json:"kind"`
+	// Detector that matched, e.g. "aadhaar" or "gstin"
+	Rule string `json:"rule"`
+	Page int    `json:"page"`
+	// Area blacked out on the page image, in pixels
+	Box image.Rectangle `json:"box"`
+	// Indices of the removed words in the page's original hOCR
+	Words  []int  `json:"words"`
+	Length int    `json:"length"`
+	SHA256 string `json:"sha256"`
+}
+
+type piiDetector struct {
+	kind    PIIKind
+	rule    string
+	pattern *regexp.Regexp
+	// Submatch holding the value to remove, 0 for the whole match
+	group int
+	valid func(string) bool
+}
+
+const datePattern = `\d{1,2}[/.\-]\d{1,2}[/.\-]\d{2,4}|\d{4}[/.\-]\d{1,2}[/.\-]\d{1,2}|` +
+	`\d{1,2}\s+[A-Za-z]{3,9}\.?,?\s+\d{4}|[A-Za-z]{3,9}\.?\s+\d{1,2},?\s+\d{4}`
+
+// Detectors run in this order and a word belongs to the first match that
+// covers it, so the stricter, checksummed formats come before phone numbers.
+var piiDetectors = []piiDetector{
+	{PIIEmail, "email", regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`), 0, nil},
+	{PIICardNumber, "card", regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), 0, luhnValid},
+	{PIINationalID, "ssn", regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`), 0, nil},
+	{PIINationalID, "aadhaar", regexp.MustCompile(`\b[2-9]\d{3}\s?\d{4}\s?\d{4}\b`), 0, verhoeffValid},
+	{PIINationalID, "nino", regexp.MustCompile(`\b[A-CEGHJ-PR-TW-Z][A-CEGHJ-NPR-TW-Z]\s?\d{2}\s?\d{2}\s?\d{2}\s?[A-D]\b`), 0, nil},
+	{PIITaxID, "gstin", regexp.MustCompile(`\b\d{2}[A-Z]{5}\d{4}[A-Z][1-9A-Z]Z[0-9A-Z]\b`), 0, gstinValid},
+	{PIITaxID, "pan", regexp.MustCompile(`\b[A-Z]{3}[ABCFGHJLPT][A-Z]\d{4}[A-Z]\b`), 0, nil},
+	{PIITaxID, "ein", regexp.MustCompile(`\b\d{2}-\d{7}\b`), 0, nil},
+	// Only dates introduced as a birth date, leaving the label readable
+	{PIIDateOfBirth, "dob", regexp.MustCompile(`(?i)\b(?:d\.?o\.?b|date\s+of\s+birth|birth\s*date|born(?:\s+on)?)\.?\s*[:\-]?\s*(` +
+		datePattern + `)`), 1, nil},
+	{PIIPhone, "phone", regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?(?:\(\d{1,4}\)[\s.-]?)?\d[\d\s.-]{6,}\d`), 0, phoneValid},
+}
+
+// FindPII looks for personal information in lines of recognized words and
+// returns what should be redacted, in reading order. Matches never span
+// lines, and a word is redacted whole when any part of it matches.
+func FindPII(lines [][]LayoutWord, rules RedactionRules) []Redaction {
+	kinds := rules.Kinds
+	if len(kinds) == 0 {
+		kinds = AllPIIKinds
+	}
+	var detectors []piiDetector
+	for _, d := range piiDetectors {
+		for _, kind := range kinds {
+			if d.kind == kind {
+				detectors = append(detectors, d)
+			}
+		}
+	}
+	for _, p := range rules.Patterns {
+		detectors = append(detectors, piiDetector{kind: PIICustom, rule: p.String(), pattern: p})
+	}
+
+	var phrases [][]string
+	for _, w := range rules.Words {
+		if fields := strings.Fields(w); len(fields) > 0 {
+			phrases = append(phrases, fields)
+		}
+	}
+
+	var found []Redaction
+	for _, words := range lines {
+		// Where each word starts in the line's text
+		starts := make([]int, len(words))
+		var sb strings.Builder
+		for i, w := range words {
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			starts[i] = sb.Len()
+			sb.WriteString(w.Text)
+		}
+		text := sb.String()
+
+		claimed := make([]bool, len(words))
+		add := func(kind PIIKind, rule string, first, last int, value string) {
+			for i := first; i <= last; i++ {
+				if claimed[i] {
+					return
+				}
+			}
+			r := Redaction{Kind: kind, Rule: rule, Length: len([]rune(value))}
+			for i := first; i <= last; i++ {
+				claimed[i] = true
+				r.Box = r.Box.Union(words[i].Box)
+				r.Words = append(r.Words, words[i].Index)
+			}
+			sum := sha256.Sum256([]byte(value))
+			r.SHA256 = hex.EncodeToString(sum[:])
+			found = append(found, r)
+		}
+
+		for _, d := range detectors {
+			for _, m := range d.pattern.FindAllStringSubmatchIndex(text, -1) {
+				start, end := m[2*d.group], m[2*d.group+1]
+				if start < 0 || start == end {
+					continue
+				}
+				value := text[start:end]
+				if d.valid != nil && !d.valid(value) {
+					continue
+				}
+				first, last := -1, -1
+				for i, w := range words {
+					if starts[i] < end && start < starts[i]+len(w.Text) {
+						if first < 0 {
+							first = i
+						}
+						last = i
+					}
+				}
+				if first < 0 {
+					continue
+				}
+				add(d.kind, d.rule, first, last, value)
+			}
+		}
+
+		for i := range words {
+			for _, phrase := range phrases {
+				if i+len(phrase) > len(words) || !matchesPhrase(words[i:i+len(phrase)], phrase) {
+					continue
+				}
+				add(PIIWordList, "word-list", i, i+len(phrase)-1, strings.Join(phrase, " "))
+			}
+		}
+	}
+
+	return found
+}
+
+// matchesPhrase compares words to a phrase, ignoring case and surrounding
+// punctuation.
+func matchesPhrase(words []LayoutWord, phrase []string) bool {
+	for i, w := range words {
+		text := strings.TrimFunc(w.Text, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsNumber(r) })
+		want := strings.TrimFunc(phrase[i], func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsNumber(r) })
+		if !strings.EqualFold(text, want) {
+			return false
+		}
+	}
+	return true
+}
+
+func digitsOf(s string) []int {
+	var digits []int
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, int(r-'0'))
+		}
+	}
+	return digits
+}
+
+// luhnValid checks the Luhn checksum used by payment card numbers.
+func luhnValid(s string) bool {
+	digits := digitsOf(s)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	for i := range digits {
+		d := digits[len(digits)-1-i]
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+var (
+	verhoeffMultiply = [10][10]int{
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, {1, 2, 3, 4, 0, 6, 7, 8, 9, 5},
+		{2, 3, 4, 0, 1, 7, 8, 9, 5, 6}, {3, 4, 0, 1, 2, 8, 9, 5, 6, 7},
+		{4, 0, 1, 2, 3, 9, 5, 6, 7, 8}, {5, 9, 8, 7, 6, 0, 4, 3, 2, 1},
+		{6, 5, 9, 8, 7, 1, 0, 4, 3, 2}, {7, 6, 5, 9, 8, 2, 1, 0, 4, 3},
+		{8, 7, 6, 5, 9, 3, 2, 1, 0, 4}, {9, 8, 7, 6, 5, 4, 3, 2, 1, 0},
+	}
+	verhoeffPermute = [8][10]int{
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, {1, 5, 7, 6, 2, 8, 3, 0, 9, 4},
+		{5, 8, 0, 3, 7, 9, 6, 1, 4, 2}, {8, 9, 1, 6, 0, 4, 3, 5, 2, 7},
+		{9, 4, 5, 3, 1, 2, 6, 8, 7, 0}, {4, 2, 8, 6, 5, 7, 3, 9, 0, 1},
+		{2, 7, 9, 3, 8, 0, 6, 4, 1, 5}, {7, 0, 4, 6, 9, 1, 3, 2, 5, 8},
+	}
+)
+
+// verhoeffValid checks the Verhoeff checksum of Aadhaar numbers.
+func verhoeffValid(s string) bool {
+	digits := digitsOf(s)
+	c := 0
+	for i := range digits {
+		c = verhoeffMultiply[c][verhoeffPermute[i%8][digits[len(digits)-1-i]]]
+	}
+	return len(digits) == 12 && c == 0
+}
+
+// gstinValid checks the mod 36 check character of an Indian GSTIN.
+func gstinValid(s string) bool {
+	const alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	if len(s) != 15 {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 14; i++ {
+		v := strings.IndexByte(alphabet, s[i])
+		if v < 0 {
+			return false
+		}
+		v *= 1 + i%2
+		sum += v/36 + v%36
+	}
+	return s[14] == alphabet[(36-sum%36)%36]
+}
+
+// phoneValid keeps numbers long enough to be phone numbers rather than
+// amounts, dates or references.
+func phoneValid(s string) bool {
+	n := len(digitsOf(s))
+	return n >= 10 && n <= 15
+}
+
+// ExtractionResult is the JSON form of the text read from a document.
+type ExtractionResult struct {
+	File     string `json:"file"`
+	Language string `json:"language"`
+	Pages    []Page `json:"pages"`
+}
+
+// RedactionResult lists the files written for a redacted document.
+type RedactionResult struct {
+	// Page images with the redacted areas blacked out
+	Images []string
+	// hOCR of each page without the redacted words
+	HOCR       []string
+	Text       string
+	PDF        string
+	JSON       string
+	AuditLog   string
+	Redactions []Redaction
+}
+
+type redactionAudit struct {
+	File       string          `json:"file"`
+	SHA256     string          `json:"sha256"`
+	Time       time.Time       `json:"time"`
+	Kinds      []PIIKind       `json:"kinds"`
+	Patterns   []string        `json:"patterns,omitempty"`
+	Words      int             `json:"wordListSize,omitempty"`
+	Counts     map[PIIKind]int `json:"counts"`
+	Outputs    []string        `json:"outputs"`
+	Redactions []Redaction     `json:"redactions"`
+}
+
+type Redactor struct {
+	tempFolder  string
+	fontsFolder string
+	rules       RedactionRules
+	padding     int
+}
+
+func NewRedactor(fontsFolder string, rules RedactionRules) *Redactor {
+	return &Redactor{tempFolder: "../../temp/", fontsFolder: fontsFolder, rules: rules, padding: 2}
+}
+
+// WithPadding grows every blacked out box by pixels on each side, so no
+// anti-aliased edges of the letters are left.
+func (r *Redactor) WithPadding(pixels int) *Redactor {
+	r.padding = pixels
+	return r
+}
+
+// Execute OCRs the image, removes the personal information found in it and
+// writes redacted page images, hOCR, text, a searchable PDF, a JSON
+// extraction result and an audit log to outDir.
+func (r *Redactor) Execute(fileName, lang, outDir string) (*RedactionResult, error) {
+	// The unredacted hOCR and page images must not outlive the redaction
+	tempFolder, err := os.MkdirTemp(r.tempFolder, "redaction-")
+	if err != nil {
+		return nil, fmt.Errorf("error creating the temp folder: %w", err)
+	}
+	defer os.RemoveAll(tempFolder)
+	tempFolder += "/"
+
+	hte := NewHOCRTextExtractor(r.fontsFolder).WithScan(pdf.ScanOptions{Profile: pdf.ProfileAuto})
+	hte.tempFolder = tempFolder
+
+	pageFiles, err := hte.splitPages(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	base := outDir + strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+	result := &RedactionResult{
+		Text:     base + "-redacted.txt",
+		PDF:      base + "-redacted.pdf",
+		JSON:     base + "-redacted.json",
+		AuditLog: base + "-redaction-audit.json",
+	}
+	extraction := ExtractionResult{File: filepath.Base(fileName), Language: lang}
+
+	var pages []hocrPage
+	var texts []string
+	for i, pageFile := range pageFiles {
+		pageBase := base + "-redacted"
+		if len(pageFiles) > 1 {
+			pageBase = fmt.Sprintf("%s-page-%d-redacted", base, i+1)
+		}
+
+		if err := hte.generateHOCR(pageFile, lang); err != nil {
+			return nil, err
+		}
+		found, hocr, err := r.redactHOCR(tempFolder + "extracted-text.hocr")
+		if err != nil {
+			return nil, err
+		}
+		for j := range found {
+			found[j].Page = i
+		}
+		result.Redactions = append(result.Redactions, found...)
+
+		imageFile := pageBase + ".png"
+		if err := r.burnBoxes(pageFile, found, imageFile); err != nil {
+			return nil, err
+		}
+		hocrFile := pageBase + ".hocr"
+		for _, path := range []string{hocrFile, tempFolder + "redacted-text.hocr"} {
+			if err := os.WriteFile(path, hocr, 0644); err != nil {
+				return nil, err
+			}
+		}
+		result.Images = append(result.Images, imageFile)
+		result.HOCR = append(result.HOCR, hocrFile)
+
+		page, err := hte.readPage(imageFile, "redacted-text.hocr")
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %w", i+1, err)
+		}
+		pages = append(pages, *page)
+
+		extracted := Page{Index: i, Width: int(page.width), Height: int(page.height), Source: PageSourceOCR}
+		var blockTexts []string
+		for _, block := range page.blocks {
+			for _, line := range block.TextLines() {
+				for _, w := range line {
+					extracted.Words = append(extracted.Words, Word{Text: w.Text, Box: w.Box, Confidence: w.Confidence})
+				}
+			}
+			blockTexts = append(blockTexts, block.Text())
+		}
+		extracted.Text = strings.Join(blockTexts, "\n\n")
+		extraction.Pages = append(extraction.Pages, extracted)
+		texts = append(texts, extracted.Text)
+	}
+
+	if err := os.WriteFile(result.Text, []byte(strings.Join(texts, "\n\f\n")+"\n"), 0644); err != nil {
+		return nil, err
+	}
+	if err := writeJSON(result.JSON, extraction); err != nil {
+		return nil, err
+	}
+	if err := hte.generatePDF(fileName, lang, result.PDF, pages); err != nil {
+		return nil, err
+	}
+
+	return result, r.writeAudit(fileName, result)
+}
+
+// redactHOCR finds personal information in an hOCR file and returns it
+// along with the hOCR without the redacted words.
+func (r *Redactor) redactHOCR(hocrFilePath string) ([]Redaction, []byte, error) {
+	data, err := os.ReadFile(hocrFilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	blocks, err := AnalyzeLayout(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	var lines [][]LayoutWord
+	for _, block := range blocks {
+		lines = append(lines, block.TextLines()...)
+	}
+	found := FindPII(lines, r.rules)
+
+	root, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing hocr: %w", err)
+	}
+	removed := map[int]bool{}
+	for _, f := range found {
+		for _, w := range f.Words {
+			removed[w] = true
+		}
+	}
+	removeWords(root, removed)
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, root); err != nil {
+		return nil, nil, err
+	}
+	return found, buf.Bytes(), nil
+}
+
+// removeWords deletes the ocrx_word elements at the given reading order
+// indices, counted the same way AnalyzeLayout does.
+func removeWords(root *html.Node, words map[int]bool) {
+	index := 0
+	var remove []*html.Node
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && hasClass(n, "ocrx_word") {
+			if words[index] {
+				remove = append(remove, n)
+			}
+			index++
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+
+	for _, n := range remove {
+		n.Parent.RemoveChild(n)
+	}
+}
+
+// burnBoxes fills the redacted areas of an image with black and saves it
+// losslessly, so nothing of the original pixels survives.
+func (r *Redactor) burnBoxes(fileName string, found []Redaction, outFile string) error {
+	img := gocv.IMRead(fileName, gocv.IMReadColor)
+	if img.Empty() {
+		return fmt.Errorf("failed to read image %s", fileName)
+	}
+	defer img.Close()
+
+	bounds := image.Rect(0, 0, img.Cols(), img.Rows())
+	for _, f := range found {
+		gocv.Rectangle(&img, f.Box.Inset(-r.padding).Intersect(bounds), color.RGBA{0, 0, 0, 255}, -1)
+	}
+
+	if ok := gocv.IMWrite(outFile, img); !ok {
+		return fmt.Errorf("failed to write image %s", outFile)
+	}
+	return nil
+}
+
+func (r *Redactor) writeAudit(fileName string, result *RedactionResult) error {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+
+	audit := redactionAudit{
+		File:       filepath.Base(fileName),
+		SHA256:     hex.EncodeToString(sum[:]),
+		Time:       time.Now().UTC(),
+		Kinds:      r.rules.Kinds,
+		Words:      len(r.rules.Words),
+		Counts:     map[PIIKind]int{},
+		Redactions: result.Redactions,
+	}
+	if len(audit.Kinds) == 0 {
+		audit.Kinds = AllPIIKinds
+	}
+	for _, p := range r.rules.Patterns {
+		audit.Patterns = append(audit.Patterns, p.String())
+	}
+	for _, f := range result.Redactions {
+		audit.Counts[f.Kind]++
+	}
+	audit.Outputs = append(append(audit.Outputs, result.Images...), result.HOCR...)
+	audit.Outputs = append(audit.Outputs, result.Text, result.PDF, result.JSON)
+
+	return writeJSON(result.AuditLog, audit)
+}
+
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
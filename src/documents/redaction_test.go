@@ -0,0 +1,183 @@
+package doc
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// testLine turns a line of text into words 10 pixels wide per character
+func testLine(text string, first int) []LayoutWord {
+	var words []LayoutWord
+	x := 0
+	for i, w := range strings.Fields(text) {
+		words = append(words, LayoutWord{Index: first + i, Text: w, Box: image.Rect(x, 0, x+10*len(w), 20)})
+		x += 10*len(w) + 10
+	}
+	return words
+}
+
+// Unit test for detecting personal information in OCR'd lines
+func TestFindPII(t *testing.T) {
+	lines := []string{
+		"Contact jane.doe@example.com or +91 98765 43210",
+		"Card 4111 1111 1111 1111 expires 12/27",
+		"Card 4111 1111 1111 1112 is not a card",
+		"SSN 123-45-6789 Aadhaar 2345 6789 0124",
+		"GSTIN 27AAPFU0939F1ZV PAN ABCPE1234F",
+		"GSTIN 27AAPFU0939F1ZX has a bad check character",
+		"DOB: 12/03/1985 joined 01/02/2020",
+		"Invoice 2024-01-15 total 1,250.00",
+	}
+	var input [][]LayoutWord
+	for i, line := range lines {
+		input = append(input, testLine(line, i*100))
+	}
+
+	found := FindPII(input, RedactionRules{})
+
+	expected := []struct {
+		rule  string
+		words []int
+	}{
+		{"email", []int{1}},
+		{"phone", []int{3, 4, 5}},
+		{"card", []int{101, 102, 103, 104}},
+		{"ssn", []int{301}},
+		{"aadhaar", []int{303, 304, 305}},
+		{"gstin", []int{401}},
+		{"pan", []int{403}},
+		{"dob", []int{601}},
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("Expected %d redactions, got %d: %+v", len(expected), len(found), found)
+	}
+	for i, want := range expected {
+		got := found[i]
+		if got.Rule != want.rule || !equalInts(got.Words, want.words) {
+			t.Errorf("Redaction %d: expected %s %v, got %s %v", i, want.rule, want.words, got.Rule, got.Words)
+		}
+	}
+
+	// The value is hashed, never kept
+	if found[0].Length != len("jane.doe@example.com") || len(found[0].SHA256) != 64 {
+		t.Errorf("Unexpected length %d and hash %q", found[0].Length, found[0].SHA256)
+	}
+	// Boxes cover all the words of a match
+	if box := found[2].Box; box.Min.X != 50 || box.Max.X != 240 {
+		t.Errorf("Expected the card box to span x 50-240, got %v", box)
+	}
+}
+
+// Unit test for restricting detectors and adding patterns and word lists
+func TestFindPIIRules(t *testing.T) {
+	input := [][]LayoutWord{
+		testLine("Patient John Smith, ref MRN-00123, mail john@example.com", 0),
+		testLine("Seen by Dr. john smith", 10),
+	}
+
+	found := FindPII(input, RedactionRules{
+		Kinds:    []PIIKind{PIIPhone},
+		Patterns: []*regexp.Regexp{regexp.MustCompile(`MRN-\d+`)},
+		Words:    []string{"John Smith"},
+	})
+
+	var got []string
+	for _, f := range found {
+		got = append(got, string(f.Kind))
+	}
+	if strings.Join(got, ",") != "custom,word-list,word-list" {
+		t.Fatalf("Expected a custom match and two word list matches, got %v", got)
+	}
+	if !equalInts(found[1].Words, []int{1, 2}) || !equalInts(found[2].Words, []int{13, 14}) {
+		t.Errorf("Unexpected word list matches %v and %v", found[1].Words, found[2].Words)
+	}
+}
+
+// Unit test for the checksums that keep random digits from being redacted
+func TestPIIChecksums(t *testing.T) {
+	checks := []struct {
+		name  string
+		valid func(string) bool
+		value string
+		want  bool
+	}{
+		{"luhn", luhnValid, "4111-1111-1111-1111", true},
+		{"luhn", luhnValid, "4111-1111-1111-1121", false},
+		{"luhn", luhnValid, "0000 0000 0000", false},
+		{"verhoeff", verhoeffValid, "234567890124", true},
+		{"verhoeff", verhoeffValid, "234567890142", false},
+		{"gstin", gstinValid, "27AAPFU0939F1ZV", true},
+		{"gstin", gstinValid, "27AAPFU0939F1ZW", false},
+		{"phone", phoneValid, "020 7946 0958", true},
+		{"phone", phoneValid, "1 250 000", false},
+	}
+	for _, c := range checks {
+		if got := c.valid(c.value); got != c.want {
+			t.Errorf("%s(%q) = %v, expected %v", c.name, c.value, got, c.want)
+		}
+	}
+}
+
+// Unit test for dropping redacted words from hOCR
+func TestRemoveWords(t *testing.T) {
+	root, err := html.Parse(strings.NewReader(layoutTestHOCR))
+	if err != nil {
+		t.Fatalf("Error parsing hocr: %v", err)
+	}
+	removeWords(root, map[int]bool{0: true, 15: true})
+
+	var sb strings.Builder
+	if err := html.Render(&sb, root); err != nil {
+		t.Fatalf("Error rendering hocr: %v", err)
+	}
+	blocks, err := AnalyzeLayout(strings.NewReader(sb.String()))
+	if err != nil {
+		t.Fatalf("Error analyzing layout: %v", err)
+	}
+	if text := blocks[0].Text(); text != "Report" {
+		t.Errorf("Expected the heading to read %q, got %q", "Report", text)
+	}
+	for _, block := range blocks {
+		if strings.Contains(block.Text(), "120") {
+			t.Errorf("Removed word still present in %q", block.Text())
+		}
+	}
+}
+
+// Unit test for redacting a resume without leaving unredacted files behind
+func TestRedactor(t *testing.T) {
+	outDir := t.TempDir() + "/"
+	result, err := NewRedactor("../../fonts/", RedactionRules{}).Execute("../../samples/documents/Eric_BROOKS-Resume.jpg", "eng", outDir)
+	if err != nil {
+		t.Fatalf("Error redacting the resume: %v", err)
+	}
+	if len(result.Redactions) == 0 {
+		t.Errorf("Expected the contact details to be redacted")
+	}
+	for _, file := range append(result.Images, result.PDF, result.AuditLog) {
+		if _, err := os.Stat(file); err != nil {
+			t.Errorf("Expected %s to be written: %v", file, err)
+		}
+	}
+	if left, _ := filepath.Glob("../../temp/redaction-*"); len(left) != 0 {
+		t.Errorf("Expected the temp files to be removed, found %v", left)
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -1,28 +1,179 @@
 package doc
 
 import (
+	"errors"
+	"fmt"
+	img "go-ocr/src/images"
 	"image"
 	"log"
+	"strings"
 
 	"github.com/otiai10/gosseract/v2"
 	"gocv.io/x/gocv"
 	"gopkg.in/gographics/imagick.v3/imagick"
 )
 
+// ErrPageRejected is returned by Extract when the quality gate fails a
+// page. The QualityReports tell why.
+var ErrPageRejected = errors.New("page rejected by the quality gate")
+
 type PlainTextExtractor struct {
 	tempFolder string
+	flattener  *img.PageFlattener
+	stamps     *img.StampDetector
+	cleaner    *img.BackgroundCleaner
+	polarity   *img.PolarityNormalizer
+	lines      *img.LineRemover
+	ruled      []img.RuledLine
+	quality    *img.QualityAnalyzer
+	failFast   bool
+	reports    []img.QualityReport
+	upscaler   *img.Upscaler
+	upscaling  img.Upscaling
 }
 
 func NewPlainTextExtractor() *PlainTextExtractor {
-	return &PlainTextExtractor{"../../temp/"}
+	return &PlainTextExtractor{tempFolder: "../../temp/"}
+}
+
+// WithPageFlattening cuts the page out of phone photos and corrects their
+// perspective before the text is read.
+func (pte *PlainTextExtractor) WithPageFlattening(flattener *img.PageFlattener) *PlainTextExtractor {
+	pte.flattener = flattener
+	return pte
+}
+
+// WithStampRemoval paints over colored stamps and seals before the text
+// is read, so the text under them isn't garbled.
+func (pte *PlainTextExtractor) WithStampRemoval(detector *img.StampDetector) *PlainTextExtractor {
+	pte.stamps = detector
+	return pte
+}
+
+// WithBackgroundCleaning evens out the light and removes the background
+// and watermarks of the page, as the cleaner's steps say, before the text
+// is read.
+func (pte *PlainTextExtractor) WithBackgroundCleaning(cleaner *img.BackgroundCleaner) *PlainTextExtractor {
+	pte.cleaner = cleaner
+	return pte
+}
+
+// WithPolarityCorrection turns white text on colored bars, and colored
+// text on colored backgrounds, into dark text on white before the text is
+// read. Tesseract skips most of it otherwise.
+func (pte *PlainTextExtractor) WithPolarityCorrection(normalizer *img.PolarityNormalizer) *PlainTextExtractor {
+	pte.polarity = normalizer
+	return pte
+}
+
+// WithLineRemoval takes form lines, table borders and underlines off the
+// page before the text is read, keeping the characters that cross them.
+func (pte *PlainTextExtractor) WithLineRemoval(remover *img.LineRemover) *PlainTextExtractor {
+	pte.lines = remover
+	return pte
+}
+
+// RuledLines returns the lines removed from the pages of the last Execute,
+// e.g. for img.TableCells. Only found WithLineRemoval.
+func (pte *PlainTextExtractor) RuledLines() []img.RuledLine {
+	return pte.ruled
+}
+
+// WithQualityGate rates the pages before any work is done on them, see
+// QualityReports. With failFast, a page outside the fail limits stops the
+// extraction with ErrPageRejected.
+func (pte *PlainTextExtractor) WithQualityGate(analyzer *img.QualityAnalyzer, failFast bool) *PlainTextExtractor {
+	pte.quality = analyzer
+	pte.failFast = failFast
+	return pte
+}
+
+// QualityReports returns the ratings of the pages of the last Execute,
+// only made WithQualityGate.
+func (pte *PlainTextExtractor) QualityReports() []img.QualityReport {
+	return pte.reports
+}
+
+// WithUpscaling enlarges pages whose text is too small for Tesseract,
+// e.g. 72 DPI photos, before the text is read.
+func (pte *PlainTextExtractor) WithUpscaling(upscaler *img.Upscaler) *PlainTextExtractor {
+	pte.upscaler = upscaler
+	return pte
 }
 
+// Upscaling returns how the page of the last Execute was enlarged, only
+// set WithUpscaling.
+func (pte *PlainTextExtractor) Upscaling() img.Upscaling {
+	return pte.upscaling
+}
+
+// Execute reads the text of an image, exiting on any error, rejected pages
+// included. Extract returns the errors instead.
 func (pte *PlainTextExtractor) Execute(fileName string, lang string) string {
-	err := pte.preProcessImage(fileName)
+	text, err := pte.Extract(fileName, lang)
 	if err != nil {
-		log.Fatal("Failed to preprocess image:", err)
+		log.Fatal(err)
 		return err.Error()
 	}
+	return text
+}
+
+// Extract reads the text of an image, preparing the page as the options
+// say first.
+func (pte *PlainTextExtractor) Extract(fileName string, lang string) (string, error) {
+	if pte.quality != nil {
+		reports, err := pte.quality.Execute(fileName)
+		if err != nil {
+			return "", fmt.Errorf("error assessing the image quality: %w", err)
+		}
+		pte.reports = reports
+		for _, report := range reports {
+			if !report.Passed() && pte.failFast {
+				return "", fmt.Errorf("%w: page %d (%s)", ErrPageRejected, report.Page+1,
+					strings.Join(report.Reasons(), ", "))
+			}
+		}
+	}
+	if pte.flattener != nil {
+		page, err := pte.flattener.Execute(fileName, pte.tempFolder)
+		if err != nil {
+			return "", fmt.Errorf("error flattening the page: %w", err)
+		}
+		fileName = page.File
+	}
+	if pte.stamps != nil {
+		clean, _, err := pte.stamps.RemoveStamps(fileName, pte.tempFolder)
+		if err != nil {
+			return "", fmt.Errorf("error removing the stamps: %w", err)
+		}
+		fileName = clean
+	}
+	if pte.cleaner != nil {
+		clean, err := pte.cleaner.Execute(fileName, pte.tempFolder)
+		if err != nil {
+			return "", fmt.Errorf("error cleaning the background: %w", err)
+		}
+		fileName = clean
+	}
+	if pte.polarity != nil {
+		normalized, _, err := pte.polarity.Execute(fileName, pte.tempFolder)
+		if err != nil {
+			return "", fmt.Errorf("error correcting the text polarity: %w", err)
+		}
+		fileName = normalized
+	}
+	if pte.lines != nil {
+		clean, lines, err := pte.lines.Execute(fileName, pte.tempFolder)
+		if err != nil {
+			return "", fmt.Errorf("error removing the lines: %w", err)
+		}
+		fileName = clean
+		pte.ruled = lines
+	}
+
+	if err := pte.preProcessImage(fileName); err != nil {
+		return "", fmt.Errorf("error preprocessing the image: %w", err)
+	}
 
 	// Now we will use Tesseract to extract text from the processed image
 	client := gosseract.NewClient()
@@ -31,20 +182,17 @@ func (pte *PlainTextExtractor) Execute(fileName string, lang string) string {
 	client.SetLanguage(lang)
 
 	// Set the image to Tesseract
-	err = client.SetImage(pte.tempFolder + "processed-image.jpg")
-	if err != nil {
-		log.Fatal("Failed to set image to Tesseract:", err)
-		return err.Error()
+	if err := client.SetImage(pte.tempFolder + "processed-image.jpg"); err != nil {
+		return "", fmt.Errorf("error setting the image to Tesseract: %w", err)
 	}
 
 	// Extract text
 	text, err := client.Text()
 	if err != nil {
-		log.Fatal("Failed to extract text:", err)
-		return err.Error()
+		return "", fmt.Errorf("error extracting the text: %w", err)
 	}
 
-	return text
+	return text, nil
 }
 
 func (pte *PlainTextExtractor) preProcessImage(fileName string) error {
@@ -58,49 +206,51 @@ func (pte *PlainTextExtractor) preProcessImage(fileName string) error {
 	// Must be *before* ReadImageFile
 	// Make sure our image is high quality
 	if err := mw.SetResolution(300, 300); err != nil {
-		log.Fatal("Failed to set image resolution:", err)
-		return err
+		return fmt.Errorf("error setting the image resolution: %w", err)
 	}
 
 	err := mw.ReadImage(fileName)
 	if err != nil {
-		log.Fatal("Failed to read image:", err)
-		return err
+		return fmt.Errorf("error reading the image: %w", err)
 	}
 
 	// Must be *after* ReadImageFile
 	// Flatten image and remove alpha channel, to prevent alpha turning black in jpg
 	if err := mw.SetImageAlphaChannel(imagick.ALPHA_CHANNEL_REMOVE); err != nil {
-		log.Fatal("Failed to set alpha channel:", err)
-		return err
+		return fmt.Errorf("error removing the alpha channel: %w", err)
 	}
 
 	// Set any compression (100 = max quality)
 	if err := mw.SetCompressionQuality(95); err != nil {
-		log.Fatal("Unable to set compression quality:", err)
-		return err
+		return fmt.Errorf("error setting the compression quality: %w", err)
 	}
 
 	// Optionally, convert or process the image with ImageMagick if necessary.
 	// Example: convert image to grayscale
 	err = mw.SetImageColorspace(imagick.COLORSPACE_GRAY)
 	if err != nil {
-		log.Fatal("Failed to set colorspace:", err)
-		return err
+		return fmt.Errorf("error setting the colorspace: %w", err)
 	}
 
 	// Save the processed image
 	err = mw.WriteImage(pte.tempFolder + "processed-image.jpg")
 	if err != nil {
-		log.Fatal("Failed to save processed image:", err)
-		return err
+		return fmt.Errorf("error saving the processed image: %w", err)
+	}
+
+	// Resolution metadata doesn't enlarge the pixels of raster images, so
+	// small text is upscaled here
+	if pte.upscaler != nil {
+		pte.upscaling, err = pte.upscaler.UpscaleFile(pte.tempFolder+"processed-image.jpg", pte.tempFolder+"processed-image.jpg")
+		if err != nil {
+			return fmt.Errorf("error upscaling the image: %w", err)
+		}
 	}
 
 	// Load image using OpenCV for further processing
 	img := gocv.IMRead(pte.tempFolder+"processed-image.jpg", gocv.IMReadColor)
 	if img.Empty() {
-		log.Fatal("Could not read the image")
-		return nil
+		return fmt.Errorf("error reading the processed image")
 	}
 	defer img.Close()
 
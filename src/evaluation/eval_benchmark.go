@@ -0,0 +1,230 @@
+package evaluation
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BenchmarkDocument is an image of a dataset with its ground truth.
+type BenchmarkDocument struct {
+	Image string `json:"image" yaml:"image"`
+	// The text of the image, a file
+	Text string `json:"text" yaml:"text"`
+	// Tesseract language, the default of RunBenchmark when empty
+	Language string `json:"language,omitempty" yaml:"language,omitempty"`
+	// Values that must be read, e.g. an invoice number, by field name
+	Fields map[string]string `json:"fields,omitempty" yaml:"fields,omitempty"`
+}
+
+// Name is the file name of the image.
+func (bd BenchmarkDocument) Name() string {
+	return filepath.Base(bd.Image)
+}
+
+// BenchmarkConfig is a named set of preprocessing and engine settings, the
+// options of PLAIN_TEXT_EXTRACTION.
+type BenchmarkConfig struct {
+	Name         string   `json:"name" yaml:"name"`
+	Flatten      bool     `json:"flatten,omitempty" yaml:"flatten,omitempty"`
+	Dewarp       bool     `json:"dewarp,omitempty" yaml:"dewarp,omitempty"`
+	RemoveStamps bool     `json:"removeStamps,omitempty" yaml:"removeStamps,omitempty"`
+	Clean        []string `json:"clean,omitempty" yaml:"clean,omitempty"`
+	FixPolarity  bool     `json:"fixPolarity,omitempty" yaml:"fixPolarity,omitempty"`
+	RemoveLines  bool     `json:"removeLines,omitempty" yaml:"removeLines,omitempty"`
+	// "lanczos", "espcn" or "fsrcnn"
+	Upscale      string `json:"upscale,omitempty" yaml:"upscale,omitempty"`
+	UpscaleModel string `json:"upscaleModel,omitempty" yaml:"upscaleModel,omitempty"`
+	ModelScale   int    `json:"modelScale,omitempty" yaml:"modelScale,omitempty"`
+	// Replaces the language of every document
+	Language string `json:"language,omitempty" yaml:"language,omitempty"`
+}
+
+// Manifest is a dataset and the configurations to compare on it.
+type Manifest struct {
+	Documents []BenchmarkDocument `json:"documents" yaml:"documents"`
+	Configs   []BenchmarkConfig   `json:"configs" yaml:"configs"`
+}
+
+// LoadManifest reads a manifest from a .json, .yaml or .yml file and
+// checks it. The paths of the images and texts are made relative to the
+// working directory. Without configurations, a "baseline" one with no
+// preprocessing is run.
+func LoadManifest(fileName string) (*Manifest, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the manifest: %w", err)
+	}
+
+	manifest := &Manifest{}
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".json":
+		err = json.Unmarshal(data, manifest)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, manifest)
+	default:
+		return nil, fmt.Errorf("unknown manifest format %s, use .json, .yaml or .yml", filepath.Ext(fileName))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the manifest %s: %w", fileName, err)
+	}
+
+	dir := filepath.Dir(fileName)
+	for i := range manifest.Documents {
+		document := &manifest.Documents[i]
+		for _, path := range []*string{&document.Image, &document.Text} {
+			if *path != "" && !filepath.IsAbs(*path) {
+				*path = filepath.Join(dir, *path)
+			}
+		}
+	}
+	if len(manifest.Configs) == 0 {
+		manifest.Configs = []BenchmarkConfig{{Name: "baseline"}}
+	}
+	if err := manifest.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", fileName, err)
+	}
+	return manifest, nil
+}
+
+// Validate checks that every document has an image and a text, and that
+// the configurations have distinct names.
+func (m *Manifest) Validate() error {
+	if len(m.Documents) == 0 {
+		return fmt.Errorf("no documents")
+	}
+	for i, document := range m.Documents {
+		if document.Image == "" || document.Text == "" {
+			return fmt.Errorf("document %d needs an image and a text", i+1)
+		}
+	}
+	names := map[string]bool{}
+	for i, config := range m.Configs {
+		if config.Name == "" {
+			return fmt.Errorf("configuration %d has no name", i+1)
+		}
+		if names[config.Name] {
+			return fmt.Errorf("configuration %q is defined twice", config.Name)
+		}
+		names[config.Name] = true
+	}
+	return nil
+}
+
+// Select keeps the configurations with the given names, in that order.
+func (m *Manifest) Select(names ...string) error {
+	var configs []BenchmarkConfig
+	for _, name := range names {
+		i := slices.IndexFunc(m.Configs, func(c BenchmarkConfig) bool { return c.Name == name })
+		if i < 0 {
+			return fmt.Errorf("no configuration %q in the manifest", name)
+		}
+		configs = append(configs, m.Configs[i])
+	}
+	m.Configs = configs
+	return nil
+}
+
+// Extractor reads the text of a document in the given language with the
+// settings of a configuration.
+type Extractor func(config BenchmarkConfig, document BenchmarkDocument, language string) (string, error)
+
+// BenchmarkResult is how a configuration did on the whole dataset.
+type BenchmarkResult struct {
+	Config BenchmarkConfig `json:"config"`
+	Text   *TextReport     `json:"text"`
+	// Share of the annotated field values found in the text, 1 when no
+	// document has fields
+	FieldAccuracy float64 `json:"fieldAccuracy"`
+	Fields        int     `json:"fields"`
+	FieldsFound   int     `json:"fieldsFound"`
+	// Extraction time per document
+	MeanLatency time.Duration `json:"meanLatency"`
+	P95Latency  time.Duration `json:"p95Latency"`
+	// Largest increase of the resident memory of the process while the
+	// configuration ran, native libraries included, over the memory held
+	// when it started, in bytes
+	PeakMemoryIncrease uint64 `json:"peakMemoryIncrease"`
+	// Documents that couldn't be read, scored as empty texts
+	Failures []string `json:"failures,omitempty"`
+}
+
+// RunBenchmark extracts every document of the manifest with every
+// configuration and scores the texts. Documents without a language are
+// read in the given one.
+func RunBenchmark(manifest *Manifest, extract Extractor, language string, options TextOptions) []BenchmarkResult {
+	var results []BenchmarkResult
+	for _, config := range manifest.Configs {
+		result := BenchmarkResult{Config: config, Text: NewTextReport(options)}
+		var latencies []time.Duration
+
+		memory := sampleMemory(10 * time.Millisecond)
+		for _, document := range manifest.Documents {
+			lang := language
+			if document.Language != "" {
+				lang = document.Language
+			}
+			if config.Language != "" {
+				lang = config.Language
+			}
+
+			start := time.Now()
+			text, err := extract(config, document, lang)
+			latencies = append(latencies, time.Since(start))
+			if err != nil {
+				result.Failures = append(result.Failures, fmt.Sprintf("%s: %v", document.Name(), err))
+				text = ""
+			}
+
+			if _, err := result.Text.AddFile(document.Name(), document.Text, text); err != nil {
+				result.Failures = append(result.Failures, fmt.Sprintf("%s: %v", document.Name(), err))
+			}
+			for _, value := range document.Fields {
+				result.Fields++
+				if containsField(text, value, options) {
+					result.FieldsFound++
+				}
+			}
+		}
+		result.PeakMemoryIncrease = memory()
+
+		result.FieldAccuracy = 1
+		if result.Fields > 0 {
+			result.FieldAccuracy = float64(result.FieldsFound) / float64(result.Fields)
+		}
+		result.MeanLatency, result.P95Latency = latencyStats(latencies)
+		results = append(results, result)
+	}
+	return results
+}
+
+// containsField tells if a field value is in a text, both normalized the
+// same way and with any whitespace as one space.
+func containsField(text, value string, options TextOptions) bool {
+	collapse := func(s string) string { return strings.Join(strings.Fields(options.normalize(s)), " ") }
+	value = collapse(value)
+	return value != "" && strings.Contains(collapse(text), value)
+}
+
+// latencyStats returns the mean and the 95th percentile of the latencies.
+func latencyStats(latencies []time.Duration) (time.Duration, time.Duration) {
+	if len(latencies) == 0 {
+		return 0, 0
+	}
+	sorted := slices.Clone(latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var total time.Duration
+	for _, latency := range sorted {
+		total += latency
+	}
+	// Nearest rank
+	rank := (95*len(sorted) + 99) / 100
+	return total / time.Duration(len(sorted)), sorted[rank-1]
+}
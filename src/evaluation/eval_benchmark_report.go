@@ -0,0 +1,88 @@
+package evaluation
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var benchmarkColumns = []string{"Config", "CER", "WER", "Bag-of-words WER", "Field accuracy", "Mean latency", "P95 latency",
+	"Peak memory increase (MB)", "Failures"}
+
+// benchmarkRow formats the columns of a result, percentages without the
+// sign when plain is set, for CSV.
+func benchmarkRow(result BenchmarkResult, plain bool) []string {
+	percent := func(rate float64) string {
+		if plain {
+			return strconv.FormatFloat(100*rate, 'f', 2, 64)
+		}
+		return fmt.Sprintf("%.2f%%", 100*rate)
+	}
+	milliseconds := func(d time.Duration) string {
+		if plain {
+			return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 0, 64)
+		}
+		return d.Round(time.Millisecond).String()
+	}
+	return []string{result.Config.Name, percent(result.Text.Total.CER), percent(result.Text.Total.WER),
+		percent(result.Text.Total.BagOfWords.ErrorRate), percent(result.FieldAccuracy),
+		milliseconds(result.MeanLatency), milliseconds(result.P95Latency),
+		strconv.FormatFloat(float64(result.PeakMemoryIncrease)/(1<<20), 'f', 1, 64), strconv.Itoa(len(result.Failures))}
+}
+
+// WriteBenchmarkMarkdown writes the results as a table, a row per
+// configuration, followed by the scores of every document.
+func WriteBenchmarkMarkdown(w io.Writer, results []BenchmarkResult) error {
+	var out strings.Builder
+	out.WriteString("| " + strings.Join(benchmarkColumns, " | ") + " |\n")
+	out.WriteString(strings.Repeat("|---", len(benchmarkColumns)) + "|\n")
+	for _, result := range results {
+		out.WriteString("| " + strings.Join(benchmarkRow(result, false), " | ") + " |\n")
+	}
+
+	for _, result := range results {
+		fmt.Fprintf(&out, "\n### %s\n\n| Document | CER | WER | Bag-of-words WER |\n|---|---|---|---|\n", result.Config.Name)
+		for _, document := range result.Text.Documents {
+			fmt.Fprintf(&out, "| %s | %.2f%% | %.2f%% | %.2f%% |\n", document.Name, 100*document.CER, 100*document.WER,
+				100*document.BagOfWords.ErrorRate)
+		}
+		for _, failure := range result.Failures {
+			fmt.Fprintf(&out, "\nFailed: %s\n", failure)
+		}
+	}
+	if _, err := io.WriteString(w, out.String()); err != nil {
+		return fmt.Errorf("error writing the benchmark: %w", err)
+	}
+	return nil
+}
+
+// WriteBenchmarkCSV writes a row per configuration, rates in percent and
+// latencies in milliseconds.
+func WriteBenchmarkCSV(w io.Writer, results []BenchmarkResult) error {
+	writer := csv.NewWriter(w)
+	header := append([]string(nil), benchmarkColumns...)
+	header[5], header[6] = "Mean latency (ms)", "P95 latency (ms)"
+	writer.Write(header)
+	for _, result := range results {
+		writer.Write(benchmarkRow(result, true))
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing the benchmark: %w", err)
+	}
+	return nil
+}
+
+// WriteBenchmarkJSON writes the results with every document's scores.
+func WriteBenchmarkJSON(w io.Writer, results []BenchmarkResult) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(results); err != nil {
+		return fmt.Errorf("error writing the benchmark: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package evaluation
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Unit test for loading the sample dataset manifest
+func TestLoadManifest(t *testing.T) {
+	manifest, err := LoadManifest("../../samples/benchmark/manifest.yaml")
+	if err != nil {
+		t.Fatalf("Error loading the manifest: %v", err)
+	}
+	if len(manifest.Documents) != 6 || len(manifest.Configs) != 3 {
+		t.Fatalf("Expected 6 documents and 3 configurations, got %+v", manifest)
+	}
+	for _, document := range manifest.Documents {
+		if _, err := os.Stat(document.Image); err != nil {
+			t.Errorf("Expected the image path relative to the manifest, got %s", document.Image)
+		}
+		if _, err := os.Stat(document.Text); err != nil {
+			t.Errorf("Expected the text path relative to the manifest, got %s", document.Text)
+		}
+	}
+	if fields := manifest.Documents[2].Fields; fields["invoiceNumber"] != "SIBHI-FY23-21142" {
+		t.Errorf("Expected the invoice number of the bill, got %v", fields)
+	}
+	if cleaned := manifest.Configs[1]; !cleaned.FixPolarity || !cleaned.RemoveLines || len(cleaned.Clean) != 3 {
+		t.Errorf("Expected the cleaned configuration, got %+v", cleaned)
+	}
+
+	if err := manifest.Select("upscaled", "baseline"); err != nil || manifest.Configs[0].Name != "upscaled" || len(manifest.Configs) != 2 {
+		t.Errorf("Expected the upscaled and baseline configurations, got %+v %v", manifest.Configs, err)
+	}
+	if err := manifest.Select("missing"); err == nil {
+		t.Errorf("Expected an error for an unknown configuration")
+	}
+}
+
+// Unit test for comparing configurations, with an extractor that reads
+// the ground truth back
+func TestRunBenchmark(t *testing.T) {
+	manifest, err := LoadManifest("../../samples/benchmark/manifest.yaml")
+	if err != nil {
+		t.Fatalf("Error loading the manifest: %v", err)
+	}
+	extract := func(config BenchmarkConfig, document BenchmarkDocument, language string) (string, error) {
+		if language != "eng" {
+			return "", fmt.Errorf("unexpected language %s", language)
+		}
+		text, err := os.ReadFile(document.Text)
+		switch {
+		case err != nil:
+			return "", err
+		case config.Name == "baseline":
+			// Every word of the memo lost
+			if document.Name() == "shaded-memo.jpg" {
+				return "", nil
+			}
+			// Memory the other configurations mustn't be charged for
+			if document.Name() == "input-image.png" {
+				buffer := make([]byte, 64<<20)
+				for i := 0; i < len(buffer); i += 4096 {
+					buffer[i] = 1
+				}
+				time.Sleep(30 * time.Millisecond)
+				runtime.KeepAlive(buffer)
+			}
+			time.Sleep(time.Millisecond)
+		case config.Name == "upscaled" && document.Name() == "bill.jpg":
+			return "", fmt.Errorf("model not found")
+		}
+		return string(text), nil
+	}
+	results := RunBenchmark(manifest, extract, "eng", DefaultTextOptions())
+	if len(results) != 3 {
+		t.Fatalf("Expected a result per configuration, got %d", len(results))
+	}
+
+	baseline, cleaned, upscaled := results[0], results[1], results[2]
+	if cleaned.Text.Total.CER != 0 || cleaned.FieldAccuracy != 1 || cleaned.Fields != 5 || len(cleaned.Failures) != 0 {
+		t.Errorf("Expected a perfect score for the ground truth, got %+v", cleaned)
+	}
+	if baseline.Text.Total.WER <= 0 || baseline.Text.Documents[5].WER != 1 || baseline.MeanLatency < time.Millisecond/2 {
+		t.Errorf("Expected the memo missed by the baseline, got %+v", baseline.Text.Documents[5])
+	}
+	if upscaled.FieldsFound != 2 || len(upscaled.Failures) != 1 || !strings.Contains(upscaled.Failures[0], "model not found") {
+		t.Errorf("Expected the bill's fields lost with the failure, got %d found, %v", upscaled.FieldsFound, upscaled.Failures)
+	}
+	if baseline.PeakMemoryIncrease < 48<<20 || baseline.P95Latency < baseline.MeanLatency {
+		t.Errorf("Expected the memory and latency measured, got %d and %v", baseline.PeakMemoryIncrease, baseline.P95Latency)
+	}
+	if cleaned.PeakMemoryIncrease > 32<<20 {
+		t.Errorf("Expected the memory of the baseline left out of the next configuration, got %d", cleaned.PeakMemoryIncrease)
+	}
+
+	var markdown, table, encoded bytes.Buffer
+	if err := WriteBenchmarkMarkdown(&markdown, results); err != nil || !strings.Contains(markdown.String(), "| cleaned | 0.00% | 0.00% |") ||
+		!strings.Contains(markdown.String(), "### upscaled") {
+		t.Errorf("Expected a Markdown row per configuration, got %v: \n%s", err, markdown.String())
+	}
+	if err := WriteBenchmarkCSV(&table, results); err != nil {
+		t.Fatalf("Error writing the CSV: %v", err)
+	}
+	if rows, err := csv.NewReader(&table).ReadAll(); err != nil || len(rows) != 4 || rows[3][0] != "upscaled" || rows[3][4] != "40.00" {
+		t.Errorf("Expected a CSV header and 3 rows, got %v %v", rows, err)
+	}
+	if err := WriteBenchmarkJSON(&encoded, results); err != nil {
+		t.Fatalf("Error writing the JSON: %v", err)
+	}
+	var decoded []BenchmarkResult
+	if err := json.Unmarshal(encoded.Bytes(), &decoded); err != nil || len(decoded) != 3 || len(decoded[0].Text.Documents) != 6 {
+		t.Errorf("Expected the results back from the JSON, got %v", err)
+	}
+}
+
+// Unit test for the latency percentiles
+func TestLatencyStats(t *testing.T) {
+	var latencies []time.Duration
+	for i := 20; i >= 1; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	mean, p95 := latencyStats(latencies)
+	if mean != 10500*time.Microsecond || p95 != 19*time.Millisecond {
+		t.Errorf("Expected a mean of 10.5ms and a 95th percentile of 19ms, got %v and %v", mean, p95)
+	}
+}
@@ -0,0 +1,108 @@
+package evaluation
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// CocoImage is an image of a COCO dataset.
+type CocoImage struct {
+	ID       int    `json:"id"`
+	FileName string `json:"file_name"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+}
+
+// CocoCategory is a class of objects of a COCO dataset.
+type CocoCategory struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// CocoAnnotation is a labeled object of a COCO dataset.
+type CocoAnnotation struct {
+	ID         int `json:"id"`
+	ImageID    int `json:"image_id"`
+	CategoryID int `json:"category_id"`
+	// Left, top, width and height, in pixels
+	BBox [4]float64 `json:"bbox"`
+	// Crowds label a group of objects in one box: detections matching them
+	// are neither right nor wrong
+	IsCrowd int `json:"iscrowd"`
+}
+
+// CocoDataset is the ground truth of an object detection dataset, in the
+// COCO JSON format. Segmentations and keypoints are not read.
+type CocoDataset struct {
+	Images      []CocoImage      `json:"images"`
+	Annotations []CocoAnnotation `json:"annotations"`
+	Categories  []CocoCategory   `json:"categories"`
+}
+
+// LoadCocoDataset reads and checks the annotations of a COCO JSON file.
+func LoadCocoDataset(fileName string) (*CocoDataset, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the annotations: %w", err)
+	}
+	dataset := &CocoDataset{}
+	if err := json.Unmarshal(data, dataset); err != nil {
+		return nil, fmt.Errorf("error parsing the annotations %s: %w", fileName, err)
+	}
+	if err := dataset.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid annotations %s: %w", fileName, err)
+	}
+	return dataset, nil
+}
+
+// Validate checks that the IDs are unique and that the annotations refer
+// to known images and categories with non-empty boxes.
+func (cd *CocoDataset) Validate() error {
+	images, categories := map[int]bool{}, map[int]bool{}
+	for _, img := range cd.Images {
+		if images[img.ID] {
+			return fmt.Errorf("image %d is defined twice", img.ID)
+		}
+		images[img.ID] = true
+	}
+	for _, category := range cd.Categories {
+		if categories[category.ID] {
+			return fmt.Errorf("category %d is defined twice", category.ID)
+		}
+		categories[category.ID] = true
+	}
+	for _, annotation := range cd.Annotations {
+		if !images[annotation.ImageID] {
+			return fmt.Errorf("annotation %d refers to the unknown image %d", annotation.ID, annotation.ImageID)
+		}
+		if !categories[annotation.CategoryID] {
+			return fmt.Errorf("annotation %d refers to the unknown category %d", annotation.ID, annotation.CategoryID)
+		}
+		if annotation.BBox[2] <= 0 || annotation.BBox[3] <= 0 {
+			return fmt.Errorf("annotation %d has an empty box", annotation.ID)
+		}
+	}
+	return nil
+}
+
+// Image finds an image by its file name, whatever its folder.
+func (cd *CocoDataset) Image(fileName string) (CocoImage, bool) {
+	for _, img := range cd.Images {
+		if filepath.Base(img.FileName) == filepath.Base(fileName) {
+			return img, true
+		}
+	}
+	return CocoImage{}, false
+}
+
+// Category finds a category by its name.
+func (cd *CocoDataset) Category(name string) (CocoCategory, bool) {
+	for _, category := range cd.Categories {
+		if category.Name == name {
+			return category, true
+		}
+	}
+	return CocoCategory{}, false
+}
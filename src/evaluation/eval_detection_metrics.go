@@ -0,0 +1,291 @@
+package evaluation
+
+import (
+	"sort"
+)
+
+// Detection is an object found by a detector, in the COCO results format.
+type Detection struct {
+	ImageID    int `json:"image_id"`
+	CategoryID int `json:"category_id"`
+	// Left, top, width and height, in pixels
+	BBox  [4]float64 `json:"bbox"`
+	Score float64    `json:"score"`
+}
+
+// MaxDetections is how many of the most confident detections of a class
+// are scored per image, as in the COCO evaluation.
+const MaxDetections = 100
+
+// IoUThresholds are the overlaps AP@[.5:.95] is averaged over.
+var IoUThresholds = []float64{0.5, 0.55, 0.6, 0.65, 0.7, 0.75, 0.8, 0.85, 0.9, 0.95}
+
+// IoU is the intersection over union of two boxes.
+func IoU(a, b [4]float64) float64 {
+	intersection := overlap(a, b)
+	union := a[2]*a[3] + b[2]*b[3] - intersection
+	if union <= 0 {
+		return 0
+	}
+	return intersection / union
+}
+
+func overlap(a, b [4]float64) float64 {
+	width := min(a[0]+a[2], b[0]+b[2]) - max(a[0], b[0])
+	height := min(a[1]+a[3], b[1]+b[3]) - max(a[1], b[1])
+	if width <= 0 || height <= 0 {
+		return 0
+	}
+	return width * height
+}
+
+// PRPoint is the precision and recall of a class when keeping the
+// detections scored at least Score.
+type PRPoint struct {
+	Score     float64 `json:"score"`
+	Precision float64 `json:"precision"`
+	Recall    float64 `json:"recall"`
+}
+
+// ClassAP is how well the objects of a class were found.
+type ClassAP struct {
+	CategoryID int    `json:"categoryId"`
+	Name       string `json:"name"`
+	// Labeled objects, crowds left out, and detections
+	Objects    int `json:"objects"`
+	Detections int `json:"detections"`
+	// Average precision at an IoU of 0.5, and averaged over IoUThresholds
+	AP50 float64 `json:"ap50"`
+	AP   float64 `json:"ap"`
+	// Precision-recall curve at an IoU of 0.5, a point per detection by
+	// decreasing score
+	Curve []PRPoint `json:"curve"`
+}
+
+// DetectionReport scores the detections of a dataset per class, as the
+// COCO evaluation does for all the object sizes.
+type DetectionReport struct {
+	Images int `json:"images"`
+	// The classes with labeled objects
+	Classes []ClassAP `json:"classes"`
+	// Means of AP50 and AP over the classes
+	MAP50     float64         `json:"map50"`
+	MAP       float64         `json:"map"`
+	Confusion ConfusionMatrix `json:"confusion"`
+}
+
+// ConfusionMatrix counts, for each labeled class, the classes it was
+// detected as. The last label is the background: its column holds the
+// objects missed and its row the detections of nothing.
+type ConfusionMatrix struct {
+	Labels []string `json:"labels"`
+	// By labeled class then detected class
+	Counts [][]int `json:"counts"`
+}
+
+// EvaluateDetections matches the detections to the objects of the
+// dataset. Detections of other images or categories are left out, and the
+// confusion matrix only counts detections scored at least minScore. For
+// APs comparable with COCO's, give every detection down to a score of
+// about 0.001.
+func EvaluateDetections(dataset *CocoDataset, detections []Detection, minScore float64) *DetectionReport {
+	images, categories := map[int]bool{}, map[int]bool{}
+	for _, img := range dataset.Images {
+		images[img.ID] = true
+	}
+	for _, category := range dataset.Categories {
+		categories[category.ID] = true
+	}
+	var kept []Detection
+	for _, detection := range detections {
+		if images[detection.ImageID] && categories[detection.CategoryID] {
+			kept = append(kept, detection)
+		}
+	}
+	// Most confident first, ties in their order
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i].Score > kept[j].Score })
+
+	report := &DetectionReport{Images: len(dataset.Images)}
+	for _, category := range dataset.Categories {
+		class := evaluateClass(dataset, kept, category)
+		if class.Objects > 0 {
+			report.Classes = append(report.Classes, class)
+			report.MAP50 += class.AP50
+			report.MAP += class.AP
+		}
+	}
+	if len(report.Classes) > 0 {
+		report.MAP50 /= float64(len(report.Classes))
+		report.MAP /= float64(len(report.Classes))
+	}
+	report.Confusion = confusionMatrix(dataset, kept, minScore)
+	return report
+}
+
+// evaluateClass scores the detections of a category, sorted by score.
+func evaluateClass(dataset *CocoDataset, detections []Detection, category CocoCategory) ClassAP {
+	class := ClassAP{CategoryID: category.ID, Name: category.Name}
+	objects := map[int][]CocoAnnotation{}
+	for _, annotation := range dataset.Annotations {
+		if annotation.CategoryID == category.ID {
+			objects[annotation.ImageID] = append(objects[annotation.ImageID], annotation)
+			if annotation.IsCrowd == 0 {
+				class.Objects++
+			}
+		}
+	}
+	var found []Detection
+	perImage := map[int]int{}
+	for _, detection := range detections {
+		if detection.CategoryID == category.ID && perImage[detection.ImageID] < MaxDetections {
+			found = append(found, detection)
+			perImage[detection.ImageID]++
+		}
+	}
+	class.Detections = len(found)
+	if class.Objects == 0 {
+		return class
+	}
+
+	for _, threshold := range IoUThresholds {
+		curve := precisionRecall(objects, found, class.Objects, threshold)
+		ap := averagePrecision(curve)
+		if threshold == IoUThresholds[0] {
+			class.AP50, class.Curve = ap, curve
+		}
+		class.AP += ap / float64(len(IoUThresholds))
+	}
+	return class
+}
+
+// precisionRecall matches each detection, most confident first, to the
+// unmatched object of its image it overlaps most, then to a crowd.
+// Detections matching a crowd are left out of the curve.
+func precisionRecall(objects map[int][]CocoAnnotation, detections []Detection, total int, threshold float64) []PRPoint {
+	matched := map[int][]bool{}
+	for id, annotations := range objects {
+		matched[id] = make([]bool, len(annotations))
+	}
+
+	var curve []PRPoint
+	truePositives, falsePositives := 0, 0
+	for _, detection := range detections {
+		best, bestIoU, crowd := -1, threshold, false
+		for i, annotation := range objects[detection.ImageID] {
+			if annotation.IsCrowd != 0 {
+				// Any part of the detection inside a crowd box is in the crowd
+				if area := detection.BBox[2] * detection.BBox[3]; area > 0 && overlap(detection.BBox, annotation.BBox)/area >= threshold {
+					crowd = true
+				}
+				continue
+			}
+			if iou := IoU(detection.BBox, annotation.BBox); !matched[detection.ImageID][i] && iou >= bestIoU {
+				best, bestIoU = i, iou
+			}
+		}
+		switch {
+		case best >= 0:
+			matched[detection.ImageID][best] = true
+			truePositives++
+		case crowd:
+			continue
+		default:
+			falsePositives++
+		}
+		curve = append(curve, PRPoint{
+			Score:     detection.Score,
+			Precision: float64(truePositives) / float64(truePositives+falsePositives),
+			Recall:    float64(truePositives) / float64(total),
+		})
+	}
+	return curve
+}
+
+// averagePrecision interpolates the precision at 101 recall levels, from
+// 0 to 1, as the COCO evaluation does.
+func averagePrecision(curve []PRPoint) float64 {
+	// The best precision at this recall or a higher one
+	precision := make([]float64, len(curve))
+	for i := len(curve) - 1; i >= 0; i-- {
+		precision[i] = curve[i].Precision
+		if i+1 < len(curve) {
+			precision[i] = max(precision[i], precision[i+1])
+		}
+	}
+	total := 0.0
+	for level := 0; level <= 100; level++ {
+		recall := float64(level) / 100
+		i := sort.Search(len(curve), func(i int) bool { return curve[i].Recall >= recall-1e-12 })
+		if i < len(curve) {
+			total += precision[i]
+		}
+	}
+	return total / 101
+}
+
+// confusionMatrix pairs the objects and the detections of each image that
+// overlap by at least 0.5, the most overlapping first, whatever their
+// classes. Crowds are left out.
+func confusionMatrix(dataset *CocoDataset, detections []Detection, minScore float64) ConfusionMatrix {
+	index := map[int]int{}
+	matrix := ConfusionMatrix{}
+	for i, category := range dataset.Categories {
+		index[category.ID] = i
+		matrix.Labels = append(matrix.Labels, category.Name)
+	}
+	background := len(matrix.Labels)
+	matrix.Labels = append(matrix.Labels, "background")
+	matrix.Counts = make([][]int, len(matrix.Labels))
+	for i := range matrix.Counts {
+		matrix.Counts[i] = make([]int, len(matrix.Labels))
+	}
+
+	objects, found := map[int][]CocoAnnotation{}, map[int][]Detection{}
+	for _, annotation := range dataset.Annotations {
+		if annotation.IsCrowd == 0 {
+			objects[annotation.ImageID] = append(objects[annotation.ImageID], annotation)
+		}
+	}
+	for _, detection := range detections {
+		if detection.Score >= minScore {
+			found[detection.ImageID] = append(found[detection.ImageID], detection)
+		}
+	}
+
+	type pair struct {
+		object, detection int
+		iou               float64
+	}
+	for _, img := range dataset.Images {
+		annotations, detections := objects[img.ID], found[img.ID]
+		var pairs []pair
+		for i, annotation := range annotations {
+			for j, detection := range detections {
+				if iou := IoU(annotation.BBox, detection.BBox); iou >= 0.5 {
+					pairs = append(pairs, pair{i, j, iou})
+				}
+			}
+		}
+		sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].iou > pairs[j].iou })
+
+		objectMatched, detectionMatched := make([]bool, len(annotations)), make([]bool, len(detections))
+		for _, p := range pairs {
+			if objectMatched[p.object] || detectionMatched[p.detection] {
+				continue
+			}
+			objectMatched[p.object], detectionMatched[p.detection] = true, true
+			matrix.Counts[index[annotations[p.object].CategoryID]][index[detections[p.detection].CategoryID]]++
+		}
+		for i, annotation := range annotations {
+			if !objectMatched[i] {
+				matrix.Counts[index[annotation.CategoryID]][background]++
+			}
+		}
+		for j, detection := range detections {
+			if !detectionMatched[j] {
+				matrix.Counts[background][index[detection.CategoryID]]++
+			}
+		}
+	}
+	return matrix
+}
@@ -0,0 +1,142 @@
+package evaluation
+
+import (
+	"bytes"
+	"encoding/csv"
+	"math"
+	"strings"
+	"testing"
+)
+
+// Unit test for loading the labels of the sample images
+func TestLoadCocoDataset(t *testing.T) {
+	dataset, err := LoadCocoDataset("../../samples/images/annotations.json")
+	if err != nil {
+		t.Fatalf("Error loading the annotations: %v", err)
+	}
+	if len(dataset.Images) != 4 || len(dataset.Categories) != 4 || len(dataset.Annotations) != 21 {
+		t.Errorf("Expected 4 images, 4 categories and 21 objects, got %d, %d and %d",
+			len(dataset.Images), len(dataset.Categories), len(dataset.Annotations))
+	}
+	if img, ok := dataset.Image("samples/images/zebra.jpg"); !ok || img.ID != 4 || img.Width != 640 {
+		t.Errorf("Expected zebra.jpg to be image 4, got %+v", img)
+	}
+	if category, ok := dataset.Category("traffic light"); !ok || category.ID != 10 {
+		t.Errorf("Expected the COCO ID of traffic lights, got %+v", category)
+	}
+
+	dataset.Annotations = append(dataset.Annotations, CocoAnnotation{ID: 99, ImageID: 5, CategoryID: 3, BBox: [4]float64{0, 0, 1, 1}})
+	if err := dataset.Validate(); err == nil {
+		t.Errorf("Expected an error for an annotation of an unknown image")
+	}
+}
+
+// Unit test for the overlap of boxes
+func TestIoU(t *testing.T) {
+	tests := []struct {
+		a, b [4]float64
+		iou  float64
+	}{
+		{[4]float64{0, 0, 10, 10}, [4]float64{0, 0, 10, 10}, 1},
+		{[4]float64{0, 0, 10, 10}, [4]float64{2, 0, 10, 10}, 80.0 / 120},
+		{[4]float64{0, 0, 10, 10}, [4]float64{5, 5, 10, 10}, 25.0 / 175},
+		{[4]float64{0, 0, 10, 10}, [4]float64{10, 0, 10, 10}, 0},
+	}
+	for _, test := range tests {
+		if iou := IoU(test.a, test.b); math.Abs(iou-test.iou) > 1e-9 {
+			t.Errorf("For %v and %v, expected an IoU of %.4f, got %.4f", test.a, test.b, test.iou, iou)
+		}
+	}
+}
+
+// Unit test for the AP and the confusion of two classes, with a box
+// shifted by 2 pixels, a false positive and a dog detected as a cat
+func TestEvaluateDetections(t *testing.T) {
+	dataset := &CocoDataset{
+		Images:     []CocoImage{{ID: 1, FileName: "pets.jpg", Width: 100, Height: 100}},
+		Categories: []CocoCategory{{ID: 1, Name: "cat"}, {ID: 2, Name: "dog"}},
+		Annotations: []CocoAnnotation{
+			{ID: 1, ImageID: 1, CategoryID: 1, BBox: [4]float64{0, 0, 10, 10}},
+			{ID: 2, ImageID: 1, CategoryID: 1, BBox: [4]float64{20, 0, 10, 10}},
+			{ID: 3, ImageID: 1, CategoryID: 2, BBox: [4]float64{0, 20, 10, 10}},
+			{ID: 4, ImageID: 1, CategoryID: 1, BBox: [4]float64{60, 60, 40, 40}, IsCrowd: 1},
+		},
+	}
+	detections := []Detection{
+		{ImageID: 1, CategoryID: 1, BBox: [4]float64{0, 20, 10, 10}, Score: 0.6},
+		{ImageID: 1, CategoryID: 1, BBox: [4]float64{0, 0, 10, 10}, Score: 0.9},
+		{ImageID: 1, CategoryID: 1, BBox: [4]float64{22, 0, 10, 10}, Score: 0.8},
+		{ImageID: 1, CategoryID: 1, BBox: [4]float64{40, 40, 10, 10}, Score: 0.7},
+		{ImageID: 1, CategoryID: 1, BBox: [4]float64{70, 70, 10, 10}, Score: 0.65},
+		{ImageID: 2, CategoryID: 2, BBox: [4]float64{0, 20, 10, 10}, Score: 0.9},
+	}
+	report := EvaluateDetections(dataset, detections, 0.5)
+
+	if report.Images != 1 || len(report.Classes) != 2 {
+		t.Fatalf("Expected the cat and dog classes, got %+v", report.Classes)
+	}
+	cat, dog := report.Classes[0], report.Classes[1]
+	if cat.Objects != 2 || cat.Detections != 5 || dog.Objects != 1 || dog.Detections != 0 {
+		t.Errorf("Expected 2 cats found 5 times and a dog never, got %+v and %+v", cat, dog)
+	}
+	// The shifted box, at an IoU of 0.67, is right up to 0.65, and the
+	// detection in the crowd counts for nothing
+	if len(cat.Curve) != 4 || cat.Curve[1].Recall != 1 || cat.Curve[3].Precision != 0.5 {
+		t.Errorf("Expected 4 points reaching a recall of 1, got %+v", cat.Curve)
+	}
+	ap := (4 + 6*51.0/101) / 10
+	if math.Abs(cat.AP50-1) > 1e-9 || math.Abs(cat.AP-ap) > 1e-9 || dog.AP50 != 0 {
+		t.Errorf("Expected a cat AP50 of 1 and AP of %.4f, and a dog AP of 0, got %.4f, %.4f and %.4f",
+			ap, cat.AP50, cat.AP, dog.AP50)
+	}
+	if math.Abs(report.MAP50-0.5) > 1e-9 || math.Abs(report.MAP-ap/2) > 1e-9 {
+		t.Errorf("Expected a mAP50 of 0.5 and mAP of %.4f, got %.4f and %.4f", ap/2, report.MAP50, report.MAP)
+	}
+
+	expected := [][]int{
+		{2, 0, 0},
+		{1, 0, 0},
+		{2, 0, 0},
+	}
+	for i, row := range expected {
+		for j, count := range row {
+			if report.Confusion.Counts[i][j] != count {
+				t.Errorf("Expected %d %s detected as %s, got %d", count, report.Confusion.Labels[i],
+					report.Confusion.Labels[j], report.Confusion.Counts[i][j])
+			}
+		}
+	}
+
+	if text := report.String(); !strings.Contains(text, "mAP") || !strings.Contains(text, "background") {
+		t.Errorf("Expected the mAP and the confusion matrix, got\n%s", text)
+	}
+	var out bytes.Buffer
+	if err := report.WriteCurvesCSV(&out); err != nil {
+		t.Fatalf("Error writing the curves: %v", err)
+	}
+	if rows, err := csv.NewReader(&out).ReadAll(); err != nil || len(rows) != 5 || rows[1][0] != "cat" || rows[1][1] != "0.9000" {
+		t.Errorf("Expected a header and 4 points of the cat curve, got %v %v", rows, err)
+	}
+}
+
+// Unit test for scoring only the most confident detections of a class in
+// an image
+func TestMaxDetections(t *testing.T) {
+	dataset := &CocoDataset{
+		Images:      []CocoImage{{ID: 1, FileName: "cat.jpg", Width: 1000, Height: 1000}},
+		Categories:  []CocoCategory{{ID: 1, Name: "cat"}},
+		Annotations: []CocoAnnotation{{ID: 1, ImageID: 1, CategoryID: 1, BBox: [4]float64{0, 0, 10, 10}}},
+	}
+	// The cat is found last, below the other boxes
+	var detections []Detection
+	for i := 0; i <= MaxDetections; i++ {
+		detections = append(detections, Detection{ImageID: 1, CategoryID: 1, BBox: [4]float64{float64(20 + 5*i), 500, 4, 4},
+			Score: 0.9 - float64(i)/1000})
+	}
+	detections[MaxDetections].BBox = [4]float64{0, 0, 10, 10}
+
+	report := EvaluateDetections(dataset, detections, 0.5)
+	if cat := report.Classes[0]; cat.Detections != MaxDetections || cat.AP50 != 0 {
+		t.Errorf("Expected %d detections scored and the cat missed, got %d and an AP of %.4f", MaxDetections, cat.Detections, cat.AP50)
+	}
+}
@@ -0,0 +1,85 @@
+package evaluation
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// String lays the report out as a table, a line per class, followed by
+// the confusion matrix.
+func (dr *DetectionReport) String() string {
+	var out strings.Builder
+	w := tabwriter.NewWriter(&out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Class\tObjects\tDetections\tAP@0.5\tAP@[.5:.95]\t")
+	for _, class := range dr.Classes {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.3f\t%.3f\t\n", class.Name, class.Objects, class.Detections, class.AP50, class.AP)
+	}
+	fmt.Fprintf(w, "mAP\t\t\t%.3f\t%.3f\t\n", dr.MAP50, dr.MAP)
+	w.Flush()
+	out.WriteString("\nConfusion, labeled class by row and detected class by column:\n")
+	out.WriteString(dr.Confusion.String())
+	return out.String()
+}
+
+// String lays the matrix out as a table, leaving out the classes with
+// neither objects nor detections.
+func (cm ConfusionMatrix) String() string {
+	var used []int
+	for i := range cm.Labels {
+		for j := range cm.Labels {
+			if cm.Counts[i][j] > 0 || cm.Counts[j][i] > 0 {
+				used = append(used, i)
+				break
+			}
+		}
+	}
+
+	var out strings.Builder
+	w := tabwriter.NewWriter(&out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, j := range used {
+		fmt.Fprintf(w, "\t%s", cm.Labels[j])
+	}
+	fmt.Fprintln(w, "\t")
+	for _, i := range used {
+		fmt.Fprint(w, cm.Labels[i])
+		for _, j := range used {
+			fmt.Fprintf(w, "\t%d", cm.Counts[i][j])
+		}
+		fmt.Fprintln(w, "\t")
+	}
+	w.Flush()
+	return out.String()
+}
+
+// WriteJSON writes the report, indented, as JSON.
+func (dr *DetectionReport) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(dr); err != nil {
+		return fmt.Errorf("error writing the report: %w", err)
+	}
+	return nil
+}
+
+// WriteCurvesCSV writes the precision-recall curves at an IoU of 0.5, a
+// row per class and detection.
+func (dr *DetectionReport) WriteCurvesCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"Class", "Score", "Precision", "Recall"})
+	format := func(v float64) string { return strconv.FormatFloat(v, 'f', 4, 64) }
+	for _, class := range dr.Classes {
+		for _, point := range class.Curve {
+			writer.Write([]string{class.Name, format(point.Score), format(point.Precision), format(point.Recall)})
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing the curves: %w", err)
+	}
+	return nil
+}
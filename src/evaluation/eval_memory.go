@@ -0,0 +1,71 @@
+package evaluation
+
+import (
+	"bufio"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// residentMemory is the memory the process holds, in bytes. It is read
+// from /proc so OpenCV's and Tesseract's count too; elsewhere only the
+// memory of the Go runtime is known.
+func residentMemory() uint64 {
+	if file, err := os.Open("/proc/self/status"); err == nil {
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			// VmRSS:     123456 kB
+			if fields := strings.Fields(scanner.Text()); len(fields) >= 2 && fields[0] == "VmRSS:" {
+				if kb, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+					return kb * 1024
+				}
+			}
+		}
+	}
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.Sys
+}
+
+// sampleMemory collects the garbage of earlier work, then polls the
+// resident memory until the returned function is called, which returns
+// the largest increase seen over the memory held at the start.
+func sampleMemory(interval time.Duration) func() uint64 {
+	// What earlier configurations left behind shouldn't count
+	debug.FreeOSMemory()
+	baseline := residentMemory()
+
+	var mutex sync.Mutex
+	peak := baseline
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				memory := residentMemory()
+				mutex.Lock()
+				peak = max(peak, memory)
+				mutex.Unlock()
+			}
+		}
+	}()
+
+	return func() uint64 {
+		close(done)
+		<-stopped
+		mutex.Lock()
+		defer mutex.Unlock()
+		return max(peak, residentMemory()) - baseline
+	}
+}
@@ -0,0 +1,224 @@
+package evaluation
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Whitespace is how spaces, tabs and line breaks are compared.
+type Whitespace string
+
+const (
+	// Any run of whitespace counts as one space, and none at the ends
+	WhitespaceCollapse Whitespace = "collapse"
+	// Whitespace is dropped from the characters, for scripts written
+	// without spaces or layouts Tesseract breaks up. Words are still split
+	// at it.
+	WhitespaceIgnore Whitespace = "ignore"
+	// Every space and line break must match
+	WhitespaceExact Whitespace = "exact"
+)
+
+// TextOptions says which differences between a reference and an OCR text
+// don't count as errors.
+type TextOptions struct {
+	// Unicode normalization of both texts, NFKC by default so full-width
+	// and compatibility characters match their plain forms
+	Form       norm.Form  `json:"-"`
+	Whitespace Whitespace `json:"whitespace"`
+	IgnoreCase bool       `json:"ignoreCase"`
+	// Curly quotes and apostrophes count as straight ones, and dashes as
+	// hyphens
+	FoldPunctuation bool `json:"foldPunctuation"`
+}
+
+func DefaultTextOptions() TextOptions {
+	return TextOptions{Form: norm.NFKC, Whitespace: WhitespaceCollapse}
+}
+
+var punctuationFolds = strings.NewReplacer("‘", "'", "’", "'", "‚", "'", "“", `"`, "”", `"`, "„", `"`,
+	"‐", "-", "‑", "-", "–", "-", "—", "-", "−", "-")
+
+// normalize applies the options to a text, except the whitespace.
+func (o TextOptions) normalize(text string) string {
+	text = o.Form.String(text)
+	if o.IgnoreCase {
+		text = strings.ToLower(text)
+	}
+	if o.FoldPunctuation {
+		text = punctuationFolds.Replace(text)
+	}
+	return text
+}
+
+// characters returns the runes of a text compared for the CER.
+func (o TextOptions) characters(text string) []rune {
+	switch o.Whitespace {
+	case WhitespaceExact:
+		return []rune(text)
+	case WhitespaceIgnore:
+		return []rune(strings.Join(strings.Fields(text), ""))
+	default:
+		return []rune(strings.Join(strings.Fields(text), " "))
+	}
+}
+
+// Edits is the cheapest way to turn a reference into an OCR text.
+type Edits struct {
+	Matches       int `json:"matches"`
+	Substitutions int `json:"substitutions"`
+	Deletions     int `json:"deletions"`
+	Insertions    int `json:"insertions"`
+}
+
+// Errors is the edit distance.
+func (e Edits) Errors() int {
+	return e.Substitutions + e.Deletions + e.Insertions
+}
+
+// Add sums the edits of two texts.
+func (e Edits) Add(other Edits) Edits {
+	return Edits{e.Matches + other.Matches, e.Substitutions + other.Substitutions,
+		e.Deletions + other.Deletions, e.Insertions + other.Insertions}
+}
+
+// Rate is the edit distance over the length of the reference. An empty
+// reference rates 0 against an empty text and 1 against anything else.
+func (e Edits) Rate() float64 {
+	reference := e.Matches + e.Substitutions + e.Deletions
+	if reference == 0 {
+		if e.Insertions == 0 {
+			return 0
+		}
+		return 1
+	}
+	return float64(e.Errors()) / float64(reference)
+}
+
+// Align finds the Levenshtein edits from a reference to a hypothesis,
+// keeping two rows of the table so long pages fit in memory. Of equally
+// cheap alignments, the one with the most matches is kept.
+func Align[T comparable](reference, hypothesis []T) Edits {
+	type cell struct {
+		cost  int
+		edits Edits
+	}
+	previous := make([]cell, len(hypothesis)+1)
+	current := make([]cell, len(hypothesis)+1)
+	for j := range previous {
+		previous[j] = cell{cost: j, edits: Edits{Insertions: j}}
+	}
+	better := func(a, b cell) bool {
+		return a.cost < b.cost || (a.cost == b.cost && a.edits.Matches > b.edits.Matches)
+	}
+
+	for i := 1; i <= len(reference); i++ {
+		current[0] = cell{cost: i, edits: Edits{Deletions: i}}
+		for j := 1; j <= len(hypothesis); j++ {
+			best := previous[j-1]
+			if reference[i-1] == hypothesis[j-1] {
+				best.edits.Matches++
+			} else {
+				best.cost++
+				best.edits.Substitutions++
+			}
+			if deletion := previous[j]; deletion.cost+1 <= best.cost {
+				deletion.cost++
+				deletion.edits.Deletions++
+				if better(deletion, best) {
+					best = deletion
+				}
+			}
+			if insertion := current[j-1]; insertion.cost+1 <= best.cost {
+				insertion.cost++
+				insertion.edits.Insertions++
+				if better(insertion, best) {
+					best = insertion
+				}
+			}
+			current[j] = best
+		}
+		previous, current = current, previous
+	}
+	return previous[len(hypothesis)].edits
+}
+
+// BagOfWords compares the words of two texts as multisets, whatever their
+// order. It doesn't penalize columns or table cells read in another order
+// than the reference's.
+type BagOfWords struct {
+	// Words found in both texts, counting repeats
+	Matches   int     `json:"matches"`
+	Precision float64 `json:"precision"`
+	Recall    float64 `json:"recall"`
+	F1        float64 `json:"f1"`
+	// Order-independent word error rate: the words missing or extra, a
+	// substitution being one of each, over the words of the reference
+	ErrorRate float64 `json:"errorRate"`
+}
+
+func bagOfWords(reference, hypothesis []string) BagOfWords {
+	counts := map[string]int{}
+	for _, word := range reference {
+		counts[word]++
+	}
+	matches := 0
+	for _, word := range hypothesis {
+		if counts[word] > 0 {
+			counts[word]--
+			matches++
+		}
+	}
+	return bagScore(matches, len(reference), len(hypothesis))
+}
+
+func bagScore(matches, reference, hypothesis int) BagOfWords {
+	bag := BagOfWords{Matches: matches, Precision: 1, Recall: 1}
+	if hypothesis > 0 {
+		bag.Precision = float64(matches) / float64(hypothesis)
+	}
+	if reference > 0 {
+		bag.Recall = float64(matches) / float64(reference)
+		bag.ErrorRate = float64(max(reference, hypothesis)-matches) / float64(reference)
+	} else if hypothesis > 0 {
+		bag.Recall, bag.ErrorRate = 0, 1
+	}
+	if bag.Precision+bag.Recall > 0 {
+		bag.F1 = 2 * bag.Precision * bag.Recall / (bag.Precision + bag.Recall)
+	}
+	return bag
+}
+
+// TextScore rates an OCR text against its reference.
+type TextScore struct {
+	// Character and word error rates
+	CER        float64    `json:"cer"`
+	WER        float64    `json:"wer"`
+	Characters Edits      `json:"characters"`
+	Words      Edits      `json:"words"`
+	BagOfWords BagOfWords `json:"bagOfWords"`
+	// Length of the reference, normalized
+	ReferenceCharacters int `json:"referenceCharacters"`
+	ReferenceWords      int `json:"referenceWords"`
+	// Length of the OCR text, normalized
+	HypothesisWords int `json:"hypothesisWords"`
+}
+
+// ScoreText compares an OCR text, the hypothesis, with its reference.
+func ScoreText(reference, hypothesis string, options TextOptions) TextScore {
+	reference, hypothesis = options.normalize(reference), options.normalize(hypothesis)
+	referenceWords, hypothesisWords := strings.Fields(reference), strings.Fields(hypothesis)
+	referenceChars := options.characters(reference)
+
+	score := TextScore{
+		Characters:          Align(referenceChars, options.characters(hypothesis)),
+		Words:               Align(referenceWords, hypothesisWords),
+		BagOfWords:          bagOfWords(referenceWords, hypothesisWords),
+		ReferenceCharacters: len(referenceChars),
+		ReferenceWords:      len(referenceWords),
+		HypothesisWords:     len(hypothesisWords),
+	}
+	score.CER, score.WER = score.Characters.Rate(), score.Words.Rate()
+	return score
+}
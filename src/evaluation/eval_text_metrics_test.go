@@ -0,0 +1,112 @@
+package evaluation
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Unit test for the edit distance
+func TestAlign(t *testing.T) {
+	edits := Align([]rune("kitten"), []rune("sitting"))
+	if edits != (Edits{Matches: 4, Substitutions: 2, Insertions: 1}) || edits.Errors() != 3 {
+		t.Errorf("Expected 2 substitutions and an insertion from kitten to sitting, got %+v", edits)
+	}
+	if edits := Align(strings.Fields("the cat sat on the mat"), strings.Fields("the cat on a mat")); edits.Errors() != 2 ||
+		edits.Deletions != 1 || edits.Substitutions != 1 {
+		t.Errorf("Expected a deleted and a substituted word, got %+v", edits)
+	}
+	if rate := Align([]rune(""), []rune("")).Rate(); rate != 0 {
+		t.Errorf("Expected no errors between empty texts, got %v", rate)
+	}
+	if rate := Align([]rune(""), []rune("noise")).Rate(); rate != 1 {
+		t.Errorf("Expected a rate of 1 for text where there is none, got %v", rate)
+	}
+}
+
+// Unit test for the normalization and whitespace options
+func TestScoreText(t *testing.T) {
+	options := DefaultTextOptions()
+	// Full-width letters and the ﬁ ligature are NFKC equivalents
+	if score := ScoreText("ABC ﬁle", "ＡＢＣ file", options); score.CER != 0 {
+		t.Errorf("Expected NFKC to match full-width and ligature forms, got %+v", score)
+	}
+	if score := ScoreText("one  two\nthree ", "one two three", options); score.CER != 0 || score.WER != 0 {
+		t.Errorf("Expected collapsed whitespace to match, got %+v", score)
+	}
+	options.Whitespace = WhitespaceExact
+	if score := ScoreText("one  two\nthree ", "one two three", options); score.Characters.Errors() != 3 || score.WER != 0 {
+		t.Errorf("Expected 3 whitespace errors and no word errors, got %+v", score)
+	}
+	options.Whitespace = WhitespaceIgnore
+	if score := ScoreText("明朝体は横線に", "明朝 体は 横線に", options); score.CER != 0 {
+		t.Errorf("Expected spaces ignored between Japanese characters, got %+v", score)
+	}
+
+	options = DefaultTextOptions()
+	if score := ScoreText("“Tis—so”", `"tis-so"`, options); score.Characters.Errors() != 4 {
+		t.Errorf("Expected 4 errors for quotes, dash and case, got %+v", score)
+	}
+	options.FoldPunctuation, options.IgnoreCase = true, true
+	if score := ScoreText("“Tis—so”", `"tis-so"`, options); score.CER != 0 {
+		t.Errorf("Expected folded punctuation and case to match, got %+v", score)
+	}
+}
+
+// Unit test for the order-independent metrics on columns read in another
+// order
+func TestBagOfWords(t *testing.T) {
+	reference, err := os.ReadFile("../../samples/ground-truth/crooked-scan.txt")
+	if err != nil {
+		t.Fatalf("Error reading the ground truth: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(reference)), "\n")
+	// The second half first, like columns read right to left
+	reordered := strings.Join(append(lines[len(lines)/2:], lines[:len(lines)/2]...), "\n")
+
+	score := ScoreText(string(reference), reordered, DefaultTextOptions())
+	if score.WER < 0.5 || score.BagOfWords.ErrorRate != 0 || score.BagOfWords.F1 != 1 {
+		t.Errorf("Expected a high WER but no bag-of-words errors, got %+v", score)
+	}
+
+	score = ScoreText("a b c d", "a b x", DefaultTextOptions())
+	if score.BagOfWords.Matches != 2 || math.Abs(score.BagOfWords.Precision-2.0/3) > 1e-9 ||
+		score.BagOfWords.Recall != 0.5 || score.BagOfWords.ErrorRate != 0.5 {
+		t.Errorf("Expected 2 of 4 words found out of 3, got %+v", score.BagOfWords)
+	}
+}
+
+// Unit test for per-document reports
+func TestTextReport(t *testing.T) {
+	report := NewTextReport(DefaultTextOptions())
+	report.Add("short", "abcd", "abxd")
+	report.Add("long", "abcdefghijklmnop", "abcdefghijklmnop")
+
+	if len(report.Documents) != 2 || report.Documents[0].CER != 0.25 || report.Documents[1].CER != 0 {
+		t.Fatalf("Expected a CER of 0.25 and 0, got %+v", report.Documents)
+	}
+	// One error in 20 characters, not the mean of the rates
+	if report.Total.CER != 0.05 || report.Total.ReferenceCharacters != 20 || report.Total.WER != 0.5 {
+		t.Errorf("Expected a total CER of 0.05 and WER of 0.5, got %+v", report.Total)
+	}
+	if table := report.String(); !strings.Contains(table, "short") || !strings.Contains(table, "25.00%") {
+		t.Errorf("Expected a line per document in the table, got: \n%s", table)
+	}
+
+	var out bytes.Buffer
+	if err := report.WriteJSON(&out); err != nil {
+		t.Fatalf("Error writing the report: %v", err)
+	}
+	var decoded struct {
+		Documents []struct {
+			Name string  `json:"name"`
+			CER  float64 `json:"cer"`
+		} `json:"documents"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil || len(decoded.Documents) != 2 || decoded.Documents[0].Name != "short" {
+		t.Errorf("Expected the documents in the JSON, got %s", out.String())
+	}
+}
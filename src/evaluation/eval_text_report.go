@@ -0,0 +1,80 @@
+package evaluation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// DocumentScore is the score of one document of a TextReport.
+type DocumentScore struct {
+	Name string `json:"name"`
+	TextScore
+}
+
+// TextReport scores OCR texts document by document, and over all of them.
+type TextReport struct {
+	Options   TextOptions     `json:"options"`
+	Documents []DocumentScore `json:"documents"`
+	// Summed over the documents, so longer documents weigh more
+	Total TextScore `json:"total"`
+}
+
+func NewTextReport(options TextOptions) *TextReport {
+	return &TextReport{Options: options}
+}
+
+// Add scores the OCR text of a document and adds it to the total.
+func (tr *TextReport) Add(name, reference, hypothesis string) TextScore {
+	score := ScoreText(reference, hypothesis, tr.Options)
+	tr.Documents = append(tr.Documents, DocumentScore{Name: name, TextScore: score})
+
+	total := &tr.Total
+	total.Characters = total.Characters.Add(score.Characters)
+	total.Words = total.Words.Add(score.Words)
+	total.ReferenceCharacters += score.ReferenceCharacters
+	total.ReferenceWords += score.ReferenceWords
+	total.HypothesisWords += score.HypothesisWords
+	total.CER, total.WER = total.Characters.Rate(), total.Words.Rate()
+	total.BagOfWords = bagScore(total.BagOfWords.Matches+score.BagOfWords.Matches, total.ReferenceWords, total.HypothesisWords)
+	return score
+}
+
+// AddFile scores the OCR text of a document against a reference file.
+func (tr *TextReport) AddFile(name, referenceFile, hypothesis string) (TextScore, error) {
+	reference, err := os.ReadFile(referenceFile)
+	if err != nil {
+		return TextScore{}, fmt.Errorf("error reading the reference text: %w", err)
+	}
+	return tr.Add(name, string(reference), hypothesis), nil
+}
+
+// String lays the report out as a table, a line per document.
+func (tr *TextReport) String() string {
+	var out strings.Builder
+	w := tabwriter.NewWriter(&out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Document\tCER\tWER\tBag-of-words WER\tF1\tCharacters\tWords\t")
+	row := func(name string, score TextScore) {
+		fmt.Fprintf(w, "%s\t%.2f%%\t%.2f%%\t%.2f%%\t%.3f\t%d\t%d\t\n", name, 100*score.CER, 100*score.WER,
+			100*score.BagOfWords.ErrorRate, score.BagOfWords.F1, score.ReferenceCharacters, score.ReferenceWords)
+	}
+	for _, document := range tr.Documents {
+		row(document.Name, document.TextScore)
+	}
+	row("Total", tr.Total)
+	w.Flush()
+	return out.String()
+}
+
+// WriteJSON writes the report, indented, as JSON.
+func (tr *TextReport) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(tr); err != nil {
+		return fmt.Errorf("error writing the report: %w", err)
+	}
+	return nil
+}
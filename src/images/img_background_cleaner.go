@@ -0,0 +1,251 @@
+package images
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+// CleanStep is a stage of BackgroundCleaner, run in the order given.
+type CleanStep string
+
+const (
+	// Lifts shadows and uneven light to the level of the lit paper,
+	// keeping the colors
+	CleanShadows CleanStep = "shadows"
+	// Divides every channel by the estimated paper, making it white
+	CleanBackground CleanStep = "background"
+	// Whitens faint gray and pale colored watermarks, best after
+	// CleanBackground
+	CleanWatermark CleanStep = "watermark"
+)
+
+// BackgroundMethod is how the paper under the text is estimated.
+type BackgroundMethod string
+
+const (
+	// A closing, which removes any ink thinner than the kernel
+	BackgroundMorphology BackgroundMethod = "morphology"
+	// A median filter, which keeps sharper shadow edges
+	BackgroundMedian BackgroundMethod = "median"
+)
+
+// The paper is estimated at this fraction of the page size, it varies
+// slowly and large kernels are costly at full size
+const backgroundScale = 4
+
+type BackgroundCleaner struct {
+	steps          []CleanStep
+	method         BackgroundMethod
+	kernelSize     int
+	watermarkLevel byte
+	debugDir       string
+}
+
+// NewBackgroundCleaner runs the steps in order, by default removing the
+// shadows, then the background and then the watermarks.
+func NewBackgroundCleaner(steps ...CleanStep) *BackgroundCleaner {
+	if len(steps) == 0 {
+		steps = []CleanStep{CleanShadows, CleanBackground, CleanWatermark}
+	}
+	return &BackgroundCleaner{steps: steps, method: BackgroundMorphology, watermarkLevel: 200}
+}
+
+// WithMethod sets how the paper is estimated, BackgroundMorphology by
+// default.
+func (bc *BackgroundCleaner) WithMethod(method BackgroundMethod) *BackgroundCleaner {
+	bc.method = method
+	return bc
+}
+
+// WithKernelSize sets the size, in pixels, of the filter estimating the
+// paper. It must be wider than the strokes of the text; by default it is
+// a 30th of the shorter side of the page.
+func (bc *BackgroundCleaner) WithKernelSize(size int) *BackgroundCleaner {
+	bc.kernelSize = size
+	return bc
+}
+
+// WithWatermarkLevel whitens gray pixels at least this light, 200 by
+// default. Pale colored pixels are whitened from 60 levels darker.
+func (bc *BackgroundCleaner) WithWatermarkLevel(level byte) *BackgroundCleaner {
+	bc.watermarkLevel = level
+	return bc
+}
+
+// WithDebug writes the page before and after every step to dir.
+func (bc *BackgroundCleaner) WithDebug(dir string) *BackgroundCleaner {
+	bc.debugDir = dir
+	return bc
+}
+
+// Execute cleans the first page of an image file and writes it as a PNG
+// to outDir.
+func (bc *BackgroundCleaner) Execute(fileName string, outDir string) (string, error) {
+	img := gocv.IMRead(fileName, gocv.IMReadUnchanged)
+	if img.Empty() {
+		return "", fmt.Errorf("error reading the image %s", fileName)
+	}
+	defer img.Close()
+	if img.Channels() == 4 {
+		gocv.CvtColor(img, &img, gocv.ColorBGRAToBGR)
+	}
+
+	base := strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+	clean, err := bc.clean(img, base)
+	if err != nil {
+		return "", err
+	}
+	defer clean.Close()
+
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return "", fmt.Errorf("error creating the output folder: %w", err)
+	}
+	outFile := filepath.Join(outDir, base+"-clean.png")
+	if ok := gocv.IMWrite(outFile, clean); !ok {
+		return "", fmt.Errorf("error writing %s", outFile)
+	}
+	return outFile, nil
+}
+
+// Clean runs the steps over a gray or BGR page.
+func (bc *BackgroundCleaner) Clean(img gocv.Mat) (gocv.Mat, error) {
+	return bc.clean(img, "page")
+}
+
+func (bc *BackgroundCleaner) clean(img gocv.Mat, base string) (gocv.Mat, error) {
+	if bc.debugDir != "" {
+		if err := os.MkdirAll(bc.debugDir, os.ModePerm); err != nil {
+			return gocv.NewMat(), fmt.Errorf("error creating the debug folder: %w", err)
+		}
+	}
+
+	page := img.Clone()
+	for i, step := range bc.steps {
+		var cleaned gocv.Mat
+		var err error
+		switch step {
+		case CleanShadows:
+			cleaned, err = bc.removeShadows(page)
+		case CleanBackground:
+			cleaned, err = bc.removeBackground(page)
+		case CleanWatermark:
+			cleaned, err = gocv.NewMatFromBytes(page.Rows(), page.Cols(), page.Type(),
+				suppressWatermark(page.ToBytes(), page.Channels(), bc.watermarkLevel, bc.watermarkLevel-min(60, bc.watermarkLevel), 40))
+		default:
+			err = fmt.Errorf("unknown cleaning step %q", step)
+		}
+		if err != nil {
+			page.Close()
+			return gocv.NewMat(), fmt.Errorf("error removing the %s: %w", step, err)
+		}
+
+		if bc.debugDir != "" {
+			prefix := filepath.Join(bc.debugDir, fmt.Sprintf("%s-%d-%s", base, i+1, step))
+			if !gocv.IMWrite(prefix+"-before.png", page) || !gocv.IMWrite(prefix+"-after.png", cleaned) {
+				page.Close()
+				cleaned.Close()
+				return gocv.NewMat(), fmt.Errorf("error writing the debug images %s", prefix)
+			}
+		}
+		page.Close()
+		page = cleaned
+	}
+	return page, nil
+}
+
+// removeShadows relights the lightness channel, L of Lab for color pages.
+func (bc *BackgroundCleaner) removeShadows(page gocv.Mat) (gocv.Mat, error) {
+	if page.Channels() == 1 {
+		return bc.relightChannel(page)
+	}
+	lab := gocv.NewMat()
+	defer lab.Close()
+	gocv.CvtColor(page, &lab, gocv.ColorBGRToLab)
+	channels := gocv.Split(lab)
+	defer func() {
+		for _, c := range channels {
+			c.Close()
+		}
+	}()
+
+	lightness, err := bc.relightChannel(channels[0])
+	if err != nil {
+		return gocv.NewMat(), err
+	}
+	channels[0].Close()
+	channels[0] = lightness
+	gocv.Merge(channels, &lab)
+	bgr := gocv.NewMat()
+	gocv.CvtColor(lab, &bgr, gocv.ColorLabToBGR)
+	return bgr, nil
+}
+
+func (bc *BackgroundCleaner) relightChannel(channel gocv.Mat) (gocv.Mat, error) {
+	background := bc.background(channel)
+	defer background.Close()
+	paper := background.ToBytes()
+	return gocv.NewMatFromBytes(channel.Rows(), channel.Cols(), gocv.MatTypeCV8U,
+		relight(channel.ToBytes(), paper, paperLevel(paper)))
+}
+
+// removeBackground divides every channel by its own background, so
+// colored paper turns white too.
+func (bc *BackgroundCleaner) removeBackground(page gocv.Mat) (gocv.Mat, error) {
+	channels := gocv.Split(page)
+	defer func() {
+		for _, c := range channels {
+			c.Close()
+		}
+	}()
+	for i, c := range channels {
+		background := bc.background(c)
+		divided, err := gocv.NewMatFromBytes(c.Rows(), c.Cols(), gocv.MatTypeCV8U, divideBackground(c.ToBytes(), background.ToBytes()))
+		background.Close()
+		if err != nil {
+			return gocv.NewMat(), err
+		}
+		c.Close()
+		channels[i] = divided
+	}
+	if len(channels) == 1 {
+		return channels[0].Clone(), nil
+	}
+	merged := gocv.NewMat()
+	gocv.Merge(channels, &merged)
+	return merged, nil
+}
+
+// background estimates the paper under the ink of one channel, on a
+// downscaled copy, and smooths the estimate so no blocks of the kernel
+// show.
+func (bc *BackgroundCleaner) background(channel gocv.Mat) gocv.Mat {
+	size := bc.kernelSize
+	if size <= 0 {
+		size = max(15, min(channel.Cols(), channel.Rows())/30)
+	}
+	// Odd, as the median filter needs
+	kernel := max(3, size/backgroundScale) | 1
+
+	small := gocv.NewMat()
+	defer small.Close()
+	gocv.Resize(channel, &small, image.Pt(0, 0), 1.0/backgroundScale, 1.0/backgroundScale, gocv.InterpolationArea)
+	estimate := gocv.NewMat()
+	defer estimate.Close()
+	if bc.method == BackgroundMedian {
+		gocv.MedianBlur(small, &estimate, kernel)
+	} else {
+		element := gocv.GetStructuringElement(gocv.MorphRect, image.Pt(kernel, kernel))
+		gocv.MorphologyEx(small, &estimate, gocv.MorphClose, element)
+		element.Close()
+	}
+	gocv.GaussianBlur(estimate, &estimate, image.Pt(kernel, kernel), 0, 0, gocv.BorderReplicate)
+
+	background := gocv.NewMat()
+	gocv.Resize(estimate, &background, image.Pt(channel.Cols(), channel.Rows()), 0, 0, gocv.InterpolationLinear)
+	return background
+}
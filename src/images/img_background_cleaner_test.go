@@ -0,0 +1,75 @@
+package images
+
+import (
+	"image"
+	"os"
+	"slices"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+// Unit test for evening out the light of a page
+func TestIllumination(t *testing.T) {
+	if out := divideBackground([]byte{100, 30, 200}, []byte{200, 120, 200}); !slices.Equal(out, []byte{127, 63, 255}) {
+		t.Errorf("Expected the paper to turn white and the ink to keep its contrast, got %v", out)
+	}
+	if out := relight([]byte{50, 50, 100}, []byte{100, 200, 200}, 200); !slices.Equal(out, []byte{100, 50, 100}) {
+		t.Errorf("Expected only the shadowed pixel to be brightened, got %v", out)
+	}
+	// Black text, a faint gray watermark, a pale red one and a red stamp
+	pixels := []byte{30, 30, 30, 215, 215, 215, 180, 180, 250, 30, 30, 200}
+	expected := []byte{30, 30, 30, 255, 255, 255, 255, 255, 255, 30, 30, 200}
+	if out := suppressWatermark(pixels, 3, 200, 140, 40); !slices.Equal(out, expected) {
+		t.Errorf("Expected %v, got %v", expected, out)
+	}
+}
+
+// Unit test for removing the shadow, tint and watermarks of a photo
+func TestBackgroundCleaner(t *testing.T) {
+	debugDir := "../../output/test/background/"
+	cleanFile, err := NewBackgroundCleaner().WithDebug(debugDir).Execute("../../samples/documents/shaded-memo.jpg", debugDir)
+	if err != nil {
+		t.Fatalf("Error cleaning the page: %v", err)
+	}
+	for _, file := range []string{cleanFile, debugDir + "shaded-memo-1-shadows-before.png", debugDir + "shaded-memo-3-watermark-after.png"} {
+		if _, err := os.Stat(file); err != nil {
+			t.Errorf("Expected %s to be written", file)
+		}
+	}
+
+	clean := gocv.IMRead(cleanFile, gocv.IMReadGrayScale)
+	defer clean.Close()
+	darkPixels := func(box image.Rectangle) int {
+		region := clean.Region(box)
+		defer region.Close()
+		crop := region.Clone()
+		defer crop.Close()
+		dark := 0
+		for _, p := range crop.ToBytes() {
+			if p < 128 {
+				dark++
+			}
+		}
+		return dark
+	}
+	mean := func(box image.Rectangle) float64 {
+		region := clean.Region(box)
+		defer region.Close()
+		return region.Mean().Val1
+	}
+
+	// The paper in the shadow and in the light are both white
+	for _, paper := range []image.Rectangle{image.Rect(30, 1180, 110, 1260), image.Rect(1000, 200, 1150, 300)} {
+		if m := mean(paper); m < 240 {
+			t.Errorf("Expected white paper at %v, got a mean of %.0f", paper, m)
+		}
+	}
+	// The CONFIDENTIAL watermark is gone and the text kept
+	if dark := darkPixels(image.Rect(150, 1370, 900, 1460)); dark > 100 {
+		t.Errorf("Expected the watermark removed, got %d dark pixels", dark)
+	}
+	if dark := darkPixels(image.Rect(90, 195, 820, 235)); dark < 2000 {
+		t.Errorf("Expected the first line of text kept, got %d dark pixels", dark)
+	}
+}
@@ -0,0 +1,282 @@
+package images
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"gocv.io/x/gocv"
+)
+
+type Symbology string
+
+const (
+	SymbologyQRCode  Symbology = "qr-code"
+	SymbologyCode128 Symbology = "code128"
+	SymbologyEAN13   Symbology = "ean-13"
+	SymbologyCode39  Symbology = "code39"
+)
+
+// Barcode is a decoded barcode and the quadrangle it covers, in pixels.
+type Barcode struct {
+	Payload   string        `json:"payload"`
+	Symbology Symbology     `json:"symbology"`
+	Polygon   []image.Point `json:"polygon"`
+	Page      int           `json:"page"`
+}
+
+// Scanlines read across every candidate 1D barcode region
+const barcodeScanlines = 15
+
+// Candidate 1D barcode regions must be at least this big, in pixels
+const minBarcodeArea = 2000
+
+type BarcodeDetector struct {
+	qr gocv.QRCodeDetector
+}
+
+func NewBarcodeDetector() *BarcodeDetector {
+	return &BarcodeDetector{gocv.NewQRCodeDetector()}
+}
+
+func (bd *BarcodeDetector) Close() error {
+	return bd.qr.Close()
+}
+
+// Execute decodes the barcodes on every page of an image file. Multi-page
+// TIFFs are read page by page.
+func (bd *BarcodeDetector) Execute(fileName string) ([]Barcode, error) {
+	pages := gocv.IMReadMulti(fileName, gocv.IMReadColor)
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("error reading the image %s", fileName)
+	}
+
+	var barcodes []Barcode
+	for i, page := range pages {
+		barcodes = append(barcodes, bd.Detect(page, i)...)
+		page.Close()
+	}
+	return barcodes, nil
+}
+
+// Detect decodes the QR codes and 1D barcodes in one page image.
+func (bd *BarcodeDetector) Detect(img gocv.Mat, page int) []Barcode {
+	gray := gocv.NewMat()
+	defer gray.Close()
+	if img.Channels() == 1 {
+		img.CopyTo(&gray)
+	} else {
+		gocv.CvtColor(img, &gray, gocv.ColorBGRToGray)
+	}
+
+	barcodes := bd.detectQRCodes(gray, page)
+	for _, b := range bd.detectLinear(gray, page) {
+		if !overlapsBarcode(b, barcodes) {
+			barcodes = append(barcodes, b)
+		}
+	}
+	return barcodes
+}
+
+// detectQRCodes finds every QR code and decodes each from its own crop.
+// DetectAndDecodeMulti can't be used, as gocv drops its decoded strings.
+func (bd *BarcodeDetector) detectQRCodes(gray gocv.Mat, page int) []Barcode {
+	points := gocv.NewMat()
+	defer points.Close()
+	if !bd.qr.DetectMulti(gray, &points) || points.Empty() {
+		return nil
+	}
+	quads := quadrangles(points)
+
+	bounds := image.Rect(0, 0, gray.Cols(), gray.Rows())
+	var barcodes []Barcode
+	for _, quad := range quads {
+		rect := boundingRect(quad)
+		// Leave the quiet zone around the code in the crop
+		rect = rect.Inset(-max(rect.Dx(), rect.Dy()) / 8).Intersect(bounds)
+		if rect.Empty() {
+			continue
+		}
+
+		region := gray.Region(rect)
+		crop := region.Clone()
+		region.Close()
+		cropPoints := gocv.NewMat()
+		straight := gocv.NewMat()
+		payload := bd.qr.DetectAndDecode(crop, &cropPoints, &straight)
+		crop.Close()
+		cropPoints.Close()
+		straight.Close()
+
+		if payload != "" {
+			barcodes = append(barcodes, Barcode{payload, SymbologyQRCode, quad, page})
+		}
+	}
+	return barcodes
+}
+
+// quadrangles reads the corners returned by the QR code detector, four
+// float pairs per code.
+func quadrangles(points gocv.Mat) [][]image.Point {
+	values, err := points.DataPtrFloat32()
+	if err != nil {
+		return nil
+	}
+	var quads [][]image.Point
+	for i := 0; i+8 <= len(values); i += 8 {
+		quad := make([]image.Point, 4)
+		for k := range quad {
+			quad[k] = image.Pt(int(math.Round(float64(values[i+2*k]))), int(math.Round(float64(values[i+2*k+1]))))
+		}
+		quads = append(quads, quad)
+	}
+	return quads
+}
+
+// detectLinear looks for areas with strong gradients in a single direction,
+// the bars of a 1D barcode, and reads scanlines across them.
+func (bd *BarcodeDetector) detectLinear(gray gocv.Mat, page int) []Barcode {
+	gradX := gocv.NewMat()
+	defer gradX.Close()
+	gradY := gocv.NewMat()
+	defer gradY.Close()
+	gocv.Sobel(gray, &gradX, gocv.MatTypeCV32F, 1, 0, -1, 1, 0, gocv.BorderDefault)
+	gocv.Sobel(gray, &gradY, gocv.MatTypeCV32F, 0, 1, -1, 1, 0, gocv.BorderDefault)
+	gocv.ConvertScaleAbs(gradX, &gradX, 1, 0)
+	gocv.ConvertScaleAbs(gradY, &gradY, 1, 0)
+
+	var barcodes []Barcode
+	// Vertical bars first, then barcodes printed sideways
+	for _, grads := range [][2]gocv.Mat{{gradX, gradY}, {gradY, gradX}} {
+		for _, rect := range barcodeRegions(grads[0], grads[1]) {
+			if b, ok := decodeRegion(gray, rect); ok {
+				b.Page = page
+				if !overlapsBarcode(b, barcodes) {
+					barcodes = append(barcodes, b)
+				}
+			}
+		}
+	}
+	return barcodes
+}
+
+// barcodeRegions returns the areas where the along gradient dominates the
+// across one.
+func barcodeRegions(along, across gocv.Mat) []gocv.RotatedRect {
+	diff := gocv.NewMat()
+	defer diff.Close()
+	gocv.Subtract(along, across, &diff)
+	gocv.Blur(diff, &diff, image.Pt(9, 9))
+	gocv.Threshold(diff, &diff, 0, 255, gocv.ThresholdBinary+gocv.ThresholdOtsu)
+
+	// Join the bars, then drop thin lines and text
+	kernel := gocv.GetStructuringElement(gocv.MorphRect, image.Pt(21, 7))
+	defer kernel.Close()
+	gocv.MorphologyEx(diff, &diff, gocv.MorphClose, kernel)
+	small := gocv.GetStructuringElement(gocv.MorphRect, image.Pt(3, 3))
+	defer small.Close()
+	for i := 0; i < 4; i++ {
+		gocv.Erode(diff, &diff, small)
+	}
+	for i := 0; i < 4; i++ {
+		gocv.Dilate(diff, &diff, small)
+	}
+
+	contours := gocv.FindContours(diff, gocv.RetrievalExternal, gocv.ChainApproxSimple)
+	defer contours.Close()
+
+	var rects []gocv.RotatedRect
+	for i := 0; i < contours.Size(); i++ {
+		contour := contours.At(i)
+		if gocv.ContourArea(contour) < minBarcodeArea {
+			continue
+		}
+		rects = append(rects, gocv.MinAreaRect(contour))
+	}
+	return rects
+}
+
+// decodeRegion straightens a candidate region and reads scanlines across
+// it in both directions, keeping the payload most of them agree on.
+func decodeRegion(gray gocv.Mat, rect gocv.RotatedRect) (Barcode, bool) {
+	rotation := gocv.GetRotationMatrix2D(rect.Center, rect.Angle, 1)
+	defer rotation.Close()
+	upright := gocv.NewMat()
+	defer upright.Close()
+	gocv.WarpAffineWithParams(gray, &upright, rotation, image.Pt(gray.Cols(), gray.Rows()),
+		gocv.InterpolationLinear, gocv.BorderConstant, color.RGBA{255, 255, 255, 0})
+
+	// Where the region ended up, widened so the quiet zones are included
+	corners := make([]image.Point, len(rect.Points))
+	for i, p := range rect.Points {
+		x, y := float64(p.X), float64(p.Y)
+		corners[i] = image.Pt(
+			int(rotation.GetDoubleAt(0, 0)*x+rotation.GetDoubleAt(0, 1)*y+rotation.GetDoubleAt(0, 2)),
+			int(rotation.GetDoubleAt(1, 0)*x+rotation.GetDoubleAt(1, 1)*y+rotation.GetDoubleAt(1, 2)))
+	}
+	box := boundingRect(corners)
+	crop := image.Rect(box.Min.X-box.Dx()/4, box.Min.Y-box.Dy()/4, box.Max.X+box.Dx()/4, box.Max.Y+box.Dy()/4).
+		Intersect(image.Rect(0, 0, upright.Cols(), upright.Rows()))
+	if crop.Empty() {
+		return Barcode{}, false
+	}
+	region := upright.Region(crop)
+	defer region.Close()
+	pixels := region.Clone()
+	defer pixels.Close()
+	data := pixels.ToBytes()
+	cols, rows := pixels.Cols(), pixels.Rows()
+
+	votes := map[Symbology]map[string]int{}
+	vote := func(line []byte) {
+		if symbology, payload, ok := decodeScanline(line); ok {
+			if votes[symbology] == nil {
+				votes[symbology] = map[string]int{}
+			}
+			votes[symbology][payload]++
+		}
+	}
+	for i := 1; i <= barcodeScanlines; i++ {
+		y := rows * i / (barcodeScanlines + 1)
+		vote(data[y*cols : (y+1)*cols])
+		x := cols * i / (barcodeScanlines + 1)
+		column := make([]byte, rows)
+		for k := range column {
+			column[k] = data[k*cols+x]
+		}
+		vote(column)
+	}
+
+	best := Barcode{}
+	count := 0
+	for symbology, payloads := range votes {
+		for payload, n := range payloads {
+			if n > count || (n == count && payload < best.Payload) {
+				best, count = Barcode{Payload: payload, Symbology: symbology}, n
+			}
+		}
+	}
+	best.Polygon = rect.Points
+	return best, count > 0
+}
+
+func boundingRect(points []image.Point) image.Rectangle {
+	rect := image.Rectangle{Min: points[0], Max: points[0]}
+	for _, p := range points[1:] {
+		rect.Min.X, rect.Min.Y = min(rect.Min.X, p.X), min(rect.Min.Y, p.Y)
+		rect.Max.X, rect.Max.Y = max(rect.Max.X, p.X), max(rect.Max.Y, p.Y)
+	}
+	return rect
+}
+
+// overlapsBarcode reports whether b was already found, e.g. by another
+// detection pass.
+func overlapsBarcode(b Barcode, found []Barcode) bool {
+	for _, f := range found {
+		if f.Page == b.Page && !boundingRect(f.Polygon).Intersect(boundingRect(b.Polygon)).Empty() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package images
+
+import (
+	"strings"
+	"testing"
+)
+
+// scanline draws run widths, starting with a bar, as a row of pixels with
+// quiet zones on both sides
+func scanline(widths []int, module int) []byte {
+	row := make([]byte, 0)
+	quiet := func() {
+		for i := 0; i < 12*module; i++ {
+			row = append(row, 230)
+		}
+	}
+	quiet()
+	for i, w := range widths {
+		value := byte(20)
+		if i%2 == 1 {
+			value = 230
+		}
+		for k := 0; k < w*module; k++ {
+			row = append(row, value)
+		}
+	}
+	quiet()
+	return row
+}
+
+func ean13Widths(code string) []int {
+	widths := []int{1, 1, 1}
+	parity := eanFirstDigit[code[0]-'0']
+	for i := 1; i <= 6; i++ {
+		p := eanPatterns[code[i]-'0']
+		if parity[i-1] == 'G' {
+			p = []int{p[3], p[2], p[1], p[0]}
+		}
+		widths = append(widths, p...)
+	}
+	widths = append(widths, 1, 1, 1, 1, 1)
+	for i := 7; i <= 12; i++ {
+		widths = append(widths, eanPatterns[code[i]-'0']...)
+	}
+	return append(widths, 1, 1, 1)
+}
+
+func code128Widths(values []int) []int {
+	check := values[0]
+	for i, v := range values[1:] {
+		check += (i + 1) * v
+	}
+	var widths []int
+	for _, v := range append(values, check%103, code128Stop) {
+		widths = append(widths, code128Patterns[v]...)
+	}
+	return append(widths, 2)
+}
+
+func code39Widths(text string) []int {
+	var widths []int
+	for _, c := range "*" + text + "*" {
+		pattern := code39Patterns[strings.IndexRune(code39Alphabet, c)]
+		for bit := 8; bit >= 0; bit-- {
+			widths = append(widths, 1+2*(pattern>>bit&1))
+		}
+		widths = append(widths, 1)
+	}
+	return widths[:len(widths)-1]
+}
+
+// Unit test for decoding 1D barcodes from scanlines
+func TestDecodeScanline(t *testing.T) {
+	tests := []struct {
+		name      string
+		row       []byte
+		symbology Symbology
+		payload   string
+	}{
+		{"ean-13", scanline(ean13Widths("4006381333931"), 3), SymbologyEAN13, "4006381333931"},
+		// Code B "Ship-42", then code C for the digit pairs of "123456"
+		{"code128", scanline(code128Widths([]int{104, 51, 72, 73, 80, 13, 20, 18, 99, 12, 34, 56}), 2),
+			SymbologyCode128, "Ship-42123456"},
+		{"code39", scanline(code39Widths("INV-2024/7"), 2), SymbologyCode39, "INV-2024/7"},
+	}
+
+	for _, test := range tests {
+		reversed := make([]byte, len(test.row))
+		for i, p := range test.row {
+			reversed[len(test.row)-1-i] = p
+		}
+		for _, row := range [][]byte{test.row, reversed} {
+			symbology, payload, ok := decodeScanline(row)
+			if !ok || symbology != test.symbology || payload != test.payload {
+				t.Errorf("%s: expected %s %q, got %s %q (%v)", test.name, test.symbology, test.payload, symbology, payload, ok)
+			}
+		}
+	}
+}
+
+// Unit test for rejecting scanlines with bad check digits
+func TestDecodeScanlineChecksum(t *testing.T) {
+	widths := ean13Widths("4006381333931")
+	// Swap the last digit for a 2
+	copy(widths[len(widths)-7:], eanPatterns[2])
+	if _, payload, ok := decodeScanline(scanline(widths, 3)); ok {
+		t.Errorf("Expected the bad EAN-13 check digit to be rejected, got %q", payload)
+	}
+
+	widths = code128Widths([]int{104, 33, 34})
+	copy(widths[6:], code128Patterns[35])
+	if _, payload, ok := decodeScanline(scanline(widths, 3)); ok {
+		t.Errorf("Expected the bad Code 128 check symbol to be rejected, got %q", payload)
+	}
+}
+
+// Unit test for finding and decoding the barcodes of a shipping label
+func TestBarcodeDetector(t *testing.T) {
+	bd := NewBarcodeDetector()
+	defer bd.Close()
+
+	barcodes, err := bd.Execute("../../samples/images/shipping-label.png")
+	if err != nil {
+		t.Fatalf("Error detecting barcodes: %v", err)
+	}
+
+	expected := map[Symbology]string{
+		SymbologyQRCode:  "https://example.com/track/SHP-20240117",
+		SymbologyCode128: "SHP-20240117",
+		SymbologyEAN13:   "4006381333931",
+		SymbologyCode39:  "PO-7781",
+	}
+	found := map[Symbology]string{}
+	for _, b := range barcodes {
+		found[b.Symbology] = b.Payload
+		if len(b.Polygon) != 4 || b.Page != 0 {
+			t.Errorf("Unexpected polygon %v or page %d for %s", b.Polygon, b.Page, b.Symbology)
+		}
+	}
+	for symbology, payload := range expected {
+		if found[symbology] != payload {
+			t.Errorf("Expected %s %q, got %q", symbology, payload, found[symbology])
+		}
+	}
+}
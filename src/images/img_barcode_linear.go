@@ -0,0 +1,391 @@
+package images
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Decoding of 1D barcodes from single scanlines. A scanline is turned into
+// the widths of its alternating light and dark runs, which the decoders
+// match against the bar patterns of each symbology.
+
+// Minimum difference between the darkest and lightest pixel of a scanline
+const minScanlineContrast = 40
+
+// linearDecoders are tried in order on every scanline, forwards and backwards.
+var linearDecoders = []struct {
+	symbology Symbology
+	decode    func(runs []int) (string, bool)
+}{
+	{SymbologyEAN13, decodeEAN13},
+	{SymbologyCode128, decodeCode128},
+	{SymbologyCode39, decodeCode39},
+}
+
+// decodeScanline reads a 1D barcode crossed by a row of gray pixels.
+func decodeScanline(row []byte) (Symbology, string, bool) {
+	runs := scanlineRuns(row)
+	if runs == nil {
+		return "", "", false
+	}
+	reversed := make([]int, len(runs))
+	for i, r := range runs {
+		reversed[len(runs)-1-i] = r
+	}
+
+	for _, rs := range [][]int{runs, reversed} {
+		for _, d := range linearDecoders {
+			if payload, ok := d.decode(rs); ok {
+				return d.symbology, payload, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// scanlineRuns returns the widths of the runs of a scanline, starting and
+// ending with light ones, possibly empty. Dark runs are at odd indices.
+func scanlineRuns(row []byte) []int {
+	lo, hi := byte(255), byte(0)
+	for _, p := range row {
+		lo, hi = min(lo, p), max(hi, p)
+	}
+	if int(hi)-int(lo) < minScanlineContrast {
+		return nil
+	}
+	threshold := (int(lo) + int(hi)) / 2
+
+	runs := []int{0}
+	dark := false
+	for _, p := range row {
+		if (int(p) < threshold) != dark {
+			dark = !dark
+			runs = append(runs, 0)
+		}
+		runs[len(runs)-1]++
+	}
+	if dark {
+		runs = append(runs, 0)
+	}
+	return runs
+}
+
+func sum(values []int) int {
+	total := 0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+// matchPattern finds the pattern closest to the run widths, with both
+// scaled to the same number of modules. It returns -1 when none is close.
+func matchPattern(runs []int, patterns [][]int, modules int, maxDistance float64) int {
+	total := float64(sum(runs))
+	if total == 0 {
+		return -1
+	}
+	best, bestDistance := -1, maxDistance
+	for i, p := range patterns {
+		distance := 0.0
+		for k, r := range runs {
+			distance += math.Abs(float64(r)*float64(modules)/total - float64(p[k]))
+		}
+		if distance < bestDistance {
+			best, bestDistance = i, distance
+		}
+	}
+	return best
+}
+
+// EAN-13 digit patterns as the widths of space, bar, space, bar. G codes
+// are these reversed and right hand R codes use the same widths starting
+// with a bar.
+var eanPatterns = [][]int{
+	{3, 2, 1, 1}, {2, 2, 2, 1}, {2, 1, 2, 2}, {1, 4, 1, 1}, {1, 1, 3, 2},
+	{1, 2, 3, 1}, {1, 1, 1, 4}, {1, 3, 1, 2}, {1, 2, 1, 3}, {3, 1, 1, 2},
+}
+
+// The first digit of an EAN-13 is given by which left digits use G codes
+var eanFirstDigit = []string{
+	"LLLLLL", "LLGLGG", "LLGGLG", "LLGGGL", "LGLLGG",
+	"LGGLLG", "LGGGLL", "LGLGLG", "LGLGGL", "LGGLGL",
+}
+
+// eanLeftPatterns are the L codes followed by the G codes.
+var eanLeftPatterns = func() [][]int {
+	patterns := append([][]int{}, eanPatterns...)
+	for _, p := range eanPatterns {
+		patterns = append(patterns, []int{p[3], p[2], p[1], p[0]})
+	}
+	return patterns
+}()
+
+func decodeEAN13(runs []int) (string, bool) {
+	// Guards, 12 digits of 4 runs and the middle guard
+	const width = 3 + 24 + 5 + 24 + 3
+	for i := 1; i+width < len(runs); i += 2 {
+		module := float64(sum(runs[i:i+width])) / 95
+		if float64(runs[i-1]) < 5*module || float64(runs[i+width]) < 5*module ||
+			!isGuard(runs[i:i+3], module) {
+			continue
+		}
+
+		digits := make([]int, 13)
+		parity := ""
+		pos := i + 3
+		ok := true
+		for d := 1; d <= 6 && ok; d++ {
+			m := matchPattern(runs[pos:pos+4], eanLeftPatterns, 7, 1.5)
+			ok = m >= 0
+			digits[d] = m % 10
+			if m >= 10 {
+				parity += "G"
+			} else {
+				parity += "L"
+			}
+			pos += 4
+		}
+		if !ok || !isGuard(runs[pos:pos+5], module) {
+			continue
+		}
+		pos += 5
+		for d := 7; d <= 12 && ok; d++ {
+			m := matchPattern(runs[pos:pos+4], eanPatterns, 7, 1.5)
+			ok = m >= 0
+			digits[d] = m
+			pos += 4
+		}
+		if !ok || !isGuard(runs[pos:pos+3], module) {
+			continue
+		}
+
+		digits[0] = -1
+		for first, p := range eanFirstDigit {
+			if p == parity {
+				digits[0] = first
+			}
+		}
+		if digits[0] < 0 {
+			continue
+		}
+
+		check := 0
+		for k, d := range digits[:12] {
+			check += d * (1 + 2*(k%2))
+		}
+		if (10-check%10)%10 != digits[12] {
+			continue
+		}
+
+		var sb strings.Builder
+		for _, d := range digits {
+			sb.WriteByte(byte('0' + d))
+		}
+		return sb.String(), true
+	}
+	return "", false
+}
+
+// isGuard reports whether runs are all about one module wide.
+func isGuard(runs []int, module float64) bool {
+	for _, r := range runs {
+		if float64(r) < 0.4*module || float64(r) > 2*module {
+			return false
+		}
+	}
+	return true
+}
+
+// Code 128 symbol patterns as the widths of bar, space, bar, space, bar,
+// space. The stop pattern, 106, has a final two module bar not listed here.
+var code128Patterns = [][]int{
+	{2, 1, 2, 2, 2, 2}, {2, 2, 2, 1, 2, 2}, {2, 2, 2, 2, 2, 1}, {1, 2, 1, 2, 2, 3}, {1, 2, 1, 3, 2, 2},
+	{1, 3, 1, 2, 2, 2}, {1, 2, 2, 2, 1, 3}, {1, 2, 2, 3, 1, 2}, {1, 3, 2, 2, 1, 2}, {2, 2, 1, 2, 1, 3},
+	{2, 2, 1, 3, 1, 2}, {2, 3, 1, 2, 1, 2}, {1, 1, 2, 2, 3, 2}, {1, 2, 2, 1, 3, 2}, {1, 2, 2, 2, 3, 1},
+	{1, 1, 3, 2, 2, 2}, {1, 2, 3, 1, 2, 2}, {1, 2, 3, 2, 2, 1}, {2, 2, 3, 2, 1, 1}, {2, 2, 1, 1, 3, 2},
+	{2, 2, 1, 2, 3, 1}, {2, 1, 3, 2, 1, 2}, {2, 2, 3, 1, 1, 2}, {3, 1, 2, 1, 3, 1}, {3, 1, 1, 2, 2, 2},
+	{3, 2, 1, 1, 2, 2}, {3, 2, 1, 2, 2, 1}, {3, 1, 2, 2, 1, 2}, {3, 2, 2, 1, 1, 2}, {3, 2, 2, 2, 1, 1},
+	{2, 1, 2, 1, 2, 3}, {2, 1, 2, 3, 2, 1}, {2, 3, 2, 1, 2, 1}, {1, 1, 1, 3, 2, 3}, {1, 3, 1, 1, 2, 3},
+	{1, 3, 1, 3, 2, 1}, {1, 1, 2, 3, 1, 3}, {1, 3, 2, 1, 1, 3}, {1, 3, 2, 3, 1, 1}, {2, 1, 1, 3, 1, 3},
+	{2, 3, 1, 1, 1, 3}, {2, 3, 1, 3, 1, 1}, {1, 1, 2, 1, 3, 3}, {1, 1, 2, 3, 3, 1}, {1, 3, 2, 1, 3, 1},
+	{1, 1, 3, 1, 2, 3}, {1, 1, 3, 3, 2, 1}, {1, 3, 3, 1, 2, 1}, {3, 1, 3, 1, 2, 1}, {2, 1, 1, 3, 3, 1},
+	{2, 3, 1, 1, 3, 1}, {2, 1, 3, 1, 1, 3}, {2, 1, 3, 3, 1, 1}, {2, 1, 3, 1, 3, 1}, {3, 1, 1, 1, 2, 3},
+	{3, 1, 1, 3, 2, 1}, {3, 3, 1, 1, 2, 1}, {3, 1, 2, 1, 1, 3}, {3, 1, 2, 3, 1, 1}, {3, 3, 2, 1, 1, 1},
+	{3, 1, 4, 1, 1, 1}, {2, 2, 1, 4, 1, 1}, {4, 3, 1, 1, 1, 1}, {1, 1, 1, 2, 2, 4}, {1, 1, 1, 4, 2, 2},
+	{1, 2, 1, 1, 2, 4}, {1, 2, 1, 4, 2, 1}, {1, 4, 1, 1, 2, 2}, {1, 4, 1, 2, 2, 1}, {1, 1, 2, 2, 1, 4},
+	{1, 1, 2, 4, 1, 2}, {1, 2, 2, 1, 1, 4}, {1, 2, 2, 4, 1, 1}, {1, 4, 2, 1, 1, 2}, {1, 4, 2, 2, 1, 1},
+	{2, 4, 1, 2, 1, 1}, {2, 2, 1, 1, 1, 4}, {4, 1, 3, 1, 1, 1}, {2, 4, 1, 1, 1, 2}, {1, 3, 4, 1, 1, 1},
+	{1, 1, 1, 2, 4, 2}, {1, 2, 1, 1, 4, 2}, {1, 2, 1, 2, 4, 1}, {1, 1, 4, 2, 1, 2}, {1, 2, 4, 1, 1, 2},
+	{1, 2, 4, 2, 1, 1}, {4, 1, 1, 2, 1, 2}, {4, 2, 1, 1, 1, 2}, {4, 2, 1, 2, 1, 1}, {2, 1, 2, 1, 4, 1},
+	{2, 1, 4, 1, 2, 1}, {4, 1, 2, 1, 2, 1}, {1, 1, 1, 1, 4, 3}, {1, 1, 1, 3, 4, 1}, {1, 3, 1, 1, 4, 1},
+	{1, 1, 4, 1, 1, 3}, {1, 1, 4, 3, 1, 1}, {4, 1, 1, 1, 1, 3}, {4, 1, 1, 3, 1, 1}, {1, 1, 3, 1, 4, 1},
+	{1, 1, 4, 1, 3, 1}, {3, 1, 1, 1, 4, 1}, {4, 1, 1, 1, 3, 1}, {2, 1, 1, 4, 1, 2}, {2, 1, 1, 2, 1, 4},
+	{2, 1, 1, 2, 3, 2}, {2, 3, 3, 1, 1, 1},
+}
+
+const (
+	code128StartA = 103
+	code128StartC = 105
+	code128Stop   = 106
+)
+
+func decodeCode128(runs []int) (string, bool) {
+	for i := 1; i+6 < len(runs); i += 2 {
+		start := matchPattern(runs[i:i+6], code128Patterns, 11, 1.5)
+		if start < code128StartA || start > code128StartC ||
+			float64(runs[i-1]) < 5*float64(sum(runs[i:i+6]))/11 {
+			continue
+		}
+
+		values := []int{start}
+		for pos := i + 6; pos+6 < len(runs); pos += 6 {
+			v := matchPattern(runs[pos:pos+6], code128Patterns, 11, 1.5)
+			if v < 0 || (v >= code128StartA && v <= code128StartC) {
+				break
+			}
+			values = append(values, v)
+			if v == code128Stop {
+				break
+			}
+		}
+		// Start, check symbol and stop at the least
+		n := len(values)
+		if n < 3 || values[n-1] != code128Stop {
+			continue
+		}
+
+		check := values[0]
+		for k := 1; k < n-2; k++ {
+			check += k * values[k]
+		}
+		if check%103 != values[n-2] {
+			continue
+		}
+
+		if text, ok := code128Text(values[:n-2]); ok {
+			return text, true
+		}
+	}
+	return "", false
+}
+
+// code128Text turns symbol values, starting with the start symbol, into
+// text. FNC1 after the first position becomes a GS separator, as in GS1
+// data.
+func code128Text(values []int) (string, bool) {
+	const (
+		setA = iota
+		setB
+		setC
+	)
+	set := values[0] - code128StartA
+	shift := false
+
+	var sb strings.Builder
+	for k, v := range values[1:] {
+		current := set
+		if shift {
+			current = setA + setB - set
+			shift = false
+		}
+
+		if current == setC {
+			switch {
+			case v < 100:
+				fmt.Fprintf(&sb, "%02d", v)
+			case v == 100:
+				set = setB
+			case v == 101:
+				set = setA
+			case v == 102 && k > 0:
+				sb.WriteByte(0x1d)
+			}
+			continue
+		}
+
+		switch {
+		case v < 64 || (v < 96 && current == setB):
+			sb.WriteByte(byte(v + 32))
+		case v < 96:
+			sb.WriteByte(byte(v - 64))
+		case v == 98:
+			shift = true
+		case v == 99:
+			set = setC
+		case v == 100 && current == setA:
+			set = setB
+		case v == 101 && current == setB:
+			set = setA
+		case v == 102 && k > 0:
+			sb.WriteByte(0x1d)
+		}
+	}
+
+	return sb.String(), sb.Len() > 0
+}
+
+// Code 39 characters and their patterns, one bit per element from the
+// first bar, set for wide elements.
+const code39Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ-. $/+%*"
+
+var code39Patterns = []int{
+	0x034, 0x121, 0x061, 0x160, 0x031, 0x130, 0x070, 0x025, 0x124, 0x064,
+	0x109, 0x049, 0x148, 0x019, 0x118, 0x058, 0x00D, 0x10C, 0x04C, 0x01C,
+	0x103, 0x043, 0x142, 0x013, 0x112, 0x052, 0x007, 0x106, 0x046, 0x016,
+	0x181, 0x0C1, 0x1C0, 0x091, 0x190, 0x0D0, 0x085, 0x184, 0x0C4, 0x0A8,
+	0x0A2, 0x08A, 0x02A, 0x094,
+}
+
+func decodeCode39(runs []int) (string, bool) {
+	for i := 1; i+9 < len(runs); i += 2 {
+		if c, ok := code39Char(runs[i : i+9]); !ok || c != '*' ||
+			float64(runs[i-1]) < float64(sum(runs[i:i+9]))/2 {
+			continue
+		}
+
+		var sb strings.Builder
+		// Characters are separated by a narrow space
+		for pos := i + 10; pos+9 < len(runs); pos += 10 {
+			c, ok := code39Char(runs[pos : pos+9])
+			if !ok {
+				break
+			}
+			if c == '*' {
+				if sb.Len() > 0 {
+					return sb.String(), true
+				}
+				break
+			}
+			sb.WriteByte(c)
+		}
+	}
+	return "", false
+}
+
+// code39Char decodes the nine elements of a character, three of which are
+// wide.
+func code39Char(runs []int) (byte, bool) {
+	sorted := append([]int{}, runs...)
+	sort.Ints(sorted)
+	// Wide elements are two to three times the narrow ones
+	if float64(sorted[6]) < 1.5*float64(sorted[5]) {
+		return 0, false
+	}
+
+	pattern := 0
+	for _, r := range runs {
+		pattern <<= 1
+		if r >= sorted[6] {
+			pattern |= 1
+		}
+	}
+	for k, p := range code39Patterns {
+		if p == pattern {
+			return code39Alphabet[k], true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,200 @@
+package images
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+// Checkbox is a square box or round bubble to mark on a form.
+type Checkbox struct {
+	Box   image.Rectangle `json:"box"`
+	Shape MarkShape       `json:"shape"`
+	State MarkState       `json:"state"`
+	// Share of the inside of the mark covered with ink
+	Fill float64 `json:"fill"`
+	// From 0.5 to 1, how clearly the fill tells the state
+	Confidence float64 `json:"confidence"`
+	// The text next to the mark, only read WithLabels
+	Label string `json:"label,omitempty"`
+	Page  int    `json:"page"`
+}
+
+type CheckboxDetector struct {
+	language string
+	minSize  int
+	maxSize  int
+}
+
+func NewCheckboxDetector() *CheckboxDetector {
+	return &CheckboxDetector{minSize: 12, maxSize: 100}
+}
+
+// WithLabels OCRs every page and links each mark to the text next to it.
+func (cd *CheckboxDetector) WithLabels(language string) *CheckboxDetector {
+	cd.language = language
+	return cd
+}
+
+// WithMarkSize sets the smallest and largest marks looked for, in pixels,
+// 12 and 100 by default.
+func (cd *CheckboxDetector) WithMarkSize(minSize, maxSize int) *CheckboxDetector {
+	cd.minSize = minSize
+	cd.maxSize = maxSize
+	return cd
+}
+
+// Execute finds the marks on every page of an image file, from top to
+// bottom and left to right. Multi-page TIFFs are read page by page.
+func (cd *CheckboxDetector) Execute(fileName string) ([]Checkbox, error) {
+	pages := gocv.IMReadMulti(fileName, gocv.IMReadColor)
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("error reading the image %s", fileName)
+	}
+	defer func() {
+		for _, page := range pages {
+			page.Close()
+		}
+	}()
+
+	var marks []Checkbox
+	for i, page := range pages {
+		found, err := cd.Detect(page, i)
+		if err != nil {
+			return nil, fmt.Errorf("error detecting marks on page %d: %w", i+1, err)
+		}
+		marks = append(marks, found...)
+	}
+	return marks, nil
+}
+
+// ExecuteOMR reads an answer sheet, arranging the marks of every page in
+// a grid of questions and choices.
+func (cd *CheckboxDetector) ExecuteOMR(fileName string) ([]OMRSheet, error) {
+	marks, err := cd.Execute(fileName)
+	if err != nil {
+		return nil, err
+	}
+	pages := map[int][]Checkbox{}
+	last := 0
+	for _, m := range marks {
+		pages[m.Page] = append(pages[m.Page], m)
+		last = max(last, m.Page)
+	}
+	var sheets []OMRSheet
+	for page := 0; page <= last; page++ {
+		sheets = append(sheets, omrSheet(pages[page], page))
+	}
+	return sheets, nil
+}
+
+// Detect finds the marks in one page image.
+func (cd *CheckboxDetector) Detect(img gocv.Mat, page int) ([]Checkbox, error) {
+	gray := gocv.NewMat()
+	defer gray.Close()
+	if img.Channels() == 1 {
+		img.CopyTo(&gray)
+	} else {
+		gocv.CvtColor(img, &gray, gocv.ColorBGRToGray)
+	}
+	ink := gocv.NewMat()
+	defer ink.Close()
+	gocv.Threshold(gray, &ink, 0, 255, gocv.ThresholdBinaryInv+gocv.ThresholdOtsu)
+	pixels := ink.ToBytes()
+	components := inkComponents(ink, nil)
+
+	// Every outline is kept, marks may be drawn inside table cells
+	contours := gocv.FindContours(ink, gocv.RetrievalList, gocv.ChainApproxSimple)
+	defer contours.Close()
+
+	var boxes []image.Rectangle
+	var shapes []MarkShape
+	for i := 0; i < contours.Size(); i++ {
+		contour := contours.At(i)
+		box := gocv.BoundingRect(contour)
+		if box.Dx() < cd.minSize || box.Dy() < cd.minSize || box.Dx() > cd.maxSize || box.Dy() > cd.maxSize {
+			continue
+		}
+		if aspect := float64(box.Dx()) / float64(box.Dy()); aspect < 0.8 || aspect > 1.25 {
+			continue
+		}
+		shape, ok := markShape(contour, box)
+		if !ok || !framed(pixels, ink.Cols(), box, shape) {
+			continue
+		}
+		boxes = append(boxes, box)
+		shapes = append(shapes, shape)
+	}
+
+	minSize := float64(letterHeight(components, boxes)) * 1.15
+	var marks []Checkbox
+	var markBoxes []image.Rectangle
+	for _, i := range dropNested(boxes) {
+		if float64(max(boxes[i].Dx(), boxes[i].Dy())) <= minSize || !isolated(boxes[i], components) {
+			continue
+		}
+		fill := fillRatio(pixels, ink.Cols(), boxes[i], shapes[i])
+		state, confidence := classifyMark(fill)
+		marks = append(marks, Checkbox{
+			Box:        boxes[i],
+			Shape:      shapes[i],
+			State:      state,
+			Fill:       fill,
+			Confidence: confidence,
+			Page:       page,
+		})
+		markBoxes = append(markBoxes, boxes[i])
+	}
+
+	if cd.language != "" && len(marks) > 0 {
+		boxes, err := readWords(gray, cd.language)
+		if err != nil {
+			return nil, err
+		}
+		var words []labelWord
+		for _, b := range boxes {
+			if text := strings.TrimSpace(b.Word); text != "" && b.Confidence >= minPrintedConfidence {
+				words = append(words, labelWord{b.Box, text})
+			}
+		}
+		for i := range marks {
+			marks[i].Label = labelFor(marks[i].Box, words, markBoxes)
+		}
+	}
+
+	sort.SliceStable(marks, func(i, j int) bool {
+		a, b := marks[i].Box, marks[j].Box
+		if a.Max.Y <= b.Min.Y || b.Max.Y <= a.Min.Y {
+			return a.Min.Y < b.Min.Y
+		}
+		return a.Min.X < b.Min.X
+	})
+	return marks, nil
+}
+
+// markShape tells a square from a circle: a square simplifies to four
+// corners and fills its bounding box, a circle is as round as its
+// perimeter allows and covers about pi/4 of the box.
+func markShape(contour gocv.PointVector, box image.Rectangle) (MarkShape, bool) {
+	area := gocv.ContourArea(contour)
+	perimeter := gocv.ArcLength(contour, true)
+	if perimeter == 0 {
+		return "", false
+	}
+	extent := area / float64(box.Dx()*box.Dy())
+
+	approx := gocv.ApproxPolyDP(contour, 0.04*perimeter, true)
+	defer approx.Close()
+	if approx.Size() == 4 && extent > 0.8 {
+		return MarkSquare, true
+	}
+	circularity := 4 * math.Pi * area / (perimeter * perimeter)
+	if circularity > 0.75 && extent > 0.7 && extent < 0.85 {
+		return MarkCircle, true
+	}
+	return "", false
+}
@@ -0,0 +1,103 @@
+package images
+
+import (
+	"image"
+	"strings"
+	"testing"
+)
+
+// Unit test for reading the state of marks and arranging them in a grid
+func TestCheckboxMarks(t *testing.T) {
+	for fill, expected := range map[float64]MarkState{0: MarkUnchecked, 0.3: MarkChecked, 0.52: MarkChecked, 0.95: MarkFilled} {
+		if state, confidence := classifyMark(fill); state != expected || confidence < 0.5 || confidence > 1 {
+			t.Errorf("Expected a fill of %.2f to be %s, got %s with confidence %.2f", fill, expected, state, confidence)
+		}
+	}
+
+	// Two blocks of three questions with choices A to C
+	var marks []Checkbox
+	answers := []string{"A", "", "BC", "C", "B", "A"}
+	for q, answer := range answers {
+		for c := 0; c < 3; c++ {
+			x, y := 100+(q/3)*400+c*50, 100+(q%3)*40
+			mark := Checkbox{Box: image.Rect(x, y, x+24, y+24), Shape: MarkCircle, State: MarkUnchecked}
+			if strings.ContainsRune(answer, rune('A'+c)) {
+				mark.State = MarkFilled
+			}
+			marks = append(marks, mark)
+		}
+	}
+	sheet := omrSheet(marks, 0)
+	if sheet.Choices != 3 || len(sheet.Questions) != len(answers) {
+		t.Fatalf("Expected %d questions of 3 choices, got %d of %d", len(answers), len(sheet.Questions), sheet.Choices)
+	}
+	for i, question := range sheet.Questions {
+		if question.Number != i+1 || question.Answer() != answers[i] || len(question.Marks) != 3 {
+			t.Errorf("Expected question %d to be answered %q, got %d: %q", i+1, answers[i], question.Number, question.Answer())
+		}
+	}
+
+	words := []labelWord{
+		{image.Rect(100, 4, 110, 24), "I"}, {image.Rect(116, 4, 170, 26), "agree"},
+		{image.Rect(520, 4, 600, 26), "Monthly"}, {image.Rect(606, 4, 650, 26), "plan"}}
+	boxes := []image.Rectangle{image.Rect(60, 0, 86, 26), image.Rect(480, 0, 506, 26)}
+	for i, expected := range []string{"I agree", "Monthly plan"} {
+		if label := labelFor(boxes[i], words, boxes); label != expected {
+			t.Errorf("Expected the label %q, got %q", expected, label)
+		}
+	}
+}
+
+// Unit test for detecting the checkboxes of a form with their labels
+func TestCheckboxDetector(t *testing.T) {
+	expected := []struct {
+		shape MarkShape
+		state MarkState
+		label string
+	}{
+		{MarkSquare, MarkChecked, "agree to the terms"},
+		{MarkCircle, MarkUnchecked, "Monthly plan"},
+		{MarkSquare, MarkUnchecked, "Send me the newsletter"},
+		{MarkCircle, MarkFilled, "Yearly plan"},
+		{MarkSquare, MarkChecked, "Contact me by email"},
+		{MarkCircle, MarkChecked, "Student discount"},
+		{MarkSquare, MarkFilled, "Contact me by phone"},
+		{MarkCircle, MarkUnchecked, "Gift membership"},
+	}
+
+	marks, err := NewCheckboxDetector().WithLabels("eng").Execute("../../samples/documents/form-checkboxes.png")
+	if err != nil {
+		t.Fatalf("Error detecting marks: %v", err)
+	}
+	if len(marks) != len(expected) {
+		t.Fatalf("Expected %d marks, got %d: %v", len(expected), len(marks), marks)
+	}
+	for i, mark := range marks {
+		e := expected[i]
+		if mark.Shape != e.shape || mark.State != e.state || mark.Confidence < 0.75 {
+			t.Errorf("Expected a %s %s mark at %v, got a %s %s with confidence %.2f",
+				e.state, e.shape, mark.Box, mark.State, mark.Shape, mark.Confidence)
+		}
+		if !strings.Contains(mark.Label, e.label) {
+			t.Errorf("Expected the mark at %v to be labelled %q, got %q", mark.Box, e.label, mark.Label)
+		}
+	}
+}
+
+// Unit test for reading an answer sheet
+func TestOMRSheet(t *testing.T) {
+	answers := []string{"A", "C", "B", "D", "A", "", "B", "C", "AD", "D", "B", "B", "C", "A", "D", "C", "A", "B", "D", "C"}
+
+	sheets, err := NewCheckboxDetector().ExecuteOMR("../../samples/documents/omr-sheet.png")
+	if err != nil {
+		t.Fatalf("Error reading the answer sheet: %v", err)
+	}
+	if len(sheets) != 1 || sheets[0].Choices != 4 || len(sheets[0].Questions) != len(answers) {
+		t.Fatalf("Expected one page of %d questions with 4 choices, got %v", len(answers), sheets)
+	}
+	for i, question := range sheets[0].Questions {
+		if question.Number != i+1 || question.Answer() != answers[i] {
+			t.Errorf("Expected question %d to be answered %q, got %d: %q", i+1, answers[i], question.Number, question.Answer())
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package images
+
+import (
+	"image"
+	"math"
+	"sort"
+	"strings"
+)
+
+type MarkShape string
+
+const (
+	MarkSquare MarkShape = "square"
+	MarkCircle MarkShape = "circle"
+)
+
+type MarkState string
+
+const (
+	MarkUnchecked MarkState = "unchecked"
+	// Ticked or crossed
+	MarkChecked MarkState = "checked"
+	// Blacked out, as bubbles on answer sheets
+	MarkFilled MarkState = "filled"
+)
+
+const (
+	// Marks whose inside has less ink than this are empty
+	maxEmptyFill = 0.05
+	// and more than this are filled in
+	minFilledFill = 0.6
+)
+
+// fillRatio is the share of ink inside a mark, leaving out its border.
+// Circles are only measured inside their inscribed circle.
+func fillRatio(ink []byte, cols int, box image.Rectangle, shape MarkShape) float64 {
+	inside := box.Inset(max(2, min(box.Dx(), box.Dy())/5))
+	if inside.Empty() {
+		return 0
+	}
+	cx := float64(inside.Min.X+inside.Max.X-1) / 2
+	cy := float64(inside.Min.Y+inside.Max.Y-1) / 2
+	radius := float64(min(inside.Dx(), inside.Dy())) / 2
+
+	area, filled := 0, 0
+	for y := inside.Min.Y; y < inside.Max.Y; y++ {
+		for x := inside.Min.X; x < inside.Max.X; x++ {
+			if shape == MarkCircle && math.Hypot(float64(x)-cx, float64(y)-cy) > radius {
+				continue
+			}
+			area++
+			if ink[y*cols+x] != 0 {
+				filled++
+			}
+		}
+	}
+	if area == 0 {
+		return 0
+	}
+	return float64(filled) / float64(area)
+}
+
+// framed tells if ink runs all around the border of a mark, on every side
+// of a square or every quarter of a circle. Letters shaped like marks,
+// such as D or O, are drawn with strokes too uneven to pass.
+func framed(ink []byte, cols int, box image.Rectangle, shape MarkShape) bool {
+	depth := max(2, min(box.Dx(), box.Dy())/8)
+	isInk := func(x, y int) bool {
+		return image.Pt(x, y).In(box) && ink[y*cols+x] != 0
+	}
+
+	var hits, samples [4]int
+	if shape == MarkCircle {
+		cx := float64(box.Min.X+box.Max.X-1) / 2
+		cy := float64(box.Min.Y+box.Max.Y-1) / 2
+		radius := float64(min(box.Dx(), box.Dy())-1) / 2
+		for k := 0; k < 64; k++ {
+			angle := 2 * math.Pi * float64(k) / 64
+			quarter := k / 16
+			samples[quarter]++
+			for d := 0; d < depth; d++ {
+				r := radius - float64(d)
+				if isInk(int(math.Round(cx+r*math.Cos(angle))), int(math.Round(cy+r*math.Sin(angle)))) {
+					hits[quarter]++
+					break
+				}
+			}
+		}
+	} else {
+		for x := box.Min.X + depth; x < box.Max.X-depth; x++ {
+			samples[0]++
+			samples[2]++
+			for d := 0; d < depth; d++ {
+				if isInk(x, box.Min.Y+d) {
+					hits[0]++
+					break
+				}
+			}
+			for d := 0; d < depth; d++ {
+				if isInk(x, box.Max.Y-1-d) {
+					hits[2]++
+					break
+				}
+			}
+		}
+		for y := box.Min.Y + depth; y < box.Max.Y-depth; y++ {
+			samples[1]++
+			samples[3]++
+			for d := 0; d < depth; d++ {
+				if isInk(box.Max.X-1-d, y) {
+					hits[1]++
+					break
+				}
+			}
+			for d := 0; d < depth; d++ {
+				if isInk(box.Min.X+d, y) {
+					hits[3]++
+					break
+				}
+			}
+		}
+	}
+	for side := range hits {
+		if samples[side] == 0 || float64(hits[side]) < 0.8*float64(samples[side]) {
+			return false
+		}
+	}
+	return true
+}
+
+// classifyMark reads the state of a mark from its fill ratio. The
+// confidence drops to 0.5 at the thresholds between two states.
+func classifyMark(fill float64) (MarkState, float64) {
+	switch {
+	case fill < maxEmptyFill:
+		return MarkUnchecked, 0.5 + 0.5*clamp01(maxEmptyFill-fill, 0, maxEmptyFill)
+	case fill >= minFilledFill:
+		return MarkFilled, 0.5 + 0.5*clamp01(fill-minFilledFill, 0, 0.2)
+	default:
+		return MarkChecked, 0.5 + 0.5*clamp01(min(fill-maxEmptyFill, minFilledFill-fill), 0, 0.1)
+	}
+}
+
+// isolated tells if nothing is written right next to a box on its line.
+// Letters such as o and O have the shape of a mark but sit in words.
+func isolated(box image.Rectangle, components []inkComponent) bool {
+	gap := max(4, min(box.Dx(), box.Dy())/5)
+	for _, c := range components {
+		if c.box.In(box.Inset(-1)) || box.In(c.box) {
+			continue
+		}
+		if c.box.Min.Y >= box.Max.Y || c.box.Max.Y <= box.Min.Y {
+			continue
+		}
+		if max(c.box.Min.X-box.Max.X, box.Min.X-c.box.Max.X) < gap {
+			return false
+		}
+	}
+	return true
+}
+
+// letterHeight is the median height of the ink that isn't a mark, marks
+// must be bigger than the letters around them.
+func letterHeight(components []inkComponent, marks []image.Rectangle) int {
+	var letters []inkComponent
+	for _, c := range components {
+		if c.area < minInkArea {
+			continue
+		}
+		mark := false
+		for _, m := range marks {
+			if c.box.In(m.Inset(-1)) {
+				mark = true
+				break
+			}
+		}
+		if !mark {
+			letters = append(letters, c)
+		}
+	}
+	return textHeight(letters)
+}
+
+// dropNested keeps the outermost of boxes lying inside each other, like
+// the inner outline of a frame or the fill of a box.
+func dropNested(boxes []image.Rectangle) []int {
+	var kept []int
+	for i, b := range boxes {
+		nested := false
+		for j, outer := range boxes {
+			if i != j && b.In(outer) && (b != outer || j < i) {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			kept = append(kept, i)
+		}
+	}
+	return kept
+}
+
+// labelWord is a word read by OCR.
+type labelWord struct {
+	box  image.Rectangle
+	text string
+}
+
+// labelFor returns the words labelling a mark: those following it on its
+// line up to the next mark or a wide gap, or else those before it.
+func labelFor(mark image.Rectangle, words []labelWord, marks []image.Rectangle) string {
+	size := max(mark.Dx(), mark.Dy())
+	centerY := (mark.Min.Y + mark.Max.Y) / 2
+	var line []labelWord
+	for _, w := range words {
+		if w.box.Min.Y <= centerY && w.box.Max.Y >= centerY && !w.box.Overlaps(mark) {
+			line = append(line, w)
+		}
+	}
+	sort.Slice(line, func(i, j int) bool { return line[i].box.Min.X < line[j].box.Min.X })
+
+	// The closest mark on the line on each side ends the label
+	right, left := math.MaxInt, math.MinInt
+	for _, m := range marks {
+		if m == mark || m.Min.Y > centerY || m.Max.Y < centerY {
+			continue
+		}
+		if m.Min.X >= mark.Max.X {
+			right = min(right, m.Min.X)
+		} else if m.Max.X <= mark.Min.X {
+			left = max(left, m.Max.X)
+		}
+	}
+
+	var label []string
+	edge := mark.Max.X
+	for _, w := range line {
+		if w.box.Min.X < mark.Max.X {
+			continue
+		}
+		if w.box.Max.X > right || w.box.Min.X-edge > 2*size {
+			break
+		}
+		label = append(label, w.text)
+		edge = w.box.Max.X
+	}
+	if len(label) > 0 {
+		return strings.Join(label, " ")
+	}
+
+	edge = mark.Min.X
+	for i := len(line) - 1; i >= 0; i-- {
+		w := line[i]
+		if w.box.Max.X > mark.Min.X {
+			continue
+		}
+		if w.box.Min.X < left || edge-w.box.Max.X > 2*size {
+			break
+		}
+		label = append([]string{w.text}, label...)
+		edge = w.box.Min.X
+	}
+	return strings.Join(label, " ")
+}
+
+// OMRQuestion is a row of bubbles on an answer sheet.
+type OMRQuestion struct {
+	// Counted down each block of questions, then across the blocks
+	Number int `json:"number"`
+	// The choices marked, 0 for the first column
+	Marked []int      `json:"marked"`
+	Marks  []Checkbox `json:"marks"`
+}
+
+// Answer spells the choices marked as letters, e.g. "B", "" when the
+// question was left blank or "AD" when it was marked twice.
+func (q OMRQuestion) Answer() string {
+	var answer strings.Builder
+	for _, choice := range q.Marked {
+		answer.WriteByte(byte('A' + choice))
+	}
+	return answer.String()
+}
+
+// OMRSheet is the grid of marks of an answer sheet page.
+type OMRSheet struct {
+	Page int `json:"page"`
+	// Choices per question
+	Choices   int           `json:"choices"`
+	Questions []OMRQuestion `json:"questions"`
+}
+
+// omrSheet arranges the marks of a page in a grid. Marks are put in
+// columns by their centers, columns much further apart than the others
+// start a new block of questions, and every row of a block is a question.
+func omrSheet(marks []Checkbox, page int) OMRSheet {
+	sheet := OMRSheet{Page: page}
+	if len(marks) == 0 {
+		return sheet
+	}
+	sizes := make([]int, len(marks))
+	for i, m := range marks {
+		sizes[i] = max(m.Box.Dx(), m.Box.Dy())
+	}
+	sort.Ints(sizes)
+	tolerance := float64(sizes[len(sizes)/2]) / 2
+
+	center := func(m Checkbox) (float64, float64) {
+		return float64(m.Box.Min.X+m.Box.Max.X) / 2, float64(m.Box.Min.Y+m.Box.Max.Y) / 2
+	}
+	xs := make([]float64, len(marks))
+	for i, m := range marks {
+		xs[i], _ = center(m)
+	}
+	columns := clusterCenters(xs, tolerance)
+
+	// Split the columns into blocks at the gaps wider than twice the usual
+	// spacing
+	var blocks [][]float64
+	if len(columns) > 1 {
+		spacings := make([]float64, len(columns)-1)
+		for i := range spacings {
+			spacings[i] = columns[i+1] - columns[i]
+		}
+		sorted := append([]float64(nil), spacings...)
+		sort.Float64s(sorted)
+		usual := sorted[len(sorted)/2]
+		start := 0
+		for i, spacing := range spacings {
+			if spacing > 2*usual {
+				blocks = append(blocks, columns[start:i+1])
+				start = i + 1
+			}
+		}
+		blocks = append(blocks, columns[start:])
+	} else {
+		blocks = [][]float64{columns}
+	}
+
+	nearest := func(centers []float64, v float64) int {
+		best := 0
+		for i, c := range centers {
+			if math.Abs(c-v) < math.Abs(centers[best]-v) {
+				best = i
+			}
+		}
+		return best
+	}
+
+	for _, block := range blocks {
+		sheet.Choices = max(sheet.Choices, len(block))
+		var inBlock []Checkbox
+		var ys []float64
+		for _, m := range marks {
+			x, y := center(m)
+			if x >= block[0]-tolerance && x <= block[len(block)-1]+tolerance {
+				inBlock = append(inBlock, m)
+				ys = append(ys, y)
+			}
+		}
+		rows := clusterCenters(ys, tolerance)
+		questions := make([]OMRQuestion, len(rows))
+		for _, m := range inBlock {
+			x, y := center(m)
+			q := &questions[nearest(rows, y)]
+			q.Marks = append(q.Marks, m)
+			if m.State != MarkUnchecked {
+				q.Marked = append(q.Marked, nearest(block, x))
+			}
+		}
+		for _, q := range questions {
+			sort.Slice(q.Marks, func(i, j int) bool { return q.Marks[i].Box.Min.X < q.Marks[j].Box.Min.X })
+			sort.Ints(q.Marked)
+			q.Number = len(sheet.Questions) + 1
+			sheet.Questions = append(sheet.Questions, q)
+		}
+	}
+	return sheet
+}
+
+// clusterCenters sorts values and merges those closer than tolerance to
+// the running mean of their cluster, returning the means.
+func clusterCenters(values []float64, tolerance float64) []float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	var centers []float64
+	count := 0.0
+	for _, v := range sorted {
+		last := len(centers) - 1
+		if last >= 0 && v-centers[last] <= tolerance {
+			count++
+			centers[last] += (v - centers[last]) / count
+			continue
+		}
+		centers = append(centers, v)
+		count = 1
+	}
+	return centers
+}
@@ -0,0 +1,242 @@
+package images
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"gocv.io/x/gocv"
+)
+
+// Signatures are scaled to fit this canvas before they are compared
+var signatureCanvas = image.Pt(256, 128)
+
+// Blank border around the canvas, so keypoints can be found near its edges
+const signatureMargin = 32
+
+// Keypoints matched across signatures must land this close, as a share of
+// the canvas width, once both are normalized
+const maxKeypointShift = 0.15
+
+// SignatureComparison is how much a signature looks like a reference one.
+type SignatureComparison struct {
+	// From 0 to 1, the weighted sum of the three similarities below
+	Score float64 `json:"score"`
+	// Share of ORB keypoints matched at the same place in both signatures
+	Keypoints float64 `json:"keypoints"`
+	// Similarity of the Hu moments
+	Shape float64 `json:"shape"`
+	// Similarity of the upper, lower and center contour profiles
+	Profile  float64 `json:"profile"`
+	Matches  int     `json:"matches"`
+	Accepted bool    `json:"accepted"`
+	// Both normalized signatures side by side with their matches, only
+	// drawn WithVisualization
+	Visualization image.Image `json:"-"`
+}
+
+type SignatureComparator struct {
+	threshold float64
+	visualize bool
+}
+
+func NewSignatureComparator() *SignatureComparator {
+	return &SignatureComparator{threshold: 0.55}
+}
+
+// WithThreshold sets the score a signature needs to be accepted, 0.55 by
+// default.
+func (sc *SignatureComparator) WithThreshold(threshold float64) *SignatureComparator {
+	sc.threshold = threshold
+	return sc
+}
+
+// WithVisualization draws the keypoint matches of every comparison.
+func (sc *SignatureComparator) WithVisualization(visualize bool) *SignatureComparator {
+	sc.visualize = visualize
+	return sc
+}
+
+// Execute compares the signature in candidateFile with the reference one.
+// Both images should be cropped around their signature, e.g. by the
+// SignatureDetector.
+func (sc *SignatureComparator) Execute(referenceFile string, candidateFile string) (*SignatureComparison, error) {
+	reference := gocv.IMRead(referenceFile, gocv.IMReadColor)
+	if reference.Empty() {
+		return nil, fmt.Errorf("error reading the image %s", referenceFile)
+	}
+	defer reference.Close()
+	candidate := gocv.IMRead(candidateFile, gocv.IMReadColor)
+	if candidate.Empty() {
+		return nil, fmt.Errorf("error reading the image %s", candidateFile)
+	}
+	defer candidate.Close()
+
+	return sc.Compare(reference, candidate)
+}
+
+// Compare scores how much the candidate signature looks like the reference.
+func (sc *SignatureComparator) Compare(reference gocv.Mat, candidate gocv.Mat) (*SignatureComparison, error) {
+	ref, err := normalizeSignature(reference)
+	if err != nil {
+		return nil, fmt.Errorf("error normalizing the reference signature: %w", err)
+	}
+	defer ref.Close()
+	cand, err := normalizeSignature(candidate)
+	if err != nil {
+		return nil, fmt.Errorf("error normalizing the candidate signature: %w", err)
+	}
+	defer cand.Close()
+
+	refInk, candInk := ref.ToBytes(), cand.ToBytes()
+	cols, rows := ref.Cols(), ref.Rows()
+	comparison := &SignatureComparison{
+		Shape:   huSimilarity(huMoments(ref), huMoments(cand)),
+		Profile: profileSimilarity(profileOf(refInk, cols, rows), profileOf(candInk, cols, rows)),
+	}
+	if err := sc.matchKeypoints(ref, cand, comparison); err != nil {
+		return nil, err
+	}
+
+	comparison.Score = 0.25*comparison.Keypoints + 0.25*comparison.Shape + 0.5*comparison.Profile
+	comparison.Accepted = comparison.Score >= sc.threshold
+	return comparison, nil
+}
+
+// matchKeypoints matches the ORB keypoints of both signatures, keeping the
+// unambiguous matches that land at the same place on both canvases.
+func (sc *SignatureComparator) matchKeypoints(refInk, candInk gocv.Mat, comparison *SignatureComparison) error {
+	ref, cand := gocv.NewMat(), gocv.NewMat()
+	defer ref.Close()
+	defer cand.Close()
+	for _, pair := range [][2]*gocv.Mat{{&refInk, &ref}, {&candInk, &cand}} {
+		gocv.CopyMakeBorder(*pair[0], pair[1], signatureMargin, signatureMargin, signatureMargin, signatureMargin,
+			gocv.BorderConstant, color.RGBA{})
+	}
+
+	orb := gocv.NewORB()
+	defer orb.Close()
+	noMask := gocv.NewMat()
+	defer noMask.Close()
+	refPoints, refDescriptors := orb.DetectAndCompute(ref, noMask)
+	defer refDescriptors.Close()
+	candPoints, candDescriptors := orb.DetectAndCompute(cand, noMask)
+	defer candDescriptors.Close()
+
+	var good []gocv.DMatch
+	if !refDescriptors.Empty() && !candDescriptors.Empty() {
+		matcher := gocv.NewBFMatcherWithParams(gocv.NormHamming, false)
+		defer matcher.Close()
+		for _, pair := range matcher.KnnMatch(refDescriptors, candDescriptors, 2) {
+			// Lowe's ratio test drops matches as good as the runner up
+			if len(pair) < 2 || pair[0].Distance > 0.8*pair[1].Distance {
+				continue
+			}
+			from, to := refPoints[pair[0].QueryIdx], candPoints[pair[0].TrainIdx]
+			if math.Hypot(from.X-to.X, from.Y-to.Y) <= maxKeypointShift*float64(signatureCanvas.X) {
+				good = append(good, pair[0])
+			}
+		}
+		comparison.Matches = len(good)
+		comparison.Keypoints = clamp01(float64(len(good))/float64(min(len(refPoints), len(candPoints))), 0, 0.3)
+	}
+
+	if !sc.visualize {
+		return nil
+	}
+	refView, candView := inkView(ref), inkView(cand)
+	defer refView.Close()
+	defer candView.Close()
+	view := gocv.NewMat()
+	defer view.Close()
+	gocv.DrawMatches(refView, refPoints, candView, candPoints, good, &view,
+		color.RGBA{0, 160, 0, 0}, color.RGBA{200, 0, 0, 0}, nil, gocv.NotDrawSinglePoints)
+	visualization, err := view.ToImage()
+	if err != nil {
+		return fmt.Errorf("error drawing the matches: %w", err)
+	}
+	comparison.Visualization = visualization
+	return nil
+}
+
+// inkView turns a normalized signature back into dark ink on white.
+func inkView(ink gocv.Mat) gocv.Mat {
+	view := gocv.NewMat()
+	gocv.BitwiseNot(ink, &view)
+	gocv.CvtColor(view, &view, gocv.ColorGrayToBGR)
+	return view
+}
+
+// normalizeSignature binarizes a signature image, crops it to its ink,
+// levels its main axis and scales it to fit the canvas, ink in white.
+func normalizeSignature(img gocv.Mat) (gocv.Mat, error) {
+	gray := gocv.NewMat()
+	defer gray.Close()
+	if img.Channels() == 1 {
+		img.CopyTo(&gray)
+	} else {
+		gocv.CvtColor(img, &gray, gocv.ColorBGRToGray)
+	}
+	ink := gocv.NewMat()
+	defer ink.Close()
+	gocv.Threshold(gray, &ink, 0, 255, gocv.ThresholdBinaryInv+gocv.ThresholdOtsu)
+
+	cropped, err := cropInk(ink)
+	if err != nil {
+		return gocv.NewMat(), err
+	}
+	defer cropped.Close()
+
+	// Rotate on a canvas big enough for the corners
+	angle := inkOrientation(cropped)
+	w, h := float64(cropped.Cols()), float64(cropped.Rows())
+	radians := angle * math.Pi / 180
+	size := image.Pt(
+		int(math.Ceil(w*math.Abs(math.Cos(radians))+h*math.Abs(math.Sin(radians)))),
+		int(math.Ceil(w*math.Abs(math.Sin(radians))+h*math.Abs(math.Cos(radians)))))
+	rotation := gocv.GetRotationMatrix2D(image.Pt(cropped.Cols()/2, cropped.Rows()/2), -angle, 1)
+	defer rotation.Close()
+	rotation.SetDoubleAt(0, 2, rotation.GetDoubleAt(0, 2)+float64(size.X-cropped.Cols())/2)
+	rotation.SetDoubleAt(1, 2, rotation.GetDoubleAt(1, 2)+float64(size.Y-cropped.Rows())/2)
+	level := gocv.NewMat()
+	defer level.Close()
+	gocv.WarpAffineWithParams(cropped, &level, rotation, size, gocv.InterpolationLinear, gocv.BorderConstant, color.RGBA{})
+	gocv.Threshold(level, &level, 127, 255, gocv.ThresholdBinary)
+
+	leveled, err := cropInk(level)
+	if err != nil {
+		return gocv.NewMat(), err
+	}
+	defer leveled.Close()
+
+	scale := min(float64(signatureCanvas.X)/float64(leveled.Cols()), float64(signatureCanvas.Y)/float64(leveled.Rows()))
+	fit := image.Pt(
+		max(1, int(float64(leveled.Cols())*scale)),
+		max(1, int(float64(leveled.Rows())*scale)))
+	interpolation := gocv.InterpolationLinear
+	if scale < 1 {
+		interpolation = gocv.InterpolationArea
+	}
+	scaled := gocv.NewMat()
+	defer scaled.Close()
+	gocv.Resize(leveled, &scaled, fit, 0, 0, interpolation)
+
+	left, top := (signatureCanvas.X-fit.X)/2, (signatureCanvas.Y-fit.Y)/2
+	canvas := gocv.NewMat()
+	gocv.CopyMakeBorder(scaled, &canvas, top, signatureCanvas.Y-fit.Y-top,
+		left, signatureCanvas.X-fit.X-left, gocv.BorderConstant, color.RGBA{})
+	gocv.Threshold(canvas, &canvas, 127, 255, gocv.ThresholdBinary)
+	return canvas, nil
+}
+
+// cropInk cuts a binary image down to its ink, ignoring specks.
+func cropInk(ink gocv.Mat) (gocv.Mat, error) {
+	box := inkBox(ink)
+	if box.Empty() {
+		return gocv.NewMat(), fmt.Errorf("no ink found")
+	}
+	region := ink.Region(box)
+	defer region.Close()
+	return region.Clone(), nil
+}
@@ -0,0 +1,129 @@
+package images
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+// Unit test for the shape descriptors of an ink mask
+func TestSignatureShape(t *testing.T) {
+	cols, rows := 120, 120
+	mask := make([]byte, cols*rows)
+	// A 3 pixel wide stroke rising to the right at 30 degrees
+	for x := 10; x < 110; x++ {
+		y := 90 - int(math.Round(float64(x-10)*math.Tan(math.Pi/6)))
+		for dy := -1; dy <= 1; dy++ {
+			mask[(y+dy)*cols+x] = 255
+		}
+	}
+
+	ink, err := gocv.NewMatFromBytes(rows, cols, gocv.MatTypeCV8U, mask)
+	if err != nil {
+		t.Fatalf("Error creating the mask: %v", err)
+	}
+	defer ink.Close()
+	if angle := inkOrientation(ink); math.Abs(angle-30) > 1 {
+		t.Errorf("Expected the stroke to rise at 30 degrees, got %.2f", angle)
+	}
+	if box := inkBox(ink); box.Min.X != 10 || box.Max.X != 110 {
+		t.Errorf("Unexpected ink box %v", box)
+	}
+
+	hu := huMoments(ink)
+	if similarity := huSimilarity(hu, hu); similarity != 1 {
+		t.Errorf("Expected identical Hu moments to score 1, got %.2f", similarity)
+	}
+
+	flipped := make([]byte, len(mask))
+	for y := 0; y < rows; y++ {
+		copy(flipped[y*cols:(y+1)*cols], mask[(rows-1-y)*cols:(rows-y)*cols])
+	}
+	profile := profileOf(mask, cols, rows)
+	if similarity := profileSimilarity(profile, profile); math.Abs(similarity-1) > 1e-9 {
+		t.Errorf("Expected identical profiles to score 1, got %.2f", similarity)
+	}
+	if similarity := profileSimilarity(profile, profileOf(flipped, cols, rows)); similarity > 0.1 {
+		t.Errorf("Expected the flipped stroke profile to score low, got %.2f", similarity)
+	}
+
+	// A mirror image only changes the sign of the seventh Hu moment, which
+	// is left out
+	mirror, err := gocv.NewMatFromBytes(rows, cols, gocv.MatTypeCV8U, flipped)
+	if err != nil {
+		t.Fatalf("Error creating the mask: %v", err)
+	}
+	defer mirror.Close()
+	if similarity := huSimilarity(hu, huMoments(mirror)); similarity < 0.99 {
+		t.Errorf("Expected the flipped stroke to have the same shape, got %.2f", similarity)
+	}
+}
+
+// rotateSignature turns an image by angle degrees, counterclockwise, and
+// scales it, on a white background.
+func rotateSignature(src gocv.Mat, angle, scale float64) gocv.Mat {
+	rotation := gocv.GetRotationMatrix2D(image.Pt(src.Cols()/2, src.Rows()/2), angle, scale)
+	defer rotation.Close()
+	dst := gocv.NewMat()
+	gocv.WarpAffineWithParams(src, &dst, rotation, image.Pt(src.Cols(), src.Rows()),
+		gocv.InterpolationLinear, gocv.BorderConstant, color.RGBA{255, 255, 255, 0})
+	return dst
+}
+
+// Unit test for comparing augmented signatures with a reference one
+func TestSignatureComparator(t *testing.T) {
+	page := gocv.IMRead("../../samples/images/signature.jpeg", gocv.IMReadColor)
+	if page.Empty() {
+		t.Fatalf("Error reading the sample")
+	}
+	defer page.Close()
+	crop := func(rect image.Rectangle) gocv.Mat {
+		region := page.Region(rect)
+		defer region.Close()
+		return region.Clone()
+	}
+	reference := crop(image.Rect(330, 520, 735, 700))
+	defer reference.Close()
+
+	scaled, blurred, gray, flipped := gocv.NewMat(), gocv.NewMat(), gocv.NewMat(), gocv.NewMat()
+	gocv.Resize(reference, &scaled, image.Pt(0, 0), 0.6, 0.6, gocv.InterpolationArea)
+	gocv.Resize(reference, &blurred, image.Pt(0, 0), 1.5, 1.5, gocv.InterpolationLinear)
+	gocv.GaussianBlur(blurred, &blurred, image.Pt(5, 5), 0, 0, gocv.BorderDefault)
+	gocv.CvtColor(reference, &gray, gocv.ColorBGRToGray)
+	gocv.Flip(reference, &flipped, 0)
+
+	tests := []struct {
+		name     string
+		img      gocv.Mat
+		accepted bool
+	}{
+		{"same", reference.Clone(), true},
+		{"rotated", rotateSignature(reference, 6, 0.8), true},
+		{"rotated back", rotateSignature(reference, -8, 0.8), true},
+		{"scaled down", scaled, true},
+		{"scaled up and blurred", blurred, true},
+		{"grayscale", gray, true},
+		{"upside down", flipped, false},
+		{"printed label", crop(image.Rect(0, 600, 300, 665)), false},
+		{"paragraph", crop(image.Rect(0, 320, 600, 470)), false},
+	}
+
+	comparator := NewSignatureComparator().WithVisualization(true)
+	for _, test := range tests {
+		comparison, err := comparator.Compare(reference, test.img)
+		test.img.Close()
+		if err != nil {
+			t.Fatalf("%s: error comparing: %v", test.name, err)
+		}
+		if comparison.Accepted != test.accepted {
+			t.Errorf("%s: expected accepted %t, got score %.2f (keypoints %.2f, shape %.2f, profile %.2f)", test.name,
+				test.accepted, comparison.Score, comparison.Keypoints, comparison.Shape, comparison.Profile)
+		}
+		if comparison.Visualization == nil {
+			t.Errorf("%s: expected the matches to be drawn", test.name)
+		}
+	}
+}
@@ -1,48 +1,216 @@
 package images
 
-// func main() {
-
-// 	// Load the image
-// 	img := gocv.IMRead("../samples/bill.jpg", gocv.IMReadColor)
-// 	if img.Empty() {
-// 		log.Fatal("Error loading image!")
-// 	}
-// 	defer img.Close()
-
-// 	// Convert the image to grayscale
-// 	gray := gocv.NewMat()
-// 	defer gray.Close()
-// 	gocv.CvtColor(img, &gray, gocv.ColorBGRToGray)
-
-// 	// Apply Gaussian blur to remove noise
-// 	blurred := gocv.NewMat()
-// 	defer blurred.Close()
-// 	gocv.GaussianBlur(gray, &blurred, image.Pt(5, 5), 0)
-
-// 	// Apply Canny edge detection to find edges
-// 	edges := gocv.NewMat()
-// 	defer edges.Close()
-// 	gocv.Canny(blurred, &edges, 100, 200)
-
-// 	// Find contours in the image
-// 	contours := gocv.FindContours(edges, gocv.RetrievalExternal, gocv.ChainApproxSimple)
-
-// 	// Draw contours and identify potential signatures
-// 	for i, contour := range contours {
-// 		// Only consider contours that are large enough (for example, signatures are typically larger)
-// 		if len(contour) > 100 { // This threshold can be adjusted based on your image size
-// 			// Draw contour on the original image
-// 			gocv.DrawContours(&img, contours, i, color.RGBA{0, 255, 0, 0}, 2)
-
-// 			// Optionally: analyze the bounding box or area to check if it matches signature characteristics
-// 			boundingRect := gocv.BoundingRect(contour)
-// 			fmt.Println("Bounding Rect:", boundingRect)
-// 		}
-// 	}
-
-// 	// Show the result
-// 	window := gocv.NewWindow("Signature Detection")
-// 	defer window.Close()
-// 	window.IMShow(img)
-// 	window.WaitKey(0)
-// }
+import (
+	"fmt"
+	"image"
+	"sort"
+
+	"github.com/otiai10/gosseract/v2"
+	"gocv.io/x/gocv"
+)
+
+// Words read with at least this confidence are printed text
+const minPrintedConfidence = 60
+
+// SignatureCandidate is a region of a page that looks handwritten.
+type SignatureCandidate struct {
+	Box image.Rectangle `json:"box"`
+	// From 0 to 1, higher looks more like a signature
+	Score float64 `json:"score"`
+	Page  int     `json:"page"`
+	// The region cut from the page, only kept WithCrops
+	Crop image.Image `json:"-"`
+}
+
+type SignatureDetector struct {
+	language string
+	minScore float64
+	crops    bool
+}
+
+func NewSignatureDetector() *SignatureDetector {
+	return &SignatureDetector{minScore: 0.5}
+}
+
+// WithOCRMask OCRs every page first and ignores the ink of the words it
+// reads confidently, so only what Tesseract can't read is left to score.
+func (sd *SignatureDetector) WithOCRMask(language string) *SignatureDetector {
+	sd.language = language
+	return sd
+}
+
+// WithMinScore drops candidates scoring below score, 0.5 by default.
+func (sd *SignatureDetector) WithMinScore(score float64) *SignatureDetector {
+	sd.minScore = score
+	return sd
+}
+
+// WithCrops keeps the image of every candidate.
+func (sd *SignatureDetector) WithCrops(crops bool) *SignatureDetector {
+	sd.crops = crops
+	return sd
+}
+
+// Execute finds the signatures on every page of an image file, best first
+// on each page. Multi-page TIFFs are read page by page.
+func (sd *SignatureDetector) Execute(fileName string) ([]SignatureCandidate, error) {
+	pages := gocv.IMReadMulti(fileName, gocv.IMReadColor)
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("error reading the image %s", fileName)
+	}
+	defer func() {
+		for _, page := range pages {
+			page.Close()
+		}
+	}()
+
+	var candidates []SignatureCandidate
+	for i, page := range pages {
+		found, err := sd.Detect(page, i)
+		if err != nil {
+			return nil, fmt.Errorf("error detecting signatures on page %d: %w", i+1, err)
+		}
+		candidates = append(candidates, found...)
+	}
+	return candidates, nil
+}
+
+// Detect finds the signatures in one page image, best first.
+func (sd *SignatureDetector) Detect(img gocv.Mat, page int) ([]SignatureCandidate, error) {
+	gray := gocv.NewMat()
+	defer gray.Close()
+	var saturation []byte
+	if img.Channels() == 1 {
+		img.CopyTo(&gray)
+	} else {
+		gocv.CvtColor(img, &gray, gocv.ColorBGRToGray)
+		saturation = saturationOf(img)
+	}
+
+	ink := strokeMask(gray)
+	defer ink.Close()
+	components := strokeComponents(inkComponents(ink, saturation), ink.Cols())
+	height := textHeight(components)
+
+	if sd.language != "" {
+		words, err := sd.printedWords(gray)
+		if err != nil {
+			return nil, err
+		}
+		components = maskWords(components, words, height)
+	}
+
+	bounds := image.Rect(0, 0, img.Cols(), img.Rows())
+	var candidates []SignatureCandidate
+	for _, region := range groupComponents(components, height*3/5) {
+		score := region.score(height)
+		if score < sd.minScore {
+			continue
+		}
+		candidate := SignatureCandidate{Box: region.box, Score: score, Page: page}
+		if sd.crops {
+			crop, err := cropImage(img, region.box.Inset(-height/2).Intersect(bounds))
+			if err != nil {
+				return nil, fmt.Errorf("error cropping the signature at %v: %w", region.box, err)
+			}
+			candidate.Crop = crop
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Score > candidates[j].Score })
+	return candidates, nil
+}
+
+func cropImage(img gocv.Mat, rect image.Rectangle) (image.Image, error) {
+	region := img.Region(rect)
+	defer region.Close()
+	crop := region.Clone()
+	defer crop.Close()
+	return crop.ToImage()
+}
+
+// saturationOf returns the HSV saturation of every pixel, pen ink is
+// usually more colorful than the printed text.
+func saturationOf(img gocv.Mat) []byte {
+	hsv := gocv.NewMat()
+	defer hsv.Close()
+	gocv.CvtColor(img, &hsv, gocv.ColorBGRToHSV)
+	channels := gocv.Split(hsv)
+	defer func() {
+		for _, c := range channels {
+			c.Close()
+		}
+	}()
+	return channels[1].ToBytes()
+}
+
+// strokeMask binarizes the page, ink in white, without its ruled lines.
+// The strokes crossing a signature line are put back where the ink goes on
+// both sides of it.
+func strokeMask(gray gocv.Mat) gocv.Mat {
+	ink := gocv.NewMat()
+	defer ink.Close()
+	gocv.Threshold(gray, &ink, 0, 255, gocv.ThresholdBinaryInv+gocv.ThresholdOtsu)
+
+	lines := gocv.NewMat()
+	defer lines.Close()
+	vertical := gocv.NewMat()
+	defer vertical.Close()
+	horizontalKernel := gocv.GetStructuringElement(gocv.MorphRect, image.Pt(max(1, gray.Cols()/15), 1))
+	defer horizontalKernel.Close()
+	verticalKernel := gocv.GetStructuringElement(gocv.MorphRect, image.Pt(1, max(1, gray.Rows()/15)))
+	defer verticalKernel.Close()
+	gocv.MorphologyEx(ink, &lines, gocv.MorphOpen, horizontalKernel)
+	gocv.MorphologyEx(ink, &vertical, gocv.MorphOpen, verticalKernel)
+	gocv.BitwiseOr(lines, vertical, &lines)
+
+	strokes := gocv.NewMat()
+	gocv.Subtract(ink, lines, &strokes)
+	for _, size := range []image.Point{image.Pt(1, 7), image.Pt(7, 1)} {
+		repair := gocv.GetStructuringElement(gocv.MorphRect, size)
+		gocv.MorphologyEx(strokes, &strokes, gocv.MorphClose, repair)
+		repair.Close()
+	}
+	gocv.BitwiseAnd(strokes, ink, &strokes)
+	return strokes
+}
+
+// printedWords returns the boxes of the words OCR reads confidently.
+func (sd *SignatureDetector) printedWords(gray gocv.Mat) ([]image.Rectangle, error) {
+	boxes, err := readWords(gray, sd.language)
+	if err != nil {
+		return nil, err
+	}
+
+	var words []image.Rectangle
+	for _, box := range boxes {
+		if box.Confidence >= minPrintedConfidence {
+			words = append(words, box.Box)
+		}
+	}
+	return words, nil
+}
+
+// readWords OCRs a page and returns every word with its box.
+func readWords(gray gocv.Mat, language string) ([]gosseract.BoundingBox, error) {
+	buf, err := gocv.IMEncode(gocv.PNGFileExt, gray)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding the page: %w", err)
+	}
+	defer buf.Close()
+
+	client := gosseract.NewClient()
+	defer client.Close()
+	if err := client.SetLanguage(language); err != nil {
+		return nil, fmt.Errorf("error setting language: %w", err)
+	}
+	if err := client.SetImageFromBytes(buf.GetBytes()); err != nil {
+		return nil, fmt.Errorf("error setting image: %w", err)
+	}
+	boxes, err := client.GetBoundingBoxes(gosseract.RIL_WORD)
+	if err != nil {
+		return nil, fmt.Errorf("error reading words: %w", err)
+	}
+	return boxes, nil
+}
@@ -0,0 +1,82 @@
+package images
+
+import (
+	"image"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+// Unit test for labeling ink components and measuring their strokes
+func TestInkComponents(t *testing.T) {
+	cols, rows := 100, 40
+	mask := make([]byte, cols*rows)
+	fill := func(rect image.Rectangle) {
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				mask[y*cols+x] = 255
+			}
+		}
+	}
+	// A 3 pixel wide stroke bent into an L, and a solid block
+	fill(image.Rect(5, 5, 8, 35))
+	fill(image.Rect(5, 32, 40, 35))
+	fill(image.Rect(45, 5, 55, 15))
+
+	ink, err := gocv.NewMatFromBytes(rows, cols, gocv.MatTypeCV8U, mask)
+	if err != nil {
+		t.Fatalf("Error creating the mask: %v", err)
+	}
+	defer ink.Close()
+	components := inkComponents(ink, nil)
+	if len(components) != 2 {
+		t.Fatalf("Expected 2 components, got %d", len(components))
+	}
+	stroke := components[0]
+	if stroke.box != image.Rect(5, 5, 40, 35) || stroke.area != 3*30+3*32 {
+		t.Errorf("Unexpected stroke %v with area %d", stroke.box, stroke.area)
+	}
+	if w := stroke.strokeWidth(); w < 2.5 || w > 3.5 {
+		t.Errorf("Expected a stroke width close to 3, got %.2f", w)
+	}
+
+	kept := strokeComponents(components, cols)
+	if len(kept) != 1 || kept[0].box != stroke.box {
+		t.Errorf("Expected only the stroke to be kept, got %v", kept)
+	}
+	if masked := maskWords(kept, []image.Rectangle{image.Rect(0, 0, 45, 40)}, 30); len(masked) != 0 {
+		t.Errorf("Expected the stroke inside a word to be masked, got %v", masked)
+	}
+}
+
+// Unit test for finding the signature of a signed agreement
+func TestSignatureDetector(t *testing.T) {
+	signature := image.Rect(341, 532, 722, 691)
+
+	for _, language := range []string{"", "eng"} {
+		candidates, err := NewSignatureDetector().
+			WithOCRMask(language).
+			WithCrops(true).
+			Execute("../../samples/images/signature.jpeg")
+		if err != nil {
+			t.Fatalf("Error detecting signatures: %v", err)
+		}
+		if len(candidates) == 0 {
+			t.Fatalf("Expected a signature with OCR mask %q, got none", language)
+		}
+
+		best := candidates[0]
+		overlap := best.Box.Intersect(signature)
+		if overlap.Dx()*overlap.Dy() < signature.Dx()*signature.Dy()*3/4 || best.Page != 0 || best.Score < 0.8 {
+			t.Errorf("Expected the signature at %v, got %v with score %.2f on page %d", signature, best.Box, best.Score, best.Page)
+		}
+		if best.Crop == nil || best.Crop.Bounds().Dx() < best.Box.Dx() || best.Crop.Bounds().Dy() < best.Box.Dy() {
+			t.Errorf("Expected a crop covering the signature, got %v", best.Crop)
+		}
+		for _, c := range candidates[1:] {
+			if c.Box.Overlaps(signature) {
+				t.Errorf("Expected the signature to be found once, got another candidate at %v", c.Box)
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package images
+
+import (
+	"fmt"
+	"image"
+
+	"gocv.io/x/gocv"
+)
+
+// DetectorOptions are the thresholds and input blob of the YOLO object
+// detectors.
+type DetectorOptions struct {
+	// Class score an object needs, also the score threshold of the NMS
+	ConfidenceThreshold float32
+	// Objectness score a box needs, 0 to keep every box
+	ObjectnessThreshold float32
+	// Overlap above which the less confident of two boxes of a class is
+	// suppressed
+	NMSIoU float32
+	// Size the image is resized to, a multiple of 32 for YOLO
+	InputSize image.Point
+	// Factor the pixel values are multiplied by, after the mean is
+	// subtracted
+	ScaleFactor float64
+	// Red, green and blue values subtracted from the pixels. The blob is
+	// in RGB order, the BGR image's red and blue swapped before the mean
+	// is subtracted.
+	Mean [3]float64
+}
+
+// DefaultDetectorOptions are the settings of YOLOv3 at 416x416.
+func DefaultDetectorOptions() DetectorOptions {
+	return DetectorOptions{
+		ConfidenceThreshold: 0.5,
+		NMSIoU:              0.3,
+		InputSize:           image.Pt(416, 416),
+		ScaleFactor:         1.0 / 255,
+	}
+}
+
+// Validate checks the ranges of the options.
+func (do DetectorOptions) Validate() error {
+	if do.ConfidenceThreshold < 0 || do.ConfidenceThreshold > 1 {
+		return fmt.Errorf("confidence threshold %.2f is not between 0 and 1", do.ConfidenceThreshold)
+	}
+	if do.ObjectnessThreshold < 0 || do.ObjectnessThreshold > 1 {
+		return fmt.Errorf("objectness threshold %.2f is not between 0 and 1", do.ObjectnessThreshold)
+	}
+	if do.NMSIoU <= 0 || do.NMSIoU > 1 {
+		return fmt.Errorf("NMS IoU %.2f is not above 0 and at most 1", do.NMSIoU)
+	}
+	if do.InputSize.X <= 0 || do.InputSize.Y <= 0 {
+		return fmt.Errorf("input size %dx%d is empty", do.InputSize.X, do.InputSize.Y)
+	}
+	if do.ScaleFactor <= 0 {
+		return fmt.Errorf("scale factor %g is not positive", do.ScaleFactor)
+	}
+	return nil
+}
+
+// ValidateNetwork checks the options against a loaded network: its
+// outputs must be YOLO layers, which downsample the input by 32, and a
+// blob of the input size must give a score per class.
+func (do DetectorOptions) ValidateNetwork(net *gocv.Net, outputLayers []string, classes int) error {
+	if err := do.Validate(); err != nil {
+		return err
+	}
+	for _, id := range net.GetUnconnectedOutLayers() {
+		layer := net.GetLayer(id)
+		kind, name := layer.GetType(), layer.GetName()
+		layer.Close()
+		if kind != "Region" {
+			return fmt.Errorf("output layer %s is a %s layer, not a YOLO one", name, kind)
+		}
+	}
+	if do.InputSize.X%32 != 0 || do.InputSize.Y%32 != 0 {
+		return fmt.Errorf("input size %dx%d is not a multiple of 32", do.InputSize.X, do.InputSize.Y)
+	}
+
+	blank := gocv.Zeros(do.InputSize.Y, do.InputSize.X, gocv.MatTypeCV8UC3)
+	defer blank.Close()
+	blob := do.Blob(blank)
+	defer blob.Close()
+	net.SetInput(blob, "")
+	outputs := net.ForwardLayers(outputLayers)
+	defer func() {
+		for _, output := range outputs {
+			output.Close()
+		}
+	}()
+	for i, output := range outputs {
+		// [centerX, centerY, width, height, objectness, class scores...]
+		if output.Cols() != 5+classes {
+			return fmt.Errorf("output layer %s gives %d class scores for %d classes", outputLayers[i], output.Cols()-5, classes)
+		}
+	}
+	return nil
+}
+
+// Blob prepares a BGR image for the network, as an RGB blob.
+func (do DetectorOptions) Blob(img gocv.Mat) gocv.Mat {
+	return gocv.BlobFromImage(img, do.ScaleFactor, do.InputSize,
+		gocv.NewScalar(do.Mean[0], do.Mean[1], do.Mean[2], 0), true, false)
+}
+
+// Accepts tells if a row of a YOLO output, with its best class score,
+// passes the thresholds.
+func (do DetectorOptions) Accepts(data gocv.Mat, confidence float32) bool {
+	return confidence >= do.ConfidenceThreshold && data.GetFloatAt(0, 4) >= do.ObjectnessThreshold
+}
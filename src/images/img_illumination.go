@@ -0,0 +1,65 @@
+package images
+
+import "sort"
+
+// divideBackground divides the pixels of a channel by the background
+// estimated under them, so the paper becomes white however it was lit or
+// tinted and the ink keeps its contrast to it.
+func divideBackground(pixels, background []byte) []byte {
+	out := make([]byte, len(pixels))
+	for i, p := range pixels {
+		out[i] = byte(min(255, int(p)*255/max(1, int(background[i]))))
+	}
+	return out
+}
+
+// paperLevel is the lightness of the well lit paper, the 90th percentile
+// of the background.
+func paperLevel(background []byte) byte {
+	if len(background) == 0 {
+		return 255
+	}
+	sorted := append([]byte(nil), background...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)*9/10]
+}
+
+// relight brightens the lightness of the pixels whose background is darker
+// than the paper by as much as it is, lifting shadows to the level of the
+// rest of the page. Colors are left to the other channels.
+func relight(lightness, background []byte, paper byte) []byte {
+	out := make([]byte, len(lightness))
+	for i, l := range lightness {
+		if b := background[i]; b > 0 && b < paper {
+			out[i] = byte(min(255, int(l)*int(paper)/int(b)))
+		} else {
+			out[i] = l
+		}
+	}
+	return out
+}
+
+// suppressWatermark whitens the light pixels of a page, faint gray
+// watermarks at or above level and pale colored ones, with a chroma of at
+// least minChroma, at or above colorLevel. Pixels are BGR when channels
+// is 3, gray otherwise. Dark text and strongly colored stamps are kept.
+func suppressWatermark(pixels []byte, channels int, level, colorLevel, minChroma byte) []byte {
+	out := append([]byte(nil), pixels...)
+	if channels != 3 {
+		for i, p := range out {
+			if p >= level {
+				out[i] = 255
+			}
+		}
+		return out
+	}
+	for i := 0; i+2 < len(out); i += 3 {
+		b, g, r := int(out[i]), int(out[i+1]), int(out[i+2])
+		luma := (299*r + 587*g + 114*b) / 1000
+		chroma := max(r, g, b) - min(r, g, b)
+		if luma >= int(level) || (chroma >= int(minChroma) && luma >= int(colorLevel)) {
+			out[i], out[i+1], out[i+2] = 255, 255, 255
+		}
+	}
+	return out
+}
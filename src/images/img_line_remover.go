@@ -0,0 +1,145 @@
+package images
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+type LineRemover struct {
+	minLength int
+}
+
+// NewLineRemover takes off strokes longer than a 20th of the page side,
+// and at least 40 pixels.
+func NewLineRemover() *LineRemover {
+	return &LineRemover{}
+}
+
+// WithMinLength sets how long, in pixels, a straight stroke must be to be
+// removed as a line. Larger than the tallest and widest letters.
+func (lr *LineRemover) WithMinLength(length int) *LineRemover {
+	lr.minLength = length
+	return lr
+}
+
+// Execute removes the lines of every page of an image file, writes the
+// first page as a PNG to outDir and returns the lines of all the pages.
+func (lr *LineRemover) Execute(fileName string, outDir string) (string, []RuledLine, error) {
+	pages := gocv.IMReadMulti(fileName, gocv.IMReadGrayScale)
+	if len(pages) == 0 {
+		return "", nil, fmt.Errorf("error reading the image %s", fileName)
+	}
+	defer func() {
+		for _, page := range pages {
+			page.Close()
+		}
+	}()
+
+	var lines []RuledLine
+	var first gocv.Mat
+	for i, page := range pages {
+		clean, pageLines := lr.Remove(page, i)
+		lines = append(lines, pageLines...)
+		if i == 0 {
+			first = clean
+			defer first.Close()
+		} else {
+			clean.Close()
+		}
+	}
+
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return "", nil, fmt.Errorf("error creating the output folder: %w", err)
+	}
+	base := strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+	outFile := filepath.Join(outDir, base+"-lines-removed.png")
+	if ok := gocv.IMWrite(outFile, first); !ok {
+		return "", nil, fmt.Errorf("error writing %s", outFile)
+	}
+	return outFile, lines, nil
+}
+
+// Remove whitens the horizontal and vertical lines of a gray or BGR page,
+// keeping the parts of the characters that cross them, and returns the
+// page in gray with the lines it took off.
+func (lr *LineRemover) Remove(img gocv.Mat, page int) (gocv.Mat, []RuledLine) {
+	gray := grayOf(img)
+	ink := gocv.NewMat()
+	defer ink.Close()
+	gocv.Threshold(gray, &ink, 0, 255, gocv.ThresholdBinaryInv+gocv.ThresholdOtsu)
+
+	horizontal := lr.strokes(ink, image.Pt(lr.length(gray.Cols()), 1))
+	defer horizontal.Close()
+	vertical := lr.strokes(ink, image.Pt(1, lr.length(gray.Rows())))
+	defer vertical.Close()
+	lines := append(ruledLines(horizontal, LineHorizontal, page), ruledLines(vertical, LineVertical, page)...)
+	if len(lines) == 0 {
+		return gray, nil
+	}
+
+	ruled := gocv.NewMat()
+	defer ruled.Close()
+	gocv.BitwiseOr(horizontal, vertical, &ruled)
+	text := gocv.NewMat()
+	defer text.Close()
+	gocv.Subtract(ink, ruled, &text)
+
+	// A character crossing a horizontal line leaves ink right above and
+	// below it, closing across the line joins the two halves again
+	thickest := map[LineOrientation]int{}
+	for _, line := range lines {
+		thickest[line.Orientation] = max(thickest[line.Orientation], line.Thickness)
+	}
+	repaired := gocv.NewMat()
+	defer repaired.Close()
+	text.CopyTo(&repaired)
+	join := func(size image.Point) {
+		kernel := gocv.GetStructuringElement(gocv.MorphRect, size)
+		defer kernel.Close()
+		closed := gocv.NewMat()
+		defer closed.Close()
+		gocv.MorphologyEx(text, &closed, gocv.MorphClose, kernel)
+		gocv.BitwiseOr(repaired, closed, &repaired)
+	}
+	if thickness := thickest[LineHorizontal]; thickness > 0 {
+		join(image.Pt(1, thickness+3))
+	}
+	if thickness := thickest[LineVertical]; thickness > 0 {
+		join(image.Pt(thickness+3, 1))
+	}
+	gocv.BitwiseAnd(repaired, ink, &repaired)
+
+	// The anti-aliased edges of the lines go too, but not the characters
+	removed := gocv.NewMat()
+	defer removed.Close()
+	gocv.Subtract(ruled, repaired, &removed)
+	kernel := gocv.GetStructuringElement(gocv.MorphRect, image.Pt(3, 3))
+	gocv.Dilate(removed, &removed, kernel)
+	kernel.Close()
+	gocv.Subtract(removed, repaired, &removed)
+
+	gocv.BitwiseOr(gray, removed, &gray)
+	return gray, lines
+}
+
+// strokes opens the ink with a one pixel thick kernel, keeping only the
+// straight runs at least as long.
+func (lr *LineRemover) strokes(ink gocv.Mat, size image.Point) gocv.Mat {
+	kernel := gocv.GetStructuringElement(gocv.MorphRect, size)
+	defer kernel.Close()
+	strokes := gocv.NewMat()
+	gocv.MorphologyEx(ink, &strokes, gocv.MorphOpen, kernel)
+	return strokes
+}
+
+func (lr *LineRemover) length(side int) int {
+	if lr.minLength > 0 {
+		return lr.minLength
+	}
+	return max(40, side/20)
+}
@@ -0,0 +1,74 @@
+package images
+
+import (
+	"image"
+	"os"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+// darkPixels counts the pixels of a gray page darker than mid-gray in a box.
+func darkPixels(gray gocv.Mat, box image.Rectangle) int {
+	region := gray.Region(box)
+	defer region.Close()
+	dark := gocv.NewMat()
+	defer dark.Close()
+	gocv.Threshold(region, &dark, 128, 255, gocv.ThresholdBinaryInv)
+	return gocv.CountNonZero(dark)
+}
+
+// Unit test for removing form lines and table borders
+func TestLineRemover(t *testing.T) {
+	page := gocv.IMRead("../../samples/documents/ruled-bill.png", gocv.IMReadGrayScale)
+	defer page.Close()
+
+	clean, lines := NewLineRemover().Remove(page, 0)
+	defer clean.Close()
+	counts := map[LineOrientation]int{}
+	for _, line := range lines {
+		counts[line.Orientation]++
+	}
+	// Two underlines and six table rules across, five table rules down
+	if counts[LineHorizontal] != 8 || counts[LineVertical] != 5 {
+		t.Fatalf("Expected 8 horizontal and 5 vertical lines, got %v", counts)
+	}
+	if lines[0].Start != image.Pt(60, 159) || lines[0].Length() < 690 || lines[0].Thickness != 3 {
+		t.Errorf("Expected the first underline from (60,159), 700 pixels long and 3 thick, got %+v", lines[0])
+	}
+
+	// The geometry is kept for the table
+	cells := TableCells(lines)
+	if len(cells) != 5 || len(cells[0]) != 4 {
+		t.Fatalf("Expected a table of 5 rows of 4 cells, got %v", cells)
+	}
+	if cell := cells[1][2]; cell.Min.X < 660 || cell.Min.X > 664 || cell.Max.Y < 418 || cell.Max.Y > 422 {
+		t.Errorf("Expected the price of the first item in (662,352)-(850,420), got %v", cell)
+	}
+
+	// The rules are gone, the descenders crossing the underline are not
+	for _, line := range lines {
+		if n := darkPixels(clean, line.Box); n > line.Box.Dx()*line.Box.Dy()/10 {
+			t.Errorf("Expected the line %v removed, %d dark pixels left", line.Box, n)
+		}
+	}
+	underline := lines[0].Box
+	if before, after := darkPixels(page, underline), darkPixels(clean, underline); after == 0 || after > before/10 {
+		t.Errorf("Expected a few descender pixels left on the underline, got %d of %d", after, before)
+	}
+	if err := os.MkdirAll("../../output/test/lines/", os.ModePerm); err != nil {
+		t.Fatalf("Error creating the output folder: %v", err)
+	}
+	gocv.IMWrite("../../output/test/lines/ruled-bill.png", clean)
+
+	// Text alone has no lines
+	plain := gocv.IMRead("../../samples/documents/inverted-header.png", gocv.IMReadGrayScale)
+	defer plain.Close()
+	crop := plain.Region(image.Rect(0, 160, 1100, 320))
+	defer crop.Close()
+	same, lines := NewLineRemover().Remove(crop, 0)
+	defer same.Close()
+	if len(lines) != 0 {
+		t.Errorf("Expected no lines in body text, got %+v", lines)
+	}
+}
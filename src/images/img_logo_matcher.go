@@ -0,0 +1,321 @@
+package images
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+// Pages are searched for logos by template matching at this size, in
+// pixels, on their longest side
+const logoSearchSize = 1200
+
+// Keypoint matches agreeing with the homography needed for a full score
+const minLogoInliers = 20
+
+// libraryLogo is a reference logo with its keypoints.
+type libraryLogo struct {
+	name        string
+	gray        gocv.Mat
+	keypoints   []gocv.KeyPoint
+	descriptors gocv.Mat
+}
+
+// LogoLibrary is a folder of reference logos, each named after its file,
+// e.g. the logo of vendor "bluepeak" is bluepeak.png.
+type LogoLibrary struct {
+	logos []libraryLogo
+}
+
+// LoadLogoLibrary reads every PNG and JPEG image of a folder.
+func LoadLogoLibrary(folder string) (*LogoLibrary, error) {
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the logo folder %s: %w", folder, err)
+	}
+
+	orb := gocv.NewORBWithParams(1000, 1.2, 8, 15, 0, 2, gocv.ORBScoreTypeHarris, 31, 10)
+	defer orb.Close()
+	noMask := gocv.NewMat()
+	defer noMask.Close()
+
+	library := &LogoLibrary{}
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (ext != ".png" && ext != ".jpg" && ext != ".jpeg") {
+			continue
+		}
+		fileName := filepath.Join(folder, entry.Name())
+		gray := gocv.IMRead(fileName, gocv.IMReadGrayScale)
+		if gray.Empty() {
+			library.Close()
+			return nil, fmt.Errorf("error reading the logo %s", fileName)
+		}
+		keypoints, descriptors := orb.DetectAndCompute(gray, noMask)
+		library.logos = append(library.logos, libraryLogo{
+			name:        strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())),
+			gray:        gray,
+			keypoints:   keypoints,
+			descriptors: descriptors,
+		})
+	}
+	if len(library.logos) == 0 {
+		return nil, fmt.Errorf("no logos found in %s", folder)
+	}
+	sort.Slice(library.logos, func(i, j int) bool { return library.logos[i].name < library.logos[j].name })
+	return library, nil
+}
+
+// Names lists the logos of the library.
+func (ll *LogoLibrary) Names() []string {
+	names := make([]string, len(ll.logos))
+	for i, logo := range ll.logos {
+		names[i] = logo.name
+	}
+	return names
+}
+
+func (ll *LogoLibrary) Close() {
+	for _, logo := range ll.logos {
+		logo.gray.Close()
+		logo.descriptors.Close()
+	}
+	ll.logos = nil
+}
+
+// LogoMatch is a known logo found on a page.
+type LogoMatch struct {
+	Name string          `json:"name"`
+	Box  image.Rectangle `json:"box"`
+	// From 0 to 1, the better of the two scores below
+	Score float64 `json:"score"`
+	// Normalized correlation of the logo at its best scale
+	TemplateScore float64 `json:"templateScore"`
+	// Share of keypoint matches agreeing with one homography, lowered
+	// when there are few of them
+	KeypointScore float64 `json:"keypointScore"`
+	// Size of the logo on the page relative to the reference
+	Scale float64 `json:"scale"`
+	Page  int     `json:"page"`
+}
+
+type LogoMatcher struct {
+	library  *LogoLibrary
+	minScore float64
+	minScale float64
+	maxScale float64
+}
+
+func NewLogoMatcher(library *LogoLibrary) *LogoMatcher {
+	return &LogoMatcher{library: library, minScore: 0.6, minScale: 0.25, maxScale: 2}
+}
+
+// WithMinScore drops matches scoring below score, 0.6 by default.
+func (lm *LogoMatcher) WithMinScore(score float64) *LogoMatcher {
+	lm.minScore = score
+	return lm
+}
+
+// WithScales sets the range of sizes logos are looked for at, relative to
+// the reference, 0.25 to 2 by default.
+func (lm *LogoMatcher) WithScales(minScale, maxScale float64) *LogoMatcher {
+	lm.minScale = minScale
+	lm.maxScale = maxScale
+	return lm
+}
+
+// Execute finds the known logos on every page of an image file, best
+// first on each page. Multi-page TIFFs are read page by page.
+func (lm *LogoMatcher) Execute(fileName string) ([]LogoMatch, error) {
+	pages := gocv.IMReadMulti(fileName, gocv.IMReadColor)
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("error reading the image %s", fileName)
+	}
+	defer func() {
+		for _, page := range pages {
+			page.Close()
+		}
+	}()
+
+	var matches []LogoMatch
+	for i, page := range pages {
+		found, err := lm.Detect(page, i)
+		if err != nil {
+			return nil, fmt.Errorf("error matching logos on page %d: %w", i+1, err)
+		}
+		matches = append(matches, found...)
+	}
+	return matches, nil
+}
+
+// Identify returns the best known logo of a page, the vendor of an
+// invoice, or nil when none scores high enough.
+func (lm *LogoMatcher) Identify(img gocv.Mat) (*LogoMatch, error) {
+	matches, err := lm.Detect(img, 0)
+	if err != nil || len(matches) == 0 {
+		return nil, err
+	}
+	return &matches[0], nil
+}
+
+// Detect looks for every logo of the library on one page, by template
+// matching over a range of scales and by keypoints, which also find
+// rotated logos.
+func (lm *LogoMatcher) Detect(img gocv.Mat, page int) ([]LogoMatch, error) {
+	gray := grayOf(img)
+	defer gray.Close()
+
+	factor := min(1, float64(logoSearchSize)/float64(max(gray.Cols(), gray.Rows())))
+	small := gocv.NewMat()
+	defer small.Close()
+	gocv.Resize(gray, &small, image.Pt(0, 0), factor, factor, gocv.InterpolationArea)
+
+	orb := gocv.NewORBWithParams(5000, 1.2, 8, 15, 0, 2, gocv.ORBScoreTypeHarris, 31, 10)
+	defer orb.Close()
+	noMask := gocv.NewMat()
+	defer noMask.Close()
+	pageKeypoints, pageDescriptors := orb.DetectAndCompute(gray, noMask)
+	defer pageDescriptors.Close()
+
+	bounds := image.Rect(0, 0, gray.Cols(), gray.Rows())
+	var matches []LogoMatch
+	for _, logo := range lm.library.logos {
+		match := LogoMatch{Name: logo.name, Page: page}
+
+		box, scale, score := lm.matchTemplate(small, logo.gray, factor)
+		match.TemplateScore = score
+		match.Box, match.Scale, match.Score = box, scale, score
+
+		if !pageDescriptors.Empty() && !logo.descriptors.Empty() {
+			box, scale, score := matchLogoKeypoints(logo, pageKeypoints, pageDescriptors)
+			match.KeypointScore = score
+			if score > match.Score {
+				match.Box, match.Scale, match.Score = box, scale, score
+			}
+		}
+
+		match.Box = match.Box.Intersect(bounds)
+		if match.Score >= lm.minScore && !match.Box.Empty() {
+			matches = append(matches, match)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	return matches, nil
+}
+
+// matchTemplate slides the logo over the page at every scale, then at
+// finer scales around the best one, and returns where it correlates best
+// in page pixels.
+func (lm *LogoMatcher) matchTemplate(small, logo gocv.Mat, factor float64) (image.Rectangle, float64, float64) {
+	noMask := gocv.NewMat()
+	defer noMask.Close()
+	result := gocv.NewMat()
+	defer result.Close()
+	template := gocv.NewMat()
+	defer template.Close()
+
+	var bestBox image.Rectangle
+	bestScale, bestScore := 0.0, -1.0
+	try := func(scale float64) {
+		size := image.Pt(int(math.Round(float64(logo.Cols())*scale*factor)), int(math.Round(float64(logo.Rows())*scale*factor)))
+		if size.X < 16 || size.Y < 16 || size.X > small.Cols() || size.Y > small.Rows() {
+			return
+		}
+		gocv.Resize(logo, &template, size, 0, 0, gocv.InterpolationArea)
+		gocv.MatchTemplate(small, template, &result, gocv.TmCcoeffNormed, noMask)
+		_, score, _, at := gocv.MinMaxLoc(result)
+		if float64(score) > bestScore {
+			bestScore, bestScale = float64(score), scale
+			bestBox = image.Rectangle{at, at.Add(size)}
+		}
+	}
+
+	scales, step := logoScales(lm.minScale, lm.maxScale, 24)
+	for _, scale := range scales {
+		try(scale)
+	}
+	if bestScore < 0 {
+		return image.Rectangle{}, 0, 0
+	}
+	coarse := bestScale
+	for k := -3; k <= 3; k++ {
+		if k != 0 {
+			try(coarse * math.Pow(step, float64(k)/4))
+		}
+	}
+
+	box := image.Rect(int(float64(bestBox.Min.X)/factor), int(float64(bestBox.Min.Y)/factor),
+		int(float64(bestBox.Max.X)/factor), int(float64(bestBox.Max.Y)/factor))
+	return box, bestScale, max(0, bestScore)
+}
+
+// logoScales spreads steps scales evenly on a log scale from minScale to
+// maxScale, and returns the ratio between two of them.
+func logoScales(minScale, maxScale float64, steps int) ([]float64, float64) {
+	if steps < 2 || maxScale <= minScale {
+		return []float64{minScale}, 1
+	}
+	step := math.Pow(maxScale/minScale, 1/float64(steps-1))
+	scales := make([]float64, steps)
+	for i := range scales {
+		scales[i] = minScale * math.Pow(step, float64(i))
+	}
+	return scales, step
+}
+
+// matchLogoKeypoints matches the keypoints of the logo on the page and
+// fits a homography, returning the box of the logo's corners mapped on
+// the page, its scale and a score.
+func matchLogoKeypoints(logo libraryLogo, pageKeypoints []gocv.KeyPoint, pageDescriptors gocv.Mat) (image.Rectangle, float64, float64) {
+	matcher := gocv.NewBFMatcherWithParams(gocv.NormHamming, false)
+	defer matcher.Close()
+	var from, to [][2]float64
+	for _, pair := range matcher.KnnMatch(logo.descriptors, pageDescriptors, 2) {
+		// Lowe's ratio test drops matches as good as the runner up
+		if len(pair) < 2 || pair[0].Distance > 0.75*pair[1].Distance {
+			continue
+		}
+		l, p := logo.keypoints[pair[0].QueryIdx], pageKeypoints[pair[0].TrainIdx]
+		from = append(from, [2]float64{l.X, l.Y})
+		to = append(to, [2]float64{p.X, p.Y})
+	}
+	if len(from) < 8 {
+		return image.Rectangle{}, 0, 0
+	}
+
+	src, dst := pointsMat(from), pointsMat(to)
+	defer src.Close()
+	defer dst.Close()
+	inlierMask := gocv.NewMat()
+	defer inlierMask.Close()
+	transform := gocv.FindHomography(src, &dst, gocv.HomographyMethodRANSAC, 5, &inlierMask, 2000, 0.995)
+	defer transform.Close()
+	if transform.Empty() {
+		return image.Rectangle{}, 0, 0
+	}
+	var h homography
+	for i := range h {
+		h[i] = transform.GetDoubleAt(i/3, i%3)
+	}
+	corners, ok := h.mapCorners(image.Pt(logo.gray.Cols(), logo.gray.Rows()))
+	if !ok || !convexQuad(corners) {
+		return image.Rectangle{}, 0, 0
+	}
+
+	inliers := gocv.CountNonZero(inlierMask)
+	score := float64(inliers) / float64(len(from)) * min(1, float64(inliers)/minLogoInliers)
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, c := range corners {
+		minX, minY = min(minX, c[0]), min(minY, c[1])
+		maxX, maxY = max(maxX, c[0]), max(maxY, c[1])
+	}
+	scale := math.Sqrt(quadArea2f(corners) / float64(logo.gray.Cols()*logo.gray.Rows()))
+	return image.Rect(int(minX), int(minY), int(math.Ceil(maxX)), int(math.Ceil(maxY))), scale, score
+}
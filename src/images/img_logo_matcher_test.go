@@ -0,0 +1,51 @@
+package images
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+// Unit test for matching the logo library on pages
+func TestLogoMatcher(t *testing.T) {
+	scales, step := logoScales(0.25, 2, 4)
+	if len(scales) != 4 || math.Abs(step-2) > 1e-9 || math.Abs(scales[3]-2) > 1e-9 {
+		t.Errorf("Expected scales doubling from 0.25 to 2, got %v", scales)
+	}
+
+	library, err := LoadLogoLibrary("../../samples/logos")
+	if err != nil {
+		t.Fatalf("Error loading the logos: %v", err)
+	}
+	defer library.Close()
+	if names := library.Names(); len(names) != 3 || names[0] != "bluepeak" {
+		t.Errorf("Expected the bluepeak, kaveri and northwind logos, got %v", names)
+	}
+	matcher := NewLogoMatcher(library)
+
+	// The invoice has the BluePeak logo drawn 1.4 times larger
+	matches, err := matcher.Execute("../../samples/documents/vendor-invoice.png")
+	if err != nil {
+		t.Fatalf("Error matching the logos: %v", err)
+	}
+	if len(matches) != 1 || matches[0].Name != "bluepeak" {
+		t.Fatalf("Expected only the bluepeak logo, got %+v", matches)
+	}
+	expected := image.Rect(80, 70, 724, 238)
+	if box := matches[0].Box; box.Intersect(expected).Size().X*box.Intersect(expected).Size().Y < 8*expected.Dx()*expected.Dy()/10 {
+		t.Errorf("Expected the logo at %v, got %v", expected, box)
+	}
+	if math.Abs(matches[0].Scale-1.4) > 0.1 {
+		t.Errorf("Expected the logo scaled by 1.4, got %.2f", matches[0].Scale)
+	}
+
+	matches, err = matcher.Execute("../../samples/forms/service-request.png")
+	if err != nil || len(matches) == 0 || matches[0].Name != "northwind" {
+		t.Errorf("Expected the northwind logo on the form, got %+v, %v", matches, err)
+	}
+
+	matches, err = matcher.Execute("../../samples/documents/omr-sheet.png")
+	if err != nil || len(matches) != 0 {
+		t.Errorf("Expected no logos on the answer sheet, got %+v, %v", matches, err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"image"
 	"os"
+	"sort"
 
 	"go-ocr/src"
 
@@ -11,12 +12,13 @@ import (
 )
 
 type ImageObjectDetection struct {
-	net        *gocv.Net
-	classes    []string
-	layerNames []string
+	net          *gocv.Net
+	classes      []string
+	outputLayers []string
+	options      DetectorOptions
 }
 
-func NewImageObjectDetector(weightsFile string, configFile string, classFile string) *ImageObjectDetection {
+func NewImageObjectDetector(weightsFile string, configFile string, classFile string, options DetectorOptions) *ImageObjectDetection {
 	// Load the pre-trained YOLOv3 model, configuration, and class labels
 	net := gocv.ReadNet(weightsFile, configFile)
 	if net.Empty() {
@@ -31,65 +33,137 @@ func NewImageObjectDetector(weightsFile string, configFile string, classFile str
 		os.Exit(1)
 	}
 
-	// Get the output layer names
+	// Get the names of the output layers, the YOLO ones
 	layerNames := net.GetLayerNames()
+	var outputLayers []string
+	for _, id := range net.GetUnconnectedOutLayers() {
+		outputLayers = append(outputLayers, layerNames[id-1])
+	}
+
+	if err := options.ValidateNetwork(&net, outputLayers, len(classes)); err != nil {
+		fmt.Println("Invalid detector options:", err)
+		os.Exit(1)
+	}
 
-	return &ImageObjectDetection{&net, classes, layerNames}
+	return &ImageObjectDetection{&net, classes, outputLayers, options}
 }
 
 func (iod *ImageObjectDetection) Close() error {
 	return iod.net.Close()
 }
 
-func (iod *ImageObjectDetection) Execute(fileName string) []DetectedObject {
+// Execute finds every object of an image, keeping the most confident of
+// the overlapping boxes of each class.
+func (iod *ImageObjectDetection) Execute(fileName string) ([]ObjectInstance, error) {
 	// Load the input image
 	img := gocv.IMRead(fileName, gocv.IMReadColor)
 	if img.Empty() {
-		fmt.Println("Error reading the image")
-		return nil
+		return nil, fmt.Errorf("error reading the image %s", fileName)
 	}
 	defer img.Close()
 
 	// Prepare the image for the network (convert to blob)
-	blob := gocv.BlobFromImage(img, 0.00392, image.Pt(416, 416),
-		gocv.NewScalar(0, 0, 0, 0), true, false)
+	blob := iod.options.Blob(img)
 	defer blob.Close()
 
 	// Set the input to the network
 	iod.net.SetInput(blob, "")
 
 	// Run a forward pass: Get the output of the network
-	// This returns a list of layers where the layerOutputs will come from
-	layerOutputs := iod.net.ForwardLayers(iod.layerNames)
-
-	// Process the output to detect objects
-	detectedObjects := make(map[int]DetectedObject, 0)
+	layerOutputs := iod.net.ForwardLayers(iod.outputLayers)
+	defer func() {
+		for _, output := range layerOutputs {
+			output.Close()
+		}
+	}()
 
-	// Process detections
+	// Candidate boxes by class
+	boxes := map[int][]image.Rectangle{}
+	confidences := map[int][]float32{}
+	bounds := image.Rect(0, 0, img.Cols(), img.Rows())
 	for _, output := range layerOutputs {
-		// Loop through the detection matrix (each object detected)
 		// Each detection result contains a vector with the structure:
-		// [centerX, centerY, width, height, confidence, classID, ...]
+		// [centerX, centerY, width, height, objectness, class scores...],
+		// relative to the image size
 		for i := 0; i < output.Rows(); i++ {
 			data := output.Row(i)
-			// Extract the detection information
-			// Class ID (class of the detected object)
 			classId, confidence := src.GetClassIndexAndConfidence(data)
-			if confidence > 0.5 { // Confidence threshold
-				className := iod.classes[classId]
-				if _, ok := detectedObjects[classId]; ok {
-					detectedObjects[classId] = DetectedObject{className, confidence}
-				} else if detectedObjects[classId].Confidence < confidence {
-					detectedObjects[classId] = DetectedObject{className, confidence}
-				}
+			if !iod.options.Accepts(data, confidence) {
+				continue
 			}
+			centerX := data.GetFloatAt(0, 0) * float32(img.Cols())
+			centerY := data.GetFloatAt(0, 1) * float32(img.Rows())
+			width := data.GetFloatAt(0, 2) * float32(img.Cols())
+			height := data.GetFloatAt(0, 3) * float32(img.Rows())
+			box := image.Rect(int(centerX-width/2), int(centerY-height/2), int(centerX+width/2), int(centerY+height/2))
+			if box = box.Intersect(bounds); box.Empty() {
+				continue
+			}
+			boxes[classId] = append(boxes[classId], box)
+			confidences[classId] = append(confidences[classId], confidence)
 		}
 	}
 
-	return src.MapToSlice(detectedObjects)
+	// Non-maximum suppression within each class, so overlapping objects of
+	// different classes are all kept
+	var instances []ObjectInstance
+	for classId := range boxes {
+		for _, i := range gocv.NMSBoxes(boxes[classId], confidences[classId], iod.options.ConfidenceThreshold, iod.options.NMSIoU) {
+			instances = append(instances, newObjectInstance(classId, iod.classes[classId], confidences[classId][i],
+				boxes[classId][i], bounds.Size()))
+		}
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].Confidence > instances[j].Confidence })
+	return instances, nil
+}
+
+// ObjectInstance is an object found in an image.
+type ObjectInstance struct {
+	ClassID    int     `json:"classId"`
+	ClassName  string  `json:"className"`
+	Confidence float32 `json:"confidence"`
+	// In pixels
+	Box image.Rectangle `json:"box"`
+	// Left, top, right and bottom of the box over the width and height of
+	// the image, from 0 to 1
+	NormalizedBox [4]float64 `json:"normalizedBox"`
+}
+
+func newObjectInstance(classId int, className string, confidence float32, box image.Rectangle, size image.Point) ObjectInstance {
+	width, height := float64(size.X), float64(size.Y)
+	return ObjectInstance{
+		ClassID:    classId,
+		ClassName:  className,
+		Confidence: confidence,
+		Box:        box,
+		NormalizedBox: [4]float64{float64(box.Min.X) / width, float64(box.Min.Y) / height,
+			float64(box.Max.X) / width, float64(box.Max.Y) / height},
+	}
 }
 
 type DetectedObject struct {
 	ClassName  string
 	Confidence float32
 }
+
+// SummarizeObjects keeps the most confident instance of each class, by
+// class ID.
+func SummarizeObjects(instances []ObjectInstance) []DetectedObject {
+	best := map[int]ObjectInstance{}
+	for _, instance := range instances {
+		if current, ok := best[instance.ClassID]; !ok || current.Confidence < instance.Confidence {
+			best[instance.ClassID] = instance
+		}
+	}
+	classIds := make([]int, 0, len(best))
+	for classId := range best {
+		classIds = append(classIds, classId)
+	}
+	sort.Ints(classIds)
+
+	var detectedObjects []DetectedObject
+	for _, classId := range classIds {
+		detectedObjects = append(detectedObjects, DetectedObject{best[classId].ClassName, best[classId].Confidence})
+	}
+	return detectedObjects
+}
@@ -1,49 +1,159 @@
 package images
 
 import (
-	"go-ocr/src"
+	"image"
+	"slices"
 	"testing"
+
+	"gocv.io/x/gocv"
 )
 
-// Test function
+// Unit test for the classes found in each image. Confidences vary with
+// the OpenCV build, so only their range is checked
 func TestImageObjectDetection(t *testing.T) {
-	// Set up the image files and expected output
+	// Set up the image files and the classes expected, by class ID
 	inputFiles := []string{"kangaroo_horse.png", "traffic.jpg", "zebra_horse.jpg", "zebra.jpg"}
-	expectedOutput := map[string][]DetectedObject{
-		"kangaroo_horse.png": {
-			{ClassName: "horse", Confidence: 0.95},
-		},
-		"traffic.jpg": {
-			{ClassName: "car", Confidence: 0.80},
-			{ClassName: "traffic light", Confidence: 0.83},
-		},
-		"zebra_horse.jpg": {
-			{ClassName: "horse", Confidence: 0.67},
-			{ClassName: "zebra", Confidence: 1.00},
-		},
-		"zebra.jpg": {
-			{ClassName: "zebra", Confidence: 0.93},
-		},
+	expectedClasses := map[string][]string{
+		"kangaroo_horse.png": {"horse"},
+		"traffic.jpg":        {"car", "traffic light"},
+		"zebra_horse.jpg":    {"horse", "zebra"},
+		"zebra.jpg":          {"zebra"},
 	}
 
+	options := DefaultDetectorOptions()
 	iod := NewImageObjectDetector(
 		"../../models/yolov3.weights",
 		"../../models/yolov3.cfg",
-		"../../models/coco.names")
+		"../../models/coco.names",
+		options)
 
 	defer iod.Close()
 
 	// Iterate over each file and test detection
 	for _, fileName := range inputFiles {
-		detectedObjects := iod.Execute("../../samples/images/" + fileName)
-
-		// Check if the output matches the expected values
-		for i, detectedObject := range detectedObjects {
-			expectedObj := expectedOutput[fileName][i]
-			if detectedObject.ClassName != expectedObj.ClassName || !src.ApproximatelyEqual(detectedObject.Confidence, expectedObj.Confidence, 0.005) {
-				t.Errorf("For file %s, expected %s with confidence %.2f, but got %s with confidence %.2f",
-					fileName, expectedObj.ClassName, expectedObj.Confidence, detectedObject.ClassName, detectedObject.Confidence)
+		instances, err := iod.Execute("../../samples/images/" + fileName)
+		if err != nil {
+			t.Fatalf("Error detecting the objects of %s: %v", fileName, err)
+		}
+		for _, instance := range instances {
+			if instance.Confidence < options.ConfidenceThreshold || instance.Confidence > 1 || instance.Box.Empty() {
+				t.Errorf("For file %s, expected a box scored from %.2f to 1, got %+v", fileName, options.ConfidenceThreshold, instance)
 			}
 		}
+
+		var classes []string
+		for _, detectedObject := range SummarizeObjects(instances) {
+			classes = append(classes, detectedObject.ClassName)
+		}
+		if !slices.Equal(classes, expectedClasses[fileName]) {
+			t.Errorf("For file %s, expected the classes %v, but got %v", fileName, expectedClasses[fileName], classes)
+		}
+	}
+}
+
+// Unit test for the boxes of every instance, with the three zebras of an
+// image found apart
+func TestImageObjectInstances(t *testing.T) {
+	iod := NewImageObjectDetector(
+		"../../models/yolov3.weights",
+		"../../models/yolov3.cfg",
+		"../../models/coco.names",
+		DefaultDetectorOptions())
+
+	defer iod.Close()
+
+	instances, err := iod.Execute("../../samples/images/zebra.jpg")
+	if err != nil {
+		t.Fatalf("Error detecting the objects: %v", err)
+	}
+	zebras := 0
+	for _, instance := range instances {
+		if instance.ClassName == "zebra" {
+			zebras++
+		}
+		if instance.ClassID < 0 || instance.Box.Empty() || !instance.Box.In(image.Rect(0, 0, 640, 386)) {
+			t.Errorf("Expected a box inside the image, got %+v", instance)
+		}
+		normalized := [4]float64{float64(instance.Box.Min.X) / 640, float64(instance.Box.Min.Y) / 386,
+			float64(instance.Box.Max.X) / 640, float64(instance.Box.Max.Y) / 386}
+		if instance.NormalizedBox != normalized {
+			t.Errorf("Expected the normalized box %v, got %v", normalized, instance.NormalizedBox)
+		}
+	}
+	if zebras != 3 {
+		t.Errorf("Expected 3 zebras, got %+v", instances)
+	}
+
+	// No two boxes of a class overlap more than the NMS allows
+	for i, a := range instances {
+		for _, b := range instances[i+1:] {
+			if a.ClassID != b.ClassID {
+				continue
+			}
+			inter := a.Box.Intersect(b.Box)
+			union := a.Box.Dx()*a.Box.Dy() + b.Box.Dx()*b.Box.Dy() - inter.Dx()*inter.Dy()
+			if iou := float64(inter.Dx()*inter.Dy()) / float64(union); iou > 0.3 {
+				t.Errorf("Expected overlapping %s boxes to be suppressed, got %v and %v", a.ClassName, a.Box, b.Box)
+			}
+		}
+	}
+}
+
+// Unit test for checking the detector options, alone and against YOLOv3
+func TestDetectorOptions(t *testing.T) {
+	net := gocv.ReadNet("../../models/yolov3.weights", "../../models/yolov3.cfg")
+	defer net.Close()
+	var outputLayers []string
+	for _, id := range net.GetUnconnectedOutLayers() {
+		outputLayers = append(outputLayers, net.GetLayerNames()[id-1])
+	}
+
+	if err := DefaultDetectorOptions().ValidateNetwork(&net, outputLayers, 80); err != nil {
+		t.Errorf("Expected the default options to suit YOLOv3, got %v", err)
+	}
+	large := DefaultDetectorOptions()
+	large.InputSize = image.Pt(608, 320)
+	if err := large.ValidateNetwork(&net, outputLayers, 80); err != nil {
+		t.Errorf("Expected a 608x320 input to suit YOLOv3, got %v", err)
+	}
+
+	invalid := map[string]func(*DetectorOptions){
+		"confidence above 1":         func(o *DetectorOptions) { o.ConfidenceThreshold = 1.5 },
+		"negative objectness":        func(o *DetectorOptions) { o.ObjectnessThreshold = -0.1 },
+		"no NMS":                     func(o *DetectorOptions) { o.NMSIoU = 0 },
+		"no scale":                   func(o *DetectorOptions) { o.ScaleFactor = 0 },
+		"input not a multiple of 32": func(o *DetectorOptions) { o.InputSize = image.Pt(400, 400) },
+	}
+	for name, change := range invalid {
+		options := DefaultDetectorOptions()
+		change(&options)
+		if err := options.ValidateNetwork(&net, outputLayers, 80); err == nil {
+			t.Errorf("Expected an error for a %s", name)
+		}
+	}
+	if err := DefaultDetectorOptions().ValidateNetwork(&net, outputLayers, 20); err == nil {
+		t.Errorf("Expected an error for a class file of another network")
+	}
+}
+
+// Unit test for the channel order of the blob: the mean is subtracted from
+// the red, green and blue channels, in that order
+func TestDetectorOptionsBlob(t *testing.T) {
+	// A BGR page of blue 10, green 20 and red 30
+	page := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(10, 20, 30, 0), 64, 64, gocv.MatTypeCV8UC3)
+	defer page.Close()
+
+	options := DefaultDetectorOptions()
+	options.InputSize, options.ScaleFactor, options.Mean = image.Pt(64, 64), 1, [3]float64{30, 20, 0}
+	blob := options.Blob(page)
+	defer blob.Close()
+
+	// Red, green, then blue, less the mean
+	for channel, expected := range []float32{0, 0, 10} {
+		plane := gocv.GetBlobChannel(blob, 0, channel)
+		if value := plane.GetFloatAt(32, 32); value != expected {
+			t.Errorf("Expected %.0f in channel %d of the blob, got %.0f", expected, channel, value)
+		}
+		plane.Close()
 	}
 }
@@ -0,0 +1,296 @@
+package images
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+type BoundaryMethod string
+
+const (
+	// The outline of the bright paper against the background
+	BoundaryContour BoundaryMethod = "contour"
+	// The outermost straight edges, when curls or clutter break the outline
+	BoundaryHough BoundaryMethod = "hough"
+	// No page found, the whole photo is kept
+	BoundaryImage BoundaryMethod = "image"
+	// Corners given WithCorners
+	BoundaryManual BoundaryMethod = "manual"
+)
+
+// Photos are searched for the page at this size, in pixels, on their
+// longest side
+const boundarySearchSize = 800
+
+// The page must cover at least this share of the photo
+const minPageArea = 0.2
+
+// PageBoundary is where a page lies in a photo.
+type PageBoundary struct {
+	// Top-left, top-right, bottom-right and bottom-left, in pixels
+	Corners [4]image.Point `json:"corners"`
+	Method  BoundaryMethod `json:"method"`
+}
+
+// FlattenedPage is a page cut out of a photo.
+type FlattenedPage struct {
+	File     string       `json:"file"`
+	Boundary PageBoundary `json:"boundary"`
+	Size     image.Point  `json:"size"`
+}
+
+type PageFlattener struct {
+	dewarp  bool
+	corners *[4]image.Point
+}
+
+func NewPageFlattener() *PageFlattener {
+	return &PageFlattener{}
+}
+
+// WithDewarp straightens the text lines of curled pages after the
+// perspective is corrected.
+func (pf *PageFlattener) WithDewarp(dewarp bool) *PageFlattener {
+	pf.dewarp = dewarp
+	return pf
+}
+
+// WithCorners skips the detection and flattens the page inside the given
+// corners, e.g. after a user adjusted the detected ones.
+func (pf *PageFlattener) WithCorners(corners [4]image.Point) *PageFlattener {
+	pf.corners = &corners
+	return pf
+}
+
+// Execute finds the page in a photo, flattens it and writes it as a PNG to
+// outDir.
+func (pf *PageFlattener) Execute(fileName string, outDir string) (*FlattenedPage, error) {
+	img := gocv.IMRead(fileName, gocv.IMReadColor)
+	if img.Empty() {
+		return nil, fmt.Errorf("error reading the image %s", fileName)
+	}
+	defer img.Close()
+
+	var boundary PageBoundary
+	if pf.corners != nil {
+		boundary = PageBoundary{*pf.corners, BoundaryManual}
+	} else {
+		boundary = pf.Detect(img)
+	}
+
+	page := pf.Flatten(img, boundary.Corners)
+	defer page.Close()
+
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("error creating the output folder: %w", err)
+	}
+	base := strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+	outFile := filepath.Join(outDir, base+"-flat.png")
+	if ok := gocv.IMWrite(outFile, page); !ok {
+		return nil, fmt.Errorf("error writing the flattened page %s", outFile)
+	}
+	return &FlattenedPage{outFile, boundary, image.Pt(page.Cols(), page.Rows())}, nil
+}
+
+// Detect finds the corners of the page in a photo. The outline of the
+// paper is tried first, then the straight edges found by the Hough
+// transform, and the whole photo is returned when both fail.
+func (pf *PageFlattener) Detect(img gocv.Mat) PageBoundary {
+	scale := min(1, float64(boundarySearchSize)/float64(max(img.Cols(), img.Rows())))
+	small := gocv.NewMat()
+	defer small.Close()
+	gocv.Resize(img, &small, image.Pt(0, 0), scale, scale, gocv.InterpolationArea)
+
+	gray := gocv.NewMat()
+	defer gray.Close()
+	gocv.CvtColor(small, &gray, gocv.ColorBGRToGray)
+	gocv.GaussianBlur(gray, &gray, image.Pt(5, 5), 0, 0, gocv.BorderDefault)
+	// Closing erases the dark text, leaving a blank sheet
+	kernel := gocv.GetStructuringElement(gocv.MorphRect, image.Pt(15, 15))
+	defer kernel.Close()
+	gocv.MorphologyEx(gray, &gray, gocv.MorphClose, kernel)
+
+	minArea := minPageArea * float64(small.Cols()*small.Rows())
+	boundary := PageBoundary{Method: BoundaryImage, Corners: [4]image.Point{
+		{0, 0}, {img.Cols() - 1, 0}, {img.Cols() - 1, img.Rows() - 1}, {0, img.Rows() - 1}}}
+
+	paper := gocv.NewMat()
+	defer paper.Close()
+	gocv.Threshold(gray, &paper, 0, 255, gocv.ThresholdBinary+gocv.ThresholdOtsu)
+	edges := gocv.NewMat()
+	defer edges.Close()
+	gocv.Canny(gray, &edges, 50, 150)
+	gocv.Dilate(edges, &edges, kernel)
+
+	var corners [4]image.Point
+	found := false
+	for _, mask := range []gocv.Mat{paper, edges} {
+		if corners, found = quadrilateral(mask, minArea); found {
+			boundary.Method = BoundaryContour
+			break
+		}
+	}
+	if !found {
+		if corners, found = houghQuadrilateral(gray, minArea); found {
+			boundary.Method = BoundaryHough
+		}
+	}
+	if !found {
+		return boundary
+	}
+
+	for i, c := range corners {
+		boundary.Corners[i] = image.Pt(
+			min(img.Cols()-1, max(0, int(math.Round(float64(c.X)/scale)))),
+			min(img.Rows()-1, max(0, int(math.Round(float64(c.Y)/scale)))))
+	}
+	return boundary
+}
+
+// quadrilateral looks for a large four sided outline in a binary mask,
+// simplifying the convex hull of each big contour until four corners are
+// left, which also rounds off curled edges and corners.
+func quadrilateral(mask gocv.Mat, minArea float64) ([4]image.Point, bool) {
+	contours := gocv.FindContours(mask, gocv.RetrievalExternal, gocv.ChainApproxSimple)
+	defer contours.Close()
+
+	order := make([]int, contours.Size())
+	areas := make([]float64, contours.Size())
+	for i := range order {
+		order[i] = i
+		areas[i] = gocv.ContourArea(contours.At(i))
+	}
+	sort.Slice(order, func(i, j int) bool { return areas[order[i]] > areas[order[j]] })
+
+	for _, i := range order {
+		if areas[i] < minArea {
+			break
+		}
+		hullPoints := gocv.NewMat()
+		gocv.ConvexHull(contours.At(i), &hullPoints, true, true)
+		hull := gocv.NewPointVectorFromMat(hullPoints)
+		hullPoints.Close()
+
+		perimeter := gocv.ArcLength(hull, true)
+		for epsilon := 0.02; epsilon <= 0.08; epsilon += 0.01 {
+			approx := gocv.ApproxPolyDP(hull, epsilon*perimeter, true)
+			points := approx.ToPoints()
+			approx.Close()
+			if len(points) == 4 {
+				corners := orderCorners(points)
+				if quadArea(corners) >= minArea {
+					hull.Close()
+					return corners, true
+				}
+			}
+			if len(points) < 4 {
+				break
+			}
+		}
+		hull.Close()
+	}
+	return [4]image.Point{}, false
+}
+
+// houghQuadrilateral finds the long straight edges of the page and
+// intersects the outermost ones.
+func houghQuadrilateral(gray gocv.Mat, minArea float64) ([4]image.Point, bool) {
+	edges := gocv.NewMat()
+	defer edges.Close()
+	gocv.Canny(gray, &edges, 50, 150)
+	lines := gocv.NewMat()
+	defer lines.Close()
+	minLength := float32(min(gray.Cols(), gray.Rows())) / 4
+	gocv.HoughLinesPWithParams(edges, &lines, 1, math.Pi/180, 80, minLength, 20)
+
+	segments := make([]segment, 0, lines.Rows())
+	for i := 0; i < lines.Rows(); i++ {
+		v := lines.GetVeciAt(i, 0)
+		segments = append(segments, segment{image.Pt(int(v[0]), int(v[1])), image.Pt(int(v[2]), int(v[3]))})
+	}
+	corners, ok := outerQuad(segments)
+	if !ok || quadArea(corners) < minArea {
+		return [4]image.Point{}, false
+	}
+	// Edges may cross a little outside the photo
+	bounds := image.Rect(0, 0, gray.Cols(), gray.Rows()).Inset(-gray.Cols() / 10)
+	for _, c := range corners {
+		if !c.In(bounds) {
+			return [4]image.Point{}, false
+		}
+	}
+	return corners, true
+}
+
+// Flatten warps the page inside the corners to a flat rectangle, as big as
+// its longest sides, and dewarps it WithDewarp.
+func (pf *PageFlattener) Flatten(img gocv.Mat, corners [4]image.Point) gocv.Mat {
+	size := pageSize(corners)
+	src := gocv.NewPointVectorFromPoints(corners[:])
+	defer src.Close()
+	dst := gocv.NewPointVectorFromPoints([]image.Point{
+		{0, 0}, {size.X - 1, 0}, {size.X - 1, size.Y - 1}, {0, size.Y - 1}})
+	defer dst.Close()
+	transform := gocv.GetPerspectiveTransform(src, dst)
+	defer transform.Close()
+
+	page := gocv.NewMat()
+	gocv.WarpPerspectiveWithParams(img, &page, transform, size, gocv.InterpolationCubic,
+		gocv.BorderReplicate, color.RGBA{})
+	if !pf.dewarp {
+		return page
+	}
+	defer page.Close()
+	return dewarpPage(page)
+}
+
+// dewarpPage fits a curve through every text line of a page and remaps it
+// so they come out straight, undoing the bulge of a curled page.
+func dewarpPage(page gocv.Mat) gocv.Mat {
+	scale := min(1, float64(boundarySearchSize)/float64(max(page.Cols(), page.Rows())))
+	small := gocv.NewMat()
+	defer small.Close()
+	gocv.Resize(page, &small, image.Pt(0, 0), scale, scale, gocv.InterpolationArea)
+	gocv.CvtColor(small, &small, gocv.ColorBGRToGray)
+	gocv.Threshold(small, &small, 0, 255, gocv.ThresholdBinaryInv+gocv.ThresholdOtsu)
+
+	// Smear the words of every line into one blob, without joining lines
+	smear := gocv.GetStructuringElement(gocv.MorphRect, image.Pt(max(3, small.Cols()/30), 1))
+	defer smear.Close()
+	gocv.MorphologyEx(small, &small, gocv.MorphClose, smear)
+
+	lines := textLines(small, small.Cols()/3)
+	if len(lines) < 2 {
+		return page.Clone()
+	}
+
+	mapX, mapY := curlMaps(lines, page.Cols(), page.Rows(), scale, float64(page.Rows())/20)
+	xs, errX := floatMat(mapX, page.Rows(), page.Cols())
+	ys, errY := floatMat(mapY, page.Rows(), page.Cols())
+	defer xs.Close()
+	defer ys.Close()
+	if errX != nil || errY != nil {
+		return page.Clone()
+	}
+
+	flat := gocv.NewMat()
+	gocv.Remap(page, &flat, &xs, &ys, gocv.InterpolationLinear, gocv.BorderReplicate, color.RGBA{})
+	return flat
+}
+
+func floatMat(values []float32, rows, cols int) (gocv.Mat, error) {
+	data := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(v))
+	}
+	return gocv.NewMatFromBytes(rows, cols, gocv.MatTypeCV32F, data)
+}
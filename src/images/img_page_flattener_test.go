@@ -0,0 +1,122 @@
+package images
+
+import (
+	"go-ocr/src"
+	"image"
+	"math"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+// Unit test for ordering corners and intersecting page edges
+func TestPageGeometry(t *testing.T) {
+	expected := [4]image.Point{{185, 215}, {1015, 150}, {1095, 1425}, {120, 1485}}
+	if corners := orderCorners([]image.Point{expected[2], expected[0], expected[3], expected[1]}); corners != expected {
+		t.Errorf("Expected corners %v, got %v", expected, corners)
+	}
+	if size := pageSize(expected); size != image.Pt(977, 1278) {
+		t.Errorf("Expected a 977x1278 page, got %v", size)
+	}
+
+	segments := []segment{
+		{image.Pt(200, 214), image.Pt(900, 159)},
+		// A text line inside the page
+		{image.Pt(300, 400), image.Pt(800, 380)},
+		{image.Pt(1020, 240), image.Pt(1085, 1280)},
+		{image.Pt(200, 1479), image.Pt(1000, 1430)},
+		{image.Pt(180, 280), image.Pt(125, 1400)},
+	}
+	corners, ok := outerQuad(segments)
+	if !ok {
+		t.Fatalf("Expected the page edges to form a quadrilateral")
+	}
+	for i, c := range corners {
+		if math.Hypot(float64(c.X-expected[i].X), float64(c.Y-expected[i].Y)) > 8 {
+			t.Errorf("Expected corner %d near %v, got %v", i, expected[i], c)
+		}
+	}
+}
+
+// Unit test for fitting curled text lines and straightening them
+func TestCurlMaps(t *testing.T) {
+	cols, rows := 400, 300
+	mask := make([]byte, cols*rows)
+	// Five lines bulging down by 16 pixels at both ends
+	bulge := func(x int) float64 { return 0.0004 * float64((x-200)*(x-200)) }
+	for _, base := range []int{40, 90, 140, 190, 240} {
+		for x := 20; x < 380; x++ {
+			y := base + int(math.Round(bulge(x)))
+			for dy := -2; dy <= 2; dy++ {
+				mask[(y+dy)*cols+x] = 255
+			}
+		}
+	}
+
+	ink, err := gocv.NewMatFromBytes(rows, cols, gocv.MatTypeCV8U, mask)
+	if err != nil {
+		t.Fatalf("Error creating the mask: %v", err)
+	}
+	defer ink.Close()
+	lines := textLines(ink, cols/3)
+	if len(lines) != 5 {
+		t.Fatalf("Expected 5 text lines, got %d", len(lines))
+	}
+	for _, l := range lines {
+		if math.Abs(l.c-0.0004) > 0.00005 {
+			t.Errorf("Expected a curvature close to 0.0004, got %f", l.c)
+		}
+	}
+
+	mapX, mapY := curlMaps(lines, cols, rows, 1, 30)
+	// The straight line at row 140 is read from the curled one
+	for _, x := range []int{20, 100, 200, 379} {
+		i := 140*cols + x
+		if mapX[i] != float32(x) || math.Abs(float64(mapY[i])-(140+bulge(x))) > 1 {
+			t.Errorf("Expected (%d, 140) to come from (%d, %.1f), got (%.1f, %.1f)", x, x, 140+bulge(x), mapX[i], mapY[i])
+		}
+	}
+}
+
+// Unit test for flattening a phone photo of a page
+func TestPageFlattener(t *testing.T) {
+	expected := [4]image.Point{{185, 215}, {1015, 150}, {1095, 1425}, {120, 1485}}
+
+	for _, dewarp := range []bool{false, true} {
+		page, err := NewPageFlattener().
+			WithDewarp(dewarp).
+			Execute("../../samples/documents/phone-photo.jpg", "../../output/test/flattened/")
+		if err != nil || !src.FileExists(page.File) {
+			t.Fatalf("Flattened page not written: %v", err)
+		}
+		if page.Boundary.Method != BoundaryContour {
+			t.Errorf("Expected the page outline to be found, got %s", page.Boundary.Method)
+		}
+		for i, c := range page.Boundary.Corners {
+			if math.Hypot(float64(c.X-expected[i].X), float64(c.Y-expected[i].Y)) > 15 {
+				t.Errorf("Expected corner %d near %v, got %v", i, expected[i], c)
+			}
+		}
+		// The page is 850x1100
+		if aspect := float64(page.Size.X) / float64(page.Size.Y); math.Abs(aspect-850.0/1100) > 0.03 {
+			t.Errorf("Expected the aspect ratio of the page, got %v", page.Size)
+		}
+	}
+
+	// Corners adjusted by hand are used as they are
+	corners := [4]image.Point{{0, 0}, {599, 0}, {599, 399}, {0, 399}}
+	page, err := NewPageFlattener().
+		WithCorners(corners).
+		Execute("../../samples/documents/phone-photo.jpg", "../../output/test/flattened/")
+	if err != nil {
+		t.Fatalf("Error flattening: %v", err)
+	}
+	if page.Boundary.Corners != corners || page.Boundary.Method != BoundaryManual || page.Size != image.Pt(599, 399) {
+		t.Errorf("Expected the given corners to be kept, got %v and size %v", page.Boundary.Corners, page.Size)
+	}
+	flat := gocv.IMRead(page.File, gocv.IMReadColor)
+	defer flat.Close()
+	if flat.Cols() != 599 || flat.Rows() != 399 {
+		t.Errorf("Expected a 599x399 image, got %dx%d", flat.Cols(), flat.Rows())
+	}
+}
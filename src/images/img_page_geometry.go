@@ -0,0 +1,255 @@
+package images
+
+import (
+	"image"
+	"math"
+	"sort"
+
+	"gocv.io/x/gocv"
+)
+
+// orderCorners sorts four corners as top-left, top-right, bottom-right and
+// bottom-left.
+func orderCorners(points []image.Point) [4]image.Point {
+	var corners [4]image.Point
+	sums := func(i int) int { return points[i].X + points[i].Y }
+	diffs := func(i int) int { return points[i].Y - points[i].X }
+	best := func(score func(int) int, lowest bool) image.Point {
+		k := 0
+		for i := range points {
+			if (lowest && score(i) < score(k)) || (!lowest && score(i) > score(k)) {
+				k = i
+			}
+		}
+		return points[k]
+	}
+	corners[0] = best(sums, true)
+	corners[1] = best(diffs, true)
+	corners[2] = best(sums, false)
+	corners[3] = best(diffs, false)
+	return corners
+}
+
+// pageSize is the size of the flattened page, from its longest sides.
+func pageSize(corners [4]image.Point) image.Point {
+	length := func(a, b image.Point) float64 {
+		return math.Hypot(float64(a.X-b.X), float64(a.Y-b.Y))
+	}
+	width := max(length(corners[0], corners[1]), length(corners[3], corners[2]))
+	height := max(length(corners[0], corners[3]), length(corners[1], corners[2]))
+	return image.Pt(int(math.Round(width)), int(math.Round(height)))
+}
+
+// quadArea is the area of a quadrilateral, by the shoelace formula.
+func quadArea(corners [4]image.Point) float64 {
+	area := 0
+	for i, p := range corners {
+		q := corners[(i+1)%4]
+		area += p.X*q.Y - q.X*p.Y
+	}
+	return math.Abs(float64(area)) / 2
+}
+
+// segment is a line segment found by the Hough transform.
+type segment struct {
+	a, b image.Point
+}
+
+func (s segment) horizontal() bool {
+	return abs(s.b.X-s.a.X) >= abs(s.b.Y-s.a.Y)
+}
+
+func (s segment) middle() image.Point {
+	return image.Pt((s.a.X+s.b.X)/2, (s.a.Y+s.b.Y)/2)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// intersect returns where the lines through two segments cross.
+func intersect(s, t segment) (image.Point, bool) {
+	x1, y1, x2, y2 := float64(s.a.X), float64(s.a.Y), float64(s.b.X), float64(s.b.Y)
+	x3, y3, x4, y4 := float64(t.a.X), float64(t.a.Y), float64(t.b.X), float64(t.b.Y)
+	den := (x1-x2)*(y3-y4) - (y1-y2)*(x3-x4)
+	if math.Abs(den) < 1e-9 {
+		return image.Point{}, false
+	}
+	u := ((x1-x3)*(y3-y4) - (y1-y3)*(x3-x4)) / den
+	return image.Pt(int(math.Round(x1+u*(x2-x1))), int(math.Round(y1+u*(y2-y1)))), true
+}
+
+// outerQuad picks the outermost horizontal and vertical segments, the page
+// edges, and returns where they cross.
+func outerQuad(segments []segment) ([4]image.Point, bool) {
+	var top, bottom, left, right *segment
+	for i := range segments {
+		s := &segments[i]
+		m := s.middle()
+		if s.horizontal() {
+			if top == nil || m.Y < top.middle().Y {
+				top = s
+			}
+			if bottom == nil || m.Y > bottom.middle().Y {
+				bottom = s
+			}
+		} else {
+			if left == nil || m.X < left.middle().X {
+				left = s
+			}
+			if right == nil || m.X > right.middle().X {
+				right = s
+			}
+		}
+	}
+	if top == nil || bottom == nil || left == nil || right == nil || top == bottom || left == right {
+		return [4]image.Point{}, false
+	}
+
+	var points []image.Point
+	for _, pair := range [][2]*segment{{top, left}, {top, right}, {bottom, right}, {bottom, left}} {
+		p, ok := intersect(*pair[0], *pair[1])
+		if !ok {
+			return [4]image.Point{}, false
+		}
+		points = append(points, p)
+	}
+	return orderCorners(points), true
+}
+
+// curlLine is a text line fitted with y = a + b*x + c*x*x.
+type curlLine struct {
+	a, b, c float64
+	// Where the line crosses the middle column
+	level float64
+}
+
+func (l curlLine) at(x float64) float64 {
+	return l.a + l.b*x + l.c*x*x
+}
+
+// textLines fits a curve through every blob of a mask of smeared text
+// lines at least minWidth wide, following the mean row of its ink.
+func textLines(mask gocv.Mat, minWidth int) []curlLine {
+	cols, rows := mask.Cols(), mask.Rows()
+	components, labels := labelInk(mask, nil)
+	sums := make([][]float64, len(components))
+	counts := make([][]float64, len(components))
+	for i, c := range components {
+		if c.box.Dx() >= minWidth && c.box.Dy() < rows/4 {
+			sums[i] = make([]float64, c.box.Dx())
+			counts[i] = make([]float64, c.box.Dx())
+		}
+	}
+	for i, label := range labels {
+		if label == 0 || sums[label-1] == nil {
+			continue
+		}
+		x := i%cols - components[label-1].box.Min.X
+		sums[label-1][x] += float64(i / cols)
+		counts[label-1][x]++
+	}
+
+	middle := float64(cols) / 2
+	var lines []curlLine
+	for i, c := range components {
+		if sums[i] == nil {
+			continue
+		}
+		var xs, ys []float64
+		for x := range sums[i] {
+			if counts[i][x] > 0 {
+				xs = append(xs, float64(c.box.Min.X+x))
+				ys = append(ys, sums[i][x]/counts[i][x])
+			}
+		}
+		a, b, cc, ok := fitQuadratic(xs, ys)
+		if !ok {
+			continue
+		}
+		line := curlLine{a: a, b: b, c: cc}
+		line.level = line.at(middle)
+		lines = append(lines, line)
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i].level < lines[j].level })
+	return lines
+}
+
+// fitQuadratic fits y = a + b*x + c*x*x by least squares.
+func fitQuadratic(xs, ys []float64) (a, b, c float64, ok bool) {
+	if len(xs) < 3 {
+		return 0, 0, 0, false
+	}
+	var s [5]float64
+	var t [3]float64
+	for i, x := range xs {
+		p := 1.0
+		for k := range s {
+			s[k] += p
+			if k < 3 {
+				t[k] += p * ys[i]
+			}
+			p *= x
+		}
+	}
+	// Cramer's rule on the normal equations
+	det3 := func(m [3][3]float64) float64 {
+		return m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+			m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+			m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	}
+	m := [3][3]float64{{s[0], s[1], s[2]}, {s[1], s[2], s[3]}, {s[2], s[3], s[4]}}
+	det := det3(m)
+	if math.Abs(det) < 1e-9 {
+		return 0, 0, 0, false
+	}
+	solve := func(col int) float64 {
+		r := m
+		for k := range r {
+			r[k][col] = t[k]
+		}
+		return det3(r) / det
+	}
+	return solve(0), solve(1), solve(2), true
+}
+
+// curlMaps returns, for every pixel of a cols x rows page, where to sample
+// the curled page so its text lines come out straight. The lines were
+// fitted on a copy of the page scaled by scale, and every row moves like
+// the lines around it.
+func curlMaps(lines []curlLine, cols, rows int, scale float64, maxShift float64) (mapX, mapY []float32) {
+	mapX = make([]float32, cols*rows)
+	mapY = make([]float32, cols*rows)
+	offsets := make([]float64, len(lines))
+	for x := 0; x < cols; x++ {
+		sx := float64(x) * scale
+		for i, l := range lines {
+			offsets[i] = max(-maxShift, min(maxShift, (l.at(sx)-l.level)/scale))
+		}
+		next := 0
+		for y := 0; y < rows; y++ {
+			sy := float64(y) * scale
+			for next < len(lines) && lines[next].level <= sy {
+				next++
+			}
+			var offset float64
+			switch {
+			case len(lines) == 0:
+			case next == 0:
+				offset = offsets[0]
+			case next == len(lines):
+				offset = offsets[len(lines)-1]
+			default:
+				above, below := lines[next-1].level, lines[next].level
+				t := (sy - above) / (below - above)
+				offset = offsets[next-1]*(1-t) + offsets[next]*t
+			}
+			mapX[y*cols+x] = float32(x)
+			mapY[y*cols+x] = float32(float64(y) + offset)
+		}
+	}
+	return mapX, mapY
+}
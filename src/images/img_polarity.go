@@ -0,0 +1,180 @@
+package images
+
+import "image"
+
+// polarity is how Otsu's threshold splits a set of pixels: into the dark
+// and the light class, one the background and the other the text.
+type polarity struct {
+	threshold           byte
+	darkMean, lightMean float64
+	darkShare           float64
+}
+
+// contrast is the difference between the mean levels of the classes.
+func (p polarity) contrast() float64 {
+	return p.lightMean - p.darkMean
+}
+
+// inverted tells if the dark class is the larger, the background, so the
+// text is light on dark.
+func (p polarity) inverted() bool {
+	return p.darkShare > 0.5
+}
+
+// stretch maps a level so the background becomes white and the text
+// black, inverting light text on dark.
+func (p polarity) stretch(v byte) byte {
+	if p.contrast() <= 0 {
+		return v
+	}
+	level := (float64(v) - p.darkMean) * 255 / p.contrast()
+	if p.inverted() {
+		level = 255 - level
+	}
+	return byte(min(255, max(0, level)))
+}
+
+// splitPolarity finds the Otsu threshold of a histogram and the classes
+// it splits.
+func splitPolarity(hist [256]int) polarity {
+	total, sum := 0, 0.0
+	for i, n := range hist {
+		total += n
+		sum += float64(i * n)
+	}
+	var p polarity
+	if total == 0 {
+		return p
+	}
+	best, sumDark, dark := -1.0, 0.0, 0
+	for t, n := range hist {
+		dark += n
+		sumDark += float64(t * n)
+		if dark == 0 || dark == total {
+			continue
+		}
+		darkMean := sumDark / float64(dark)
+		lightMean := (sum - sumDark) / float64(total-dark)
+		if between := float64(dark) * float64(total-dark) * (lightMean - darkMean) * (lightMean - darkMean); between > best {
+			best = between
+			p = polarity{threshold: byte(t), darkMean: darkMean, lightMean: lightMean, darkShare: float64(dark) / float64(total)}
+		}
+	}
+	if best < 0 {
+		// A single level, all background
+		p = polarity{threshold: 255, darkMean: sum / float64(total), lightMean: sum / float64(total), darkShare: 1}
+	}
+	return p
+}
+
+// boxHistogram counts the levels of a channel inside a box.
+func boxHistogram(channel []byte, cols int, box image.Rectangle) [256]int {
+	var hist [256]int
+	for y := box.Min.Y; y < box.Max.Y; y++ {
+		for _, v := range channel[y*cols+box.Min.X : y*cols+box.Max.X] {
+			hist[v]++
+		}
+	}
+	return hist
+}
+
+// reversedTiles marks the tiles of a page whose background isn't white
+// paper: dark, where text would be light, or strongly colored. The
+// background is the larger class of the tile's Otsu split.
+func reversedTiles(gray, saturation []byte, cols, rows, tile int, minSaturation float64) ([]bool, int, int) {
+	tilesX, tilesY := (cols+tile-1)/tile, (rows+tile-1)/tile
+	marked := make([]bool, tilesX*tilesY)
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			box := image.Rect(tx*tile, ty*tile, min(cols, (tx+1)*tile), min(rows, (ty+1)*tile))
+			p := splitPolarity(boxHistogram(gray, cols, box))
+
+			// The saturation of the background class only, colored text
+			// on white paper is not reversed
+			var background, count float64
+			for y := box.Min.Y; y < box.Max.Y; y++ {
+				for x := box.Min.X; x < box.Max.X; x++ {
+					if i := y*cols + x; (gray[i] <= p.threshold) == p.inverted() {
+						background += float64(saturation[i])
+						count++
+					}
+				}
+			}
+			level := p.lightMean
+			if p.inverted() {
+				level = p.darkMean
+			}
+			colored := count > 0 && background/count >= minSaturation
+			marked[ty*tilesX+tx] = level < 128 || colored
+		}
+	}
+	return marked, tilesX, tilesY
+}
+
+// tileRegions joins side by side marked tiles into boxes, in pixels.
+func tileRegions(marked []bool, tilesX, tilesY, tile, cols, rows int) []image.Rectangle {
+	seen := make([]bool, len(marked))
+	var regions []image.Rectangle
+	for start, m := range marked {
+		if !m || seen[start] {
+			continue
+		}
+		var box image.Rectangle
+		seen[start] = true
+		stack := []int{start}
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			tx, ty := i%tilesX, i/tilesX
+			box = box.Union(image.Rect(tx*tile, ty*tile, min(cols, (tx+1)*tile), min(rows, (ty+1)*tile)))
+			for _, n := range [][2]int{{tx - 1, ty}, {tx + 1, ty}, {tx, ty - 1}, {tx, ty + 1}} {
+				if n[0] >= 0 && n[1] >= 0 && n[0] < tilesX && n[1] < tilesY {
+					if j := n[1]*tilesX + n[0]; marked[j] && !seen[j] {
+						seen[j] = true
+						stack = append(stack, j)
+					}
+				}
+			}
+		}
+		regions = append(regions, box)
+	}
+	return regions
+}
+
+// trimRegion shrinks a box to the rows and columns where most pixels are
+// on the background side of the polarity, cutting off the white paper the
+// tiles overlapped.
+func trimRegion(channel []byte, cols int, box image.Rectangle, p polarity) image.Rectangle {
+	isBackground := func(v byte) bool { return (v <= p.threshold) == p.inverted() }
+	rowShare := func(y int) bool {
+		n := 0
+		for x := box.Min.X; x < box.Max.X; x++ {
+			if isBackground(channel[y*cols+x]) {
+				n++
+			}
+		}
+		return 2*n > box.Dx()
+	}
+	colShare := func(x int) bool {
+		n := 0
+		for y := box.Min.Y; y < box.Max.Y; y++ {
+			if isBackground(channel[y*cols+x]) {
+				n++
+			}
+		}
+		return 2*n > box.Dy()
+	}
+	for box.Min.Y < box.Max.Y && !rowShare(box.Min.Y) {
+		box.Min.Y++
+	}
+	for box.Max.Y > box.Min.Y && !rowShare(box.Max.Y-1) {
+		box.Max.Y--
+	}
+	for box.Min.X < box.Max.X && !colShare(box.Min.X) {
+		box.Min.X++
+	}
+	for box.Max.X > box.Min.X && !colShare(box.Max.X-1) {
+		box.Max.X--
+	}
+	return box
+}
@@ -0,0 +1,166 @@
+package images
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+// InvertedRegion is a part of a page whose text isn't dark on white paper:
+// light text on a dark bar, or colored text on a colored background.
+type InvertedRegion struct {
+	Box image.Rectangle `json:"box"`
+	// The channel the text contrasts best in: gray, blue, green or red
+	Channel string `json:"channel"`
+	// True when the text is lighter than its background
+	Inverted bool    `json:"inverted"`
+	Contrast float64 `json:"contrast"`
+	Page     int     `json:"page"`
+
+	polarity polarity
+}
+
+// The channels a region is read from, gray first so it wins the ties
+var polarityChannels = []string{"gray", "blue", "green", "red"}
+
+type PolarityNormalizer struct {
+	tileSize      int
+	minContrast   float64
+	minSaturation float64
+}
+
+// NewPolarityNormalizer finds reversed regions by Otsu's threshold over
+// 40 pixel tiles, and rewrites them as dark text on white.
+func NewPolarityNormalizer() *PolarityNormalizer {
+	return &PolarityNormalizer{tileSize: 40, minContrast: 40, minSaturation: 80}
+}
+
+// WithTileSize sets the side of the tiles, in pixels. They should be about
+// as tall as a header line: bars thinner than half a tile are missed.
+func (pn *PolarityNormalizer) WithTileSize(size int) *PolarityNormalizer {
+	pn.tileSize = size
+	return pn
+}
+
+// WithMinContrast ignores regions whose text and background levels are
+// closer than this, in the best channel. 40 by default.
+func (pn *PolarityNormalizer) WithMinContrast(contrast float64) *PolarityNormalizer {
+	pn.minContrast = contrast
+	return pn
+}
+
+// Execute normalizes the first page of an image file and writes it, in
+// gray, as a PNG to outDir.
+func (pn *PolarityNormalizer) Execute(fileName string, outDir string) (string, []InvertedRegion, error) {
+	img := gocv.IMRead(fileName, gocv.IMReadColor)
+	if img.Empty() {
+		return "", nil, fmt.Errorf("error reading the image %s", fileName)
+	}
+	defer img.Close()
+
+	normalized, regions, err := pn.Normalize(img)
+	if err != nil {
+		return "", nil, err
+	}
+	defer normalized.Close()
+
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return "", nil, fmt.Errorf("error creating the output folder: %w", err)
+	}
+	base := strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+	outFile := filepath.Join(outDir, base+"-polarity.png")
+	if ok := gocv.IMWrite(outFile, normalized); !ok {
+		return "", nil, fmt.Errorf("error writing %s", outFile)
+	}
+	return outFile, regions, nil
+}
+
+// Normalize returns a gray page where every reversed region is replaced by
+// its best channel, stretched and inverted as needed so the text is dark
+// on white like the rest of the page.
+func (pn *PolarityNormalizer) Normalize(img gocv.Mat) (gocv.Mat, []InvertedRegion, error) {
+	channels := pn.channels(img)
+	regions := pn.detect(channels, img.Cols(), img.Rows(), 0)
+
+	gray := channels[0]
+	page := make([]byte, len(gray))
+	copy(page, gray)
+	for _, region := range regions {
+		channel := channels[slices.Index(polarityChannels, region.Channel)]
+		for y := region.Box.Min.Y; y < region.Box.Max.Y; y++ {
+			for x := region.Box.Min.X; x < region.Box.Max.X; x++ {
+				i := y*img.Cols() + x
+				page[i] = region.polarity.stretch(channel[i])
+			}
+		}
+	}
+	normalized, err := gocv.NewMatFromBytes(img.Rows(), img.Cols(), gocv.MatTypeCV8U, page)
+	if err != nil {
+		return gocv.NewMat(), nil, fmt.Errorf("error normalizing the page: %w", err)
+	}
+	return normalized, regions, nil
+}
+
+// Detect finds the reversed regions of a gray or BGR page.
+func (pn *PolarityNormalizer) Detect(img gocv.Mat, page int) []InvertedRegion {
+	return pn.detect(pn.channels(img), img.Cols(), img.Rows(), page)
+}
+
+func (pn *PolarityNormalizer) detect(channels [][]byte, cols, rows, page int) []InvertedRegion {
+	saturation := channels[len(channels)-1]
+	marked, tilesX, tilesY := reversedTiles(channels[0], saturation, cols, rows, pn.tileSize, pn.minSaturation)
+
+	var regions []InvertedRegion
+	for _, box := range tileRegions(marked, tilesX, tilesY, pn.tileSize, cols, rows) {
+		var best InvertedRegion
+		for c, name := range polarityChannels[:len(channels)-1] {
+			p := splitPolarity(boxHistogram(channels[c], cols, box))
+			// Tiles only partly on the bar weren't marked, the trimming finds
+			// its edges
+			trimmed := trimRegion(channels[c], cols, box.Inset(-pn.tileSize).Intersect(image.Rect(0, 0, cols, rows)), p)
+			if trimmed.Empty() {
+				continue
+			}
+			// The classes of the region itself, without the paper around
+			p = splitPolarity(boxHistogram(channels[c], cols, trimmed))
+			if p.contrast() > best.Contrast {
+				best = InvertedRegion{Box: trimmed, Channel: name, Inverted: p.inverted(), Contrast: p.contrast(), Page: page, polarity: p}
+			}
+		}
+		if best.Contrast >= pn.minContrast && best.Box.Dy() >= pn.tileSize/2 {
+			regions = append(regions, best)
+		}
+	}
+	return regions
+}
+
+// channels splits a page into its gray, blue, green and red levels, and
+// last the saturation. Gray pages only have the gray and a saturation of 0.
+func (pn *PolarityNormalizer) channels(img gocv.Mat) [][]byte {
+	gray := grayOf(img)
+	defer gray.Close()
+	if img.Channels() == 1 {
+		return [][]byte{gray.ToBytes(), make([]byte, gray.Cols()*gray.Rows())}
+	}
+
+	channels := [][]byte{gray.ToBytes()}
+	bgr := gocv.Split(img)
+	for _, c := range bgr[:3] {
+		channels = append(channels, c.ToBytes())
+	}
+	for _, c := range bgr {
+		c.Close()
+	}
+	hsv := gocv.NewMat()
+	defer hsv.Close()
+	gocv.CvtColor(img, &hsv, gocv.ColorBGRToHSV)
+	saturation := gocv.NewMat()
+	defer saturation.Close()
+	gocv.ExtractChannel(hsv, &saturation, 1)
+	return append(channels, saturation.ToBytes())
+}
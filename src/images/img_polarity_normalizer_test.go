@@ -0,0 +1,58 @@
+package images
+
+import (
+	"image"
+	"os"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+// Unit test for finding and normalizing reversed header bars
+func TestPolarityNormalizer(t *testing.T) {
+	page := gocv.IMRead("../../samples/documents/inverted-header.png", gocv.IMReadColor)
+	defer page.Close()
+
+	normalized, regions, err := NewPolarityNormalizer().Normalize(page)
+	defer normalized.Close()
+	if err != nil {
+		t.Fatalf("Error normalizing the page: %v", err)
+	}
+	bars := []image.Rectangle{image.Rect(0, 40, 1100, 150), image.Rect(50, 330, 1050, 410), image.Rect(50, 640, 1050, 720)}
+	if len(regions) != len(bars) {
+		t.Fatalf("Expected %d reversed regions, got %+v", len(bars), regions)
+	}
+	for i, region := range regions {
+		if region.Box.Intersect(bars[i]).Size() != bars[i].Size() || region.Box.Dx() > bars[i].Dx()+4 || region.Box.Dy() > bars[i].Dy()+4 {
+			t.Errorf("Expected region %d at %v, got %v", i, bars[i], region.Box)
+		}
+		if !region.Inverted {
+			t.Errorf("Expected region %d to hold light text on a dark background", i)
+		}
+	}
+	// Red text on a blue bar hardly differs in gray
+	if regions[1].Channel != "red" || regions[1].Contrast < 100 {
+		t.Errorf("Expected the red channel for red text on blue, got %s with a contrast of %.1f", regions[1].Channel, regions[1].Contrast)
+	}
+
+	// The bars turn white, their text dark
+	for _, bar := range bars {
+		region := normalized.Region(bar)
+		mean := region.Mean()
+		region.Close()
+		if mean.Val1 < 200 {
+			t.Errorf("Expected the bar %v whitened, got a mean level of %.1f", bar, mean.Val1)
+		}
+	}
+	if err := os.MkdirAll("../../output/test/polarity/", os.ModePerm); err != nil {
+		t.Fatalf("Error creating the output folder: %v", err)
+	}
+	gocv.IMWrite("../../output/test/polarity/inverted-header.png", normalized)
+
+	// Dark text on white paper is left alone
+	plain := gocv.IMRead("../../samples/documents/input-image.png", gocv.IMReadColor)
+	defer plain.Close()
+	if regions := NewPolarityNormalizer().Detect(plain, 0); len(regions) != 0 {
+		t.Errorf("Expected no reversed regions on a plain page, got %+v", regions)
+	}
+}
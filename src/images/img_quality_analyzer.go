@@ -0,0 +1,84 @@
+package images
+
+import (
+	"fmt"
+
+	"gocv.io/x/gocv"
+)
+
+// QualityReport rates how well a page will OCR.
+type QualityReport struct {
+	Page    int            `json:"page"`
+	Metrics QualityMetrics `json:"metrics"`
+	// From 0 to 1, 0.5 is a page at the warning limits
+	Score  float64        `json:"score"`
+	Issues []QualityIssue `json:"issues,omitempty"`
+}
+
+// Passed tells if no metric is outside its fail limit, warnings aside.
+func (qr QualityReport) Passed() bool {
+	for _, issue := range qr.Issues {
+		if issue.Fail {
+			return false
+		}
+	}
+	return true
+}
+
+// Reasons lists why the page is rejected, e.g. "too blurry".
+func (qr QualityReport) Reasons() []string {
+	var reasons []string
+	for _, issue := range qr.Issues {
+		if issue.Fail {
+			reasons = append(reasons, issue.Reason)
+		}
+	}
+	return reasons
+}
+
+type QualityAnalyzer struct {
+	thresholds QualityThresholds
+}
+
+func NewQualityAnalyzer() *QualityAnalyzer {
+	return &QualityAnalyzer{thresholds: DefaultQualityThresholds()}
+}
+
+// WithThresholds replaces the DefaultQualityThresholds.
+func (qa *QualityAnalyzer) WithThresholds(thresholds QualityThresholds) *QualityAnalyzer {
+	qa.thresholds = thresholds
+	return qa
+}
+
+// Execute rates every page of an image file. Multi-page TIFFs are read
+// page by page.
+func (qa *QualityAnalyzer) Execute(fileName string) ([]QualityReport, error) {
+	pages := gocv.IMReadMulti(fileName, gocv.IMReadGrayScale)
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("error reading the image %s", fileName)
+	}
+	defer func() {
+		for _, page := range pages {
+			page.Close()
+		}
+	}()
+
+	reports := make([]QualityReport, len(pages))
+	for i, page := range pages {
+		reports[i] = qa.Assess(page, i)
+	}
+	return reports, nil
+}
+
+// Assess measures one page and checks it against the thresholds.
+func (qa *QualityAnalyzer) Assess(img gocv.Mat, page int) QualityReport {
+	gray := grayOf(img)
+	defer gray.Close()
+	ink := gocv.NewMat()
+	defer ink.Close()
+	gocv.Threshold(gray, &ink, 0, 255, gocv.ThresholdBinaryInv+gocv.ThresholdOtsu)
+
+	report := QualityReport{Page: page, Metrics: pageMetrics(gray, ink)}
+	report.Score, report.Issues = assessQuality(report.Metrics, qa.thresholds)
+	return report
+}
@@ -0,0 +1,102 @@
+package images
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"slices"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+// Unit test for rating page metrics against the thresholds
+func TestQualityMetrics(t *testing.T) {
+	thresholds := DefaultQualityThresholds()
+	good := QualityMetrics{Blur: 5000, Contrast: 0.8, Brightness: 230, DPI: 300, TextCoverage: 0.1}
+	score, issues := assessQuality(good, thresholds)
+	if len(issues) != 0 || score < 0.95 {
+		t.Errorf("Expected a good page to pass with a high score, got %.2f %+v", score, issues)
+	}
+
+	poor := good
+	poor.Blur, poor.DPI, poor.Skew = 300, 80, -5
+	score, issues = assessQuality(poor, thresholds)
+	var reasons []string
+	for _, issue := range issues {
+		reasons = append(reasons, issue.Reason)
+	}
+	if !slices.Equal(reasons, []string{"too blurry", "below 100 DPI", "skewed by more than 2 degrees"}) ||
+		issues[0].Fail || !issues[1].Fail || issues[2].Fail {
+		t.Errorf("Expected blur and skew warnings and a DPI failure, got %+v", issues)
+	}
+	if score >= 0.9 {
+		t.Errorf("Expected a lower score for a poor page, got %.2f", score)
+	}
+
+	// Lines of characters 10 pixels tall going down 3 degrees to the right
+	var characters []inkComponent
+	for line := 0; line < 5; line++ {
+		for x := 0; x < 600; x += 12 {
+			y := 40*line + int(float64(x)*math.Tan(3*math.Pi/180))
+			characters = append(characters, inkComponent{box: image.Rect(x, y, x+8, y+10), area: 40})
+		}
+	}
+	if h := xHeight(characters); h != 10 {
+		t.Errorf("Expected an x-height of 10, got %v", h)
+	}
+	if skew := textSkew(characters, 20, 15); math.Abs(skew-3) > 0.5 {
+		t.Errorf("Expected a skew of 3 degrees, got %v", skew)
+	}
+
+	flat := make([]byte, 100*100)
+	for i := range flat {
+		flat[i] = 200
+	}
+	if noise := noiseLevel(flat, 100, 100); noise != 0 {
+		t.Errorf("Expected no noise on a flat page, got %v", noise)
+	}
+}
+
+// Unit test for rejecting blurry, dark and low resolution pages
+func TestQualityAnalyzer(t *testing.T) {
+	reports, err := NewQualityAnalyzer().Execute("../../samples/documents/input-image.png")
+	if err != nil {
+		t.Fatalf("Error assessing the image: %v", err)
+	}
+	if len(reports) != 1 || !reports[0].Passed() {
+		t.Fatalf("Expected the sample to pass, got %+v", reports)
+	}
+
+	page := gocv.IMRead("../../samples/documents/input-image.png", gocv.IMReadGrayScale)
+	defer page.Close()
+	degraded := gocv.NewMat()
+	defer degraded.Close()
+
+	gocv.GaussianBlur(page, &degraded, image.Pt(0, 0), 3, 3, gocv.BorderDefault)
+	if report := NewQualityAnalyzer().Assess(degraded, 0); !slices.Contains(report.Reasons(), "too blurry") {
+		t.Errorf("Expected a blurred page to be too blurry, got %+v", report)
+	}
+
+	page.ConvertToWithParams(&degraded, gocv.MatTypeCV8U, 0.25, 0)
+	if report := NewQualityAnalyzer().Assess(degraded, 0); !slices.Contains(report.Reasons(), "too dark") {
+		t.Errorf("Expected a darkened page to be too dark, got %+v", report)
+	}
+
+	// Past the fail limit, the page is measured skewed by 30 degrees and
+	// not by the largest angle that was searched
+	rotation := gocv.GetRotationMatrix2D(image.Pt(page.Cols()/2, page.Rows()/2), -30, 1)
+	defer rotation.Close()
+	gocv.WarpAffineWithParams(page, &degraded, rotation, image.Pt(page.Cols(), page.Rows()),
+		gocv.InterpolationLinear, gocv.BorderConstant, color.RGBA{255, 255, 255, 0})
+	report := NewQualityAnalyzer().Assess(degraded, 0)
+	if !slices.ContainsFunc(report.Issues, func(issue QualityIssue) bool { return issue.Metric == "skew" && issue.Fail }) ||
+		math.Abs(math.Abs(report.Metrics.Skew)-30) > 1 {
+		t.Errorf("Expected a page rotated by 30 degrees to be rejected as skewed, got %+v", report)
+	}
+
+	gocv.Resize(page, &degraded, image.Pt(0, 0), 0.4, 0.4, gocv.InterpolationArea)
+	if report := NewQualityAnalyzer().Assess(degraded, 0); !slices.Contains(report.Reasons(), "below 100 DPI") {
+		t.Errorf("Expected a downscaled page to be below 100 DPI, got %+v", report)
+	}
+}
@@ -0,0 +1,313 @@
+package images
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+
+	"gocv.io/x/gocv"
+)
+
+// Height of a lowercase x in inches for 11 point body text, used to tell
+// the resolution of a page from the size of its letters
+const xHeightInches = 0.075
+
+// Skew is searched within this angle, in degrees, well past the fail limit
+// so badly skewed pages are measured rather than read as the largest angle
+// tried
+const maxSkewSearch = 45
+
+// QualityMetrics are the measures a page is rated by.
+type QualityMetrics struct {
+	// Variance of the Laplacian around the text, sharp edges give high
+	// values
+	Blur float64 `json:"blur"`
+	// Difference between the mean ink and paper levels, from 0 to 1
+	Contrast float64 `json:"contrast"`
+	// Mean gray level, from 0 to 255
+	Brightness float64 `json:"brightness"`
+	// Standard deviation of the pixel noise, in gray levels
+	Noise float64 `json:"noise"`
+	// Resolution estimated from the x-height of the text, 0 when the page
+	// has no text
+	DPI float64 `json:"dpi"`
+	// Angle of the text lines in degrees, positive when they go down to
+	// the right
+	Skew float64 `json:"skew"`
+	// Share of the page covered by characters, from 0 to 1
+	TextCoverage float64 `json:"textCoverage"`
+}
+
+// QualityLimits bound each metric. Zero leaves a metric unchecked.
+type QualityLimits struct {
+	MinBlur         float64 `json:"minBlur"`
+	MinContrast     float64 `json:"minContrast"`
+	MinBrightness   float64 `json:"minBrightness"`
+	MaxBrightness   float64 `json:"maxBrightness"`
+	MaxNoise        float64 `json:"maxNoise"`
+	MinDPI          float64 `json:"minDPI"`
+	MaxSkew         float64 `json:"maxSkew"`
+	MinTextCoverage float64 `json:"minTextCoverage"`
+}
+
+// QualityThresholds reject the pages outside the Fail limits and warn
+// about those outside the Warn ones.
+type QualityThresholds struct {
+	Fail QualityLimits `json:"fail"`
+	Warn QualityLimits `json:"warn"`
+}
+
+// DefaultQualityThresholds suit office documents scanned for OCR. Pages
+// are only rejected below 100 DPI: the resolution is estimated from 11
+// point text, and smaller print on pages scanned at 150 DPI, such as the
+// input-image sample Tesseract reads almost flawlessly, comes out near
+// 120. Pages below 150 DPI are warned about.
+func DefaultQualityThresholds() QualityThresholds {
+	return QualityThresholds{
+		Fail: QualityLimits{MinBlur: 150, MinContrast: 0.2, MinBrightness: 70, MaxNoise: 25, MinDPI: 100,
+			MaxSkew: 15, MinTextCoverage: 0.002},
+		Warn: QualityLimits{MinBlur: 400, MinContrast: 0.35, MinBrightness: 120, MaxNoise: 12, MinDPI: 150,
+			MaxSkew: 2, MinTextCoverage: 0.01},
+	}
+}
+
+// QualityIssue is a metric outside its limit.
+type QualityIssue struct {
+	Metric string `json:"metric"`
+	// e.g. "too blurry" or "below 150 DPI"
+	Reason string  `json:"reason"`
+	Value  float64 `json:"value"`
+	Limit  float64 `json:"limit"`
+	// Whether the page is rejected, or only warned about
+	Fail bool `json:"fail"`
+}
+
+// qualityCheck bounds one metric from below, or from above when max is
+// set.
+type qualityCheck struct {
+	metric     string
+	value      float64
+	max        bool
+	fail, warn float64
+	reason     func(limit float64) string
+}
+
+func (c qualityCheck) outside(limit float64) bool {
+	return limit != 0 && ((c.max && c.value > limit) || (!c.max && c.value < limit))
+}
+
+// rate scores the metric from 0 at the fail limit to 0.5 at the warn limit
+// and 1 at zero for upper bounds, or as far past the warn limit again for
+// lower ones.
+func (c qualityCheck) rate() float64 {
+	if c.fail == 0 && c.warn == 0 {
+		return 1
+	}
+	if c.fail == 0 || c.warn == 0 || c.fail == c.warn {
+		if c.outside(c.fail) || c.outside(c.warn) {
+			return 0
+		}
+		return 1
+	}
+	if c.max {
+		if c.value > c.warn {
+			return 0.5 - 0.5*clamp01(c.value, c.warn, c.fail)
+		}
+		return 1 - 0.5*c.value/c.warn
+	}
+	if c.value < c.warn {
+		return 0.5 * clamp01(c.value, c.fail, c.warn)
+	}
+	return 0.5 + 0.5*clamp01(c.value, c.warn, 2*c.warn-c.fail)
+}
+
+// assessQuality scores the metrics of a page from 0 to 1, the mean rating
+// of every checked metric, and lists those outside their limits.
+// Resolution, skew and blur are measured on the text and left unchecked on
+// pages without any.
+func assessQuality(m QualityMetrics, t QualityThresholds) (float64, []QualityIssue) {
+	checks := []qualityCheck{
+		{"textCoverage", m.TextCoverage, false, t.Fail.MinTextCoverage, t.Warn.MinTextCoverage,
+			func(float64) string { return "too little text" }},
+		{"contrast", m.Contrast, false, t.Fail.MinContrast, t.Warn.MinContrast,
+			func(float64) string { return "low contrast" }},
+		{"brightness", m.Brightness, false, t.Fail.MinBrightness, t.Warn.MinBrightness,
+			func(float64) string { return "too dark" }},
+		{"brightness", m.Brightness, true, t.Fail.MaxBrightness, t.Warn.MaxBrightness,
+			func(float64) string { return "too bright" }},
+		{"noise", m.Noise, true, t.Fail.MaxNoise, t.Warn.MaxNoise,
+			func(float64) string { return "too noisy" }},
+	}
+	if m.DPI > 0 {
+		checks = append(checks,
+			qualityCheck{"blur", m.Blur, false, t.Fail.MinBlur, t.Warn.MinBlur,
+				func(float64) string { return "too blurry" }},
+			qualityCheck{"dpi", m.DPI, false, t.Fail.MinDPI, t.Warn.MinDPI,
+				func(limit float64) string { return fmt.Sprintf("below %g DPI", limit) }},
+			qualityCheck{"skew", math.Abs(m.Skew), true, t.Fail.MaxSkew, t.Warn.MaxSkew,
+				func(limit float64) string { return fmt.Sprintf("skewed by more than %g degrees", limit) }})
+	}
+
+	var issues []QualityIssue
+	total := 0.0
+	for _, c := range checks {
+		total += c.rate()
+		if c.outside(c.fail) {
+			issues = append(issues, QualityIssue{Metric: c.metric, Reason: c.reason(c.fail), Value: c.value, Limit: c.fail, Fail: true})
+		} else if c.outside(c.warn) {
+			issues = append(issues, QualityIssue{Metric: c.metric, Reason: c.reason(c.warn), Value: c.value, Limit: c.warn})
+		}
+	}
+	return total / float64(len(checks)), issues
+}
+
+// characterComponents keeps the components shaped like printed characters,
+// dropping specks, rules, pictures and page borders.
+func characterComponents(components []inkComponent, rows int) []inkComponent {
+	var characters []inkComponent
+	for _, c := range components {
+		w, h := c.box.Dx(), c.box.Dy()
+		if h >= 4 && h <= max(4, rows/15) && w <= 3*h && c.area >= 4 {
+			characters = append(characters, c)
+		}
+	}
+	return characters
+}
+
+// xHeight is the most common character height, lowercase letters without
+// ascenders or descenders outnumber the others in running text.
+func xHeight(characters []inkComponent) float64 {
+	counts := map[int]int{}
+	for _, c := range characters {
+		counts[c.box.Dy()]++
+	}
+	best, bestCount := 0, 0
+	for h := range counts {
+		// Heights one pixel apart are the same letters, rounded apart
+		if count := counts[h-1] + 2*counts[h] + counts[h+1]; count > bestCount || (count == bestCount && h < best) {
+			best, bestCount = h, count
+		}
+	}
+	return float64(best)
+}
+
+// textSkew finds the angle, in degrees within ±maxAngle, at which the
+// bottoms of the characters line up best: their projection across the
+// lines then piles up in the fewest, fullest bins.
+func textSkew(characters []inkComponent, lineHeight, maxAngle float64) float64 {
+	if len(characters) < 10 || lineHeight <= 0 {
+		return 0
+	}
+	bin := max(1, lineHeight/3)
+	best, bestEnergy := 0.0, -1.0
+	for angle := -maxAngle; angle <= maxAngle+1e-9; angle += 0.25 {
+		sin, cos := math.Sincos(angle * math.Pi / 180)
+		counts := map[int]int{}
+		for _, c := range characters {
+			x, y := float64(c.box.Min.X+c.box.Max.X)/2, float64(c.box.Max.Y)
+			counts[int(math.Floor((y*cos-x*sin)/bin))]++
+		}
+		energy := 0.0
+		for _, n := range counts {
+			energy += float64(n * n)
+		}
+		// Ties go to the angle closest to level
+		if energy > bestEnergy || (energy == bestEnergy && math.Abs(angle) < math.Abs(best)) {
+			best, bestEnergy = angle, energy
+		}
+	}
+	return best
+}
+
+// noiseLevel estimates the standard deviation of the pixel noise by
+// Immerkær's method. The median response of the filter is used rather
+// than the mean, so the edges of the text don't count as noise.
+func noiseLevel(gray []byte, cols, rows int) float64 {
+	if cols < 3 || rows < 3 {
+		return 0
+	}
+	var responses []int
+	for y := 1; y < rows-1; y += 2 {
+		for x := 1; x < cols-1; x += 2 {
+			p := func(dx, dy int) int { return int(gray[(y+dy)*cols+x+dx]) }
+			r := p(-1, -1) - 2*p(0, -1) + p(1, -1) -
+				2*p(-1, 0) + 4*p(0, 0) - 2*p(1, 0) +
+				p(-1, 1) - 2*p(0, 1) + p(1, 1)
+			responses = append(responses, max(r, -r))
+		}
+	}
+	sort.Ints(responses)
+	// The filter's response to Gaussian noise of deviation s has a
+	// deviation of 6s, and the median of its absolute value is 0.6745 of
+	// that
+	return float64(responses[len(responses)/2]) / (6 * 0.6745)
+}
+
+// sharpness is the variance of the Laplacian over the boxes of the
+// characters, or over the whole page when there are none.
+func sharpness(gray gocv.Mat, characters []inkComponent) float64 {
+	laplacian := gocv.NewMat()
+	defer laplacian.Close()
+	gocv.Laplacian(gray, &laplacian, gocv.MatTypeCV64F, 1, 1, 0, gocv.BorderDefault)
+	squares := gocv.NewMat()
+	defer squares.Close()
+	gocv.Multiply(laplacian, laplacian, &squares)
+
+	mask := gocv.Zeros(gray.Rows(), gray.Cols(), gocv.MatTypeCV8U)
+	defer mask.Close()
+	if len(characters) == 0 {
+		gocv.Rectangle(&mask, image.Rect(0, 0, gray.Cols(), gray.Rows()), color.RGBA{255, 255, 255, 0}, -1)
+	}
+	for _, c := range characters {
+		gocv.Rectangle(&mask, c.box, color.RGBA{255, 255, 255, 0}, -1)
+	}
+	mean := laplacian.MeanWithMask(mask).Val1
+	return squares.MeanWithMask(mask).Val1 - mean*mean
+}
+
+// textContrast is the difference between the mean gray levels of the
+// paper and of the ink, from 0 to 1.
+func textContrast(gray, ink []byte) float64 {
+	var inkSum, paperSum, inkCount int
+	for i, g := range gray {
+		if ink[i] != 0 {
+			inkSum += int(g)
+			inkCount++
+		} else {
+			paperSum += int(g)
+		}
+	}
+	if inkCount == 0 || inkCount == len(gray) {
+		return 0
+	}
+	return max(0, float64(paperSum)/float64(len(gray)-inkCount)-float64(inkSum)/float64(inkCount)) / 255
+}
+
+// pageMetrics measures a grayscale page and its ink, non-zero in the
+// mask.
+func pageMetrics(grayMat, inkMat gocv.Mat) QualityMetrics {
+	gray, ink := grayMat.ToBytes(), inkMat.ToBytes()
+	cols, rows := grayMat.Cols(), grayMat.Rows()
+	characters := characterComponents(inkComponents(inkMat, nil), rows)
+
+	m := QualityMetrics{
+		Contrast:   textContrast(gray, ink),
+		Noise:      noiseLevel(gray, cols, rows),
+		Blur:       sharpness(grayMat, characters),
+		Brightness: grayMat.Mean().Val1,
+	}
+
+	if len(characters) > 0 {
+		area := 0
+		for _, c := range characters {
+			area += c.box.Dx() * c.box.Dy()
+		}
+		m.TextCoverage = float64(area) / float64(cols*rows)
+		height := xHeight(characters)
+		m.DPI = height / xHeightInches
+		m.Skew = textSkew(characters, 2*height, maxSkewSearch)
+	}
+	return m
+}
@@ -0,0 +1,158 @@
+package images
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"gocv.io/x/gocv"
+)
+
+// Matches further than this from where the homography puts them, in
+// reference pixels, are outliers
+const ransacThreshold = 4.0
+
+// Registration tells how well a scan was aligned to a reference image.
+type Registration struct {
+	// Maps scan pixels to reference pixels, row by row
+	Homography [9]float64 `json:"homography"`
+	// Keypoint pairs surviving the ratio test
+	Matches int `json:"matches"`
+	// Matches agreeing with the homography
+	Inliers     int     `json:"inliers"`
+	InlierRatio float64 `json:"inlierRatio"`
+	// Mean distance of the inliers to where the homography maps them
+	ReprojectionError float64 `json:"reprojectionError"`
+	// From 0 to 1, see WithMinQuality
+	Quality float64 `json:"quality"`
+}
+
+type ImageRegistrar struct {
+	features   int
+	minInliers int
+	minQuality float64
+}
+
+func NewImageRegistrar() *ImageRegistrar {
+	return &ImageRegistrar{features: 5000, minInliers: 20, minQuality: 0.4}
+}
+
+// WithFeatures sets how many ORB keypoints are looked for on each image,
+// 5000 by default.
+func (ir *ImageRegistrar) WithFeatures(features int) *ImageRegistrar {
+	ir.features = features
+	return ir
+}
+
+// WithMinQuality fails registrations of a lower quality, 0.4 by default.
+func (ir *ImageRegistrar) WithMinQuality(quality float64) *ImageRegistrar {
+	ir.minQuality = quality
+	return ir
+}
+
+// Register aligns a scan to a reference image by matching their ORB
+// keypoints and fitting a homography with RANSAC, so skewed, shifted or
+// scaled scans are put back in place. It returns the scan warped to the
+// size of the reference.
+func (ir *ImageRegistrar) Register(reference gocv.Mat, scan gocv.Mat) (gocv.Mat, *Registration, error) {
+	refGray, scanGray := grayOf(reference), grayOf(scan)
+	defer refGray.Close()
+	defer scanGray.Close()
+
+	orb := gocv.NewORBWithParams(ir.features, 1.2, 8, 31, 0, 2, gocv.ORBScoreTypeHarris, 31, 20)
+	defer orb.Close()
+	noMask := gocv.NewMat()
+	defer noMask.Close()
+	refPoints, refDescriptors := orb.DetectAndCompute(refGray, noMask)
+	defer refDescriptors.Close()
+	scanPoints, scanDescriptors := orb.DetectAndCompute(scanGray, noMask)
+	defer scanDescriptors.Close()
+	if refDescriptors.Empty() || scanDescriptors.Empty() {
+		return gocv.NewMat(), nil, fmt.Errorf("no keypoints found to register the scan")
+	}
+
+	matcher := gocv.NewBFMatcherWithParams(gocv.NormHamming, false)
+	defer matcher.Close()
+	var from, to [][2]float64
+	for _, pair := range matcher.KnnMatch(scanDescriptors, refDescriptors, 2) {
+		// Lowe's ratio test drops matches as good as the runner up
+		if len(pair) < 2 || pair[0].Distance > 0.75*pair[1].Distance {
+			continue
+		}
+		s, r := scanPoints[pair[0].QueryIdx], refPoints[pair[0].TrainIdx]
+		from = append(from, [2]float64{s.X, s.Y})
+		to = append(to, [2]float64{r.X, r.Y})
+	}
+	registration := &Registration{Matches: len(from)}
+	if len(from) < ir.minInliers {
+		return gocv.NewMat(), registration, fmt.Errorf("only %d keypoints matched, the scan doesn't look like the reference", len(from))
+	}
+
+	src, dst := pointsMat(from), pointsMat(to)
+	defer src.Close()
+	defer dst.Close()
+	inlierMask := gocv.NewMat()
+	defer inlierMask.Close()
+	transform := gocv.FindHomography(src, &dst, gocv.HomographyMethodRANSAC, ransacThreshold, &inlierMask, 2000, 0.995)
+	defer transform.Close()
+	if transform.Empty() {
+		return gocv.NewMat(), registration, fmt.Errorf("no homography fits the %d matches", len(from))
+	}
+
+	var h homography
+	for i := range h {
+		h[i] = transform.GetDoubleAt(i/3, i%3)
+	}
+	registration.Homography = h
+	refSize := image.Pt(reference.Cols(), reference.Rows())
+	if !h.plausible(image.Pt(scan.Cols(), scan.Rows()), refSize) {
+		return gocv.NewMat(), registration, fmt.Errorf("the homography folds or collapses the page")
+	}
+
+	var inliers [][2]float64
+	totalError := 0.0
+	for i := range from {
+		if inlierMask.GetUCharAt(i, 0) == 0 {
+			continue
+		}
+		x, y := h.apply(from[i][0], from[i][1])
+		totalError += math.Hypot(x-to[i][0], y-to[i][1])
+		inliers = append(inliers, to[i])
+	}
+	registration.Inliers = len(inliers)
+	registration.InlierRatio = float64(len(inliers)) / float64(len(from))
+	if len(inliers) > 0 {
+		registration.ReprojectionError = totalError / float64(len(inliers))
+	}
+	registration.Quality = registrationQuality(registration.InlierRatio, coverage(inliers, refSize), registration.ReprojectionError)
+
+	if len(inliers) < ir.minInliers || registration.Quality < ir.minQuality {
+		return gocv.NewMat(), registration, fmt.Errorf("poor alignment: %d inliers, quality %.2f", len(inliers), registration.Quality)
+	}
+
+	aligned := gocv.NewMat()
+	gocv.WarpPerspectiveWithParams(scan, &aligned, transform, refSize, gocv.InterpolationLinear,
+		gocv.BorderConstant, color.RGBA{255, 255, 255, 0})
+	return aligned, registration, nil
+}
+
+func grayOf(img gocv.Mat) gocv.Mat {
+	gray := gocv.NewMat()
+	if img.Channels() == 1 {
+		img.CopyTo(&gray)
+	} else {
+		gocv.CvtColor(img, &gray, gocv.ColorBGRToGray)
+	}
+	return gray
+}
+
+// pointsMat packs points in the two channel matrix FindHomography takes.
+func pointsMat(points [][2]float64) gocv.Mat {
+	m := gocv.NewMatWithSize(len(points), 1, gocv.MatTypeCV64FC2)
+	for i, p := range points {
+		m.SetDoubleAt(i, 0, p[0])
+		m.SetDoubleAt(i, 1, p[1])
+	}
+	return m
+}
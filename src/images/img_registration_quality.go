@@ -0,0 +1,93 @@
+package images
+
+import (
+	"image"
+	"math"
+)
+
+// homography is a 3x3 perspective transform, row by row.
+type homography [9]float64
+
+// apply maps a point through the homography.
+func (h homography) apply(x, y float64) (float64, float64) {
+	w := h[6]*x + h[7]*y + h[8]
+	if w == 0 {
+		return math.Inf(1), math.Inf(1)
+	}
+	return (h[0]*x + h[1]*y + h[2]) / w, (h[3]*x + h[4]*y + h[5]) / w
+}
+
+// plausible tells if the homography maps the scan corners to a convex,
+// unmirrored quadrilateral of a sensible size, a degenerate fit folds or
+// collapses the page.
+func (h homography) plausible(scan, reference image.Point) bool {
+	mapped, ok := h.mapCorners(scan)
+	if !ok || !convexQuad(mapped) {
+		return false
+	}
+	ratio := quadArea2f(mapped) / float64(reference.X*reference.Y)
+	return ratio > 0.1 && ratio < 10
+}
+
+// mapCorners maps the corners of an image of the given size, clockwise
+// from the top-left.
+func (h homography) mapCorners(size image.Point) ([4][2]float64, bool) {
+	corners := [4][2]float64{{0, 0}, {float64(size.X), 0}, {float64(size.X), float64(size.Y)}, {0, float64(size.Y)}}
+	var mapped [4][2]float64
+	for i, c := range corners {
+		mapped[i][0], mapped[i][1] = h.apply(c[0], c[1])
+		if math.IsInf(mapped[i][0], 0) || math.IsNaN(mapped[i][0]) {
+			return mapped, false
+		}
+	}
+	return mapped, true
+}
+
+// convexQuad tells if every corner of a quadrilateral turns the same way
+// as those of an image, a mirrored one turns the other way.
+func convexQuad(quad [4][2]float64) bool {
+	for i := range quad {
+		a, b, c := quad[i], quad[(i+1)%4], quad[(i+2)%4]
+		if (b[0]-a[0])*(c[1]-b[1])-(b[1]-a[1])*(c[0]-b[0]) <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func quadArea2f(quad [4][2]float64) float64 {
+	area := 0.0
+	for i, a := range quad {
+		b := quad[(i+1)%4]
+		area += a[0]*b[1] - b[0]*a[1]
+	}
+	return math.Abs(area) / 2
+}
+
+// registrationQuality rates an alignment from 0 to 1: half from the share
+// of matches agreeing with the homography, a quarter from how much of the
+// reference its inliers cover and a quarter from their reprojection error.
+func registrationQuality(inlierRatio, coverage, meanError float64) float64 {
+	return 0.5*clamp01(inlierRatio, 0.1, 0.6) + 0.25*coverage + 0.25*(1-clamp01(meanError, 0.5, 3))
+}
+
+// coverage is the share of the cells of a 4x4 grid over the reference
+// holding at least one point, inliers bunched in a corner fit the rest of
+// the page poorly.
+func coverage(points [][2]float64, reference image.Point) float64 {
+	var cells [16]bool
+	for _, p := range points {
+		col := int(p[0] * 4 / float64(reference.X))
+		row := int(p[1] * 4 / float64(reference.Y))
+		if col >= 0 && col < 4 && row >= 0 && row < 4 {
+			cells[row*4+col] = true
+		}
+	}
+	covered := 0
+	for _, c := range cells {
+		if c {
+			covered++
+		}
+	}
+	return float64(covered) / 16
+}
@@ -0,0 +1,64 @@
+package images
+
+import (
+	"image"
+	"math"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+// Unit test for checking homographies and rating alignments
+func TestRegistrationQuality(t *testing.T) {
+	// Scales by 2 and shifts by (10, 20)
+	h := homography{2, 0, 10, 0, 2, 20, 0, 0, 1}
+	if x, y := h.apply(5, 5); x != 20 || y != 30 {
+		t.Errorf("Expected (20, 30), got (%v, %v)", x, y)
+	}
+	if !h.plausible(image.Pt(100, 100), image.Pt(200, 200)) {
+		t.Errorf("Expected a scaled page to be plausible")
+	}
+	// Mirrored pages and collapsed ones are not
+	for _, bad := range []homography{{-1, 0, 100, 0, 1, 0, 0, 0, 1}, {0.01, 0, 0, 0, 0.01, 0, 0, 0, 1}, {1, 1, 0, 1, 1, 0, 0, 0, 1}} {
+		if bad.plausible(image.Pt(100, 100), image.Pt(100, 100)) {
+			t.Errorf("Expected %v not to be plausible", bad)
+		}
+	}
+
+	spread := [][2]float64{{10, 10}, {90, 10}, {10, 90}, {90, 90}, {40, 40}, {60, 60}}
+	bunched := [][2]float64{{1, 1}, {2, 2}, {3, 3}, {4, 4}, {5, 5}, {6, 6}}
+	if c := coverage(spread, image.Pt(100, 100)); c != 6.0/16 {
+		t.Errorf("Expected 6 cells covered, got %v", c*16)
+	}
+	if good, poor := registrationQuality(0.8, coverage(spread, image.Pt(100, 100)), 0.5),
+		registrationQuality(0.8, coverage(bunched, image.Pt(100, 100)), 0.5); good <= poor || good > 1 {
+		t.Errorf("Expected spread inliers to rate better, got %.2f and %.2f", good, poor)
+	}
+}
+
+// Unit test for registering a rotated and scaled scan to its reference
+func TestImageRegistrar(t *testing.T) {
+	reference := gocv.IMRead("../../samples/forms/service-request.png", gocv.IMReadColor)
+	defer reference.Close()
+	scan := gocv.IMRead("../../samples/forms/filled/service-request-2.jpg", gocv.IMReadColor)
+	defer scan.Close()
+
+	aligned, registration, err := NewImageRegistrar().Register(reference, scan)
+	defer aligned.Close()
+	if err != nil {
+		t.Fatalf("Error registering the scan: %v", err)
+	}
+	if aligned.Cols() != reference.Cols() || aligned.Rows() != reference.Rows() {
+		t.Errorf("Expected the scan warped to %dx%d, got %dx%d", reference.Cols(), reference.Rows(), aligned.Cols(), aligned.Rows())
+	}
+
+	// The scan was rotated by 3.5 degrees, scaled by 1.2 and shifted by
+	// (120, 40), so (500, 650) on the reference was drawn at (671, 855)
+	x, y := homography(registration.Homography).apply(671.3, 855.2)
+	if math.Hypot(x-500, y-650) > 3 {
+		t.Errorf("Expected the scan to map back to (500, 650), got (%.1f, %.1f)", x, y)
+	}
+	if registration.Inliers < 50 || registration.Quality < 0.6 {
+		t.Errorf("Expected a good alignment, got %+v", *registration)
+	}
+}
@@ -0,0 +1,98 @@
+package images
+
+import (
+	"image"
+	"sort"
+
+	"gocv.io/x/gocv"
+)
+
+type LineOrientation string
+
+const (
+	LineHorizontal LineOrientation = "horizontal"
+	LineVertical   LineOrientation = "vertical"
+)
+
+// RuledLine is a form line, table border or underline taken off a page.
+type RuledLine struct {
+	Orientation LineOrientation `json:"orientation"`
+	// Ends of the center line of the stroke
+	Start image.Point `json:"start"`
+	End   image.Point `json:"end"`
+	// Average width of the stroke, in pixels
+	Thickness int             `json:"thickness"`
+	Box       image.Rectangle `json:"box"`
+	Page      int             `json:"page"`
+}
+
+// Length is the distance between the ends of the line.
+func (rl RuledLine) Length() int {
+	if rl.Orientation == LineHorizontal {
+		return rl.End.X - rl.Start.X
+	}
+	return rl.End.Y - rl.Start.Y
+}
+
+// ruledLines turns the components of a mask of horizontal or vertical
+// strokes into lines.
+func ruledLines(mask gocv.Mat, orientation LineOrientation, page int) []RuledLine {
+	var lines []RuledLine
+	for _, c := range inkComponents(mask, nil) {
+		line := RuledLine{Orientation: orientation, Box: c.box, Page: page}
+		if orientation == LineHorizontal {
+			center := (c.box.Min.Y + c.box.Max.Y) / 2
+			line.Start, line.End = image.Pt(c.box.Min.X, center), image.Pt(c.box.Max.X-1, center)
+			line.Thickness = max(1, (c.area+c.box.Dx()/2)/c.box.Dx())
+		} else {
+			center := (c.box.Min.X + c.box.Max.X) / 2
+			line.Start, line.End = image.Pt(center, c.box.Min.Y), image.Pt(center, c.box.Max.Y-1)
+			line.Thickness = max(1, (c.area+c.box.Dy()/2)/c.box.Dy())
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// TableCells rebuilds the grid of a ruled table from its lines: a cell is
+// enclosed by two neighboring horizontal lines and two neighboring
+// vertical lines that all reach across it. Cells come back by row, top to
+// bottom, and rows without any cell are left out.
+func TableCells(lines []RuledLine) [][]image.Rectangle {
+	var horizontal, vertical []RuledLine
+	for _, line := range lines {
+		if line.Orientation == LineHorizontal {
+			horizontal = append(horizontal, line)
+		} else {
+			vertical = append(vertical, line)
+		}
+	}
+	sort.Slice(horizontal, func(i, j int) bool { return horizontal[i].Start.Y < horizontal[j].Start.Y })
+	sort.Slice(vertical, func(i, j int) bool { return vertical[i].Start.X < vertical[j].Start.X })
+
+	// Lines may stop a few pixels short of the ones they meet
+	spans := func(line RuledLine, from, to int) bool {
+		slack := 2*line.Thickness + 3
+		if line.Orientation == LineHorizontal {
+			return line.Start.X <= from+slack && line.End.X >= to-slack
+		}
+		return line.Start.Y <= from+slack && line.End.Y >= to-slack
+	}
+
+	var cells [][]image.Rectangle
+	for i := 0; i+1 < len(horizontal); i++ {
+		top, bottom := horizontal[i], horizontal[i+1]
+		var row []image.Rectangle
+		for j := 0; j+1 < len(vertical); j++ {
+			left, right := vertical[j], vertical[j+1]
+			if spans(top, left.Start.X, right.Start.X) && spans(bottom, left.Start.X, right.Start.X) &&
+				spans(left, top.Start.Y, bottom.Start.Y) && spans(right, top.Start.Y, bottom.Start.Y) {
+				row = append(row, image.Rect(left.Box.Max.X, top.Box.Max.Y, right.Box.Min.X, bottom.Box.Min.Y))
+			}
+		}
+		if len(row) > 0 {
+			cells = append(cells, row)
+		}
+	}
+	return cells
+}
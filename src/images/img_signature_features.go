@@ -0,0 +1,222 @@
+package images
+
+import (
+	"encoding/binary"
+	"image"
+	"sort"
+
+	"gocv.io/x/gocv"
+)
+
+// Components smaller than this, in pixels, are scanner noise
+const minInkArea = 12
+
+// Components filling more of their box than this are solid blocks, e.g.
+// banners or photos, not pen strokes
+const maxInkDensity = 0.6
+
+// inkComponent is a connected blob of ink pixels.
+type inkComponent struct {
+	box  image.Rectangle
+	area int
+	// Ink pixels next to the paper
+	boundary int
+	// Summed saturation of its pixels, 0-255 each
+	saturation int
+}
+
+// strokeWidth estimates the pen width: a stroke of width w and length l
+// covers w*l pixels with about 2*l of them on its edges.
+func (c inkComponent) strokeWidth() float64 {
+	if c.boundary == 0 {
+		return 1
+	}
+	return max(1, 2*float64(c.area)/float64(c.boundary))
+}
+
+// inkComponents finds the 8-connected components of a binary mask, where
+// ink is non-zero. saturation may be nil for grayscale pages.
+func inkComponents(mask gocv.Mat, saturation []byte) []inkComponent {
+	components, _ := labelInk(mask, saturation)
+	return components
+}
+
+// labelInk finds the components of a mask and labels every pixel with its
+// component, from 1, or 0 for the paper. OpenCV measures the boxes and
+// areas, the boundaries and saturations are summed here.
+func labelInk(mask gocv.Mat, saturation []byte) ([]inkComponent, []int32) {
+	labelMat := gocv.NewMat()
+	defer labelMat.Close()
+	stats := gocv.NewMat()
+	defer stats.Close()
+	centroids := gocv.NewMat()
+	defer centroids.Close()
+	n := gocv.ConnectedComponentsWithStats(mask, &labelMat, &stats, &centroids)
+
+	components := make([]inkComponent, max(0, n-1))
+	for i := range components {
+		stat := func(s gocv.ConnectedComponentsTypes) int { return int(stats.GetIntAt(i+1, int(s))) }
+		x, y := stat(gocv.CC_STAT_LEFT), stat(gocv.CC_STAT_TOP)
+		components[i] = inkComponent{
+			box:  image.Rect(x, y, x+stat(gocv.CC_STAT_WIDTH), y+stat(gocv.CC_STAT_HEIGHT)),
+			area: stat(gocv.CC_STAT_AREA),
+		}
+	}
+
+	data := labelMat.ToBytes()
+	labels := make([]int32, len(data)/4)
+	for i := range labels {
+		labels[i] = int32(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+	cols, rows := mask.Cols(), mask.Rows()
+	for i, label := range labels {
+		if label == 0 {
+			continue
+		}
+		c := &components[label-1]
+		if saturation != nil {
+			c.saturation += int(saturation[i])
+		}
+		// Any ink next to it is in the same component
+		x, y := i%cols, i/cols
+		if x == 0 || y == 0 || x == cols-1 || y == rows-1 ||
+			labels[i-1] == 0 || labels[i+1] == 0 || labels[i-cols] == 0 || labels[i+cols] == 0 {
+			c.boundary++
+		}
+	}
+	return components, labels
+}
+
+// maskWords drops the components inside the boxes of printed words. Boxes
+// much taller than the text are handwriting OCR made words of, and kept.
+func maskWords(components []inkComponent, words []image.Rectangle, textHeight int) []inkComponent {
+	var kept []inkComponent
+	for _, c := range components {
+		center := c.box.Min.Add(c.box.Size().Div(2))
+		printed := false
+		for _, word := range words {
+			if word.Dy() <= 3*textHeight && center.In(word) {
+				printed = true
+				break
+			}
+		}
+		if !printed {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// signatureRegion is a group of nearby ink components.
+type signatureRegion struct {
+	box        image.Rectangle
+	components []inkComponent
+}
+
+// textHeight is the median height of the components, about the height of
+// the printed characters on most pages.
+func textHeight(components []inkComponent) int {
+	if len(components) == 0 {
+		return 0
+	}
+	heights := make([]int, len(components))
+	for i, c := range components {
+		heights[i] = c.box.Dy()
+	}
+	sort.Ints(heights)
+	return heights[len(heights)/2]
+}
+
+// strokeComponents drops noise, solid blocks and components spanning most
+// of the page, such as rules and banners.
+func strokeComponents(components []inkComponent, cols int) []inkComponent {
+	var kept []inkComponent
+	for _, c := range components {
+		density := float64(c.area) / float64(c.box.Dx()*c.box.Dy())
+		if c.area < minInkArea || density > maxInkDensity || c.box.Dx() > cols/2 {
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return kept
+}
+
+// groupComponents joins components closer than the gap along a line, and
+// barely at all across lines, so printed lines stay apart.
+func groupComponents(components []inkComponent, gap int) []signatureRegion {
+	parent := make([]int, len(components))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	grown := make([]image.Rectangle, len(components))
+	for i, c := range components {
+		grown[i] = image.Rect(c.box.Min.X-gap, c.box.Min.Y-gap/8, c.box.Max.X+gap, c.box.Max.Y+gap/8)
+	}
+	for i := range components {
+		for k := i + 1; k < len(components); k++ {
+			if grown[i].Overlaps(grown[k]) {
+				parent[find(i)] = find(k)
+			}
+		}
+	}
+
+	groups := map[int]*signatureRegion{}
+	var roots []int
+	for i, c := range components {
+		root := find(i)
+		region, ok := groups[root]
+		if !ok {
+			region = &signatureRegion{box: c.box}
+			groups[root] = region
+			roots = append(roots, root)
+		}
+		region.box = region.box.Union(c.box)
+		region.components = append(region.components, c)
+	}
+
+	regions := make([]signatureRegion, len(roots))
+	for i, root := range roots {
+		regions[i] = *groups[root]
+	}
+	return regions
+}
+
+// clamp01 maps value from [low, high] onto [0, 1].
+func clamp01(value, low, high float64) float64 {
+	return min(1, max(0, (value-low)/(high-low)))
+}
+
+// score rates how much a region looks like a handwritten signature, from 0
+// to 1. Signatures are taller than the printed text around them, cursive
+// joins letters into wide components drawn with thin strokes, the ink is
+// sparse and often colored.
+func (r signatureRegion) score(textHeight int) float64 {
+	height := float64(max(1, textHeight))
+
+	area, saturation := 0, 0
+	widest, largest := 0, r.components[0]
+	for _, c := range r.components {
+		area += c.area
+		saturation += c.saturation
+		widest = max(widest, c.box.Dx())
+		if c.area > largest.area {
+			largest = c
+		}
+	}
+
+	tall := clamp01(float64(r.box.Dy())/height, 1.5, 4)
+	cursive := clamp01(float64(widest)/height, 1.2, 4)
+	slender := clamp01(float64(largest.box.Dy())/largest.strokeWidth(), 10, 30)
+	sparse := clamp01(0.35-float64(area)/float64(r.box.Dx()*r.box.Dy()), 0, 0.25)
+	colored := clamp01(float64(saturation)/float64(area), 0, 80)
+
+	return 0.25*tall + 0.25*cursive + 0.2*slender + 0.15*sparse + 0.15*colored
+}
@@ -0,0 +1,136 @@
+package images
+
+import (
+	"image"
+	"math"
+
+	"gocv.io/x/gocv"
+)
+
+// inkBox is the bounding box of the ink of a binary mask, ignoring specks.
+func inkBox(mask gocv.Mat) image.Rectangle {
+	var box image.Rectangle
+	for _, c := range inkComponents(mask, nil) {
+		if c.area >= minInkArea {
+			box = box.Union(c.box)
+		}
+	}
+	return box
+}
+
+// inkOrientation is the angle, in degrees, of the main axis of the ink
+// against the horizontal, positive when it rises to the right.
+func inkOrientation(mask gocv.Mat) float64 {
+	m := gocv.Moments(mask, true)
+	if m["m00"] == 0 {
+		return 0
+	}
+	// Image rows grow downwards
+	return -0.5 * math.Atan2(2*m["mu11"], m["mu20"]-m["mu02"]) * 180 / math.Pi
+}
+
+// huMoments are the seven moments of the ink invariant to translation,
+// scale and rotation, combined from the normalized central moments of
+// gocv.Moments as gocv doesn't wrap cv::HuMoments.
+func huMoments(mask gocv.Mat) [7]float64 {
+	m := gocv.Moments(mask, true)
+	if m["m00"] == 0 {
+		return [7]float64{}
+	}
+	n20, n11, n02 := m["nu20"], m["nu11"], m["nu02"]
+	n30, n21, n12, n03 := m["nu30"], m["nu21"], m["nu12"], m["nu03"]
+
+	a, b := n30+n12, n21+n03
+	return [7]float64{
+		n20 + n02,
+		(n20-n02)*(n20-n02) + 4*n11*n11,
+		(n30-3*n12)*(n30-3*n12) + (3*n21-n03)*(3*n21-n03),
+		a*a + b*b,
+		(n30-3*n12)*a*(a*a-3*b*b) + (3*n21-n03)*b*(3*a*a-b*b),
+		(n20-n02)*(a*a-b*b) + 4*n11*a*b,
+		(3*n21-n03)*a*(a*a-3*b*b) - (n30-3*n12)*b*(3*a*a-b*b),
+	}
+}
+
+// huSimilarity compares Hu moments on a log scale, as their magnitudes are
+// orders apart, from 0 to 1.
+func huSimilarity(a, b [7]float64) float64 {
+	logScale := func(h float64) float64 {
+		if h == 0 {
+			return 0
+		}
+		return math.Copysign(math.Log10(math.Abs(h)), h)
+	}
+	distance := 0.0
+	// The last moment only tells mirror images apart and is too noisy
+	for i := 0; i < 6; i++ {
+		distance += math.Abs(logScale(a[i])-logScale(b[i])) / float64(i+1)
+	}
+	return math.Exp(-distance)
+}
+
+// signatureProfile holds, per column, where the ink starts from the top
+// and the bottom and its center, each from 0 to 1.
+type signatureProfile struct {
+	top, bottom, center []float64
+}
+
+func profileOf(mask []byte, cols, rows int) signatureProfile {
+	p := signatureProfile{make([]float64, cols), make([]float64, cols), make([]float64, cols)}
+	for x := 0; x < cols; x++ {
+		first, last, count, sum := -1, -1, 0, 0
+		for y := 0; y < rows; y++ {
+			if mask[y*cols+x] != 0 {
+				if first < 0 {
+					first = y
+				}
+				last = y
+				count++
+				sum += y
+			}
+		}
+		if first < 0 {
+			// Empty columns sit in the middle, between both profiles
+			p.top[x], p.bottom[x], p.center[x] = 0.5, 0.5, 0.5
+			continue
+		}
+		p.top[x] = float64(first) / float64(rows)
+		p.bottom[x] = float64(rows-1-last) / float64(rows)
+		p.center[x] = float64(sum) / float64(count*rows)
+	}
+	return p
+}
+
+// profileSimilarity correlates two profiles of the same width, from 0 to 1.
+// Correlations are squared, as unrelated handwriting still correlates a
+// little.
+func profileSimilarity(a, b signatureProfile) float64 {
+	similarity := 0.0
+	for _, pair := range [][2][]float64{{a.top, b.top}, {a.bottom, b.bottom}, {a.center, b.center}} {
+		c := max(0, correlation(pair[0], pair[1]))
+		similarity += c * c
+	}
+	return similarity / 3
+}
+
+// correlation is the Pearson correlation of two series of the same length.
+func correlation(a, b []float64) float64 {
+	n := float64(len(a))
+	var sumA, sumB float64
+	for i := range a {
+		sumA += a[i]
+		sumB += b[i]
+	}
+	meanA, meanB := sumA/n, sumB/n
+	var cov, varA, varB float64
+	for i := range a {
+		da, db := a[i]-meanA, b[i]-meanB
+		cov += da * db
+		varA += da * da
+		varB += db * db
+	}
+	if varA == 0 || varB == 0 {
+		return 0
+	}
+	return cov / math.Sqrt(varA*varB)
+}
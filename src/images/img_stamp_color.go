@@ -0,0 +1,83 @@
+package images
+
+import "math"
+
+// Hue bands stamps are segmented by, on the 0 to 180 OpenCV hue scale.
+// Red wraps around 0.
+var stampColors = []struct {
+	name     string
+	low, top byte
+}{
+	{"red", 160, 10},
+	{"orange", 10, 22},
+	{"yellow", 22, 35},
+	{"green", 35, 85},
+	{"blue", 85, 130},
+	{"purple", 130, 160},
+}
+
+const (
+	// Stamp ink is at least this saturated
+	minStampSaturation = 70
+	// and this bright, darker pixels are the printed text under it
+	minStampValue = 60
+)
+
+// stampBand returns the index of the hue band of a pixel in stampColors,
+// or -1 when it's too gray or dark to be stamp ink.
+func stampBand(h, s, v, minSaturation byte) int {
+	if s < minSaturation || v < minStampValue {
+		return -1
+	}
+	for i, c := range stampColors {
+		if (c.low < c.top && h >= c.low && h < c.top) || (c.low > c.top && (h >= c.low || h < c.top)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// bandMasks splits the colored pixels of an HSV image into one mask per
+// hue band, 255 where the band's ink is. Bands with fewer than minPixels
+// pixels are left nil.
+func bandMasks(hsv []byte, minPixels int) [][]byte {
+	pixels := len(hsv) / 3
+	masks := make([][]byte, len(stampColors))
+	counts := make([]int, len(stampColors))
+	bands := make([]int8, pixels)
+	for i := range bands {
+		band := stampBand(hsv[3*i], hsv[3*i+1], hsv[3*i+2], minStampSaturation)
+		bands[i] = int8(band)
+		if band >= 0 {
+			counts[band]++
+		}
+	}
+	for band, count := range counts {
+		if count < minPixels {
+			continue
+		}
+		masks[band] = make([]byte, pixels)
+		for i, b := range bands {
+			if int(b) == band {
+				masks[band][i] = 255
+			}
+		}
+	}
+	return masks
+}
+
+// stampShape tells round stamps from rectangular ones by the convex hull
+// of their ink: circles are as round as a hull gets, rectangles fill
+// their rotated bounding box.
+func stampShape(hullArea, hullPerimeter, boxArea float64) (StampShape, bool) {
+	if hullPerimeter == 0 || boxArea == 0 {
+		return "", false
+	}
+	if circularity := 4 * math.Pi * hullArea / (hullPerimeter * hullPerimeter); circularity > 0.85 {
+		return StampRound, true
+	}
+	if hullArea/boxArea > 0.85 {
+		return StampRectangular, true
+	}
+	return "", false
+}
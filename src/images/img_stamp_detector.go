@@ -0,0 +1,224 @@
+package images
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+type StampShape string
+
+const (
+	// Round company stamps and hanko seals
+	StampRound       StampShape = "round"
+	StampRectangular StampShape = "rectangular"
+)
+
+// Stamp is a colored rubber stamp or seal on a page.
+type Stamp struct {
+	Box   image.Rectangle `json:"box"`
+	Shape StampShape      `json:"shape"`
+	// Name of the hue of the ink, e.g. "red" or "blue"
+	Color string `json:"color"`
+	// Mean color of the ink
+	RGB  color.RGBA `json:"rgb"`
+	Page int        `json:"page"`
+	band int
+}
+
+type StampDetector struct {
+	minSize int
+}
+
+func NewStampDetector() *StampDetector {
+	return &StampDetector{minSize: 30}
+}
+
+// WithMinSize ignores stamps whose sides are shorter than size pixels, 30
+// by default.
+func (sd *StampDetector) WithMinSize(size int) *StampDetector {
+	sd.minSize = size
+	return sd
+}
+
+// Execute finds the stamps on every page of an image file. Multi-page
+// TIFFs are read page by page.
+func (sd *StampDetector) Execute(fileName string) ([]Stamp, error) {
+	pages := gocv.IMReadMulti(fileName, gocv.IMReadColor)
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("error reading the image %s", fileName)
+	}
+	defer func() {
+		for _, page := range pages {
+			page.Close()
+		}
+	}()
+
+	var stamps []Stamp
+	for i, page := range pages {
+		found, err := sd.Detect(page, i)
+		if err != nil {
+			return nil, fmt.Errorf("error detecting stamps on page %d: %w", i+1, err)
+		}
+		stamps = append(stamps, found...)
+	}
+	return stamps, nil
+}
+
+// Detect segments the colored ink of a page by hue, joins the strokes of
+// each color into blobs and keeps the round and rectangular ones.
+func (sd *StampDetector) Detect(img gocv.Mat, page int) ([]Stamp, error) {
+	if img.Channels() != 3 {
+		// Stamps are told apart from the text by their color only
+		return nil, nil
+	}
+	hsv := gocv.NewMat()
+	defer hsv.Close()
+	gocv.CvtColor(img, &hsv, gocv.ColorBGRToHSV)
+	pixels := img.ToBytes()
+
+	cols, rows := img.Cols(), img.Rows()
+	maxSize := min(cols, rows) / 2
+	kernel := gocv.GetStructuringElement(gocv.MorphEllipse, image.Pt(max(3, min(cols, rows)/100), max(3, min(cols, rows)/100)))
+	defer kernel.Close()
+
+	var stamps []Stamp
+	for band, mask := range bandMasks(hsv.ToBytes(), sd.minSize*sd.minSize/10) {
+		if mask == nil {
+			continue
+		}
+		ink, err := gocv.NewMatFromBytes(rows, cols, gocv.MatTypeCV8U, mask)
+		if err != nil {
+			return nil, fmt.Errorf("error segmenting the %s ink: %w", stampColors[band].name, err)
+		}
+		// Join the letters and rings of a stamp into one blob
+		blobs := gocv.NewMat()
+		gocv.MorphologyEx(ink, &blobs, gocv.MorphClose, kernel)
+		ink.Close()
+		contours := gocv.FindContours(blobs, gocv.RetrievalExternal, gocv.ChainApproxSimple)
+		blobs.Close()
+
+		for i := 0; i < contours.Size(); i++ {
+			box := gocv.BoundingRect(contours.At(i))
+			if min(box.Dx(), box.Dy()) < sd.minSize || max(box.Dx(), box.Dy()) > maxSize {
+				continue
+			}
+			hullPoints := gocv.NewMat()
+			gocv.ConvexHull(contours.At(i), &hullPoints, true, true)
+			hull := gocv.NewPointVectorFromMat(hullPoints)
+			hullPoints.Close()
+			rotated := gocv.MinAreaRect(hull)
+			shape, ok := stampShape(gocv.ContourArea(hull), gocv.ArcLength(hull, true), float64(rotated.Width*rotated.Height))
+			hull.Close()
+			if !ok {
+				continue
+			}
+
+			stamp := Stamp{Box: box, Shape: shape, Color: stampColors[band].name, Page: page, band: band}
+			var sum [3]int
+			count := 0
+			for y := box.Min.Y; y < box.Max.Y; y++ {
+				for x := box.Min.X; x < box.Max.X; x++ {
+					if i := y*cols + x; mask[i] != 0 {
+						sum[0] += int(pixels[3*i])
+						sum[1] += int(pixels[3*i+1])
+						sum[2] += int(pixels[3*i+2])
+						count++
+					}
+				}
+			}
+			if count > 0 {
+				stamp.RGB = color.RGBA{uint8(sum[2] / count), uint8(sum[1] / count), uint8(sum[0] / count), 255}
+			}
+			stamps = append(stamps, stamp)
+		}
+		contours.Close()
+	}
+
+	sort.Slice(stamps, func(i, j int) bool {
+		return stamps[i].Box.Dx()*stamps[i].Box.Dy() > stamps[j].Box.Dx()*stamps[j].Box.Dy()
+	})
+	return stamps, nil
+}
+
+// Remove paints the ink of the stamps over with the paper around them.
+// Only pixels of the stamp's hue are touched, so the dark printed text
+// under a stamp is kept for OCR.
+func (sd *StampDetector) Remove(img gocv.Mat, stamps []Stamp) (gocv.Mat, error) {
+	if len(stamps) == 0 || img.Channels() != 3 {
+		return img.Clone(), nil
+	}
+	hsvMat := gocv.NewMat()
+	defer hsvMat.Close()
+	gocv.CvtColor(img, &hsvMat, gocv.ColorBGRToHSV)
+	hsv := hsvMat.ToBytes()
+	pixels := img.ToBytes()
+	cols := img.Cols()
+
+	for _, stamp := range stamps {
+		// The paper is the bright, gray part of the box
+		var paper [3]int
+		count := 0
+		for y := stamp.Box.Min.Y; y < stamp.Box.Max.Y; y++ {
+			for x := stamp.Box.Min.X; x < stamp.Box.Max.X; x++ {
+				if i := y*cols + x; hsv[3*i+1] < minStampSaturation/2 && hsv[3*i+2] > 180 {
+					paper[0] += int(pixels[3*i])
+					paper[1] += int(pixels[3*i+1])
+					paper[2] += int(pixels[3*i+2])
+					count++
+				}
+			}
+		}
+		fill := [3]byte{255, 255, 255}
+		if count > 0 {
+			fill = [3]byte{byte(paper[0] / count), byte(paper[1] / count), byte(paper[2] / count)}
+		}
+
+		// Faint edges of the ink are less saturated than its middle
+		for y := stamp.Box.Min.Y; y < stamp.Box.Max.Y; y++ {
+			for x := stamp.Box.Min.X; x < stamp.Box.Max.X; x++ {
+				i := y*cols + x
+				if stampBand(hsv[3*i], hsv[3*i+1], hsv[3*i+2], minStampSaturation/2) == stamp.band {
+					copy(pixels[3*i:3*i+3], fill[:])
+				}
+			}
+		}
+	}
+	return gocv.NewMatFromBytes(img.Rows(), cols, gocv.MatTypeCV8UC3, pixels)
+}
+
+// RemoveStamps finds the stamps of the first page of an image file and
+// writes the page without them as a PNG to outDir.
+func (sd *StampDetector) RemoveStamps(fileName string, outDir string) (string, []Stamp, error) {
+	img := gocv.IMRead(fileName, gocv.IMReadColor)
+	if img.Empty() {
+		return "", nil, fmt.Errorf("error reading the image %s", fileName)
+	}
+	defer img.Close()
+
+	stamps, err := sd.Detect(img, 0)
+	if err != nil {
+		return "", nil, err
+	}
+	clean, err := sd.Remove(img, stamps)
+	if err != nil {
+		return "", nil, fmt.Errorf("error removing the stamps: %w", err)
+	}
+	defer clean.Close()
+
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return "", nil, fmt.Errorf("error creating the output folder: %w", err)
+	}
+	base := strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+	outFile := filepath.Join(outDir, base+"-nostamp.png")
+	if ok := gocv.IMWrite(outFile, clean); !ok {
+		return "", nil, fmt.Errorf("error writing %s", outFile)
+	}
+	return outFile, stamps, nil
+}
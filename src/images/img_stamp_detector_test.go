@@ -0,0 +1,93 @@
+package images
+
+import (
+	"go-ocr/src"
+	"image"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+// Unit test for segmenting stamp ink by hue and telling its shape
+func TestStampColor(t *testing.T) {
+	for _, c := range []struct {
+		h, s, v byte
+		color   string
+	}{{2, 200, 200, "red"}, {175, 200, 200, "red"}, {110, 180, 190, "blue"}, {60, 150, 150, "green"}, {140, 120, 160, "purple"}} {
+		if band := stampBand(c.h, c.s, c.v, minStampSaturation); band < 0 || stampColors[band].name != c.color {
+			t.Errorf("Expected hue %d to be %s, got band %d", c.h, c.color, band)
+		}
+	}
+	// Gray paper and black text are not ink
+	for _, c := range [][3]byte{{0, 10, 240}, {110, 200, 30}} {
+		if band := stampBand(c[0], c[1], c[2], minStampSaturation); band != -1 {
+			t.Errorf("Expected %v not to be stamp ink, got band %d", c, band)
+		}
+	}
+
+	for _, c := range []struct {
+		area, perimeter, box float64
+		shape                StampShape
+		ok                   bool
+	}{
+		// A circle of radius 100, in its 200x200 box
+		{31416, 628, 40000, StampRound, true},
+		{340 * 110, 900, 340 * 110, StampRectangular, true},
+		// An L shape
+		{5000, 400, 10000, "", false},
+	} {
+		if shape, ok := stampShape(c.area, c.perimeter, c.box); shape != c.shape || ok != c.ok {
+			t.Errorf("Expected %q (%t), got %q (%t)", c.shape, c.ok, shape, ok)
+		}
+	}
+}
+
+// Unit test for finding stamps on an invoice and removing them
+func TestStampDetector(t *testing.T) {
+	expected := []Stamp{
+		{Box: image.Rect(293, 366, 647, 534), Shape: StampRectangular, Color: "blue"},
+		{Box: image.Rect(455, 495, 666, 706), Shape: StampRound, Color: "red"},
+		{Box: image.Rect(662, 185, 739, 260), Shape: StampRound, Color: "red"},
+	}
+
+	stamps, err := NewStampDetector().Execute("../../samples/documents/stamped-invoice.png")
+	if err != nil {
+		t.Fatalf("Error detecting stamps: %v", err)
+	}
+	if len(stamps) != len(expected) {
+		t.Fatalf("Expected %d stamps, got %v", len(expected), stamps)
+	}
+	for i, stamp := range stamps {
+		e := expected[i]
+		overlap := stamp.Box.Intersect(e.Box)
+		if overlap.Dx()*overlap.Dy() < e.Box.Dx()*e.Box.Dy()*9/10 || stamp.Shape != e.Shape || stamp.Color != e.Color {
+			t.Errorf("Expected a %s %s stamp at %v, got a %s %s one at %v", e.Color, e.Shape, e.Box, stamp.Color, stamp.Shape, stamp.Box)
+		}
+	}
+
+	outFile, stamps, err := NewStampDetector().RemoveStamps("../../samples/documents/stamped-invoice.png", "../../output/test/stamps/")
+	if err != nil || !src.FileExists(outFile) {
+		t.Fatalf("Page without stamps not written: %v", err)
+	}
+	if len(stamps) != len(expected) {
+		t.Errorf("Expected %d stamps removed, got %d", len(expected), len(stamps))
+	}
+	clean := gocv.IMRead(outFile, gocv.IMReadColor)
+	defer clean.Close()
+	// No stamp should be left to find
+	if left, err := NewStampDetector().Detect(clean, 0); err != nil || len(left) != 0 {
+		t.Errorf("Expected the stamps to be removed, found %v", left)
+	}
+	// and the text under the round stamp is kept
+	gray := gocv.NewMat()
+	defer gray.Close()
+	gocv.CvtColor(clean, &gray, gocv.ColorBGRToGray)
+	under := gray.Region(image.Rect(455, 560, 600, 600))
+	defer under.Close()
+	paper := gocv.NewMat()
+	defer paper.Close()
+	gocv.Threshold(under, &paper, 100, 255, gocv.ThresholdBinary)
+	if dark := paper.Total() - gocv.CountNonZero(paper); dark < 200 {
+		t.Errorf("Expected the text under the stamp to be kept, got %d dark pixels", dark)
+	}
+}
@@ -0,0 +1,201 @@
+package images
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"gocv.io/x/gocv"
+)
+
+type UpscaleMethod string
+
+const (
+	UpscaleLanczos UpscaleMethod = "lanczos"
+	// Super-resolution networks of OpenCV's dnn_superres module, run on
+	// the luma channel like it does
+	UpscaleESPCN  UpscaleMethod = "espcn"
+	UpscaleFSRCNN UpscaleMethod = "fsrcnn"
+)
+
+// Upscaling is how a page was enlarged for OCR.
+type Upscaling struct {
+	Method UpscaleMethod `json:"method"`
+	// 1 when the text was large enough already
+	Factor float64 `json:"factor"`
+	// Height of the lowercase letters before upscaling, 0 when the page
+	// has no text
+	XHeight float64 `json:"xHeight"`
+}
+
+// ToOriginal maps a box found on the upscaled page back to the original.
+func (u Upscaling) ToOriginal(box image.Rectangle) image.Rectangle {
+	if u.Factor <= 0 || u.Factor == 1 {
+		return box
+	}
+	return image.Rect(int(math.Floor(float64(box.Min.X)/u.Factor)), int(math.Floor(float64(box.Min.Y)/u.Factor)),
+		int(math.Ceil(float64(box.Max.X)/u.Factor)), int(math.Ceil(float64(box.Max.Y)/u.Factor)))
+}
+
+type Upscaler struct {
+	method        UpscaleMethod
+	modelFile     string
+	modelScale    int
+	minXHeight    float64
+	targetXHeight float64
+	maxFactor     float64
+}
+
+// NewUpscaler enlarges pages whose lowercase letters are under 15 pixels
+// tall, about 200 DPI, to 22 pixels, about 300 DPI, with Lanczos
+// interpolation.
+func NewUpscaler() *Upscaler {
+	return &Upscaler{method: UpscaleLanczos, minXHeight: 15, targetXHeight: 22, maxFactor: 4}
+}
+
+// WithModel upscales with an ESPCN or FSRCNN TensorFlow model, e.g.
+// ESPCN_x4.pb, trained to enlarge by scale. Other factors are reached by
+// resizing its output.
+func (u *Upscaler) WithModel(method UpscaleMethod, modelFile string, scale int) *Upscaler {
+	u.method = method
+	u.modelFile = modelFile
+	u.modelScale = scale
+	return u
+}
+
+// WithXHeight upscales pages whose x-height is under minHeight pixels so
+// it becomes targetHeight, enlarging by at most maxFactor.
+func (u *Upscaler) WithXHeight(minHeight, targetHeight, maxFactor float64) *Upscaler {
+	u.minXHeight = minHeight
+	u.targetXHeight = targetHeight
+	u.maxFactor = maxFactor
+	return u
+}
+
+// Estimate measures the x-height of the text of a page, in pixels.
+func (u *Upscaler) Estimate(img gocv.Mat) float64 {
+	gray := grayOf(img)
+	defer gray.Close()
+	ink := gocv.NewMat()
+	defer ink.Close()
+	gocv.Threshold(gray, &ink, 0, 255, gocv.ThresholdBinaryInv+gocv.ThresholdOtsu)
+	return xHeight(characterComponents(inkComponents(ink, nil), ink.Rows()))
+}
+
+// factor is how much a page of the given x-height is enlarged.
+func (u *Upscaler) factor(xHeight float64) float64 {
+	if xHeight <= 0 || xHeight >= u.minXHeight {
+		return 1
+	}
+	return min(u.maxFactor, u.targetXHeight/xHeight)
+}
+
+// Upscale enlarges a page when its text is too small for Tesseract. The
+// page is returned as is, cloned, otherwise.
+func (u *Upscaler) Upscale(img gocv.Mat) (gocv.Mat, Upscaling, error) {
+	upscaling := Upscaling{Method: u.method, Factor: 1, XHeight: u.Estimate(img)}
+	upscaling.Factor = u.factor(upscaling.XHeight)
+	if upscaling.Factor == 1 {
+		return img.Clone(), upscaling, nil
+	}
+
+	size := image.Pt(int(math.Round(float64(img.Cols())*upscaling.Factor)), int(math.Round(float64(img.Rows())*upscaling.Factor)))
+	if u.method == UpscaleLanczos || u.modelFile == "" {
+		upscaling.Method = UpscaleLanczos
+		upscaled := gocv.NewMat()
+		gocv.Resize(img, &upscaled, size, 0, 0, gocv.InterpolationLanczos4)
+		return upscaled, upscaling, nil
+	}
+
+	upscaled, err := u.superResolve(img)
+	if err != nil {
+		return gocv.NewMat(), upscaling, err
+	}
+	if upscaled.Cols() != size.X || upscaled.Rows() != size.Y {
+		gocv.Resize(upscaled, &upscaled, size, 0, 0, gocv.InterpolationLanczos4)
+	}
+	return upscaled, upscaling, nil
+}
+
+// superResolve enlarges the luma of a page by the model's scale and the
+// chroma by bicubic interpolation, as dnn_superres does for ESPCN and
+// FSRCNN.
+func (u *Upscaler) superResolve(img gocv.Mat) (gocv.Mat, error) {
+	net := gocv.ReadNet(u.modelFile, "")
+	if net.Empty() {
+		return gocv.NewMat(), fmt.Errorf("error reading the super-resolution model %s", u.modelFile)
+	}
+	defer net.Close()
+	net.SetPreferableBackend(gocv.NetBackendOpenCV)
+	net.SetPreferableTarget(gocv.NetTargetCPU)
+
+	var channels []gocv.Mat
+	if img.Channels() == 1 {
+		channels = []gocv.Mat{img.Clone()}
+	} else {
+		ycrcb := gocv.NewMat()
+		gocv.CvtColor(img, &ycrcb, gocv.ColorBGRToYCrCb)
+		channels = gocv.Split(ycrcb)
+		ycrcb.Close()
+	}
+	defer func() {
+		for _, c := range channels {
+			c.Close()
+		}
+	}()
+
+	blob := gocv.BlobFromImage(channels[0], 1.0/255, image.Pt(channels[0].Cols(), channels[0].Rows()),
+		gocv.NewScalar(0, 0, 0, 0), false, false)
+	defer blob.Close()
+	net.SetInput(blob, "")
+	output := net.Forward("")
+	defer output.Close()
+	luma := gocv.GetBlobChannel(output, 0, 0)
+	defer luma.Close()
+	if luma.Cols() != img.Cols()*u.modelScale || luma.Rows() != img.Rows()*u.modelScale {
+		return gocv.NewMat(), fmt.Errorf("the model enlarged %dx%d to %dx%d, not by %d", img.Cols(), img.Rows(),
+			luma.Cols(), luma.Rows(), u.modelScale)
+	}
+
+	upscaled := gocv.NewMat()
+	luma.ConvertToWithParams(&upscaled, gocv.MatTypeCV8U, 255, 0)
+	if img.Channels() == 1 {
+		return upscaled, nil
+	}
+	size := image.Pt(upscaled.Cols(), upscaled.Rows())
+	merged := []gocv.Mat{upscaled}
+	for _, c := range channels[1:] {
+		chroma := gocv.NewMat()
+		gocv.Resize(c, &chroma, size, 0, 0, gocv.InterpolationCubic)
+		merged = append(merged, chroma)
+	}
+	ycrcb := gocv.NewMat()
+	defer ycrcb.Close()
+	gocv.Merge(merged, &ycrcb)
+	for _, m := range merged {
+		m.Close()
+	}
+	bgr := gocv.NewMat()
+	gocv.CvtColor(ycrcb, &bgr, gocv.ColorYCrCbToBGR)
+	return bgr, nil
+}
+
+// UpscaleFile upscales the first page of an image file and writes it to
+// outFile.
+func (u *Upscaler) UpscaleFile(fileName, outFile string) (Upscaling, error) {
+	img := gocv.IMRead(fileName, gocv.IMReadUnchanged)
+	if img.Empty() {
+		return Upscaling{}, fmt.Errorf("error reading the image %s", fileName)
+	}
+	defer img.Close()
+
+	upscaled, upscaling, err := u.Upscale(img)
+	if err != nil {
+		return upscaling, err
+	}
+	defer upscaled.Close()
+	if ok := gocv.IMWrite(outFile, upscaled); !ok {
+		return upscaling, fmt.Errorf("error writing %s", outFile)
+	}
+	return upscaling, nil
+}
@@ -0,0 +1,58 @@
+package images
+
+import (
+	"image"
+	"math"
+	"os"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+// Unit test for upscaling pages with small text
+func TestUpscaler(t *testing.T) {
+	page := gocv.IMRead("../../samples/documents/input-image.png", gocv.IMReadColor)
+	defer page.Close()
+	small := gocv.NewMat()
+	defer small.Close()
+	gocv.Resize(page, &small, image.Pt(0, 0), 0.6, 0.6, gocv.InterpolationArea)
+
+	upscaled, upscaling, err := NewUpscaler().Upscale(small)
+	defer upscaled.Close()
+	if err != nil {
+		t.Fatalf("Error upscaling the page: %v", err)
+	}
+	if upscaling.XHeight < 5 || upscaling.XHeight > 7 || math.Abs(upscaling.Factor-22/upscaling.XHeight) > 1e-9 {
+		t.Errorf("Expected an x-height of about 6 enlarged to 22, got %+v", upscaling)
+	}
+	if math.Abs(float64(upscaled.Cols())-float64(small.Cols())*upscaling.Factor) > 1 {
+		t.Errorf("Expected the page enlarged %.2f times, got %d columns from %d", upscaling.Factor, upscaled.Cols(), small.Cols())
+	}
+	if x := NewUpscaler().Estimate(upscaled); x < 18 {
+		t.Errorf("Expected an x-height of about 22 after upscaling, got %v", x)
+	}
+	box := image.Rect(0, 0, int(100*upscaling.Factor), int(50*upscaling.Factor))
+	if original := upscaling.ToOriginal(box); original != image.Rect(0, 0, 100, 50) {
+		t.Errorf("Expected the box mapped back to (0,0)-(100,50), got %v", original)
+	}
+
+	// Large text is left alone
+	sheet := gocv.IMRead("../../samples/documents/omr-sheet.png", gocv.IMReadColor)
+	defer sheet.Close()
+	same, upscaling, _ := NewUpscaler().Upscale(sheet)
+	defer same.Close()
+	if upscaling.Factor != 1 || same.Cols() != sheet.Cols() {
+		t.Errorf("Expected the answer sheet not to be upscaled, got %+v", upscaling)
+	}
+
+	// Download ESPCN_x4.pb to models/ to test super-resolution
+	model := "../../models/ESPCN_x4.pb"
+	if _, err := os.Stat(model); err != nil {
+		t.Skipf("No super-resolution model at %s", model)
+	}
+	resolved, upscaling, err := NewUpscaler().WithModel(UpscaleESPCN, model, 4).Upscale(small)
+	defer resolved.Close()
+	if err != nil || upscaling.Method != UpscaleESPCN || resolved.Cols() != upscaled.Cols() || resolved.Channels() != 3 {
+		t.Errorf("Expected the page enlarged %.2f times by ESPCN, got %+v %v", upscaling.Factor, upscaling, err)
+	}
+}
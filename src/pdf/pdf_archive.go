@@ -0,0 +1,333 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// PDFAPart selects the PDF/A flavour. Both use level B (visual appearance);
+// part 3 additionally allows arbitrary embedded files.
+type PDFAPart int
+
+const (
+	PDFA2B PDFAPart = 2
+	PDFA3B PDFAPart = 3
+)
+
+// ArchiveInfo is the document metadata written to both the Info dictionary
+// and the XMP packet, which PDF/A requires to agree.
+type ArchiveInfo struct {
+	Title       string
+	Author      string
+	CreatorTool string
+	Producer    string
+	// Creation date; left out of the file when zero
+	Date time.Time
+}
+
+const srgbIdentifier = "sRGB IEC61966-2.1"
+
+// ConvertToPDFA rewrites a PDF so that it meets the structural requirements
+// of PDF/A-2b or PDF/A-3b: XMP metadata with the PDF/A identification, an sRGB
+// output intent, complete font dictionaries and a deterministic file ID.
+func ConvertToPDFA(data []byte, part PDFAPart, info ArchiveInfo) ([]byte, error) {
+	if part != PDFA2B && part != PDFA3B {
+		return nil, fmt.Errorf("unsupported PDF/A part %d", part)
+	}
+
+	r, err := NewReader(data)
+	if err != nil {
+		return nil, err
+	}
+	e := NewEditor(r)
+
+	catalog := e.Catalog()
+	if catalog == nil {
+		return nil, fmt.Errorf("document catalog not found")
+	}
+
+	var fontErr error
+	e.Objects(func(ref Ref, o Object) {
+		d, ok := o.(Dict)
+		if !ok || d.Name("Type") != "Font" {
+			return
+		}
+		// Embedded TrueType CID fonts must spell out their CID to glyph mapping
+		if d.Name("Subtype") == "CIDFontType2" {
+			if _, ok := d["CIDToGIDMap"]; !ok {
+				d["CIDToGIDMap"] = Name("Identity")
+			}
+		}
+		if err := checkFontEmbedded(e.Resolve, d); err != nil && fontErr == nil {
+			fontErr = err
+		}
+	})
+	if fontErr != nil {
+		return nil, fontErr
+	}
+
+	infoDict := Dict{"Producer": TextString(info.Producer)}
+	if info.Title != "" {
+		infoDict["Title"] = TextString(info.Title)
+	}
+	if info.Author != "" {
+		infoDict["Author"] = TextString(info.Author)
+	}
+	if info.CreatorTool != "" {
+		infoDict["Creator"] = TextString(info.CreatorTool)
+	}
+	if !info.Date.IsZero() {
+		infoDict["CreationDate"] = String(pdfDate(info.Date))
+		infoDict["ModDate"] = String(pdfDate(info.Date))
+	}
+	// Entries outside the standard set have no XMP counterpart to agree with
+	if old, ok := e.Resolve(e.Trailer()["Info"]).(Dict); ok {
+		for key, value := range old {
+			if !standardInfoKeys[key] {
+				infoDict[key] = value
+			}
+		}
+	}
+	e.Trailer()["Info"] = e.Add(infoDict)
+	// The ID is recomputed from the new content
+	delete(e.Trailer(), "ID")
+
+	profile := e.Add(&Stream{Dict: Dict{"N": int64(3)}, Raw: SRGBProfile()})
+	catalog["OutputIntents"] = Array{Dict{
+		"Type":                      Name("OutputIntent"),
+		"S":                         Name("GTS_PDFA1"),
+		"OutputConditionIdentifier": String(srgbIdentifier),
+		"Info":                      String(srgbIdentifier),
+		"DestOutputProfile":         profile,
+	}}
+
+	// Metadata streams stay unfiltered so the XMP can be found by scanning
+	catalog["Metadata"] = e.Add(&Stream{
+		Dict: Dict{"Type": Name("Metadata"), "Subtype": Name("XML")},
+		Raw:  xmpPacket(part, info),
+	})
+
+	return e.Bytes()
+}
+
+func checkFontEmbedded(resolve func(Object) Object, font Dict) error {
+	switch font.Name("Subtype") {
+	case "Type0", "Type3":
+		// Type0 fonts are checked through their descendant, Type3 glyphs are content streams
+		return nil
+	}
+	fd, _ := resolve(font["FontDescriptor"]).(Dict)
+	for _, key := range []Name{"FontFile", "FontFile2", "FontFile3"} {
+		if _, ok := fd[key]; ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("font %s is not embedded", font.Name("BaseFont"))
+}
+
+func pdfDate(t time.Time) string {
+	return "D:" + t.UTC().Format("20060102150405") + "Z"
+}
+
+func xmpDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+func xmpPacket(part PDFAPart, info ArchiveInfo) []byte {
+	var b bytes.Buffer
+	esc := html.EscapeString
+
+	b.WriteString("<?xpacket begin=\"\uFEFF\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	b.WriteString("<rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+
+	b.WriteString("<rdf:Description rdf:about=\"\" xmlns:dc=\"http://purl.org/dc/elements/1.1/\">\n")
+	b.WriteString("<dc:format>application/pdf</dc:format>\n")
+	if info.Title != "" {
+		fmt.Fprintf(&b, "<dc:title><rdf:Alt><rdf:li xml:lang=\"x-default\">%s</rdf:li></rdf:Alt></dc:title>\n", esc(info.Title))
+	}
+	if info.Author != "" {
+		fmt.Fprintf(&b, "<dc:creator><rdf:Seq><rdf:li>%s</rdf:li></rdf:Seq></dc:creator>\n", esc(info.Author))
+	}
+	b.WriteString("</rdf:Description>\n")
+
+	b.WriteString("<rdf:Description rdf:about=\"\" xmlns:xmp=\"http://ns.adobe.com/xap/1.0/\">\n")
+	if info.CreatorTool != "" {
+		fmt.Fprintf(&b, "<xmp:CreatorTool>%s</xmp:CreatorTool>\n", esc(info.CreatorTool))
+	}
+	if !info.Date.IsZero() {
+		date := xmpDate(info.Date)
+		fmt.Fprintf(&b, "<xmp:CreateDate>%s</xmp:CreateDate>\n<xmp:ModifyDate>%s</xmp:ModifyDate>\n<xmp:MetadataDate>%s</xmp:MetadataDate>\n", date, date, date)
+	}
+	b.WriteString("</rdf:Description>\n")
+
+	b.WriteString("<rdf:Description rdf:about=\"\" xmlns:pdf=\"http://ns.adobe.com/pdf/1.3/\">\n")
+	fmt.Fprintf(&b, "<pdf:Producer>%s</pdf:Producer>\n", esc(info.Producer))
+	b.WriteString("</rdf:Description>\n")
+
+	b.WriteString("<rdf:Description rdf:about=\"\" xmlns:pdfaid=\"http://www.aiim.org/pdfa/ns/id/\">\n")
+	fmt.Fprintf(&b, "<pdfaid:part>%d</pdfaid:part>\n<pdfaid:conformance>B</pdfaid:conformance>\n", part)
+	b.WriteString("</rdf:Description>\n")
+
+	b.WriteString("</rdf:RDF>\n</x:xmpmeta>\n")
+	// Padding lets metadata be edited in place later
+	b.WriteString(strings.Repeat(strings.Repeat(" ", 99)+"\n", 20))
+	b.WriteString("<?xpacket end=\"w\"?>")
+	return b.Bytes()
+}
+
+var (
+	xmpPart        = regexp.MustCompile(`<pdfaid:part>\s*(\d)\s*</pdfaid:part>`)
+	xmpConformance = regexp.MustCompile(`<pdfaid:conformance>\s*([ABU])\s*</pdfaid:conformance>`)
+	xmpTitle       = regexp.MustCompile(`(?s)<dc:title>.*?<rdf:li[^>]*>(.*?)</rdf:li>`)
+	xmpCreator     = regexp.MustCompile(`(?s)<dc:creator>.*?<rdf:li[^>]*>(.*?)</rdf:li>`)
+	xmpTool        = regexp.MustCompile(`<xmp:CreatorTool>(.*?)</xmp:CreatorTool>`)
+	xmpProducer    = regexp.MustCompile(`<pdf:Producer>(.*?)</pdf:Producer>`)
+)
+
+// CheckPDFA verifies the structural PDF/A-2b/3b requirements that this
+// package controls and returns one message per violation. It is a self-check
+// of our own output, not a replacement for a full validator such as veraPDF.
+func CheckPDFA(data []byte) []string {
+	var problems []string
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if !bytes.HasPrefix(data, []byte("%PDF-1.")) {
+		report("file does not start with a %%PDF-1.x header")
+	}
+	if lines := bytes.SplitN(data, []byte("\n"), 3); len(lines) < 2 || !isBinaryComment(lines[1]) {
+		report("header is not followed by a binary comment")
+	}
+
+	r, err := NewReader(data)
+	if err != nil {
+		return append(problems, err.Error())
+	}
+
+	if id, ok := r.Resolve(r.trailer["ID"]).(Array); !ok || len(id) != 2 {
+		report("trailer has no file identifier")
+	}
+
+	catalog, _ := r.Resolve(r.trailer["Root"]).(Dict)
+
+	// Identification and metadata
+	var xmp []byte
+	if meta, ok := r.Resolve(catalog["Metadata"]).(*Stream); !ok {
+		report("catalog has no XMP metadata stream")
+	} else if _, filtered := meta.Dict["Filter"]; filtered {
+		report("XMP metadata stream is compressed")
+	} else {
+		xmp = meta.Raw
+	}
+	if xmp != nil {
+		part := xmpPart.FindSubmatch(xmp)
+		conformance := xmpConformance.FindSubmatch(xmp)
+		if part == nil || (string(part[1]) != "2" && string(part[1]) != "3") {
+			report("XMP metadata does not identify PDF/A part 2 or 3")
+		}
+		if conformance == nil {
+			report("XMP metadata has no PDF/A conformance level")
+		}
+	}
+
+	info, _ := r.Resolve(r.trailer["Info"]).(Dict)
+	for key, pattern := range map[Name]*regexp.Regexp{
+		"Title": xmpTitle, "Author": xmpCreator, "Creator": xmpTool, "Producer": xmpProducer,
+	} {
+		s, ok := r.Resolve(info[key]).(String)
+		if !ok {
+			continue
+		}
+		m := pattern.FindSubmatch(xmp)
+		if m == nil || html.UnescapeString(string(m[1])) != s.Text() {
+			report("document info %s does not match the XMP metadata", key)
+		}
+	}
+
+	// Output intent
+	intents, _ := r.Resolve(catalog["OutputIntents"]).(Array)
+	hasIntent := false
+	for _, o := range intents {
+		intent, _ := r.Resolve(o).(Dict)
+		profile, ok := r.Resolve(intent["DestOutputProfile"]).(*Stream)
+		if intent.Name("S") == "GTS_PDFA1" && ok && profile.Dict.Int("N", 0) > 0 {
+			hasIntent = true
+		}
+	}
+	if !hasIntent {
+		report("catalog has no GTS_PDFA1 output intent with an ICC profile")
+	}
+
+	for _, num := range r.ObjectNumbers() {
+		obj := r.objects[num]
+		var d Dict
+		switch v := obj.(type) {
+		case Dict:
+			d = v
+		case *Stream:
+			d = v.Dict
+			filters, _ := r.filterChain(d)
+			for _, f := range filters {
+				if f == "LZWDecode" || f == "LZW" {
+					report("object %d uses LZW compression", num)
+				}
+			}
+			if interpolate, _ := r.Resolve(d["Interpolate"]).(bool); interpolate {
+				report("image %d requests interpolation", num)
+			}
+		default:
+			continue
+		}
+
+		switch d.Name("Type") {
+		case "Font":
+			problems = append(problems, checkFont(r, num, d)...)
+		case "Annot":
+			if d.Int("F", 0)&4 == 0 || d.Int("F", 0)&(1|2|32) != 0 {
+				report("annotation %d is not set to print or is hidden", num)
+			}
+		}
+		if s := d.Name("S"); s == "JavaScript" || s == "Launch" {
+			report("object %d contains a forbidden %s action", num, s)
+		}
+	}
+
+	return problems
+}
+
+func checkFont(r *Reader, num int, d Dict) []string {
+	var problems []string
+	switch d.Name("Subtype") {
+	case "Type0":
+		if _, ok := d["ToUnicode"]; !ok {
+			problems = append(problems, fmt.Sprintf("font %d has no ToUnicode map", num))
+		}
+	case "CIDFontType2":
+		if _, ok := d["CIDToGIDMap"]; !ok {
+			problems = append(problems, fmt.Sprintf("font %d has no CIDToGIDMap", num))
+		}
+	}
+	if err := checkFontEmbedded(r.Resolve, d); err != nil {
+		problems = append(problems, fmt.Sprintf("font %d: %s", num, err))
+	}
+	return problems
+}
+
+func isBinaryComment(line []byte) bool {
+	if len(line) < 5 || line[0] != '%' {
+		return false
+	}
+	high := 0
+	for _, c := range line[1:] {
+		if c > 127 {
+			high++
+		}
+	}
+	return high >= 4
+}
@@ -0,0 +1,50 @@
+package pdf
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// Unit test for converting gopdf output to PDF/A and checking the result
+func TestConvertToPDFA(t *testing.T) {
+	data := generateTextPDF(t, map[float64]string{100: "Archived record 2024-117"})
+
+	if problems := CheckPDFA(data); len(problems) == 0 {
+		t.Fatalf("Expected plain gopdf output to fail the PDF/A check")
+	}
+
+	info := ArchiveInfo{
+		Title:       "record-2024-117",
+		Author:      "Records Office",
+		CreatorTool: "gocr-lib",
+		Producer:    "gocr-lib",
+		Date:        time.Date(2024, 5, 17, 9, 30, 0, 0, time.UTC),
+	}
+
+	for _, part := range []PDFAPart{PDFA2B, PDFA3B} {
+		archived, err := ConvertToPDFA(data, part, info)
+		if err != nil {
+			t.Fatalf("Error converting to PDF/A part %d: %v", part, err)
+		}
+		if problems := CheckPDFA(archived); len(problems) != 0 {
+			t.Errorf("PDF/A part %d check failed: %v", part, problems)
+		}
+
+		// Same input and metadata must give the same bytes, including the ID
+		again, _ := ConvertToPDFA(data, part, info)
+		if !bytes.Equal(archived, again) {
+			t.Errorf("PDF/A part %d output is not deterministic", part)
+		}
+
+		// The text layer must survive the rewrite
+		r, err := NewReader(archived)
+		if err != nil {
+			t.Fatalf("Error reading archived pdf: %v", err)
+		}
+		content, _ := r.Page(0).Analyze()
+		if len(content.Words) != 3 || content.Words[2].Text != "2024-117" {
+			t.Errorf("Text layer changed after conversion: %+v", content.Words)
+		}
+	}
+}
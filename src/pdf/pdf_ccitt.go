@@ -0,0 +1,182 @@
+package pdf
+
+// CCITT Group 4 (T.6) encoding of bitonal images, stored with
+// /CCITTFaxDecode and /K -1.
+
+type code struct {
+	bits  uint32
+	width uint
+}
+
+// Run length codes from T.4, indexed by run length for terminating codes
+// and by length/64 - 1 for makeup codes.
+var (
+	whiteTerminating = codes(
+		"00110101", "000111", "0111", "1000", "1011", "1100", "1110", "1111",
+		"10011", "10100", "00111", "01000", "001000", "000011", "110100", "110101",
+		"101010", "101011", "0100111", "0001100", "0001000", "0010111", "0000011", "0000100",
+		"0101000", "0101011", "0010011", "0100100", "0011000", "00000010", "00000011", "00011010",
+		"00011011", "00010010", "00010011", "00010100", "00010101", "00010110", "00010111", "00101000",
+		"00101001", "00101010", "00101011", "00101100", "00101101", "00000100", "00000101", "00001010",
+		"00001011", "01010010", "01010011", "01010100", "01010101", "00100100", "00100101", "01011000",
+		"01011001", "01011010", "01011011", "01001010", "01001011", "00110010", "00110011", "00110100",
+	)
+	blackTerminating = codes(
+		"0000110111", "010", "11", "10", "011", "0011", "0010", "00011",
+		"000101", "000100", "0000100", "0000101", "0000111", "00000100", "00000111", "000011000",
+		"0000010111", "0000011000", "0000001000", "00001100111", "00001101000", "00001101100", "00000110111", "00000101000",
+		"00000010111", "00000011000", "000011001010", "000011001011", "000011001100", "000011001101", "000001101000", "000001101001",
+		"000001101010", "000001101011", "000011010010", "000011010011", "000011010100", "000011010101", "000011010110", "000011010111",
+		"000001101100", "000001101101", "000011011010", "000011011011", "000001010100", "000001010101", "000001010110", "000001010111",
+		"000001100100", "000001100101", "000001010010", "000001010011", "000000100100", "000000110111", "000000111000", "000000100111",
+		"000000101000", "000001011000", "000001011001", "000000101011", "000000101100", "000001011010", "000001100110", "000001100111",
+	)
+	whiteMakeup = codes(
+		"11011", "10010", "010111", "0110111", "00110110", "00110111", "01100100", "01100101",
+		"01101000", "01100111", "011001100", "011001101", "011010010", "011010011", "011010100", "011010101",
+		"011010110", "011010111", "011011000", "011011001", "011011010", "011011011", "010011000", "010011001",
+		"010011010", "011000", "010011011",
+	)
+	blackMakeup = codes(
+		"0000001111", "000011001000", "000011001001", "000001011011", "000000110011", "000000110100", "000000110101", "0000001101100",
+		"0000001101101", "0000001001010", "0000001001011", "0000001001100", "0000001001101", "0000001110010", "0000001110011", "0000001110100",
+		"0000001110101", "0000001110110", "0000001110111", "0000001010010", "0000001010011", "0000001010100", "0000001010101", "0000001011010",
+		"0000001011011", "0000001100100", "0000001100101",
+	)
+	// Shared by both colours, for runs of 1792 to 2560
+	extendedMakeup = codes(
+		"00000001000", "00000001100", "00000001101", "000000010010", "000000010011", "000000010100", "000000010101",
+		"000000010110", "000000010111", "000000011100", "000000011101", "000000011110", "000000011111",
+	)
+
+	passCode  = codes("0001")[0]
+	horizCode = codes("001")[0]
+	// Vertical mode codes for a1 - b1 from -3 to 3
+	vertCodes = codes("0000010", "000010", "010", "1", "011", "000011", "0000011")
+	eofb      = codes("000000000001000000000001")[0]
+)
+
+func codes(patterns ...string) []code {
+	out := make([]code, len(patterns))
+	for i, p := range patterns {
+		for _, c := range p {
+			out[i].bits = out[i].bits<<1 | uint32(c-'0')
+		}
+		out[i].width = uint(len(p))
+	}
+	return out
+}
+
+type bitWriter struct {
+	buf   []byte
+	acc   uint32
+	nbits uint
+}
+
+func (w *bitWriter) put(c code) {
+	w.acc = w.acc<<c.width | c.bits
+	w.nbits += c.width
+	for w.nbits >= 8 {
+		w.buf = append(w.buf, byte(w.acc>>(w.nbits-8)))
+		w.nbits -= 8
+	}
+	w.acc &= 1<<w.nbits - 1
+}
+
+func (w *bitWriter) flush() []byte {
+	if w.nbits > 0 {
+		w.buf = append(w.buf, byte(w.acc<<(8-w.nbits)))
+		w.nbits = 0
+	}
+	return w.buf
+}
+
+func (w *bitWriter) putRun(run int, black bool) {
+	terminating, makeup := whiteTerminating, whiteMakeup
+	if black {
+		terminating, makeup = blackTerminating, blackMakeup
+	}
+	for run > 2560 {
+		w.put(extendedMakeup[len(extendedMakeup)-1])
+		run -= 2560
+	}
+	if run >= 1792 {
+		w.put(extendedMakeup[(run-1792)/64])
+		run %= 64
+	} else if run >= 64 {
+		w.put(makeup[run/64-1])
+		run %= 64
+	}
+	w.put(terminating[run])
+}
+
+// encodeG4 compresses a bitonal image given as rows of pixels, true for
+// black, with CCITT Group 4.
+func encodeG4(rows [][]bool, width int) []byte {
+	var w bitWriter
+
+	pixel := func(row []bool, i int) bool {
+		return i < width && row[i]
+	}
+	// First position at or after start whose colour is not black
+	findDiff := func(row []bool, start int, black bool) int {
+		for i := start; i < width; i++ {
+			if row[i] != black {
+				return i
+			}
+		}
+		return width
+	}
+
+	ref := make([]bool, width)
+	for _, row := range rows {
+		a0 := 0
+		a1 := 0
+		if !pixel(row, 0) {
+			a1 = findDiff(row, 0, false)
+		}
+		b1 := 0
+		if !pixel(ref, 0) {
+			b1 = findDiff(ref, 0, false)
+		}
+
+		for {
+			b2 := width
+			if b1 < width {
+				b2 = findDiff(ref, b1, pixel(ref, b1))
+			}
+			if b2 >= a1 {
+				d := b1 - a1
+				if d < -3 || d > 3 {
+					a2 := width
+					if a1 < width {
+						a2 = findDiff(row, a1, pixel(row, a1))
+					}
+					w.put(horizCode)
+					first := a0+a1 == 0 || !pixel(row, a0)
+					w.putRun(a1-a0, !first)
+					w.putRun(a2-a1, first)
+					a0 = a2
+				} else {
+					w.put(vertCodes[3-d])
+					a0 = a1
+				}
+			} else {
+				w.put(passCode)
+				a0 = b2
+			}
+			if a0 >= width {
+				break
+			}
+			color := pixel(row, a0)
+			a1 = findDiff(row, a0, color)
+			b1 = findDiff(ref, a0, !color)
+			b1 = findDiff(ref, b1, color)
+		}
+
+		ref = row
+	}
+
+	w.put(eofb)
+	return w.flush()
+}
@@ -0,0 +1,429 @@
+package pdf
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Rect is an axis aligned box in points, with the origin at the top-left
+// corner of the page as it is displayed (after /Rotate is applied).
+type Rect struct {
+	X0, Y0, X1, Y1 float64
+}
+
+func (r Rect) Width() float64  { return r.X1 - r.X0 }
+func (r Rect) Height() float64 { return r.Y1 - r.Y0 }
+
+func (r Rect) Union(o Rect) Rect {
+	return Rect{min(r.X0, o.X0), min(r.Y0, o.Y0), max(r.X1, o.X1), max(r.Y1, o.Y1)}
+}
+
+// Word is a run of glyphs on one baseline with no space between them.
+type Word struct {
+	Text     string
+	Box      Rect
+	FontSize float64
+	// Invisible words are drawn with text render mode 3 or 7, which is how
+	// OCR tools lay a searchable text layer over a scanned image.
+	Invisible bool
+}
+
+// PageContent is what the content stream of a page draws, reduced to the
+// parts that matter for text extraction.
+type PageContent struct {
+	Width, Height float64
+	Words         []Word
+	Images        []Rect
+	// Number of glyphs shown, and how many of them came from fonts without a
+	// usable Unicode mapping (text that can be seen but not extracted).
+	Glyphs         int
+	UnmappedGlyphs int
+}
+
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+// mul returns m × n, i.e. m applied first and n second.
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func (m matrix) apply(x, y float64) (float64, float64) {
+	return x*m[0] + y*m[2] + m[4], x*m[1] + y*m[3] + m[5]
+}
+
+type graphicsState struct {
+	ctm       matrix
+	font      *font
+	fontSize  float64
+	charSpace float64
+	wordSpace float64
+	hScale    float64
+	leading   float64
+	rise      float64
+	render    int
+}
+
+type placedGlyph struct {
+	text      string
+	box       Rect
+	size      float64
+	space     bool
+	invisible bool
+}
+
+type interpreter struct {
+	page    Page
+	fonts   map[Ref]*font
+	forms   map[Ref]bool
+	glyphs  []placedGlyph
+	images  []Rect
+	content *PageContent
+}
+
+// Analyze interprets the page content and returns its words and images.
+func (p Page) Analyze() (*PageContent, error) {
+	data, err := p.Content()
+	if err != nil {
+		return nil, err
+	}
+
+	box := p.MediaBox()
+	content := &PageContent{Width: box[2] - box[0], Height: box[3] - box[1]}
+	if rot := p.Rotate(); rot == 90 || rot == 270 {
+		content.Width, content.Height = content.Height, content.Width
+	}
+
+	in := &interpreter{page: p, fonts: map[Ref]*font{}, forms: map[Ref]bool{}, content: content}
+	gs := graphicsState{ctm: identity, hScale: 1}
+	in.run(data, p.Resources(), gs, 0)
+
+	content.Words = groupWords(in.glyphs)
+	content.Images = in.images
+	return content, nil
+}
+
+// ImageCoverage returns the fraction of the page area covered by images,
+// counting overlapping images only once.
+func (c *PageContent) ImageCoverage() float64 {
+	if c.Width <= 0 || c.Height <= 0 || len(c.Images) == 0 {
+		return 0
+	}
+
+	// Rasterize the image boxes onto a coarse grid
+	const cells = 100
+	covered := 0
+	for gy := 0; gy < cells; gy++ {
+		y := (float64(gy) + 0.5) * c.Height / cells
+		for gx := 0; gx < cells; gx++ {
+			x := (float64(gx) + 0.5) * c.Width / cells
+			for _, img := range c.Images {
+				if x >= img.X0 && x <= img.X1 && y >= img.Y0 && y <= img.Y1 {
+					covered++
+					break
+				}
+			}
+		}
+	}
+	return float64(covered) / (cells * cells)
+}
+
+// toDisplay converts user space coordinates to top-left display coordinates.
+func (p Page) toDisplay(x, y float64) (float64, float64) {
+	box := p.MediaBox()
+	w, h := box[2]-box[0], box[3]-box[1]
+	u, v := x-box[0], y-box[1]
+	switch p.Rotate() {
+	case 90:
+		return v, u
+	case 180:
+		return w - u, v
+	case 270:
+		return h - v, w - u
+	}
+	return u, h - v
+}
+
+// displayRect transforms the unit box spanned by (x0,y0)-(x1,y1) in the
+// given space and returns its bounding box in display coordinates.
+func (in *interpreter) displayRect(m matrix, x0, y0, x1, y1 float64) Rect {
+	r := Rect{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, pt := range [][2]float64{{x0, y0}, {x1, y0}, {x0, y1}, {x1, y1}} {
+		ux, uy := m.apply(pt[0], pt[1])
+		dx, dy := in.page.toDisplay(ux, uy)
+		r = Rect{min(r.X0, dx), min(r.Y0, dy), max(r.X1, dx), max(r.Y1, dy)}
+	}
+	return r
+}
+
+func (in *interpreter) run(data []byte, resources Dict, gs graphicsState, depth int) {
+	if depth > 8 {
+		return
+	}
+
+	var stack []graphicsState
+	var tm, tlm matrix
+	var operands []Object
+
+	l := newLexer(data)
+	for {
+		o, err := l.next()
+		if err != nil {
+			return
+		}
+		op, isOp := o.(Operator)
+		if !isOp {
+			operands = append(operands, o)
+			continue
+		}
+
+		num := func(i int) float64 {
+			if i < len(operands) {
+				n, _ := Number(operands[i])
+				return n
+			}
+			return 0
+		}
+
+		switch op {
+		case "q":
+			stack = append(stack, gs)
+		case "Q":
+			if len(stack) > 0 {
+				gs = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+		case "cm":
+			gs.ctm = matrix{num(0), num(1), num(2), num(3), num(4), num(5)}.mul(gs.ctm)
+		case "BT":
+			tm, tlm = identity, identity
+		case "Tf":
+			if len(operands) >= 2 {
+				name, _ := operands[0].(Name)
+				gs.font = in.font(resources, name)
+				gs.fontSize = num(1)
+			}
+		case "Tc":
+			gs.charSpace = num(0)
+		case "Tw":
+			gs.wordSpace = num(0)
+		case "Tz":
+			gs.hScale = num(0) / 100
+		case "TL":
+			gs.leading = num(0)
+		case "Ts":
+			gs.rise = num(0)
+		case "Tr":
+			gs.render = int(num(0))
+		case "Td":
+			tlm = matrix{1, 0, 0, 1, num(0), num(1)}.mul(tlm)
+			tm = tlm
+		case "TD":
+			gs.leading = -num(1)
+			tlm = matrix{1, 0, 0, 1, num(0), num(1)}.mul(tlm)
+			tm = tlm
+		case "Tm":
+			tlm = matrix{num(0), num(1), num(2), num(3), num(4), num(5)}
+			tm = tlm
+		case "T*":
+			tlm = matrix{1, 0, 0, 1, 0, -gs.leading}.mul(tlm)
+			tm = tlm
+		case "Tj", "'", "\"":
+			if op != "Tj" {
+				if op == "\"" {
+					gs.wordSpace, gs.charSpace = num(0), num(1)
+				}
+				tlm = matrix{1, 0, 0, 1, 0, -gs.leading}.mul(tlm)
+				tm = tlm
+			}
+			if len(operands) > 0 {
+				if s, ok := operands[len(operands)-1].(String); ok {
+					in.show(s, &tm, gs)
+				}
+			}
+		case "TJ":
+			if len(operands) > 0 {
+				arr, _ := operands[0].(Array)
+				for _, item := range arr {
+					switch v := item.(type) {
+					case String:
+						in.show(v, &tm, gs)
+					case int64, float64:
+						n, _ := Number(v)
+						tx := -n / 1000 * gs.fontSize * gs.hScale
+						tm = matrix{1, 0, 0, 1, tx, 0}.mul(tm)
+					}
+				}
+			}
+		case "Do":
+			if len(operands) > 0 {
+				name, _ := operands[0].(Name)
+				in.xobject(resources, name, gs, depth)
+			}
+		case "BI":
+			in.inlineImage(l, gs)
+		}
+		operands = operands[:0]
+	}
+}
+
+func (in *interpreter) font(resources Dict, name Name) *font {
+	r := in.page.r
+	fonts, _ := r.Resolve(resources["Font"]).(Dict)
+	ref, isRef := fonts[name].(Ref)
+	if isRef {
+		if f, ok := in.fonts[ref]; ok {
+			return f
+		}
+	}
+
+	d, ok := r.Resolve(fonts[name]).(Dict)
+	if !ok {
+		return nil
+	}
+	f := r.loadFont(d)
+	if isRef {
+		in.fonts[ref] = f
+	}
+	return f
+}
+
+// show places each glyph of s and advances the text matrix.
+func (in *interpreter) show(s String, tm *matrix, gs graphicsState) {
+	if gs.font == nil {
+		return
+	}
+
+	invisible := gs.render == 3 || gs.render == 7
+	for _, g := range gs.font.decode(s) {
+		trm := matrix{gs.fontSize * gs.hScale, 0, 0, gs.fontSize, 0, gs.rise}.mul(*tm).mul(gs.ctm)
+
+		// Glyph box: advance width by a nominal ascent/descent
+		box := in.displayRect(trm, 0, -0.2, max(g.width, 0.1), 0.8)
+		// Effective font size on the page
+		size := math.Hypot(trm[2], trm[3])
+
+		in.content.Glyphs++
+		if g.text == "" && !g.space {
+			in.content.UnmappedGlyphs++
+		}
+
+		in.glyphs = append(in.glyphs, placedGlyph{
+			text:      g.text,
+			box:       box,
+			size:      size,
+			space:     g.space || strings.TrimSpace(g.text) == "",
+			invisible: invisible,
+		})
+
+		advance := g.width*gs.fontSize + gs.charSpace
+		if g.space {
+			advance += gs.wordSpace
+		}
+		*tm = matrix{1, 0, 0, 1, advance * gs.hScale, 0}.mul(*tm)
+	}
+}
+
+func (in *interpreter) xobject(resources Dict, name Name, gs graphicsState, depth int) {
+	r := in.page.r
+	xobjects, _ := r.Resolve(resources["XObject"]).(Dict)
+	stream, ok := r.Resolve(xobjects[name]).(*Stream)
+	if !ok {
+		return
+	}
+
+	switch stream.Dict.Name("Subtype") {
+	case "Image":
+		in.images = append(in.images, in.displayRect(gs.ctm, 0, 0, 1, 1))
+	case "Form":
+		if ref, isRef := xobjects[name].(Ref); isRef {
+			// A form that (indirectly) draws itself would never terminate
+			if in.forms[ref] {
+				return
+			}
+			in.forms[ref] = true
+			defer delete(in.forms, ref)
+		}
+
+		data, err := r.DecodeStream(stream)
+		if err != nil {
+			return
+		}
+		if m := Numbers(r.Resolve(stream.Dict["Matrix"])); len(m) == 6 {
+			gs.ctm = matrix{m[0], m[1], m[2], m[3], m[4], m[5]}.mul(gs.ctm)
+		}
+		formResources := resources
+		if res, ok := r.Resolve(stream.Dict["Resources"]).(Dict); ok {
+			formResources = res
+		}
+		in.run(data, formResources, gs, depth+1)
+	}
+}
+
+// inlineImage skips over BI ... ID <data> EI and records the image area.
+func (in *interpreter) inlineImage(l *lexer, gs graphicsState) {
+	l.skipInlineImage()
+	in.images = append(in.images, in.displayRect(gs.ctm, 0, 0, 1, 1))
+}
+
+// groupWords joins consecutive glyphs that touch on the same line.
+func groupWords(glyphs []placedGlyph) []Word {
+	var words []Word
+	var cur *Word
+	var last placedGlyph
+
+	flush := func() {
+		if cur != nil && strings.TrimSpace(cur.Text) != "" {
+			words = append(words, *cur)
+		}
+		cur = nil
+	}
+
+	for _, g := range glyphs {
+		if g.space {
+			flush()
+			continue
+		}
+		if g.text == "" {
+			continue
+		}
+
+		if cur != nil {
+			h := min(g.box.Height(), last.box.Height())
+			overlap := min(g.box.Y1, last.box.Y1) - max(g.box.Y0, last.box.Y0)
+			gap := g.box.X0 - last.box.X1
+			sameLine := overlap >= 0.5*h
+			touching := gap <= 0.2*h && g.box.X0 >= last.box.X0-0.5*h
+			if !sameLine || !touching || g.invisible != cur.Invisible {
+				flush()
+			}
+		}
+
+		if cur == nil {
+			cur = &Word{Box: g.box, FontSize: g.size, Invisible: g.invisible}
+		} else {
+			cur.Box = cur.Box.Union(g.box)
+			cur.FontSize = max(cur.FontSize, g.size)
+		}
+		cur.Text += g.text
+		last = g
+
+		// Text extracted from ligatures or CMaps may already contain spaces
+		if strings.IndexFunc(g.text, unicode.IsSpace) >= 0 {
+			cur.Text = strings.TrimSpace(cur.Text)
+			flush()
+		}
+	}
+	flush()
+
+	return words
+}
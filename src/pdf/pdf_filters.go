@@ -0,0 +1,262 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"fmt"
+	"io"
+)
+
+// DecodeStream applies the stream's filter chain and returns the decoded data.
+// Image codecs (DCTDecode, JPXDecode, CCITTFaxDecode, JBIG2Decode) are left
+// alone and reported as an error, since only text related streams are decoded.
+func (r *Reader) DecodeStream(s *Stream) ([]byte, error) {
+	filters, params := r.filterChain(s.Dict)
+
+	data := s.Raw
+	for i, f := range filters {
+		var err error
+		switch f {
+		case "FlateDecode", "Fl":
+			data, err = inflate(data)
+			if err == nil {
+				data, err = unpredict(data, params[i])
+			}
+		case "ASCIIHexDecode", "AHx":
+			data, err = decodeASCIIHex(data)
+		case "ASCII85Decode", "A85":
+			data, err = decodeASCII85(data)
+		case "LZWDecode", "LZW":
+			data = decodeLZW(data, params[i].Int("EarlyChange", 1) == 1)
+			data, err = unpredict(data, params[i])
+		case "RunLengthDecode", "RL":
+			data = decodeRunLength(data)
+		default:
+			return nil, fmt.Errorf("unsupported filter %s", f)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply %s: %w", f, err)
+		}
+	}
+	return data, nil
+}
+
+func (r *Reader) filterChain(d Dict) ([]Name, []Dict) {
+	var filters []Name
+	var params []Dict
+
+	switch f := r.Resolve(d["Filter"]).(type) {
+	case Name:
+		filters = []Name{f}
+	case Array:
+		for _, v := range f {
+			if n, ok := r.Resolve(v).(Name); ok {
+				filters = append(filters, n)
+			}
+		}
+	}
+
+	switch p := r.Resolve(d["DecodeParms"]).(type) {
+	case Dict:
+		params = []Dict{p}
+	case Array:
+		for _, v := range p {
+			pd, _ := r.Resolve(v).(Dict)
+			params = append(params, pd)
+		}
+	}
+	for len(params) < len(filters) {
+		params = append(params, nil)
+	}
+	return filters, params
+}
+
+func inflate(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	out, err := io.ReadAll(zr)
+	// Many writers produce streams with a bad checksum or truncated tail;
+	// keep whatever inflated cleanly.
+	if err != nil && len(out) > 0 {
+		return out, nil
+	}
+	return out, err
+}
+
+// unpredict reverses the TIFF and PNG predictors used by Flate and LZW.
+func unpredict(data []byte, params Dict) ([]byte, error) {
+	predictor := params.Int("Predictor", 1)
+	if predictor < 2 {
+		return data, nil
+	}
+
+	colors := params.Int("Colors", 1)
+	bpc := params.Int("BitsPerComponent", 8)
+	columns := params.Int("Columns", 1)
+	bpp := max(1, colors*bpc/8)
+	rowLen := (colors*bpc*columns + 7) / 8
+
+	if predictor == 2 {
+		if bpc != 8 {
+			return nil, fmt.Errorf("unsupported TIFF predictor depth %d", bpc)
+		}
+		for row := 0; row+rowLen <= len(data); row += rowLen {
+			for i := bpp; i < rowLen; i++ {
+				data[row+i] += data[row+i-bpp]
+			}
+		}
+		return data, nil
+	}
+
+	out := make([]byte, 0, len(data))
+	prev := make([]byte, rowLen)
+	for pos := 0; pos+1+rowLen <= len(data); pos += 1 + rowLen {
+		kind := data[pos]
+		row := append([]byte{}, data[pos+1:pos+1+rowLen]...)
+		for i := range row {
+			var left, upLeft byte
+			if i >= bpp {
+				left = row[i-bpp]
+				upLeft = prev[i-bpp]
+			}
+			up := prev[i]
+			switch kind {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func decodeASCIIHex(data []byte) ([]byte, error) {
+	l := &lexer{data: append(append([]byte{}, data...), '>')}
+	s, err := l.hexString()
+	if err != nil {
+		return nil, err
+	}
+	return s.(String), nil
+}
+
+func decodeASCII85(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	data = bytes.TrimPrefix(data, []byte("<~"))
+	if idx := bytes.Index(data, []byte("~>")); idx >= 0 {
+		data = data[:idx]
+	}
+	out := make([]byte, len(data))
+	n, _, err := ascii85.Decode(out, data, true)
+	return out[:n], err
+}
+
+func decodeRunLength(data []byte) []byte {
+	var out []byte
+	for i := 0; i < len(data); {
+		n := int(data[i])
+		i++
+		switch {
+		case n == 128:
+			return out
+		case n < 128:
+			end := min(i+n+1, len(data))
+			out = append(out, data[i:end]...)
+			i = end
+		default:
+			if i < len(data) {
+				out = append(out, bytes.Repeat(data[i:i+1], 257-n)...)
+			}
+			i++
+		}
+	}
+	return out
+}
+
+// decodeLZW implements the PDF flavour of LZW, which differs from
+// compress/lzw by switching code width one code early.
+func decodeLZW(data []byte, earlyChange bool) []byte {
+	var out []byte
+	table := make([][]byte, 258, 4096)
+	for i := 0; i < 256; i++ {
+		table[i] = []byte{byte(i)}
+	}
+
+	width := 9
+	var bitBuf uint32
+	bitCount := 0
+	var prev []byte
+
+	for _, b := range data {
+		bitBuf = bitBuf<<8 | uint32(b)
+		bitCount += 8
+		for bitCount >= width {
+			code := int(bitBuf>>(bitCount-width)) & (1<<width - 1)
+			bitCount -= width
+
+			switch {
+			case code == 256:
+				table = table[:258]
+				width = 9
+				prev = nil
+				continue
+			case code == 257:
+				return out
+			}
+
+			var entry []byte
+			if code < len(table) {
+				entry = table[code]
+			} else if prev != nil {
+				entry = append(append([]byte{}, prev...), prev[0])
+			} else {
+				return out
+			}
+			out = append(out, entry...)
+
+			if prev != nil && len(table) < 4096 {
+				table = append(table, append(append([]byte{}, prev...), entry[0]))
+			}
+			prev = entry
+
+			limit := len(table)
+			if earlyChange {
+				limit++
+			}
+			if limit >= 1<<width && width < 12 {
+				width++
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,418 @@
+package pdf
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// font turns the bytes of a shown string into Unicode text and glyph widths.
+type font struct {
+	// Byte lengths of character codes, from the codespace ranges
+	codeLengths []codespace
+	toUnicode   map[int]string
+	encoding    [256]rune
+	simple      bool
+	// ucs2 is set for Type0 fonts whose CMap already yields UTF-16 codes.
+	// Other Type0 fonts without a ToUnicode CMap only carry glyph ids.
+	ucs2 bool
+
+	widths       map[int]float64
+	defaultWidth float64
+	// Glyph space to text space scale, 1/1000 except for Type3 fonts
+	scale float64
+}
+
+type codespace struct {
+	n      int
+	lo, hi int
+}
+
+// glyph is one decoded character code.
+type glyph struct {
+	code  int
+	text  string
+	width float64 // in text space units, before font size scaling
+	space bool    // single-byte code 32, which receives word spacing
+}
+
+func (r *Reader) loadFont(d Dict) *font {
+	f := &font{scale: 0.001, defaultWidth: 500, widths: map[int]float64{}}
+
+	subtype := d.Name("Subtype")
+	if subtype == "Type3" {
+		if m := Numbers(r.Resolve(d["FontMatrix"])); len(m) == 6 {
+			f.scale = m[0]
+		}
+	}
+
+	if subtype == "Type0" {
+		f.loadCIDFont(r, d)
+	} else {
+		f.simple = true
+		f.loadSimpleEncoding(r, d)
+		first := d.Int("FirstChar", 0)
+		for i, w := range Numbers(r.Resolve(d["Widths"])) {
+			f.widths[first+i] = w
+		}
+		if fd, ok := r.Resolve(d["FontDescriptor"]).(Dict); ok {
+			if w, ok := Number(r.Resolve(fd["MissingWidth"])); ok && w > 0 {
+				f.defaultWidth = w
+			}
+		}
+		if strings.Contains(string(d.Name("BaseFont")), "Courier") {
+			f.defaultWidth = 600
+		}
+	}
+
+	if s, ok := r.Resolve(d["ToUnicode"]).(*Stream); ok {
+		if data, err := r.DecodeStream(s); err == nil {
+			f.parseCMap(data)
+		}
+	}
+
+	return f
+}
+
+func (f *font) loadCIDFont(r *Reader, d Dict) {
+	f.defaultWidth = 1000
+	f.codeLengths = []codespace{{2, 0, 0xFFFF}}
+
+	encoding := string(d.Name("Encoding"))
+	f.ucs2 = strings.HasSuffix(encoding, "UCS2-H") || strings.HasSuffix(encoding, "UTF16-H")
+
+	descendants, _ := r.Resolve(d["DescendantFonts"]).(Array)
+	if len(descendants) == 0 {
+		return
+	}
+	cid, ok := r.Resolve(descendants[0]).(Dict)
+	if !ok {
+		return
+	}
+
+	f.defaultWidth = float64(cid.Int("DW", 1000))
+	w, _ := r.Resolve(cid["W"]).(Array)
+	for i := 0; i < len(w); {
+		first, ok := Number(r.Resolve(w[i]))
+		if !ok || i+1 >= len(w) {
+			break
+		}
+		if list, ok := r.Resolve(w[i+1]).(Array); ok {
+			// c [w1 w2 ...]
+			for j, v := range list {
+				n, _ := Number(r.Resolve(v))
+				f.widths[int(first)+j] = n
+			}
+			i += 2
+			continue
+		}
+		// cfirst clast w
+		if i+2 >= len(w) {
+			break
+		}
+		last, _ := Number(r.Resolve(w[i+1]))
+		width, _ := Number(r.Resolve(w[i+2]))
+		for c := int(first); c <= int(last) && c-int(first) < 65536; c++ {
+			f.widths[c] = width
+		}
+		i += 3
+	}
+}
+
+func (f *font) loadSimpleEncoding(r *Reader, d Dict) {
+	base := winAnsiEncoding
+	var differences Array
+
+	switch enc := r.Resolve(d["Encoding"]).(type) {
+	case Name:
+		base = baseEncoding(enc, base)
+	case Dict:
+		base = baseEncoding(enc.Name("BaseEncoding"), base)
+		differences, _ = r.Resolve(enc["Differences"]).(Array)
+	}
+	f.encoding = base
+
+	code := 0
+	for _, v := range differences {
+		switch v := r.Resolve(v).(type) {
+		case int64:
+			code = int(v)
+		case float64:
+			code = int(v)
+		case Name:
+			if code >= 0 && code < 256 {
+				f.encoding[code] = glyphNameToRune(string(v))
+			}
+			code++
+		}
+	}
+}
+
+func baseEncoding(name Name, def [256]rune) [256]rune {
+	switch name {
+	case "WinAnsiEncoding":
+		return winAnsiEncoding
+	case "MacRomanEncoding":
+		return macRomanEncoding
+	case "StandardEncoding":
+		return standardEncoding
+	}
+	return def
+}
+
+// parseCMap reads the codespace and bfchar/bfrange sections of a ToUnicode CMap.
+func (f *font) parseCMap(data []byte) {
+	f.toUnicode = map[int]string{}
+	var ranges []codespace
+
+	l := newLexer(data)
+	var operands []Object
+	for {
+		o, err := l.next()
+		if err != nil {
+			break
+		}
+		op, isOp := o.(Operator)
+		if !isOp {
+			operands = append(operands, o)
+			continue
+		}
+
+		switch op {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				lo, _ := operands[i].(String)
+				hi, _ := operands[i+1].(String)
+				if len(lo) > 0 {
+					ranges = append(ranges, codespace{len(lo), bytesToInt(lo), bytesToInt(hi)})
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, _ := operands[i].(String)
+				dst, _ := operands[i+1].(String)
+				f.toUnicode[bytesToInt(src)] = decodeUTF16(dst)
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, _ := operands[i].(String)
+				hi, _ := operands[i+1].(String)
+				start, end := bytesToInt(lo), bytesToInt(hi)
+				if end-start > 65535 {
+					continue
+				}
+				switch dst := operands[i+2].(type) {
+				case String:
+					// The last byte of the destination is incremented for each code
+					base := append(String{}, dst...)
+					for c := start; c <= end; c++ {
+						f.toUnicode[c] = decodeUTF16(base)
+						incrementLast(base)
+					}
+				case Array:
+					for j, v := range dst {
+						if s, ok := v.(String); ok && start+j <= end {
+							f.toUnicode[start+j] = decodeUTF16(s)
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+
+	if len(ranges) > 0 {
+		f.codeLengths = ranges
+	}
+}
+
+func incrementLast(b String) {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return
+		}
+	}
+}
+
+func bytesToInt(b []byte) int {
+	v := 0
+	for _, c := range b {
+		v = v<<8 | int(c)
+	}
+	return v
+}
+
+func decodeUTF16(b []byte) string {
+	if len(b) == 1 {
+		return string(rune(b[0]))
+	}
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		u = append(u, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(u))
+}
+
+// decode splits a shown string into glyphs.
+func (f *font) decode(s String) []glyph {
+	var out []glyph
+	for i := 0; i < len(s); {
+		n := f.codeLength(s[i:])
+		code := bytesToInt(s[i:min(i+n, len(s))])
+		i += n
+
+		g := glyph{code: code, width: f.defaultWidth * f.scale}
+		if w, ok := f.widths[code]; ok {
+			g.width = w * f.scale
+		}
+		g.space = n == 1 && code == 32
+
+		if text, ok := f.toUnicode[code]; ok {
+			g.text = text
+		} else if f.ucs2 {
+			g.text = decodeUTF16([]byte{byte(code >> 8), byte(code)})
+		} else if f.simple && code < 256 && f.encoding[code] != 0 {
+			g.text = string(f.encoding[code])
+		}
+		out = append(out, g)
+	}
+	return out
+}
+
+func (f *font) codeLength(b []byte) int {
+	if len(f.codeLengths) == 0 {
+		return 1
+	}
+	for _, cs := range f.codeLengths {
+		if cs.n <= len(b) {
+			c := bytesToInt(b[:cs.n])
+			if c >= cs.lo && c <= cs.hi {
+				return cs.n
+			}
+		}
+	}
+	return f.codeLengths[0].n
+}
+
+var (
+	winAnsiEncoding  [256]rune
+	macRomanEncoding [256]rune
+	standardEncoding [256]rune
+	glyphNames       = map[string]rune{}
+)
+
+// Glyph names for the printable ASCII punctuation, in code order from 0x20
+var asciiNames = []string{
+	"space", "exclam", "quotedbl", "numbersign", "dollar", "percent", "ampersand", "quotesingle",
+	"parenleft", "parenright", "asterisk", "plus", "comma", "hyphen", "period", "slash",
+	"colon", "semicolon", "less", "equal", "greater", "question", "at",
+	"bracketleft", "backslash", "bracketright", "asciicircum", "underscore", "grave",
+	"braceleft", "bar", "braceright", "asciitilde",
+}
+
+// WinAnsi glyph names for 0x80-0xFF, "" where the code is undefined
+var winAnsiHighNames = strings.Fields(`
+	Euro - quotesinglbase florin quotedblbase ellipsis dagger daggerdbl circumflex perthousand Scaron guilsinglleft OE - Zcaron -
+	- quoteleft quoteright quotedblleft quotedblright bullet endash emdash tilde trademark scaron guilsinglright oe - zcaron Ydieresis
+	nbspace exclamdown cent sterling currency yen brokenbar section dieresis copyright ordfeminine guillemotleft logicalnot sfthyphen registered macron
+	degree plusminus twosuperior threesuperior acute mu paragraph periodcentered cedilla onesuperior ordmasculine guillemotright onequarter onehalf threequarters questiondown
+	Agrave Aacute Acircumflex Atilde Adieresis Aring AE Ccedilla Egrave Eacute Ecircumflex Edieresis Igrave Iacute Icircumflex Idieresis
+	Eth Ntilde Ograve Oacute Ocircumflex Otilde Odieresis multiply Oslash Ugrave Uacute Ucircumflex Udieresis Yacute Thorn germandbls
+	agrave aacute acircumflex atilde adieresis aring ae ccedilla egrave eacute ecircumflex edieresis igrave iacute icircumflex idieresis
+	eth ntilde ograve oacute ocircumflex otilde odieresis divide oslash ugrave uacute ucircumflex udieresis yacute thorn ydieresis`)
+
+const cp1252High = "€�‚ƒ„…†‡ˆ‰Š‹Œ�Ž��‘’“”•–—˜™š›œ�žŸ"
+
+const macRomanHigh = "ÄÅÇÉÑÖÜáàâäãåçéèêëíìîïñóòôöõúùûü†°¢£§•¶ß®©™´¨≠ÆØ∞±≤≥¥µ∂∑∏π∫ªºΩæø¿¡¬√ƒ≈∆«»…\u00a0ÀÃÕŒœ–—“”‘’÷◊ÿŸ⁄€‹›ﬁﬂ‡·‚„‰ÂÊÁËÈÍÎÏÌÓÔ\uf8ffÒÚÛÙıˆ˜¯˘˙˚¸˝˛ˇ"
+
+// Differences from ASCII in the Adobe standard encoding
+var standardDiffs = map[int]string{
+	0x27: "quoteright", 0x60: "quoteleft", 0xA1: "exclamdown", 0xA2: "cent", 0xA3: "sterling",
+	0xA4: "fraction", 0xA5: "yen", 0xA6: "florin", 0xA7: "section", 0xA8: "currency",
+	0xA9: "quotesingle", 0xAA: "quotedblleft", 0xAB: "guillemotleft", 0xAC: "guilsinglleft",
+	0xAD: "guilsinglright", 0xAE: "fi", 0xAF: "fl", 0xB1: "endash", 0xB2: "dagger",
+	0xB3: "daggerdbl", 0xB4: "periodcentered", 0xB6: "paragraph", 0xB7: "bullet",
+	0xB8: "quotesinglbase", 0xB9: "quotedblbase", 0xBA: "quotedblright", 0xBB: "guillemotright",
+	0xBC: "ellipsis", 0xBD: "perthousand", 0xBF: "questiondown", 0xC1: "grave", 0xC2: "acute",
+	0xC3: "circumflex", 0xC4: "tilde", 0xC5: "macron", 0xC6: "breve", 0xC7: "dotaccent",
+	0xC8: "dieresis", 0xCA: "ring", 0xCB: "cedilla", 0xCD: "hungarumlaut", 0xCE: "ogonek",
+	0xCF: "caron", 0xD0: "emdash", 0xE1: "AE", 0xE3: "ordfeminine", 0xE8: "Lslash",
+	0xE9: "Oslash", 0xEA: "OE", 0xEB: "ordmasculine", 0xF1: "ae", 0xF5: "dotlessi",
+	0xF8: "lslash", 0xF9: "oslash", 0xFA: "oe", 0xFB: "germandbls",
+}
+
+// Names outside WinAnsi that still show up in Differences arrays
+var extraNames = map[string]rune{
+	"fi": 0xFB01, "fl": 0xFB02, "ff": 0xFB00, "ffi": 0xFB03, "ffl": 0xFB04,
+	"dotlessi": 0x0131, "fraction": 0x2044, "minus": 0x2212, "Lslash": 0x0141, "lslash": 0x0142,
+	"breve": 0x02D8, "dotaccent": 0x02D9, "ring": 0x02DA, "hungarumlaut": 0x02DD,
+	"ogonek": 0x02DB, "caron": 0x02C7, "nbspace": 0x00A0, "sfthyphen": 0x00AD,
+}
+
+func init() {
+	// ASCII: punctuation names in code order, letters and digits by value
+	next := 0
+	for c := 0x20; c < 0x7F; c++ {
+		winAnsiEncoding[c] = rune(c)
+		switch {
+		case c >= '0' && c <= '9':
+			glyphNames[[]string{"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine"}[c-'0']] = rune(c)
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z':
+			glyphNames[string(rune(c))] = rune(c)
+		default:
+			glyphNames[asciiNames[next]] = rune(c)
+			next++
+		}
+	}
+
+	high := []rune(cp1252High)
+	for i := 0; i < 128; i++ {
+		r := rune(0x80 + i)
+		if i < len(high) {
+			r = high[i]
+		}
+		if r == 0xFFFD {
+			continue
+		}
+		winAnsiEncoding[0x80+i] = r
+		if name := winAnsiHighNames[i]; name != "-" {
+			glyphNames[name] = r
+		}
+	}
+	for name, r := range extraNames {
+		glyphNames[name] = r
+	}
+
+	mac := []rune(macRomanHigh)
+	for c := 0x20; c < 0x7F; c++ {
+		macRomanEncoding[c] = rune(c)
+		standardEncoding[c] = rune(c)
+	}
+	for i, r := range mac {
+		macRomanEncoding[0x80+i] = r
+	}
+	for c, name := range standardDiffs {
+		standardEncoding[c] = glyphNames[name]
+	}
+}
+
+// glyphNameToRune maps an Adobe glyph name to its Unicode value, including the
+// "uniXXXX" and "uXXXX" conventions.
+func glyphNameToRune(name string) rune {
+	if r, ok := glyphNames[name]; ok {
+		return r
+	}
+	// Strip suffixes such as "a.sc" or "f_i.alt"
+	if idx := strings.IndexByte(name, '.'); idx > 0 {
+		return glyphNameToRune(name[:idx])
+	}
+	for _, prefix := range []string{"uni", "u"} {
+		if strings.HasPrefix(name, prefix) && len(name) >= len(prefix)+4 {
+			if v, err := strconv.ParseUint(name[len(prefix):len(prefix)+4], 16, 32); err == nil {
+				return rune(v)
+			}
+		}
+	}
+	return 0
+}
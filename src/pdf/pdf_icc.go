@@ -0,0 +1,110 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// SRGBProfile builds an ICC v2 display profile for sRGB IEC61966-2.1.
+//
+// Generating it keeps a binary blob out of the repository and makes every
+// archival PDF carry byte-identical output intent data.
+func SRGBProfile() []byte {
+	type tag struct {
+		sig  string
+		data []byte
+	}
+
+	xyz := func(x, y, z float64) []byte {
+		var b bytes.Buffer
+		b.WriteString("XYZ \x00\x00\x00\x00")
+		for _, v := range []float64{x, y, z} {
+			binary.Write(&b, binary.BigEndian, int32(math.Round(v*65536)))
+		}
+		return b.Bytes()
+	}
+
+	text := func(s string) []byte {
+		return append([]byte("text\x00\x00\x00\x00"+s), 0)
+	}
+
+	desc := func(s string) []byte {
+		var b bytes.Buffer
+		b.WriteString("desc\x00\x00\x00\x00")
+		binary.Write(&b, binary.BigEndian, uint32(len(s)+1))
+		b.WriteString(s)
+		b.WriteByte(0)
+		// Empty Unicode and ScriptCode descriptions
+		b.Write(make([]byte, 4+4+2+1+67))
+		return b.Bytes()
+	}
+
+	// The sRGB transfer function, sampled
+	var trc bytes.Buffer
+	trc.WriteString("curv\x00\x00\x00\x00")
+	const samples = 1024
+	binary.Write(&trc, binary.BigEndian, uint32(samples))
+	for i := 0; i < samples; i++ {
+		v := float64(i) / (samples - 1)
+		if v <= 0.04045 {
+			v /= 12.92
+		} else {
+			v = math.Pow((v+0.055)/1.055, 2.4)
+		}
+		binary.Write(&trc, binary.BigEndian, uint16(math.Round(v*65535)))
+	}
+
+	// Primaries adapted to the D50 connection space (Bradford)
+	tags := []tag{
+		{"desc", desc("sRGB IEC61966-2.1")},
+		{"cprt", text("No copyright, use freely")},
+		{"wtpt", xyz(0.9505, 1.0, 1.0890)},
+		{"rXYZ", xyz(0.4360747, 0.2225045, 0.0139322)},
+		{"gXYZ", xyz(0.3850649, 0.7168786, 0.0971045)},
+		{"bXYZ", xyz(0.1430804, 0.0606169, 0.7141733)},
+		{"rTRC", trc.Bytes()},
+		{"gTRC", trc.Bytes()},
+		{"bTRC", trc.Bytes()},
+	}
+
+	tableLen := 4 + 12*len(tags)
+	offset := 128 + tableLen
+
+	var table, data bytes.Buffer
+	binary.Write(&table, binary.BigEndian, uint32(len(tags)))
+	shared := map[string]int{}
+	for _, t := range tags {
+		// The three TRC tags share one curve
+		off, ok := shared[string(t.data)]
+		if !ok {
+			off = offset + data.Len()
+			shared[string(t.data)] = off
+			data.Write(t.data)
+			for data.Len()%4 != 0 {
+				data.WriteByte(0)
+			}
+		}
+		table.WriteString(t.sig)
+		binary.Write(&table, binary.BigEndian, uint32(off))
+		binary.Write(&table, binary.BigEndian, uint32(len(t.data)))
+	}
+
+	size := 128 + table.Len() + data.Len()
+
+	var header bytes.Buffer
+	binary.Write(&header, binary.BigEndian, uint32(size))
+	header.WriteString("\x00\x00\x00\x00") // preferred CMM
+	header.Write([]byte{2, 0x10, 0, 0})    // version 2.1
+	header.WriteString("mntrRGB XYZ ")
+	// Fixed creation date keeps the profile deterministic: 2024-01-01 00:00:00
+	for _, v := range []uint16{2024, 1, 1, 0, 0, 0} {
+		binary.Write(&header, binary.BigEndian, v)
+	}
+	header.WriteString("acsp")
+	header.Write(make([]byte, 4+4+4+4+8+4)) // platform, flags, manufacturer, model, attributes, intent
+	header.Write(xyz(0.9642, 1.0, 0.8249)[8:])
+	header.Write(make([]byte, 128-header.Len()))
+
+	return append(append(header.Bytes(), table.Bytes()...), data.Bytes()...)
+}
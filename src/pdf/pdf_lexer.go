@@ -0,0 +1,338 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// lexer reads PDF objects out of a byte slice. It is shared by the file
+// reader and the content stream interpreter.
+type lexer struct {
+	data []byte
+	pos  int
+}
+
+func newLexer(data []byte) *lexer {
+	return &lexer{data: data}
+}
+
+func isWhitespace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isDelimiter(c byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), c) >= 0
+}
+
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isWhitespace(c) {
+			l.pos++
+		} else if c == '%' {
+			// Comments run to the end of the line
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		} else {
+			return
+		}
+	}
+}
+
+// keyword reads a run of regular characters (numbers, operators, true, ...).
+func (l *lexer) keyword() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isWhitespace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+// next returns the next object or operator. Array and dictionary ends are
+// reported as the operators "]" and ">>".
+func (l *lexer) next() (Object, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, io.EOF
+	}
+
+	switch c := l.data[l.pos]; c {
+	case '/':
+		l.pos++
+		return l.name(), nil
+	case '(':
+		l.pos++
+		return l.literalString()
+	case '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return l.dict()
+		}
+		l.pos++
+		return l.hexString()
+	case '>':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return Operator(">>"), nil
+		}
+		l.pos++
+		return nil, fmt.Errorf("unexpected '>' at offset %d", l.pos-1)
+	case '[':
+		l.pos++
+		return l.array()
+	case ']':
+		l.pos++
+		return Operator("]"), nil
+	case '{', '}':
+		// Only used by PostScript calculator functions, which we never evaluate
+		l.pos++
+		return Operator(string(c)), nil
+	}
+
+	kw := l.keyword()
+	if kw == "" {
+		l.pos++
+		return nil, fmt.Errorf("unexpected character %q at offset %d", l.data[l.pos-1], l.pos-1)
+	}
+
+	switch kw {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+
+	if n, ok := parseNumber(kw); ok {
+		if i, isInt := n.(int64); isInt {
+			return l.maybeRef(i), nil
+		}
+		return n, nil
+	}
+
+	return Operator(kw), nil
+}
+
+// maybeRef turns "num gen R" into a Ref, leaving the lexer untouched otherwise.
+func (l *lexer) maybeRef(num int64) Object {
+	save := l.pos
+	l.skipSpace()
+	gen := l.keyword()
+	if g, err := strconv.Atoi(gen); err == nil && g >= 0 {
+		l.skipSpace()
+		if l.keyword() == "R" {
+			return Ref{int(num), g}
+		}
+	}
+	l.pos = save
+	return num
+}
+
+func parseNumber(s string) (Object, bool) {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, true
+	}
+	c := s[0]
+	if (c < '0' || c > '9') && c != '-' && c != '+' && c != '.' {
+		return nil, false
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, true
+	}
+	// Some writers emit "--5" or "5-"; treat as best effort
+	cleaned := bytes.Trim([]byte(s), "+-")
+	if f, err := strconv.ParseFloat(string(cleaned), 64); err == nil {
+		if s[0] == '-' {
+			f = -f
+		}
+		return f, true
+	}
+	return nil, false
+}
+
+func (l *lexer) name() Name {
+	var buf []byte
+	for l.pos < len(l.data) && !isWhitespace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		c := l.data[l.pos]
+		if c == '#' && l.pos+2 < len(l.data) {
+			if v, err := strconv.ParseUint(string(l.data[l.pos+1:l.pos+3]), 16, 8); err == nil {
+				buf = append(buf, byte(v))
+				l.pos += 3
+				continue
+			}
+		}
+		buf = append(buf, c)
+		l.pos++
+	}
+	return Name(buf)
+}
+
+func (l *lexer) literalString() (Object, error) {
+	var buf []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return String(buf), nil
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				break
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				// Line continuation
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		buf = append(buf, c)
+	}
+	return nil, fmt.Errorf("unterminated string")
+}
+
+func (l *lexer) hexString() (Object, error) {
+	var buf []byte
+	var hi int = -1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		if c == '>' {
+			if hi >= 0 {
+				buf = append(buf, byte(hi<<4))
+			}
+			return String(buf), nil
+		}
+		v := unhex(c)
+		if v < 0 {
+			continue
+		}
+		if hi < 0 {
+			hi = v
+		} else {
+			buf = append(buf, byte(hi<<4|v))
+			hi = -1
+		}
+	}
+	return nil, fmt.Errorf("unterminated hex string")
+}
+
+func unhex(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'f':
+		return int(c-'a') + 10
+	case c >= 'A' && c <= 'F':
+		return int(c-'A') + 10
+	}
+	return -1
+}
+
+func (l *lexer) array() (Object, error) {
+	arr := Array{}
+	for {
+		o, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		if op, ok := o.(Operator); ok && op == "]" {
+			return arr, nil
+		}
+		arr = append(arr, o)
+	}
+}
+
+func (l *lexer) dict() (Object, error) {
+	d := Dict{}
+	for {
+		o, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		if op, ok := o.(Operator); ok && op == ">>" {
+			return d, nil
+		}
+		key, ok := o.(Name)
+		if !ok {
+			// Skip garbage keys instead of failing the whole file
+			continue
+		}
+		v, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		if op, ok := v.(Operator); ok && op == ">>" {
+			return d, nil
+		}
+		d[key] = v
+	}
+}
+
+// skipInlineImage moves past the rest of an inline image, from just after
+// its BI operator to the end of its EI.
+func (l *lexer) skipInlineImage() {
+	for {
+		o, err := l.next()
+		if err != nil {
+			return
+		}
+		if op, ok := o.(Operator); ok && op == "ID" {
+			break
+		}
+	}
+	l.pos++
+
+	// The data ends at an "EI" surrounded by whitespace
+	for l.pos < len(l.data) {
+		idx := bytes.Index(l.data[l.pos:], []byte("EI"))
+		if idx < 0 {
+			l.pos = len(l.data)
+			return
+		}
+		end := l.pos + idx
+		l.pos = end + 2
+		before := end == 0 || isWhitespace(l.data[end-1])
+		after := l.pos >= len(l.data) || isWhitespace(l.data[l.pos]) || isDelimiter(l.data[l.pos])
+		if before && after {
+			return
+		}
+	}
+}
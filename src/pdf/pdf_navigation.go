@@ -0,0 +1,141 @@
+package pdf
+
+import (
+	"fmt"
+	"time"
+)
+
+// OutlineItem is a bookmark that jumps to a position on a page.
+type OutlineItem struct {
+	Title string
+	Page  int
+	// Distance of the destination from the top of the page, in points
+	Top  float64
+	Kids []*OutlineItem
+}
+
+// AddOutline replaces the document outline with items and has viewers
+// open the document with the outline panel shown.
+func AddOutline(data []byte, items []*OutlineItem) ([]byte, error) {
+	r, err := NewReader(data)
+	if err != nil {
+		return nil, err
+	}
+	e := NewEditor(r)
+
+	catalog := e.Catalog()
+	if catalog == nil {
+		return nil, fmt.Errorf("document catalog not found")
+	}
+	if len(items) == 0 {
+		delete(catalog, "Outlines")
+		return e.Bytes()
+	}
+
+	var addLevel func(items []*OutlineItem, parent Ref, parentDict Dict) (int, error)
+	addLevel = func(items []*OutlineItem, parent Ref, parentDict Dict) (int, error) {
+		refs := make([]Ref, len(items))
+		for i := range items {
+			refs[i] = e.Add(nil)
+		}
+
+		// Every level is shown expanded, so counts include all descendants
+		count := len(items)
+		for i, item := range items {
+			if item.Page < 0 || item.Page >= e.NumPages() {
+				return 0, fmt.Errorf("outline item %q refers to missing page %d", item.Title, item.Page)
+			}
+			pageRef, _ := e.Page(item.Page)
+			box := r.Page(item.Page).MediaBox()
+
+			d := Dict{
+				"Title":  TextString(item.Title),
+				"Parent": parent,
+				"Dest":   Array{pageRef, Name("XYZ"), box[0], box[3] - item.Top, nil},
+			}
+			if i > 0 {
+				d["Prev"] = refs[i-1]
+			}
+			if i < len(items)-1 {
+				d["Next"] = refs[i+1]
+			}
+			if len(item.Kids) > 0 {
+				n, err := addLevel(item.Kids, refs[i], d)
+				if err != nil {
+					return 0, err
+				}
+				count += n
+			}
+			e.Set(refs[i], d)
+		}
+
+		parentDict["First"] = refs[0]
+		parentDict["Last"] = refs[len(refs)-1]
+		parentDict["Count"] = int64(count)
+		return count, nil
+	}
+
+	root := Dict{"Type": Name("Outlines")}
+	rootRef := e.Add(root)
+	if _, err := addLevel(items, rootRef, root); err != nil {
+		return nil, err
+	}
+	catalog["Outlines"] = rootRef
+	catalog["PageMode"] = Name("UseOutlines")
+
+	return e.Bytes()
+}
+
+// DocumentInfo is the content of the document information dictionary.
+// Extra holds entries outside the standard set, such as how the document
+// was produced.
+type DocumentInfo struct {
+	Title    string
+	Author   string
+	Subject  string
+	Creator  string
+	Producer string
+	Created  time.Time
+	Modified time.Time
+	Extra    map[string]string
+}
+
+// standardInfoKeys are the Info entries that have XMP equivalents.
+var standardInfoKeys = map[Name]bool{
+	"Title": true, "Author": true, "Subject": true, "Keywords": true,
+	"Creator": true, "Producer": true, "CreationDate": true, "ModDate": true, "Trapped": true,
+}
+
+// SetInfo replaces the document information dictionary.
+func SetInfo(data []byte, info DocumentInfo) ([]byte, error) {
+	r, err := NewReader(data)
+	if err != nil {
+		return nil, err
+	}
+	e := NewEditor(r)
+
+	d := Dict{}
+	for key, value := range map[Name]string{
+		"Title": info.Title, "Author": info.Author, "Subject": info.Subject,
+		"Creator": info.Creator, "Producer": info.Producer,
+	} {
+		if value != "" {
+			d[key] = TextString(value)
+		}
+	}
+	if !info.Created.IsZero() {
+		d["CreationDate"] = String(pdfDate(info.Created))
+	}
+	if !info.Modified.IsZero() {
+		d["ModDate"] = String(pdfDate(info.Modified))
+	}
+	for key, value := range info.Extra {
+		if standardInfoKeys[Name(key)] {
+			return nil, fmt.Errorf("info entry %s is not an extra entry", key)
+		}
+		d[Name(key)] = TextString(value)
+	}
+	e.Trailer()["Info"] = e.Add(d)
+
+	return e.Bytes()
+}
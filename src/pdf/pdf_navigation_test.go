@@ -0,0 +1,70 @@
+package pdf
+
+import (
+	"testing"
+	"time"
+)
+
+// Unit test for writing bookmarks and document info
+func TestOutlineAndInfo(t *testing.T) {
+	data := generateTextPDF(t, map[float64]string{100: "Introduction", 400: "Scope"})
+
+	outlined, err := AddOutline(data, []*OutlineItem{
+		{Title: "Introduction", Page: 0, Top: 100, Kids: []*OutlineItem{
+			{Title: "Scope", Page: 0, Top: 400},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Error adding outline: %v", err)
+	}
+	if _, err := AddOutline(data, []*OutlineItem{{Title: "Missing", Page: 3}}); err == nil {
+		t.Errorf("Expected an error for an outline item on a missing page")
+	}
+
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	withInfo, err := SetInfo(outlined, DocumentInfo{
+		Title:    "scan-0042",
+		Creator:  "gocr-lib",
+		Producer: "gocr-lib",
+		Created:  created,
+		Modified: created,
+		Extra:    map[string]string{"OCRLanguage": "eng"},
+	})
+	if err != nil {
+		t.Fatalf("Error setting info: %v", err)
+	}
+
+	r, err := NewReader(withInfo)
+	if err != nil {
+		t.Fatalf("Error reading pdf: %v", err)
+	}
+	catalog, _ := r.Resolve(r.Trailer()["Root"]).(Dict)
+	outlines, _ := r.Resolve(catalog["Outlines"]).(Dict)
+	if outlines.Int("Count", 0) != 2 {
+		t.Errorf("Expected 2 visible bookmarks, got %v", outlines["Count"])
+	}
+	top, _ := r.Resolve(outlines["First"]).(Dict)
+	kid, _ := r.Resolve(top["First"]).(Dict)
+	if title, _ := kid["Title"].(String); title.Text() != "Scope" {
+		t.Errorf("Expected nested bookmark Scope, got %q", title.Text())
+	}
+
+	info, _ := r.Resolve(r.Trailer()["Info"]).(Dict)
+	if lang, _ := info["OCRLanguage"].(String); lang.Text() != "eng" {
+		t.Errorf("Expected OCRLanguage eng, got %q", lang.Text())
+	}
+
+	// Extra entries survive the archival conversion
+	archived, err := ConvertToPDFA(withInfo, PDFA2B, ArchiveInfo{Title: "scan-0042", Producer: "gocr-lib", Date: created})
+	if err != nil {
+		t.Fatalf("Error converting to PDF/A: %v", err)
+	}
+	if problems := CheckPDFA(archived); len(problems) != 0 {
+		t.Errorf("PDF/A check failed: %v", problems)
+	}
+	r, _ = NewReader(archived)
+	info, _ = r.Resolve(r.Trailer()["Info"]).(Dict)
+	if _, ok := info["OCRLanguage"]; !ok {
+		t.Errorf("OCRLanguage was dropped by the PDF/A conversion")
+	}
+}
@@ -0,0 +1,121 @@
+package pdf
+
+import (
+	"fmt"
+	"unicode/utf16"
+)
+
+// Object is any value that can appear in a PDF file: nil, bool, int64,
+// float64, String, Name, Array, Dict, *Stream or Ref.
+type Object interface{}
+
+// Name is a PDF name object, stored without the leading slash.
+type Name string
+
+// String is a PDF literal or hexadecimal string, kept as raw bytes.
+type String []byte
+
+// Array is a PDF array object.
+type Array []Object
+
+// Dict is a PDF dictionary object.
+type Dict map[Name]Object
+
+// Ref is an indirect reference to an object ("12 0 R").
+type Ref struct {
+	Num, Gen int
+}
+
+// Stream is a dictionary followed by a (still encoded) byte sequence.
+type Stream struct {
+	Dict Dict
+	Raw  []byte
+}
+
+// Operator is a bare keyword found in a content stream (Tj, cm, BT, ...).
+type Operator string
+
+func (r Ref) String() string {
+	return fmt.Sprintf("%d %d R", r.Num, r.Gen)
+}
+
+// Number converts an int64 or float64 object to float64.
+func Number(o Object) (float64, bool) {
+	switch v := o.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// Numbers converts an array of numbers to a float64 slice.
+func Numbers(o Object) []float64 {
+	arr, ok := o.(Array)
+	if !ok {
+		return nil
+	}
+	out := make([]float64, 0, len(arr))
+	for _, v := range arr {
+		n, _ := Number(v)
+		out = append(out, n)
+	}
+	return out
+}
+
+// Name returns the name stored under key, or "" when missing.
+func (d Dict) Name(key Name) Name {
+	n, _ := d[key].(Name)
+	return n
+}
+
+// Int returns the integer stored under key, or def when missing.
+func (d Dict) Int(key Name, def int) int {
+	if n, ok := Number(d[key]); ok {
+		return int(n)
+	}
+	return def
+}
+
+// Clone returns a shallow copy of the dictionary.
+func (d Dict) Clone() Dict {
+	c := make(Dict, len(d))
+	for k, v := range d {
+		c[k] = v
+	}
+	return c
+}
+
+// TextString encodes s as a PDF text string: plain bytes for ASCII,
+// UTF-16BE with a byte order mark otherwise.
+func TextString(s string) String {
+	ascii := true
+	for _, c := range s {
+		if c > 0x7E {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return String(s)
+	}
+
+	out := String{0xFE, 0xFF}
+	for _, u := range utf16.Encode([]rune(s)) {
+		out = append(out, byte(u>>8), byte(u))
+	}
+	return out
+}
+
+// Text decodes a PDF text string (UTF-16BE with BOM, or single bytes).
+func (s String) Text() string {
+	if len(s) >= 2 && s[0] == 0xFE && s[1] == 0xFF {
+		return decodeUTF16(s[2:])
+	}
+	runes := make([]rune, len(s))
+	for i, c := range s {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
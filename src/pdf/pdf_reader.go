@@ -0,0 +1,362 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+var ErrEncrypted = errors.New("encrypted PDFs are not supported")
+
+// Reader gives access to the objects and pages of a PDF file.
+//
+// Instead of trusting the cross-reference table, the reader scans the whole
+// file for "N G obj" definitions. The last definition in file order wins, which
+// is what incremental updates rely on, and it keeps working on files with a
+// broken or missing xref.
+type Reader struct {
+	data    []byte
+	objects map[int]Object
+	offsets map[int]int
+	trailer Dict
+	pages   []Dict
+	refs    []Ref
+}
+
+// Page is a single page with its inheritable attributes already resolved.
+type Page struct {
+	Index int
+	Ref   Ref
+	Dict  Dict
+	r     *Reader
+}
+
+var objHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+func Open(filePath string) (*Reader, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pdf: %w", err)
+	}
+	return NewReader(data)
+}
+
+func NewReader(data []byte) (*Reader, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, " \r\n\t"), []byte("%PDF-")) {
+		return nil, fmt.Errorf("not a PDF file")
+	}
+
+	r := &Reader{data: data, objects: map[int]Object{}, offsets: map[int]int{}, trailer: Dict{}}
+	r.scanObjects()
+	r.expandObjectStreams()
+	r.scanTrailers()
+
+	if _, ok := r.trailer["Encrypt"]; ok {
+		return nil, ErrEncrypted
+	}
+
+	root, ok := r.Resolve(r.trailer["Root"]).(Dict)
+	if !ok {
+		return nil, fmt.Errorf("document catalog not found")
+	}
+	r.collectPages(root["Pages"], Dict{}, map[Ref]bool{})
+	if len(r.pages) == 0 {
+		return nil, fmt.Errorf("document has no pages")
+	}
+
+	return r, nil
+}
+
+func (r *Reader) scanObjects() {
+	pos := 0
+	for pos < len(r.data) {
+		loc := objHeader.FindSubmatchIndex(r.data[pos:])
+		if loc == nil {
+			return
+		}
+		num, _ := strconv.Atoi(string(r.data[pos+loc[2] : pos+loc[3]]))
+		start := pos + loc[0]
+		pos += loc[1]
+
+		l := &lexer{data: r.data, pos: pos}
+		obj, err := l.next()
+		if err != nil {
+			continue
+		}
+		pos = l.pos
+
+		if d, ok := obj.(Dict); ok {
+			l.skipSpace()
+			save := l.pos
+			if l.keyword() == "stream" {
+				raw, end := r.streamData(d, l.pos)
+				obj = &Stream{Dict: d, Raw: raw}
+				pos = end
+			} else {
+				l.pos = save
+			}
+		}
+
+		r.objects[num] = obj
+		r.offsets[num] = start
+	}
+}
+
+// streamData returns the stream bytes following the "stream" keyword and the
+// offset right after "endstream".
+func (r *Reader) streamData(d Dict, pos int) ([]byte, int) {
+	// The keyword is followed by CRLF or LF (a lone CR is tolerated)
+	if pos < len(r.data) && r.data[pos] == '\r' {
+		pos++
+	}
+	if pos < len(r.data) && r.data[pos] == '\n' {
+		pos++
+	}
+
+	if length, ok := d["Length"].(int64); ok && length >= 0 && pos+int(length) <= len(r.data) {
+		end := pos + int(length)
+		rest := bytes.TrimLeft(r.data[end:min(end+32, len(r.data))], " \r\n\t")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			return r.data[pos:end], end + bytes.Index(r.data[end:], []byte("endstream")) + len("endstream")
+		}
+	}
+
+	// Length is indirect or wrong: fall back to searching for the keyword
+	idx := bytes.Index(r.data[pos:], []byte("endstream"))
+	if idx < 0 {
+		return r.data[pos:], len(r.data)
+	}
+	raw := r.data[pos : pos+idx]
+	raw = bytes.TrimSuffix(raw, []byte("\n"))
+	raw = bytes.TrimSuffix(raw, []byte("\r"))
+	return raw, pos + idx + len("endstream")
+}
+
+// expandObjectStreams lifts objects stored inside /Type /ObjStm streams.
+func (r *Reader) expandObjectStreams() {
+	nums := make([]int, 0)
+	for num, obj := range r.objects {
+		if s, ok := obj.(*Stream); ok && s.Dict.Name("Type") == "ObjStm" {
+			nums = append(nums, num)
+		}
+	}
+	sort.Slice(nums, func(i, j int) bool { return r.offsets[nums[i]] < r.offsets[nums[j]] })
+
+	for _, num := range nums {
+		s := r.objects[num].(*Stream)
+		data, err := r.DecodeStream(s)
+		if err != nil {
+			continue
+		}
+		n := s.Dict.Int("N", 0)
+		first := s.Dict.Int("First", 0)
+
+		l := newLexer(data)
+		type entry struct{ num, off int }
+		entries := make([]entry, 0, n)
+		for i := 0; i < n; i++ {
+			a, err1 := l.next()
+			b, err2 := l.next()
+			objNum, ok1 := a.(int64)
+			off, ok2 := b.(int64)
+			if err1 != nil || err2 != nil || !ok1 || !ok2 {
+				break
+			}
+			entries = append(entries, entry{int(objNum), int(off)})
+		}
+
+		for _, e := range entries {
+			// A direct definition later in the file belongs to a newer revision
+			if prev, ok := r.offsets[e.num]; ok && prev > r.offsets[num] {
+				continue
+			}
+			ol := &lexer{data: data, pos: first + e.off}
+			obj, err := ol.next()
+			if err != nil {
+				continue
+			}
+			r.objects[e.num] = obj
+			r.offsets[e.num] = r.offsets[num]
+		}
+	}
+}
+
+// scanTrailers merges classic trailer dictionaries and cross-reference stream
+// dictionaries, newest last.
+func (r *Reader) scanTrailers() {
+	type found struct {
+		off int
+		d   Dict
+	}
+	var trailers []found
+
+	pos := 0
+	for {
+		idx := bytes.Index(r.data[pos:], []byte("trailer"))
+		if idx < 0 {
+			break
+		}
+		l := &lexer{data: r.data, pos: pos + idx + len("trailer")}
+		if d, err := l.next(); err == nil {
+			if dict, ok := d.(Dict); ok {
+				trailers = append(trailers, found{pos + idx, dict})
+			}
+		}
+		pos += idx + len("trailer")
+	}
+
+	for num, obj := range r.objects {
+		if s, ok := obj.(*Stream); ok && s.Dict.Name("Type") == "XRef" {
+			trailers = append(trailers, found{r.offsets[num], s.Dict})
+		}
+	}
+
+	sort.Slice(trailers, func(i, j int) bool { return trailers[i].off < trailers[j].off })
+	for _, t := range trailers {
+		for _, key := range []Name{"Root", "Info", "ID", "Encrypt"} {
+			if v, ok := t.d[key]; ok {
+				r.trailer[key] = v
+			}
+		}
+	}
+
+	// Last resort for files without any trailer: look for the catalog itself
+	if _, ok := r.trailer["Root"]; !ok {
+		for num, obj := range r.objects {
+			if d, ok := obj.(Dict); ok && d.Name("Type") == "Catalog" {
+				r.trailer["Root"] = Ref{num, 0}
+			}
+		}
+	}
+}
+
+var inheritable = []Name{"Resources", "MediaBox", "CropBox", "Rotate"}
+
+func (r *Reader) collectPages(node Object, inherited Dict, seen map[Ref]bool) {
+	d, ok := r.Resolve(node).(Dict)
+	if !ok {
+		return
+	}
+
+	attrs := inherited.Clone()
+	for _, key := range inheritable {
+		if v, ok := d[key]; ok {
+			attrs[key] = v
+		}
+	}
+
+	kids, isTree := r.Resolve(d["Kids"]).(Array)
+	if !isTree || d.Name("Type") == "Page" {
+		page := d.Clone()
+		for k, v := range attrs {
+			page[k] = v
+		}
+		ref, _ := node.(Ref)
+		r.pages = append(r.pages, page)
+		r.refs = append(r.refs, ref)
+		return
+	}
+
+	for _, kid := range kids {
+		// Guard against cyclic page trees
+		if ref, ok := kid.(Ref); ok {
+			if seen[ref] {
+				continue
+			}
+			seen[ref] = true
+		}
+		r.collectPages(kid, attrs, seen)
+	}
+}
+
+// Resolve follows indirect references until it reaches a direct object.
+func (r *Reader) Resolve(o Object) Object {
+	for i := 0; i < 32; i++ {
+		ref, ok := o.(Ref)
+		if !ok {
+			return o
+		}
+		o = r.objects[ref.Num]
+	}
+	return nil
+}
+
+// Object returns the object with the given number.
+func (r *Reader) Object(num int) Object {
+	return r.objects[num]
+}
+
+// ObjectNumbers lists every object number defined in the file, sorted.
+func (r *Reader) ObjectNumbers() []int {
+	nums := make([]int, 0, len(r.objects))
+	for n := range r.objects {
+		nums = append(nums, n)
+	}
+	sort.Ints(nums)
+	return nums
+}
+
+// Trailer returns the merged trailer dictionary.
+func (r *Reader) Trailer() Dict {
+	return r.trailer
+}
+
+func (r *Reader) NumPages() int {
+	return len(r.pages)
+}
+
+func (r *Reader) Page(index int) Page {
+	return Page{Index: index, Ref: r.refs[index], Dict: r.pages[index], r: r}
+}
+
+// MediaBox returns the visible page area (CropBox when present) as
+// llx, lly, urx, ury in PDF points.
+func (p Page) MediaBox() [4]float64 {
+	box := [4]float64{0, 0, 612, 792}
+	for _, key := range []Name{"MediaBox", "CropBox"} {
+		if nums := Numbers(p.r.Resolve(p.Dict[key])); len(nums) == 4 {
+			box = [4]float64{min(nums[0], nums[2]), min(nums[1], nums[3]), max(nums[0], nums[2]), max(nums[1], nums[3])}
+		}
+	}
+	return box
+}
+
+func (p Page) Rotate() int {
+	n, _ := Number(p.r.Resolve(p.Dict["Rotate"]))
+	return ((int(n) % 360) + 360) % 360
+}
+
+func (p Page) Resources() Dict {
+	d, _ := p.r.Resolve(p.Dict["Resources"]).(Dict)
+	return d
+}
+
+// Content returns the decoded page content, joining multiple streams.
+func (p Page) Content() ([]byte, error) {
+	var streams []Object
+	switch c := p.r.Resolve(p.Dict["Contents"]).(type) {
+	case Array:
+		streams = c
+	case *Stream:
+		streams = []Object{c}
+	}
+
+	var buf bytes.Buffer
+	for _, s := range streams {
+		stream, ok := p.r.Resolve(s).(*Stream)
+		if !ok {
+			continue
+		}
+		data, err := p.r.DecodeStream(stream)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,74 @@
+package pdf
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/signintech/gopdf"
+)
+
+// Builds a born-digital PDF with gopdf, the same library the extractors write with
+func generateTextPDF(t *testing.T, lines map[float64]string) []byte {
+	pdf := gopdf.GoPdf{}
+	pdf.Start(gopdf.Config{PageSize: *gopdf.PageSizeA4})
+	pdf.AddPage()
+	if err := pdf.AddTTFFont("Arial", "../../fonts/arial.ttf"); err != nil {
+		t.Fatalf("Error loading font: %v", err)
+	}
+	if err := pdf.SetFont("Arial", "", 14); err != nil {
+		t.Fatalf("Error setting font: %v", err)
+	}
+	for y, text := range lines {
+		pdf.SetXY(72, y)
+		pdf.Cell(nil, text)
+	}
+	return pdf.GetBytesPdf()
+}
+
+// Unit test for reading words and their positions back from a text layer
+func TestPageTextExtraction(t *testing.T) {
+	data := generateTextPDF(t, map[float64]string{
+		100: "Invoice Number 4711",
+		300: "Total due: 12.50 EUR",
+	})
+
+	reader, err := NewReader(data)
+	if err != nil {
+		t.Fatalf("Error reading pdf: %v", err)
+	}
+	if reader.NumPages() != 1 {
+		t.Fatalf("Expected 1 page, got %d", reader.NumPages())
+	}
+
+	content, err := reader.Page(0).Analyze()
+	if err != nil {
+		t.Fatalf("Error analyzing page: %v", err)
+	}
+
+	var texts []string
+	for _, w := range content.Words {
+		texts = append(texts, w.Text)
+	}
+	got := strings.Join(texts, " ")
+	if got != "Invoice Number 4711 Total due: 12.50 EUR" && got != "Total due: 12.50 EUR Invoice Number 4711" {
+		t.Fatalf("Unexpected words: %q", got)
+	}
+
+	for _, w := range content.Words {
+		if w.Invisible || content.UnmappedGlyphs != 0 {
+			t.Errorf("Word %q should be visible, extractable text", w.Text)
+		}
+		if math.Abs(w.FontSize-14) > 0.5 {
+			t.Errorf("Word %q has font size %.2f, expected 14", w.Text, w.FontSize)
+		}
+		// gopdf positions the top of the cell at y
+		if w.Text == "Invoice" && (math.Abs(w.Box.X0-72) > 1 || w.Box.Y0 < 95 || w.Box.Y1 > 120) {
+			t.Errorf("Word %q at unexpected position %+v", w.Text, w.Box)
+		}
+	}
+
+	if content.ImageCoverage() != 0 {
+		t.Errorf("Expected no images, got coverage %.2f", content.ImageCoverage())
+	}
+}
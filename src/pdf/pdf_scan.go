@@ -0,0 +1,499 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+)
+
+// CompressionProfile selects how page scans are stored.
+type CompressionProfile string
+
+const (
+	// Colour or greyscale JPEG
+	ProfileJPEG CompressionProfile = "jpeg"
+	// Black and white, CCITT Group 4. Only suited to pages of plain text.
+	ProfileBitonal CompressionProfile = "bitonal"
+	// Mixed raster content: a full resolution Group 4 mask holding the text
+	// in its colour, over a low resolution JPEG background
+	ProfileMRC CompressionProfile = "mrc"
+	// Bitonal for pages of plain text, MRC for everything else
+	ProfileAuto CompressionProfile = "auto"
+)
+
+const (
+	defaultScanDPI       = 300
+	defaultBackgroundDPI = 100
+	defaultJPEGQuality   = 75
+	// Pages with more pixels than this in colour or in mid-grey are not
+	// plain text
+	maxColorFraction   = 0.01
+	maxMidToneFraction = 0.15
+)
+
+// ScanOptions controls how page scans are stored.
+type ScanOptions struct {
+	Profile CompressionProfile
+	// Resolution of the scans; 300 when zero
+	DPI float64
+	// Scans are downsampled to at most this resolution; zero keeps them as they are
+	MaxDPI float64
+	// Resolution of the MRC background; 100 when zero
+	BackgroundDPI float64
+	// JPEG quality from 1 to 100; 75 when zero
+	JPEGQuality int
+}
+
+// PageScan is the scanned image of a page.
+type PageScan struct {
+	Image image.Image
+	// Where the text is, in image pixels. When set, the MRC mask is limited
+	// to these areas so pictures stay in the background layer.
+	Text []image.Rectangle
+}
+
+// ScanStats reports how well the scan of a page compressed.
+type ScanStats struct {
+	Page    int
+	Profile CompressionProfile
+	// Size of the uncompressed samples and of the image streams written
+	RawBytes    int
+	StoredBytes int
+}
+
+// Ratio is the compression ratio achieved, uncompressed to stored size.
+func (s ScanStats) Ratio() float64 {
+	if s.StoredBytes == 0 {
+		return 0
+	}
+	return float64(s.RawBytes) / float64(s.StoredBytes)
+}
+
+// AddScans places one scan under each page, stretched over the page, and
+// makes the existing text invisible so it becomes a searchable layer over
+// the image.
+func AddScans(data []byte, scans []PageScan, opts ScanOptions) ([]byte, []ScanStats, error) {
+	if opts.DPI == 0 {
+		opts.DPI = defaultScanDPI
+	}
+	if opts.BackgroundDPI == 0 {
+		opts.BackgroundDPI = defaultBackgroundDPI
+	}
+	if opts.JPEGQuality == 0 {
+		opts.JPEGQuality = defaultJPEGQuality
+	}
+	if opts.JPEGQuality < 1 || opts.JPEGQuality > 100 {
+		return nil, nil, fmt.Errorf("JPEG quality %d is not between 1 and 100", opts.JPEGQuality)
+	}
+	switch opts.Profile {
+	case ProfileJPEG, ProfileBitonal, ProfileMRC, ProfileAuto:
+	default:
+		return nil, nil, fmt.Errorf("unknown compression profile %q", opts.Profile)
+	}
+
+	r, err := NewReader(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(scans) != r.NumPages() {
+		return nil, nil, fmt.Errorf("got %d scans for %d pages", len(scans), r.NumPages())
+	}
+	e := NewEditor(r)
+
+	var stats []ScanStats
+	for i, pageScan := range scans {
+		scan := pageScan.Image
+		textAreas := pageScan.Text
+		content, err := r.Page(i).Content()
+		if err != nil {
+			return nil, nil, err
+		}
+		box := r.Page(i).MediaBox()
+		width, height := box[2]-box[0], box[3]-box[1]
+
+		if opts.MaxDPI > 0 && opts.DPI > opts.MaxDPI {
+			factor := opts.MaxDPI / opts.DPI
+			sb := scan.Bounds()
+			scan = downsample(scan, nil, factor)
+			var scaled []image.Rectangle
+			for _, t := range textAreas {
+				t = t.Sub(sb.Min)
+				scaled = append(scaled, image.Rect(
+					int(float64(t.Min.X)*factor), int(float64(t.Min.Y)*factor),
+					int(float64(t.Max.X)*factor+1), int(float64(t.Max.Y)*factor+1)))
+			}
+			textAreas = scaled
+		}
+
+		profile := opts.Profile
+		if profile == ProfileAuto {
+			profile = ProfileMRC
+			if isPlainText(scan) {
+				profile = ProfileBitonal
+			}
+		}
+
+		b := scan.Bounds()
+		channels := 3
+		if isGray(scan) {
+			channels = 1
+		}
+		pageStats := ScanStats{Page: i, Profile: profile, RawBytes: b.Dx() * b.Dy() * channels}
+
+		xobjects := Dict{}
+		var draw bytes.Buffer
+		place := fmt.Sprintf("q %g 0 0 %g %g %g cm", width, height, box[0], box[1])
+
+		switch profile {
+		case ProfileJPEG:
+			img, err := jpegImage(scan, opts.JPEGQuality)
+			if err != nil {
+				return nil, nil, err
+			}
+			xobjects["Scan"] = e.Add(img)
+			pageStats.StoredBytes = len(img.Raw)
+			fmt.Fprintf(&draw, "%s /Scan Do Q\n", place)
+		case ProfileBitonal:
+			mask := binarize(scan)
+			img := &Stream{Dict: g4Dict(b.Dx(), b.Dy()), Raw: encodeG4(mask, b.Dx())}
+			img.Dict["ColorSpace"] = Name("DeviceGray")
+			img.Dict["BitsPerComponent"] = int64(1)
+			xobjects["Scan"] = e.Add(img)
+			pageStats.StoredBytes = len(img.Raw)
+			fmt.Fprintf(&draw, "%s /Scan Do Q\n", place)
+		case ProfileMRC:
+			mask := binarize(scan)
+			if len(textAreas) > 0 {
+				limitMask(mask, scan.Bounds(), textAreas)
+			}
+			background := downsample(scan, mask, min(1, opts.BackgroundDPI/min(opts.DPI, nonZero(opts.MaxDPI, opts.DPI))))
+			bg, err := jpegImage(background, opts.JPEGQuality)
+			if err != nil {
+				return nil, nil, err
+			}
+			fg := &Stream{Dict: g4Dict(b.Dx(), b.Dy()), Raw: encodeG4(mask, b.Dx())}
+			fg.Dict["ImageMask"] = true
+			xobjects["Scan"] = e.Add(bg)
+			xobjects["ScanMask"] = e.Add(fg)
+			pageStats.StoredBytes = len(bg.Raw) + len(fg.Raw)
+
+			c := foregroundColor(scan, mask)
+			fmt.Fprintf(&draw, "%s /Scan Do Q\n", place)
+			fmt.Fprintf(&draw, "%s %.3f %.3f %.3f rg /ScanMask Do Q\n", place,
+				float64(c.R)/255, float64(c.G)/255, float64(c.B)/255)
+		}
+		stats = append(stats, pageStats)
+
+		// The text stays selectable and searchable but is not painted
+		var marked bytes.Buffer
+		marked.Write(draw.Bytes())
+		marked.Write(invisibleText(content))
+		compressed, err := compress(marked.Bytes())
+		if err != nil {
+			return nil, nil, err
+		}
+
+		_, page := e.Page(i)
+		page["Contents"] = e.Add(&Stream{Dict: Dict{"Filter": Name("FlateDecode")}, Raw: compressed})
+
+		// Resources are often shared between pages, so each page gets a copy
+		resources, _ := e.Resolve(page["Resources"]).(Dict)
+		resources = resources.Clone()
+		existing, _ := e.Resolve(resources["XObject"]).(Dict)
+		for name, ref := range existing {
+			xobjects[name] = ref
+		}
+		resources["XObject"] = xobjects
+		page["Resources"] = resources
+	}
+
+	out, err := e.Bytes()
+	return out, stats, err
+}
+
+// limitMask clears the mask outside of the text areas.
+func limitMask(mask [][]bool, bounds image.Rectangle, areas []image.Rectangle) {
+	for y, row := range mask {
+		for x := range row {
+			if !row[x] {
+				continue
+			}
+			p := image.Pt(bounds.Min.X+x, bounds.Min.Y+y)
+			inside := false
+			for _, a := range areas {
+				if p.In(a) {
+					inside = true
+					break
+				}
+			}
+			row[x] = inside
+		}
+	}
+}
+
+func nonZero(v, def float64) float64 {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+// invisibleText switches every text object to render mode 3 (neither fill
+// nor stroke).
+func invisibleText(content []byte) []byte {
+	var out bytes.Buffer
+	l := newLexer(content)
+	copied := 0
+	for {
+		o, err := l.next()
+		if err != nil {
+			break
+		}
+		op, _ := o.(Operator)
+		switch op {
+		case "BT":
+			out.Write(content[copied:l.pos])
+			out.WriteString("\n3 Tr")
+			copied = l.pos
+		case "BI":
+			l.skipInlineImage()
+		}
+	}
+	out.Write(content[copied:])
+	return out.Bytes()
+}
+
+func g4Dict(width, height int) Dict {
+	return Dict{
+		"Type":    Name("XObject"),
+		"Subtype": Name("Image"),
+		"Width":   int64(width),
+		"Height":  int64(height),
+		"Filter":  Name("CCITTFaxDecode"),
+		"DecodeParms": Dict{
+			"K":       int64(-1),
+			"Columns": int64(width),
+			"Rows":    int64(height),
+		},
+		"BitsPerComponent": int64(1),
+	}
+}
+
+func jpegImage(img image.Image, quality int) (*Stream, error) {
+	colorSpace := Name("DeviceRGB")
+	if isGray(img) {
+		colorSpace = "DeviceGray"
+		img = toGray(img)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, fmt.Errorf("failed to encode JPEG: %w", err)
+	}
+
+	b := img.Bounds()
+	return &Stream{Dict: Dict{
+		"Type":             Name("XObject"),
+		"Subtype":          Name("Image"),
+		"Width":            int64(b.Dx()),
+		"Height":           int64(b.Dy()),
+		"ColorSpace":       colorSpace,
+		"BitsPerComponent": int64(8),
+		"Filter":           Name("DCTDecode"),
+	}, Raw: buf.Bytes()}, nil
+}
+
+func isGray(img image.Image) bool {
+	switch img.ColorModel() {
+	case color.GrayModel, color.Gray16Model:
+		return true
+	}
+	return false
+}
+
+func toGray(img image.Image) *image.Gray {
+	if g, ok := img.(*image.Gray); ok {
+		return g
+	}
+	b := img.Bounds()
+	gray := image.NewGray(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			gray.Set(x, y, img.At(x, y))
+		}
+	}
+	return gray
+}
+
+func luminance(c color.Color) uint8 {
+	return color.GrayModel.Convert(c).(color.Gray).Y
+}
+
+// binarize splits the image into dark (true) and light pixels at the Otsu
+// threshold of its luminance.
+func binarize(img image.Image) [][]bool {
+	b := img.Bounds()
+	gray := toGray(img)
+
+	var hist [256]int
+	for _, v := range gray.Pix {
+		hist[v]++
+	}
+	threshold := otsu(hist, len(gray.Pix))
+
+	rows := make([][]bool, b.Dy())
+	for y := range rows {
+		rows[y] = make([]bool, b.Dx())
+		line := gray.Pix[y*gray.Stride : y*gray.Stride+b.Dx()]
+		for x, v := range line {
+			rows[y][x] = v <= threshold
+		}
+	}
+	return rows
+}
+
+// otsu returns the threshold that best separates the two classes of a
+// luminance histogram.
+func otsu(hist [256]int, total int) uint8 {
+	sum := 0.0
+	for i, n := range hist {
+		sum += float64(i * n)
+	}
+
+	var best uint8
+	var bestVar, sumB float64
+	weightB := 0
+	for t, n := range hist {
+		weightB += n
+		if weightB == 0 {
+			continue
+		}
+		weightF := total - weightB
+		if weightF == 0 {
+			break
+		}
+		sumB += float64(t * n)
+		meanB := sumB / float64(weightB)
+		meanF := (sum - sumB) / float64(weightF)
+		between := float64(weightB) * float64(weightF) * (meanB - meanF) * (meanB - meanF)
+		if between > bestVar {
+			bestVar = between
+			best = uint8(t)
+		}
+	}
+	return best
+}
+
+// isPlainText reports whether a scan is dark text on a light, colourless
+// background, which black and white storage reproduces faithfully.
+func isPlainText(img image.Image) bool {
+	b := img.Bounds()
+	colored, mid := 0, 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			hi, lo := max(r, g, bl)>>8, min(r, g, bl)>>8
+			if hi-lo > 40 {
+				colored++
+			}
+			if l := luminance(img.At(x, y)); l > 64 && l < 192 {
+				mid++
+			}
+		}
+	}
+	total := float64(b.Dx() * b.Dy())
+	return float64(colored) <= maxColorFraction*total && float64(mid) <= maxMidToneFraction*total
+}
+
+// foregroundColor is the average colour of the masked pixels.
+func foregroundColor(img image.Image, mask [][]bool) color.RGBA {
+	b := img.Bounds()
+	var r, g, bl, n uint64
+	for y, row := range mask {
+		for x, dark := range row {
+			if dark {
+				cr, cg, cb, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+				r, g, bl, n = r+uint64(cr>>8), g+uint64(cg>>8), bl+uint64(cb>>8), n+1
+			}
+		}
+	}
+	if n == 0 {
+		return color.RGBA{A: 255}
+	}
+	return color.RGBA{uint8(r / n), uint8(g / n), uint8(bl / n), 255}
+}
+
+// downsample scales the image by factor (at most 1) by averaging the source
+// pixels under each target pixel. Pixels set in mask are left out of the
+// average, so text does not bleed into an MRC background; target pixels
+// covered by the mask alone take the average background colour.
+func downsample(img image.Image, mask [][]bool, factor float64) image.Image {
+	b := img.Bounds()
+	if factor >= 1 && mask == nil {
+		return img
+	}
+	factor = min(factor, 1)
+	w := max(1, int(float64(b.Dx())*factor))
+	h := max(1, int(float64(b.Dy())*factor))
+
+	gray := isGray(img)
+	var out image.Image
+	var set func(x, y int, c color.RGBA)
+	if gray {
+		g := image.NewGray(image.Rect(0, 0, w, h))
+		out = g
+		set = func(x, y int, c color.RGBA) { g.SetGray(x, y, color.Gray{Y: c.R}) }
+	} else {
+		rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+		out = rgba
+		set = func(x, y int, c color.RGBA) { rgba.SetRGBA(x, y, c) }
+	}
+
+	var fill color.RGBA
+	if mask != nil {
+		// Average of everything the mask leaves, for cells with no background
+		var r, g, bl, n uint64
+		for y := 0; y < b.Dy(); y++ {
+			for x := 0; x < b.Dx(); x++ {
+				if !mask[y][x] {
+					cr, cg, cb, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+					r, g, bl, n = r+uint64(cr>>8), g+uint64(cg>>8), bl+uint64(cb>>8), n+1
+				}
+			}
+		}
+		fill = color.RGBA{255, 255, 255, 255}
+		if n > 0 {
+			fill = color.RGBA{uint8(r / n), uint8(g / n), uint8(bl / n), 255}
+		}
+	}
+
+	for ty := 0; ty < h; ty++ {
+		y0, y1 := ty*b.Dy()/h, max((ty+1)*b.Dy()/h, ty*b.Dy()/h+1)
+		for tx := 0; tx < w; tx++ {
+			x0, x1 := tx*b.Dx()/w, max((tx+1)*b.Dx()/w, tx*b.Dx()/w+1)
+			var r, g, bl, n uint64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					if mask != nil && mask[y][x] {
+						continue
+					}
+					cr, cg, cb, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+					r, g, bl, n = r+uint64(cr>>8), g+uint64(cg>>8), bl+uint64(cb>>8), n+1
+				}
+			}
+			if n == 0 {
+				set(tx, ty, fill)
+				continue
+			}
+			c := color.RGBA{uint8(r / n), uint8(g / n), uint8(bl / n), 255}
+			if gray {
+				c.R = luminance(c)
+			}
+			set(tx, ty, c)
+		}
+	}
+
+	return out
+}
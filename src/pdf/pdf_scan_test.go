@@ -0,0 +1,117 @@
+package pdf
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io"
+	"testing"
+
+	"golang.org/x/image/ccitt"
+)
+
+// testScan draws dark "text" bars on paper, with a coloured photo when
+// photo is set.
+func testScan(photo bool) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 600, 800))
+	for y := 0; y < 800; y++ {
+		for x := 0; x < 600; x++ {
+			c := color.RGBA{250, 250, 245, 255}
+			if y%40 < 12 && x > 50 && x < 550 && (x/30)%4 != 3 {
+				c = color.RGBA{20, 20, 30, 255}
+			}
+			if photo && x > 100 && x < 400 && y > 400 && y < 700 {
+				c = color.RGBA{uint8(x % 256), uint8(y % 256), 120, 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// Unit test for the CCITT Group 4 encoder, decoding its output again
+func TestEncodeG4(t *testing.T) {
+	const width, height = 203, 61
+	rows := make([][]bool, height)
+	for y := range rows {
+		rows[y] = make([]bool, width)
+		for x := range rows[y] {
+			// Runs of many lengths, including ones longer than 64 pixels
+			rows[y][x] = (x*7+y*y)%23 < 9 || (y > 30 && x > 20 && x < 180)
+		}
+	}
+
+	encoded := encodeG4(rows, width)
+	decoded, err := io.ReadAll(ccitt.NewReader(bytes.NewReader(encoded), ccitt.MSB, ccitt.Group4, width, height, nil))
+	if err != nil {
+		t.Fatalf("Error decoding G4 data: %v", err)
+	}
+
+	stride := (width + 7) / 8
+	for y := range rows {
+		for x := range rows[y] {
+			// Decoded data has 1 for white
+			white := decoded[y*stride+x/8]&(0x80>>(x%8)) != 0
+			if white == rows[y][x] {
+				t.Fatalf("Pixel %d,%d differs after decoding", x, y)
+			}
+		}
+	}
+}
+
+// Unit test for embedding scans with each compression profile
+func TestAddScans(t *testing.T) {
+	data := generateTextPDF(t, map[float64]string{100: "Scanned page text"})
+
+	for _, test := range []struct {
+		profile  CompressionProfile
+		photo    bool
+		expected CompressionProfile
+		images   int
+	}{
+		{ProfileJPEG, false, ProfileJPEG, 1},
+		{ProfileBitonal, false, ProfileBitonal, 1},
+		{ProfileMRC, true, ProfileMRC, 2},
+		{ProfileAuto, false, ProfileBitonal, 1},
+		{ProfileAuto, true, ProfileMRC, 2},
+	} {
+		scan := PageScan{Image: testScan(test.photo), Text: []image.Rectangle{image.Rect(40, 0, 560, 400)}}
+		out, stats, err := AddScans(data, []PageScan{scan}, ScanOptions{Profile: test.profile, MaxDPI: 150})
+		if err != nil {
+			t.Fatalf("Error adding %s scan: %v", test.profile, err)
+		}
+		if len(stats) != 1 || stats[0].Profile != test.expected || stats[0].Ratio() <= 1 {
+			t.Errorf("Profile %s: unexpected stats %+v", test.profile, stats)
+		}
+
+		r, err := NewReader(out)
+		if err != nil {
+			t.Fatalf("Error reading pdf: %v", err)
+		}
+		content, _ := r.Page(0).Analyze()
+		if len(content.Images) != test.images || content.ImageCoverage() < 0.99 {
+			t.Errorf("Profile %s: expected %d page covering images, got %v", test.profile, test.images, content.Images)
+		}
+		if len(content.Words) != 3 || !content.Words[0].Invisible {
+			t.Errorf("Profile %s: expected an invisible text layer, got %+v", test.profile, content.Words)
+		}
+	}
+
+	// Scanned output can still be tagged and archived; the scan becomes an artifact
+	out, _, _ := AddScans(data, []PageScan{{Image: testScan(true)}}, ScanOptions{Profile: ProfileMRC})
+	tagged, err := TagPDF(out, "en", "Scan", []*StructElem{{Type: "P", Runs: []int{0}}})
+	if err != nil {
+		t.Fatalf("Error tagging scanned pdf: %v", err)
+	}
+	archived, err := ConvertToPDFA(tagged, PDFA2B, ArchiveInfo{Title: "Scan"})
+	if err != nil {
+		t.Fatalf("Error archiving scanned pdf: %v", err)
+	}
+	if problems := append(CheckTagged(archived), CheckPDFA(archived)...); len(problems) != 0 {
+		t.Errorf("Scanned pdf checks failed: %v", problems)
+	}
+
+	if _, _, err := AddScans(data, nil, ScanOptions{Profile: ProfileJPEG}); err == nil {
+		t.Errorf("Expected an error when scans and pages differ")
+	}
+}
@@ -0,0 +1,489 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"sort"
+)
+
+// StructElem is a node of the logical structure tree of a tagged PDF.
+//
+// Leaf elements own text objects (BT ... ET blocks) of one page, identified
+// by their position in that page's content stream: Runs {0, 1} are the
+// first two text objects drawn on Page.
+type StructElem struct {
+	// Standard structure type: P, H1, H2, L, LI, Lbl, LBody, Table, TR, TD, Figure, ...
+	Type Name
+	Page int
+	Runs []int
+	Kids []*StructElem
+	// Alternate description, required for figures
+	Alt string
+	// Replacement text read instead of the content. OCR text layers place
+	// every word on its own, so without it readers run the words together.
+	ActualText string
+	// Optional area covered by the element, in displayed page points
+	Box *Rect
+	// Target of a Link element. A link annotation covering Box is added to
+	// the page and attached to the element.
+	URI string
+	// Areas of a link that wraps over lines, each covered by an annotation
+	// of its own instead of Box
+	Areas []Rect
+}
+
+// TagPDF adds a structure tree to an untagged document. Text objects owned
+// by an element are wrapped in marked content with an MCID, everything else
+// that is drawn (other text, images) is marked as an artifact. lang is the
+// BCP 47 document language and title is shown by viewers instead of the
+// file name.
+func TagPDF(data []byte, lang, title string, elems []*StructElem) ([]byte, error) {
+	r, err := NewReader(data)
+	if err != nil {
+		return nil, err
+	}
+	e := NewEditor(r)
+
+	catalog := e.Catalog()
+	if catalog == nil {
+		return nil, fmt.Errorf("document catalog not found")
+	}
+	if _, ok := catalog["StructTreeRoot"]; ok {
+		return nil, fmt.Errorf("document is already tagged")
+	}
+
+	// Which element owns each text object, per page
+	owners := map[int]map[int]*StructElem{}
+	var own func(el *StructElem) error
+	own = func(el *StructElem) error {
+		if len(el.Runs) > 0 && (el.Page < 0 || el.Page >= e.NumPages()) {
+			return fmt.Errorf("%s element refers to missing page %d", el.Type, el.Page)
+		}
+		for _, run := range el.Runs {
+			if owners[el.Page] == nil {
+				owners[el.Page] = map[int]*StructElem{}
+			}
+			if owners[el.Page][run] != nil {
+				return fmt.Errorf("text object %d on page %d has two owners", run, el.Page)
+			}
+			owners[el.Page][run] = el
+		}
+		for _, kid := range el.Kids {
+			if err := own(kid); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, el := range elems {
+		if err := own(el); err != nil {
+			return nil, err
+		}
+	}
+
+	// Rewrite the page contents, numbering marked content per page
+	mcids := map[*StructElem][]Object{}
+	parents := make([][]*StructElem, e.NumPages())
+	for i := 0; i < e.NumPages(); i++ {
+		content, err := r.Page(i).Content()
+		if err != nil {
+			return nil, err
+		}
+		marked, order := markContent(content, owners[i])
+		for mcid, el := range order {
+			mcids[el] = append(mcids[el], int64(mcid))
+		}
+		parents[i] = order
+
+		compressed, err := compress(marked)
+		if err != nil {
+			return nil, err
+		}
+		_, page := e.Page(i)
+		page["Contents"] = e.Add(&Stream{Dict: Dict{"Filter": Name("FlateDecode")}, Raw: compressed})
+		page["StructParents"] = int64(i)
+		// Tab order follows the structure
+		page["Tabs"] = Name("S")
+	}
+
+	// Position of an element's first marked content, for reading order
+	first := map[*StructElem]int{}
+	var firstOf func(el *StructElem) int
+	firstOf = func(el *StructElem) int {
+		pos := -1
+		if m := mcids[el]; len(m) > 0 {
+			pos = el.Page<<20 | int(m[0].(int64))
+		}
+		for _, kid := range el.Kids {
+			if k := firstOf(kid); k >= 0 && (pos < 0 || k < pos) {
+				pos = k
+			}
+		}
+		first[el] = pos
+		return pos
+	}
+	for _, el := range elems {
+		firstOf(el)
+	}
+
+	rootRef := e.Add(nil)
+	refs := map[*StructElem]Ref{}
+	// Annotations follow the pages in the parent tree
+	nextKey := e.NumPages()
+	var annotParents Array
+	var build func(el *StructElem, parent Ref) (Ref, error)
+	build = func(el *StructElem, parent Ref) (Ref, error) {
+		ref := e.Add(nil)
+		refs[el] = ref
+
+		// Children and marked content interleave in content order; children
+		// without content keep their place after the preceding entry
+		type entry struct {
+			pos int
+			obj Object
+		}
+		var entries []entry
+		last := -1
+		for _, kid := range el.Kids {
+			kidRef, err := build(kid, ref)
+			if err != nil {
+				return ref, err
+			}
+			if first[kid] >= 0 {
+				last = first[kid]
+			}
+			entries = append(entries, entry{last, kidRef})
+		}
+		for _, mcid := range mcids[el] {
+			entries = append(entries, entry{el.Page<<20 | int(mcid.(int64)), mcid})
+		}
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].pos < entries[j].pos })
+		kids := Array{}
+		for _, en := range entries {
+			kids = append(kids, en.obj)
+		}
+
+		d := Dict{"Type": Name("StructElem"), "S": el.Type, "P": parent, "K": kids}
+		if len(el.Runs) > 0 || el.Box != nil {
+			pageRef, _ := e.Page(el.Page)
+			d["Pg"] = pageRef
+		}
+		if el.URI != "" {
+			if el.Box == nil {
+				return ref, fmt.Errorf("link to %s has no area", el.URI)
+			}
+			pageRef, page := e.Page(el.Page)
+			box := r.Page(el.Page).MediaBox()
+			contents := el.ActualText
+			if contents == "" {
+				contents = el.URI
+			}
+			areas := el.Areas
+			if len(areas) == 0 {
+				areas = []Rect{*el.Box}
+			}
+			for _, area := range areas {
+				annot := e.Add(Dict{
+					"Type":    Name("Annot"),
+					"Subtype": Name("Link"),
+					"Rect": Array{
+						box[0] + area.X0, box[3] - area.Y1, box[0] + area.X1, box[3] - area.Y0,
+					},
+					"Border":       Array{int64(0), int64(0), int64(0)},
+					"F":            int64(4),
+					"Contents":     TextString(contents),
+					"A":            Dict{"S": Name("URI"), "URI": String(el.URI)},
+					"StructParent": int64(nextKey),
+				})
+				annots, _ := e.Resolve(page["Annots"]).(Array)
+				page["Annots"] = append(annots, annot)
+				annotParents = append(annotParents, int64(nextKey), ref)
+				nextKey++
+				kids = append(kids, Dict{"Type": Name("OBJR"), "Obj": annot, "Pg": pageRef})
+			}
+			d["K"] = kids
+		}
+		if el.Alt != "" {
+			d["Alt"] = TextString(el.Alt)
+		}
+		if el.ActualText != "" {
+			d["ActualText"] = TextString(el.ActualText)
+		}
+		if el.Box != nil {
+			// Layout attributes use default user space, origin bottom-left
+			box := r.Page(el.Page).MediaBox()
+			d["A"] = Dict{"O": Name("Layout"), "BBox": Array{
+				box[0] + el.Box.X0, box[3] - el.Box.Y1, box[0] + el.Box.X1, box[3] - el.Box.Y0,
+			}}
+		}
+		e.Set(ref, d)
+		return ref, nil
+	}
+
+	docRef := e.Add(nil)
+	docKids := Array{}
+	for _, el := range elems {
+		ref, err := build(el, docRef)
+		if err != nil {
+			return nil, err
+		}
+		docKids = append(docKids, ref)
+	}
+	e.Set(docRef, Dict{"Type": Name("StructElem"), "S": Name("Document"), "P": rootRef, "K": docKids})
+
+	// The parent tree maps each page's MCIDs back to their elements
+	nums := Array{}
+	for i, order := range parents {
+		arr := Array{}
+		for _, el := range order {
+			arr = append(arr, refs[el])
+		}
+		nums = append(nums, int64(i), e.Add(arr))
+	}
+	nums = append(nums, annotParents...)
+	e.Set(rootRef, Dict{
+		"Type":              Name("StructTreeRoot"),
+		"K":                 docRef,
+		"ParentTree":        e.Add(Dict{"Nums": nums}),
+		"ParentTreeNextKey": int64(nextKey),
+	})
+
+	catalog["StructTreeRoot"] = rootRef
+	catalog["MarkInfo"] = Dict{"Marked": true}
+	catalog["ViewerPreferences"] = Dict{"DisplayDocTitle": true}
+	if lang != "" {
+		catalog["Lang"] = TextString(lang)
+	}
+
+	if title != "" {
+		info, ok := e.Resolve(e.Trailer()["Info"]).(Dict)
+		if !ok {
+			info = Dict{}
+			e.Trailer()["Info"] = e.Add(info)
+		}
+		info["Title"] = TextString(title)
+	}
+
+	return e.Bytes()
+}
+
+// markContent wraps text objects and images in marked content sequences.
+// It returns the new content and the owner of each MCID in order.
+func markContent(content []byte, owners map[int]*StructElem) ([]byte, []*StructElem) {
+	var out bytes.Buffer
+	var order []*StructElem
+
+	l := newLexer(content)
+	copied := 0
+	wrap := func(start, end int, el *StructElem) {
+		out.Write(content[copied:start])
+		if el != nil {
+			writeName(&out, el.Type)
+			fmt.Fprintf(&out, " <</MCID %d>> BDC\n", len(order))
+			order = append(order, el)
+		} else {
+			out.WriteString("/Artifact BMC\n")
+		}
+		out.Write(content[start:end])
+		out.WriteString("\nEMC")
+		copied = end
+	}
+
+	run := 0
+	textStart := -1
+	// Start of the operands of the next operator
+	opStart := 0
+	for {
+		l.skipSpace()
+		pos := l.pos
+		o, err := l.next()
+		if err != nil {
+			break
+		}
+		op, ok := o.(Operator)
+		if !ok {
+			continue
+		}
+
+		switch op {
+		case "BT":
+			textStart = pos
+		case "ET":
+			if textStart >= 0 {
+				wrap(textStart, l.pos, owners[run])
+				run++
+			}
+			textStart = -1
+		case "Do":
+			if textStart < 0 {
+				wrap(opStart, l.pos, nil)
+			}
+		case "BI":
+			l.skipInlineImage()
+			if textStart < 0 {
+				wrap(pos, l.pos, nil)
+			}
+		}
+		l.skipSpace()
+		opStart = l.pos
+	}
+	out.Write(content[copied:])
+
+	return out.Bytes(), order
+}
+
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// CheckTagged lists the ways a document falls short of being a tagged PDF
+// that assistive technology can read. An empty result means it passed.
+func CheckTagged(data []byte) []string {
+	r, err := NewReader(data)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	var problems []string
+	catalog, _ := r.Resolve(r.Trailer()["Root"]).(Dict)
+	if catalog == nil {
+		return []string{"document catalog not found"}
+	}
+	if mark, _ := r.Resolve(catalog["MarkInfo"]).(Dict); mark == nil || mark["Marked"] != true {
+		problems = append(problems, "MarkInfo /Marked is not true")
+	}
+	if lang, _ := r.Resolve(catalog["Lang"]).(String); len(lang) == 0 {
+		problems = append(problems, "document language is missing")
+	}
+	prefs, _ := r.Resolve(catalog["ViewerPreferences"]).(Dict)
+	info, _ := r.Resolve(r.Trailer()["Info"]).(Dict)
+	if title, _ := r.Resolve(info["Title"]).(String); len(title) == 0 || prefs == nil || prefs["DisplayDocTitle"] != true {
+		problems = append(problems, "document title is missing or not displayed")
+	}
+
+	root, _ := r.Resolve(catalog["StructTreeRoot"]).(Dict)
+	if root == nil {
+		return append(problems, "structure tree is missing")
+	}
+
+	// Collect the MCIDs the parent tree knows about, per page
+	known := map[int]int{}
+	if tree, _ := r.Resolve(root["ParentTree"]).(Dict); tree != nil {
+		nums, _ := r.Resolve(tree["Nums"]).(Array)
+		for i := 0; i+1 < len(nums); i += 2 {
+			key, _ := Number(nums[i])
+			arr, _ := r.Resolve(nums[i+1]).(Array)
+			known[int(key)] = len(arr)
+		}
+	}
+
+	// Every figure needs a text alternative
+	seen := map[Ref]bool{}
+	var walk func(o Object)
+	walk = func(o Object) {
+		if ref, ok := o.(Ref); ok {
+			if seen[ref] {
+				return
+			}
+			seen[ref] = true
+		}
+		switch v := r.Resolve(o).(type) {
+		case Dict:
+			if v.Name("S") == "Figure" {
+				if alt, _ := r.Resolve(v["Alt"]).(String); len(alt) == 0 {
+					problems = append(problems, "figure without alternate text")
+				}
+			}
+			walk(v["K"])
+		case Array:
+			for _, kid := range v {
+				walk(kid)
+			}
+		}
+	}
+	walk(root["K"])
+
+	for i := 0; i < r.NumPages(); i++ {
+		page := r.Page(i)
+		content, err := page.Content()
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("page %d: %v", i+1, err))
+			continue
+		}
+		parent, hasParent := Number(page.Dict["StructParents"])
+		mcids, untagged := scanMarkedContent(content)
+		if untagged > 0 {
+			problems = append(problems, fmt.Sprintf("page %d: %d text objects are neither tagged nor artifacts", i+1, untagged))
+		}
+		if mcids > 0 && (!hasParent || known[int(parent)] < mcids) {
+			problems = append(problems, fmt.Sprintf("page %d: marked content is missing from the parent tree", i+1))
+		}
+
+		annots, _ := r.Resolve(page.Dict["Annots"]).(Array)
+		for _, a := range annots {
+			annot, _ := r.Resolve(a).(Dict)
+			if annot.Name("Subtype") != "Link" {
+				continue
+			}
+			key, ok := Number(annot["StructParent"])
+			if _, known := known[int(key)]; !ok || !known {
+				problems = append(problems, fmt.Sprintf("page %d: link annotation is not in the structure tree", i+1))
+			}
+			if contents, _ := r.Resolve(annot["Contents"]).(String); len(contents) == 0 {
+				problems = append(problems, fmt.Sprintf("page %d: link annotation has no description", i+1))
+			}
+		}
+	}
+
+	return problems
+}
+
+// scanMarkedContent counts the MCIDs on a page and the text objects drawn
+// outside of any marked content.
+func scanMarkedContent(content []byte) (mcids, untagged int) {
+	depth := 0
+	var operands []Object
+	l := newLexer(content)
+	for {
+		o, err := l.next()
+		if err != nil {
+			return
+		}
+		op, ok := o.(Operator)
+		if !ok {
+			operands = append(operands, o)
+			continue
+		}
+		switch op {
+		case "BDC":
+			if len(operands) > 0 {
+				if props, ok := operands[len(operands)-1].(Dict); ok {
+					if _, ok := props["MCID"]; ok {
+						mcids++
+					}
+				}
+			}
+			depth++
+		case "BMC":
+			depth++
+		case "EMC":
+			depth--
+		case "BT":
+			if depth <= 0 {
+				untagged++
+			}
+		case "BI":
+			l.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+}
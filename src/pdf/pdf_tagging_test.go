@@ -0,0 +1,85 @@
+package pdf
+
+import (
+	"testing"
+	"time"
+)
+
+// Unit test for adding a structure tree to gopdf output
+func TestTagPDF(t *testing.T) {
+	data := generateTextPDF(t, map[float64]string{
+		100: "Quarterly Report",
+		300: "Revenue grew in every region.",
+		500: "www.example.com",
+	})
+
+	if problems := CheckTagged(data); len(problems) == 0 {
+		t.Fatalf("Expected plain gopdf output to fail the tagging check")
+	}
+
+	elems := []*StructElem{
+		{Type: "H1", Page: 0, Runs: []int{0}},
+		{Type: "P", Page: 0, Kids: []*StructElem{
+			{Type: "Span", Page: 0, Runs: []int{1}, ActualText: "Revenue grew in every region. "},
+			{Type: "Link", Page: 0, Runs: []int{2}, ActualText: "www.example.com", URI: "https://www.example.com", Box: &Rect{72, 500, 200, 514}},
+		}},
+		{Type: "Figure", Page: 0, Alt: "Figure 1", Box: &Rect{72, 400, 272, 500}},
+	}
+	tagged, err := TagPDF(data, "en", "Quarterly Report", elems)
+	if err != nil {
+		t.Fatalf("Error tagging pdf: %v", err)
+	}
+	if problems := CheckTagged(tagged); len(problems) != 0 {
+		t.Errorf("Tagged pdf check failed: %v", problems)
+	}
+
+	r, err := NewReader(tagged)
+	if err != nil {
+		t.Fatalf("Error reading tagged pdf: %v", err)
+	}
+	catalog, _ := r.Resolve(r.Trailer()["Root"]).(Dict)
+	if lang, _ := catalog["Lang"].(String); string(lang) != "en" {
+		t.Errorf("Expected document language en, got %q", lang)
+	}
+	content, _ := r.Page(0).Analyze()
+	annots, _ := r.Resolve(r.Page(0).Dict["Annots"]).(Array)
+	if len(annots) != 1 {
+		t.Errorf("Expected 1 link annotation, got %d", len(annots))
+	}
+	if len(content.Words) != 8 {
+		t.Errorf("Text layer changed after tagging: %+v", content.Words)
+	}
+
+	// Both tagging and the archival conversion must survive each other
+	archived, err := ConvertToPDFA(tagged, PDFA2B, ArchiveInfo{Title: "Quarterly Report", Date: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatalf("Error converting tagged pdf: %v", err)
+	}
+	if problems := append(CheckPDFA(archived), CheckTagged(archived)...); len(problems) != 0 {
+		t.Errorf("Tagged PDF/A check failed: %v", problems)
+	}
+
+	// A link wrapping over two lines gets an annotation on each
+	wrapped, err := TagPDF(data, "en", "Quarterly Report", []*StructElem{
+		{Type: "Link", Page: 0, Runs: []int{1, 2}, URI: "https://www.example.com", Box: &Rect{72, 300, 400, 514},
+			Areas: []Rect{{300, 300, 400, 314}, {72, 500, 200, 514}}},
+	})
+	if err != nil {
+		t.Fatalf("Error tagging pdf: %v", err)
+	}
+	if problems := CheckTagged(wrapped); len(problems) != 0 {
+		t.Errorf("Tagged pdf check failed: %v", problems)
+	}
+	r, err = NewReader(wrapped)
+	if err != nil {
+		t.Fatalf("Error reading tagged pdf: %v", err)
+	}
+	annots, _ = r.Resolve(r.Page(0).Dict["Annots"]).(Array)
+	if len(annots) != 2 {
+		t.Errorf("Expected 2 link annotations, got %d", len(annots))
+	}
+
+	if _, err := TagPDF(data, "en", "", []*StructElem{{Type: "P", Runs: []int{0}}, {Type: "P", Runs: []int{0}}}); err == nil {
+		t.Errorf("Expected an error for a text object with two owners")
+	}
+}
@@ -0,0 +1,267 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Editor holds a modifiable copy of a document's objects and writes them
+// back out as a fresh, single-revision PDF.
+type Editor struct {
+	r       *Reader
+	objects map[int]Object
+	trailer Dict
+	next    int
+}
+
+func NewEditor(r *Reader) *Editor {
+	e := &Editor{r: r, objects: map[int]Object{}, trailer: Dict{}}
+	for num, obj := range r.objects {
+		// Object and xref streams are containers; their objects were lifted out
+		if s, ok := obj.(*Stream); ok && (s.Dict.Name("Type") == "ObjStm" || s.Dict.Name("Type") == "XRef") {
+			continue
+		}
+		e.objects[num] = obj
+		e.next = max(e.next, num+1)
+	}
+	for _, key := range []Name{"Root", "Info", "ID"} {
+		if v, ok := r.trailer[key]; ok {
+			e.trailer[key] = v
+		}
+	}
+	return e
+}
+
+// Resolve follows references through the edited objects.
+func (e *Editor) Resolve(o Object) Object {
+	for i := 0; i < 32; i++ {
+		ref, ok := o.(Ref)
+		if !ok {
+			return o
+		}
+		o = e.objects[ref.Num]
+	}
+	return nil
+}
+
+// Add stores a new indirect object and returns its reference.
+func (e *Editor) Add(o Object) Ref {
+	ref := Ref{e.next, 0}
+	e.objects[ref.Num] = o
+	e.next++
+	return ref
+}
+
+// Set replaces the object behind ref.
+func (e *Editor) Set(ref Ref, o Object) {
+	e.objects[ref.Num] = o
+}
+
+// Catalog returns the document catalog; changes to it are written out.
+func (e *Editor) Catalog() Dict {
+	d, _ := e.Resolve(e.trailer["Root"]).(Dict)
+	return d
+}
+
+// Page returns the reference and the editable dictionary of a page.
+func (e *Editor) Page(index int) (Ref, Dict) {
+	ref := e.r.refs[index]
+	d, _ := e.Resolve(ref).(Dict)
+	return ref, d
+}
+
+func (e *Editor) NumPages() int {
+	return len(e.r.refs)
+}
+
+// Objects calls fn for every object, in object number order.
+func (e *Editor) Objects(fn func(ref Ref, o Object)) {
+	nums := make([]int, 0, len(e.objects))
+	for n := range e.objects {
+		nums = append(nums, n)
+	}
+	sort.Ints(nums)
+	for _, n := range nums {
+		fn(Ref{n, 0}, e.objects[n])
+	}
+}
+
+// Trailer returns the trailer entries that are written out (Root, Info, ID).
+func (e *Editor) Trailer() Dict {
+	return e.trailer
+}
+
+// Bytes serializes the document. Objects are renumbered densely so the
+// cross-reference table has a single subsection and no free-list holes.
+// When the trailer has no ID, one is derived from the body so that the
+// same content always produces the same file.
+func (e *Editor) Bytes() ([]byte, error) {
+	// Only keep objects reachable from the trailer
+	renumber := map[int]int{}
+	var order []int
+	var visit func(o Object)
+	visit = func(o Object) {
+		switch v := o.(type) {
+		case Ref:
+			if _, done := renumber[v.Num]; done {
+				return
+			}
+			target, ok := e.objects[v.Num]
+			if !ok {
+				return
+			}
+			renumber[v.Num] = len(order) + 1
+			order = append(order, v.Num)
+			visit(target)
+		case Array:
+			for _, item := range v {
+				visit(item)
+			}
+		case Dict:
+			// Sorted keys give the same numbering, and so the same file ID, on every run
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, string(k))
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				visit(v[Name(k)])
+			}
+		case *Stream:
+			visit(v.Dict)
+		}
+	}
+	visit(e.trailer["Root"])
+	visit(e.trailer["Info"])
+
+	var body bytes.Buffer
+	body.WriteString("%PDF-1.7\n%\xE2\xE3\xCF\xD3\n")
+
+	offsets := make([]int, len(order))
+	for i, num := range order {
+		offsets[i] = body.Len()
+		fmt.Fprintf(&body, "%d 0 obj\n", i+1)
+		writeObject(&body, e.objects[num], renumber)
+		body.WriteString("\nendobj\n")
+	}
+
+	trailer := Dict{"Size": int64(len(order) + 1)}
+	for _, key := range []Name{"Root", "Info"} {
+		if v, ok := e.trailer[key]; ok {
+			trailer[key] = v
+		}
+	}
+	if id, ok := e.trailer["ID"].(Array); ok && len(id) == 2 {
+		trailer["ID"] = id
+	} else {
+		sum := md5.Sum(body.Bytes())
+		trailer["ID"] = Array{hexString(sum[:]), hexString(sum[:])}
+	}
+
+	xref := body.Len()
+	fmt.Fprintf(&body, "xref\n0 %d\n0000000000 65535 f \n", len(order)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&body, "%010d 00000 n \n", off)
+	}
+	body.WriteString("trailer\n")
+	writeObject(&body, trailer, renumber)
+	fmt.Fprintf(&body, "\nstartxref\n%d\n%%%%EOF\n", xref)
+
+	return body.Bytes(), nil
+}
+
+// hexString marks bytes that should be written in <hex> form.
+type hexString []byte
+
+func writeObject(buf *bytes.Buffer, o Object, renumber map[int]int) {
+	switch v := o.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case int:
+		buf.WriteString(strconv.Itoa(v))
+	case int64:
+		buf.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		buf.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+	case Name:
+		writeName(buf, v)
+	case String:
+		writeString(buf, v)
+	case hexString:
+		fmt.Fprintf(buf, "<%X>", []byte(v))
+	case Operator:
+		buf.WriteString(string(v))
+	case Array:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			writeObject(buf, item, renumber)
+		}
+		buf.WriteByte(']')
+	case Dict:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, string(k))
+		}
+		sort.Strings(keys)
+		buf.WriteString("<<")
+		for _, k := range keys {
+			writeName(buf, Name(k))
+			buf.WriteByte(' ')
+			writeObject(buf, v[Name(k)], renumber)
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(">>")
+	case *Stream:
+		d := v.Dict.Clone()
+		d["Length"] = int64(len(v.Raw))
+		writeObject(buf, d, renumber)
+		buf.WriteString("\nstream\n")
+		buf.Write(v.Raw)
+		buf.WriteString("\nendstream")
+	case Ref:
+		num, ok := renumber[v.Num]
+		if !ok {
+			buf.WriteString("null")
+			return
+		}
+		fmt.Fprintf(buf, "%d 0 R", num)
+	default:
+		buf.WriteString("null")
+	}
+}
+
+func writeName(buf *bytes.Buffer, n Name) {
+	buf.WriteByte('/')
+	for _, c := range []byte(n) {
+		if c < 0x21 || c > 0x7E || c == '#' || isDelimiter(c) {
+			fmt.Fprintf(buf, "#%02X", c)
+		} else {
+			buf.WriteByte(c)
+		}
+	}
+}
+
+func writeString(buf *bytes.Buffer, s String) {
+	for _, c := range s {
+		if c < 0x20 || c > 0x7E {
+			fmt.Fprintf(buf, "<%X>", []byte(s))
+			return
+		}
+	}
+	buf.WriteByte('(')
+	for _, c := range s {
+		if c == '(' || c == ')' || c == '\\' {
+			buf.WriteByte('\\')
+		}
+		buf.WriteByte(c)
+	}
+	buf.WriteByte(')')
+}
@@ -3,6 +3,7 @@ package videos
 import (
 	"fmt"
 	"go-ocr/src"
+	img "go-ocr/src/images"
 	"image"
 	"image/color"
 	"log"
@@ -17,9 +18,18 @@ type VideoObjectDetection struct {
 	net               *gocv.Net
 	classes           []string
 	layersNamesOutput []string
+	options           img.DetectorOptions
 }
 
-func NewVideoObjectDetector(weightsFile string, configFile string, classFile string) *VideoObjectDetection {
+// DefaultDetectorOptions are the image detector's, except for the 127.5
+// the video detector has always subtracted from the red channel.
+func DefaultDetectorOptions() img.DetectorOptions {
+	options := img.DefaultDetectorOptions()
+	options.Mean = [3]float64{127.5, 0, 0}
+	return options
+}
+
+func NewVideoObjectDetector(weightsFile string, configFile string, classFile string, options img.DetectorOptions) *VideoObjectDetection {
 	// Load the pre-trained YOLOv3 model, configuration, and class labels
 	net := gocv.ReadNet(weightsFile, configFile)
 	if net.Empty() {
@@ -42,7 +52,12 @@ func NewVideoObjectDetector(weightsFile string, configFile string, classFile str
 		layersNamesOutput = append(layersNamesOutput, layerNames[id-1])
 	}
 
-	return &VideoObjectDetection{&net, classes, layersNamesOutput}
+	if err := options.ValidateNetwork(&net, layersNamesOutput, len(classes)); err != nil {
+		fmt.Println("Invalid detector options:", err)
+		os.Exit(1)
+	}
+
+	return &VideoObjectDetection{&net, classes, layersNamesOutput, options}
 }
 
 // Perform object detection and return bounding boxes, confidences, and class IDs
@@ -51,8 +66,8 @@ func (vod *VideoObjectDetection) detectObjects(frame gocv.Mat) ([]image.Rectangl
 	height := frame.Rows()
 
 	// Get blob from the image
-	blob := gocv.BlobFromImage(frame, 1.0/255, image.Point{416, 416},
-		gocv.NewScalar(127.5, 0, 0, 0), true, false)
+	blob := vod.options.Blob(frame)
+	defer blob.Close()
 
 	// Set the input blob for YOLO
 	vod.net.SetInput(blob, "")
@@ -75,7 +90,7 @@ func (vod *VideoObjectDetection) detectObjects(frame gocv.Mat) ([]image.Rectangl
 				}
 			}
 
-			if confidence < 0.5 || classId == -1 {
+			if classId == -1 || !vod.options.Accepts(data, confidence) {
 				continue
 			}
 
@@ -145,7 +160,7 @@ func (vod *VideoObjectDetection) Execute(fileName, outfilePath string, showWindo
 		boxes, confidences, classIds := vod.detectObjects(frame)
 
 		// Apply Non-Maximum Suppression
-		indices := gocv.NMSBoxes(boxes, confidences, 0.5, 0.3)
+		indices := gocv.NMSBoxes(boxes, confidences, vod.options.ConfidenceThreshold, vod.options.NMSIoU)
 
 		// Draw bounding boxes and labels on the frame
 		for _, idx := range indices {
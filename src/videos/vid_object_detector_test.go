@@ -2,7 +2,10 @@ package videos
 
 import (
 	"go-ocr/src"
+	"image"
 	"testing"
+
+	"gocv.io/x/gocv"
 )
 
 // Unit test for checking text extraction from multiple images
@@ -14,7 +17,8 @@ func TestVideoObjectDetection(t *testing.T) {
 	vod := NewVideoObjectDetector(
 		"../../models/yolov3.weights",
 		"../../models/yolov3.cfg",
-		"../../models/coco.names")
+		"../../models/coco.names",
+		DefaultDetectorOptions())
 
 	// Loop over image files and verify the output
 	for _, fileName := range inputFiles {
@@ -25,3 +29,25 @@ func TestVideoObjectDetection(t *testing.T) {
 		}
 	}
 }
+
+// Unit test for the blob of the video detector, 127.5 less in the red
+// channel only
+func TestDefaultDetectorOptions(t *testing.T) {
+	// A BGR frame of blue 10, green 20 and red 200
+	frame := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(10, 20, 200, 0), 64, 64, gocv.MatTypeCV8UC3)
+	defer frame.Close()
+
+	options := DefaultDetectorOptions()
+	options.InputSize, options.ScaleFactor = image.Pt(64, 64), 1
+	blob := options.Blob(frame)
+	defer blob.Close()
+
+	// Red, green, then blue
+	for channel, expected := range []float32{72.5, 20, 10} {
+		plane := gocv.GetBlobChannel(blob, 0, channel)
+		if value := plane.GetFloatAt(32, 32); value != expected {
+			t.Errorf("Expected %.1f in channel %d of the blob, got %.1f", expected, channel, value)
+		}
+		plane.Close()
+	}
+}